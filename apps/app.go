@@ -14,6 +14,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
 )
 
 type Application interface {
@@ -23,3 +24,9 @@ type Application interface {
 	Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
 	AppOperationsInfo() (*api.OperationsInfo, error)
 }
+
+// ConnectionPoolReporter is implemented by applications whose
+// executor keeps connections to the nodes open between operations.
+type ConnectionPoolReporter interface {
+	ConnectionPoolStats() []rex.PoolStats
+}
@@ -10,11 +10,14 @@
 package glusterfs
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -22,11 +25,18 @@ import (
 	"github.com/lpabon/godbc"
 
 	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/executors/agentexec"
 	"github.com/heketi/heketi/v10/executors/injectexec"
 	"github.com/heketi/heketi/v10/executors/kubeexec"
 	"github.com/heketi/heketi/v10/executors/mockexec"
+	"github.com/heketi/heketi/v10/executors/nodeexec"
 	"github.com/heketi/heketi/v10/executors/sshexec"
+	"github.com/heketi/heketi/v10/pkg/db/backup"
+	"github.com/heketi/heketi/v10/pkg/db/store"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/heketi/v10/pkg/logging"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/ssh"
 	"github.com/heketi/heketi/v10/server/rest"
 )
 
@@ -42,6 +52,7 @@ const (
 	DB_CLUSTER_HAS_FILE_BLOCK_FLAG = "DB_CLUSTER_HAS_FILE_BLOCK_FLAG"
 	DB_BRICK_HAS_SUBTYPE_FIELD     = "DB_BRICK_HAS_SUBTYPE_FIELD"
 	DEFAULT_OP_LIMIT               = 8
+	DEFAULT_OP_QUEUE_LIMIT         = 1000
 )
 
 var (
@@ -63,6 +74,11 @@ var (
 	// operations cleanup mechanism.
 	EnableBackgroundCleaner = false
 
+	// creates the store holding the db, replaced by tests
+	newDbStore = func(c *store.Config) (store.Store, error) {
+		return c.NewStore()
+	}
+
 	// global var that contains list of volume options that are set *before*
 	// setting the volume options that come as part of volume request.
 	PreReqVolumeOptions = ""
@@ -80,10 +96,25 @@ type App struct {
 	_allocator   Allocator
 	conf         *GlusterFSConfig
 
+	// the db as used by the background tasks, reloaded with the db
+	sharedDb *reloadableDb
 	// health monitor
 	nhealth *NodeHealthCache
 	// background operations cleaner
 	bgcleaner *backgroundOperationCleaner
+	// background device resync
+	dresync *DeviceResyncMonitor
+	// periodic db backups
+	backups *backup.Manager
+	// store holding the db, and the copy of the changes to it
+	dbStore  store.Store
+	dbMirror *store.Mirror
+	// ssh host keys pinned on first use
+	hostKeys *NodeHostKeyStore
+	// persisted async operations
+	asyncQueue *AsyncQueueStore
+	// serializes create requests with idempotency keys
+	idempotencyLock sync.Mutex
 
 	// operations tracker
 	optracker *OpTracker
@@ -133,6 +164,12 @@ func (app *App) setup(conf *GlusterFSConfig) error {
 
 	// Setup asynchronous manager
 	app.asyncManager = rest.NewAsyncHttpManager(ASYNC_ROUTE)
+	app.asyncManager.SetProgress(func(opId string) interface{} {
+		if p := runningOps.progress(opId); p != nil {
+			return p
+		}
+		return nil
+	})
 
 	// Setup executor
 	switch app.conf.Executor {
@@ -143,6 +180,10 @@ func (app *App) setup(conf *GlusterFSConfig) error {
 		app.executor, err = kubeexec.NewKubeExecutor(&app.conf.KubeConfig)
 	case "ssh", "":
 		app.executor, err = sshexec.NewSshExecutor(&app.conf.SshConfig)
+	case "node":
+		app.executor, err = nodeexec.NewNodeExecutor(&app.conf.NodeConfig)
+	case "agent":
+		app.executor, err = agentexec.NewAgentExecutor(&app.conf.AgentConfig)
 	case "inject/ssh":
 		app.executor, err = sshexec.NewSshExecutor(&app.conf.SshConfig)
 		app.executor = injectexec.NewInjectExecutor(
@@ -165,11 +206,27 @@ func (app *App) setup(conf *GlusterFSConfig) error {
 		dbfilename = app.conf.DBfile
 	}
 
+	err = app.prepareDbStore()
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+
 	err = app.initDB()
 	if err != nil {
 		logger.Err(err)
 		return err
 	}
+	app.sharedDb = newReloadableDb(app.db)
+
+	err = app.initDbStoreSync()
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+
+	app.initHostKeys()
+	app.initAsyncQueue()
 
 	// Drop a note that the system had pending operations in the db
 	// at start up time. Even though we now have auto-cleanup
@@ -193,6 +250,8 @@ func (app *App) setup(conf *GlusterFSConfig) error {
 	app.initOpTracker()
 	app.initNodeMonitor()
 	app.initBackgroundCleaner()
+	app.initDeviceResync()
+	app.initDbBackup()
 
 	// Show application has loaded
 	logger.Info("GlusterFS Application Loaded")
@@ -220,8 +279,19 @@ func (app *App) initDB() error {
 			return logger.LogError("Unable to open database: %v", err)
 		}
 		app.dbReadOnly = true
+		err = app.db.View(func(tx *bolt.Tx) error {
+			if err := checkDbSchemaVersion(tx); err != nil {
+				return logger.LogError("Unable to use db: %v", err)
+			}
+			return nil
+		})
 	} else {
 		err = app.db.Update(func(tx *bolt.Tx) error {
+			// Refuse dbs of newer versions before changing anything
+			if err := checkDbSchemaVersion(tx); err != nil {
+				return logger.LogError("Unable to use db: %v", err)
+			}
+
 			err := initializeBuckets(tx)
 			if err != nil {
 				return logger.LogError("Unable to initialize buckets: %v", err)
@@ -241,12 +311,132 @@ func (app *App) initDB() error {
 				return logger.LogError("Unable to Upgrade DB: %v", err)
 			}
 
+			err = MigrateDbSchema(tx, DbSchemaVersion, false)
+			if err != nil {
+				return logger.LogError("Unable to migrate DB schema: %v", err)
+			}
+
 			return nil
 		})
 	}
+	if err != nil {
+		app.db.Close()
+	}
 	return err
 }
 
+// prepareDbStore makes the db file a copy of the db held by the
+// configured store. A store without entries is filled from the db
+// file. A db file holding changes not yet written to the store is
+// kept, the initial sync writes them. Any other db file that differs
+// from the store is set aside.
+func (app *App) prepareDbStore() error {
+	if !app.conf.DbStore.Enabled() {
+		return nil
+	}
+	if app.conf.DBReadOnly {
+		logger.Info("Db store not used for read-only db")
+		return nil
+	}
+	s, err := newDbStore(&app.conf.DbStore)
+	if err != nil {
+		return fmt.Errorf("Unable to set up db store: %v", err)
+	}
+	empty, err := store.IsEmpty(s)
+	if err != nil {
+		s.Close()
+		return fmt.Errorf("Unable to read db store: %v", err)
+	}
+	if empty {
+		logger.Info("Db store %v is empty, it will be filled from %v",
+			app.conf.DbStore.Type, dbfilename)
+	} else if err := loadDbFromStore(dbfilename, s); err != nil {
+		s.Close()
+		return err
+	}
+	app.dbStore = s
+	return nil
+}
+
+func loadDbFromStore(dbfile string, s store.Store) error {
+	if _, err := os.Stat(dbfile); err == nil {
+		db, err := OpenDB(dbfile, false)
+		if err != nil {
+			return fmt.Errorf("Unable to open database: %v", err)
+		}
+		diff, err := store.Diff(db, s)
+		var pending bool
+		if err == nil && diff != 0 {
+			pending, err = store.Unsynced(db, s)
+		}
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("Unable to compare db with the db store: %v", err)
+		}
+		if diff == 0 {
+			return nil
+		}
+		if pending {
+			logger.Warning("Db file %v holds %v entries not written to "+
+				"the db store, they will be synced", dbfile, diff)
+			return nil
+		}
+		unsynced := fmt.Sprintf("%v.unsynced-%v", dbfile, time.Now().Unix())
+		logger.Warning("Db file %v differs from the db store in %v entries, "+
+			"moving it to %v", dbfile, diff, unsynced)
+		if err := os.Rename(dbfile, unsynced); err != nil {
+			return fmt.Errorf("Unable to move db file: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to stat db file: %v", err)
+	}
+
+	db, err := OpenDB(dbfile, false)
+	if err != nil {
+		return fmt.Errorf("Unable to create database: %v", err)
+	}
+	defer db.Close()
+	if err := store.Load(db, s); err != nil {
+		return fmt.Errorf("Unable to load db from the db store: %v", err)
+	}
+	logger.Info("Loaded db from the db store")
+	return nil
+}
+
+// initDbStoreSync starts copying the changes of the db file to the
+// db store.
+func (app *App) initDbStoreSync() error {
+	if app.dbStore == nil {
+		return nil
+	}
+	if app.dbReadOnly {
+		logger.Info("Db store sync disabled for read-only db")
+		app.dbStore.Close()
+		app.dbStore = nil
+		return nil
+	}
+	app.dbMirror = store.NewMirror(app.db, app.dbStore)
+	if err := app.dbMirror.Sync(); err != nil {
+		app.db.Close()
+		app.dbStore.Close()
+		return fmt.Errorf("Unable to sync db to the db store: %v", err)
+	}
+	app.dbMirror.Start(app.conf.DbStore.SyncPeriod())
+	return nil
+}
+
+// DbPath returns the path of the db file of an app created with the
+// given configuration.
+func DbPath(conf *GlusterFSConfig) string {
+	if env := os.Getenv("HEKETI_DB_PATH"); env != "" {
+		return env
+	}
+	if conf.DBfile != "" {
+		return conf.DBfile
+	}
+	return dbfilename
+}
+
 func (app *App) initNodeMonitor() {
 	//default monitor gluster node refresh time
 	var timer uint32 = 120
@@ -258,7 +448,7 @@ func (app *App) initNodeMonitor() {
 		startDelay = app.conf.StartTimeMonitorGlusterNodes
 	}
 	if MonitorGlusterNodes {
-		app.nhealth = NewNodeHealthCache(timer, startDelay, app.db, app.executor)
+		app.nhealth = NewNodeHealthCache(timer, startDelay, app.sharedDb, app.executor)
 		app.nhealth.Monitor()
 		currentNodeHealthCache = app.nhealth
 	}
@@ -272,18 +462,123 @@ func (app *App) initBackgroundCleaner() {
 	if app.conf.RefreshTimeBackgroundCleaner == 0 {
 		app.conf.RefreshTimeBackgroundCleaner = 3600
 	}
+	if app.dbReadOnly {
+		logger.Info("Background cleaner disabled for read-only db")
+		return
+	}
 	if EnableBackgroundCleaner {
 		app.bgcleaner = app.BackgroundCleaner()
 		app.bgcleaner.Start()
 	}
 }
 
+// hostKeyStoreSetter is implemented by executors that can pin the
+// ssh host keys of the nodes.
+type hostKeyStoreSetter interface {
+	SetHostKeyStore(store ssh.HostKeyStore)
+}
+
+// executorCloser is implemented by executors holding resources,
+// such as pooled connections, that must be released on shutdown.
+type executorCloser interface {
+	Close()
+}
+
+// realExecutor returns the executor doing the work, unwrapping the
+// inject executor, so that the optional interfaces of the executor
+// are found through the wrapper.
+func (a *App) realExecutor() executors.Executor {
+	if ie, ok := a.executor.(*injectexec.InjectExecutor); ok {
+		return ie.RealExecutor()
+	}
+	return a.executor
+}
+
+// ConnectionPoolStats returns the usage of the connections the
+// executor keeps open to the nodes, if any.
+func (a *App) ConnectionPoolStats() []rex.PoolStats {
+	if p, ok := a.realExecutor().(interface {
+		PoolStats() []rex.PoolStats
+	}); ok {
+		return p.PoolStats()
+	}
+	return nil
+}
+
+func (app *App) initHostKeys() {
+	app.hostKeys = NewNodeHostKeyStore(app.sharedDb)
+	// a standby only keeps the keys it sees, the leader saves them
+	app.hostKeys.ReadOnly = app.dbReadOnly
+	if s, ok := app.realExecutor().(hostKeyStoreSetter); ok {
+		s.SetHostKeyStore(app.hostKeys)
+	}
+}
+
+func (app *App) initAsyncQueue() {
+	if app.dbReadOnly {
+		logger.Info("Async queue not persisted for read-only db")
+		return
+	}
+	app.asyncQueue = NewAsyncQueueStore(app.db, app.conf.AsyncQueueTTL)
+	if err := app.asyncQueue.Resolve(); err != nil {
+		logger.LogError("Unable to resolve interrupted async operations: %v", err)
+	}
+	if err := app.asyncQueue.Collect(); err != nil {
+		logger.LogError("Unable to remove expired async operations: %v", err)
+	}
+	app.asyncManager.SetStore(app.asyncQueue)
+	app.asyncQueue.Start()
+}
+
+func (app *App) initDeviceResync() {
+	if !app.conf.EnableDeviceResync {
+		return
+	}
+	if app.dbReadOnly {
+		logger.Info("Device resync monitor disabled for read-only db")
+		return
+	}
+	var timer uint32 = 3600
+	var startDelay uint32 = 300
+	if app.conf.RefreshTimeDeviceResync > 0 {
+		timer = app.conf.RefreshTimeDeviceResync
+	}
+	if app.conf.StartTimeDeviceResync > 0 {
+		startDelay = app.conf.StartTimeDeviceResync
+	}
+	app.dresync = NewDeviceResyncMonitor(timer, startDelay,
+		app.conf.MaxConcurrentResyncs, app.db, app.executor)
+	app.dresync.Start()
+}
+
+func (app *App) initDbBackup() {
+	if !app.conf.DbBackup.Enabled() {
+		return
+	}
+	m, err := backup.NewManager(&app.conf.DbBackup)
+	if err != nil {
+		logger.LogError("Unable to set up db backups: %v", err)
+		return
+	}
+	m.Attributes = DbAttributes
+	app.backups = m
+	if app.dbReadOnly {
+		logger.Info("Periodic db backups disabled for read-only db")
+		return
+	}
+	m.Start(app.db)
+}
+
 func (app *App) initOpTracker() {
 	oplimit := app.conf.MaxInflightOperations
 	if oplimit == 0 {
 		oplimit = DEFAULT_OP_LIMIT
 	}
 	app.optracker = newOpTracker(oplimit)
+	app.optracker.QueueLimit = app.conf.MaxQueuedOperations
+	if app.optracker.QueueLimit == 0 {
+		app.optracker.QueueLimit = DEFAULT_OP_QUEUE_LIMIT
+	}
 }
 
 func SetLogLevel(level string) error {
@@ -385,6 +680,11 @@ func (a *App) setFromEnvironmentalVariable() {
 		a.conf.ZoneChecking = env
 	}
 
+	env = os.Getenv("HEKETI_ALLOCATOR")
+	if "" != env {
+		a.conf.Allocator = env
+	}
+
 	env = os.Getenv("HEKETI_GLUSTER_MAX_VOLUMES_PER_CLUSTER")
 	if env != "" {
 		a.conf.MaxVolumesPerCluster, err = strconv.Atoi(env)
@@ -392,6 +692,36 @@ func (a *App) setFromEnvironmentalVariable() {
 			logger.LogError("Error: While parsing HEKETI_GLUSTER_MAX_VOLUMES_PER_CLUSTER: %v", err)
 		}
 	}
+
+	env = os.Getenv("HEKETI_DB_BACKUP_DIR")
+	if env != "" {
+		a.conf.DbBackup.Dir = env
+	}
+
+	env = os.Getenv("HEKETI_DB_BACKUP_S3_ACCESS_KEY")
+	if env != "" {
+		a.conf.DbBackup.S3.AccessKey = env
+	}
+
+	env = os.Getenv("HEKETI_DB_BACKUP_S3_SECRET_KEY")
+	if env != "" {
+		a.conf.DbBackup.S3.SecretKey = env
+	}
+
+	env = os.Getenv("HEKETI_DB_STORE_TYPE")
+	if env != "" {
+		a.conf.DbStore.Type = env
+	}
+
+	env = os.Getenv("HEKETI_DB_STORE_ETCD_ENDPOINTS")
+	if env != "" {
+		a.conf.DbStore.Etcd.Endpoints = strings.Split(env, ",")
+	}
+
+	env = os.Getenv("HEKETI_DB_STORE_ETCD_PASSWORD")
+	if env != "" {
+		a.conf.DbStore.Etcd.Password = env
+	}
 }
 
 func (a *App) setAdvSettings() {
@@ -431,6 +761,10 @@ func (a *App) setAdvSettings() {
 		logger.Info("Zone checking: '%v'", a.conf.ZoneChecking)
 		ZoneChecking = ZoneCheckingStrategy(a.conf.ZoneChecking)
 	}
+	if a.conf.Allocator != "" {
+		logger.Info("Brick allocator: '%v'", a.conf.Allocator)
+		BrickAllocator = BrickAllocatorStrategy(a.conf.Allocator)
+	}
 	if a.conf.MaxVolumesPerCluster < 0 {
 		logger.Info("Volumes per cluster limit is removed as it is set to %v", a.conf.MaxVolumesPerCluster)
 		maxVolumesPerCluster = math.MaxInt32
@@ -473,6 +807,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.asyncManager.HandlerStatus},
+		rest.Route{
+			Name:        "AsyncCancel",
+			Method:      "DELETE",
+			Pattern:     ASYNC_ROUTE + "/{id:[A-Fa-f0-9]+}",
+			HandlerFunc: a.asyncManager.HandlerCancel},
 
 		// Cluster
 		rest.Route{
@@ -501,6 +840,28 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Pattern:     "/clusters/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.ClusterDelete},
 
+		// Placement profiles
+		rest.Route{
+			Name:        "ProfileCreate",
+			Method:      "POST",
+			Pattern:     "/profiles",
+			HandlerFunc: a.ProfileCreate},
+		rest.Route{
+			Name:        "ProfileList",
+			Method:      "GET",
+			Pattern:     "/profiles",
+			HandlerFunc: a.ProfileList},
+		rest.Route{
+			Name:        "ProfileInfo",
+			Method:      "GET",
+			Pattern:     "/profiles/{name:[A-Za-z0-9_-]+}",
+			HandlerFunc: a.ProfileInfo},
+		rest.Route{
+			Name:        "ProfileDelete",
+			Method:      "DELETE",
+			Pattern:     "/profiles/{name:[A-Za-z0-9_-]+}",
+			HandlerFunc: a.ProfileDelete},
+
 		// Node
 		rest.Route{
 			Name:        "NodeAdd",
@@ -527,6 +888,16 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/tags",
 			HandlerFunc: a.NodeSetTags},
+		rest.Route{
+			Name:        "NodeSshHostKey",
+			Method:      "GET",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/sshhostkey",
+			HandlerFunc: a.NodeSshHostKey},
+		rest.Route{
+			Name:        "NodeSshHostKeyReset",
+			Method:      "DELETE",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/sshhostkey",
+			HandlerFunc: a.NodeSshHostKeyReset},
 
 		// Devices
 		rest.Route{
@@ -591,6 +962,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/block-restriction",
 			HandlerFunc: a.VolumeSetBlockRestriction},
+		rest.Route{
+			Name:        "VolumeSetTags",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/tags",
+			HandlerFunc: a.VolumeSetTags},
 
 		// Volume Cloning
 		rest.Route{
@@ -625,6 +1001,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/expand",
 			HandlerFunc: a.BlockVolumeExpand},
+		rest.Route{
+			Name:        "BlockVolumeSetTags",
+			Method:      "POST",
+			Pattern:     "/blockvolumes/{id:[A-Fa-f0-9]+}/tags",
+			HandlerFunc: a.BlockVolumeSetTags},
 
 		// Brick (special)
 		rest.Route{
@@ -639,6 +1020,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/backup/db",
 			HandlerFunc: a.Backup},
+		rest.Route{
+			Name:        "BackupList",
+			Method:      "GET",
+			Pattern:     "/backups",
+			HandlerFunc: a.BackupList},
 
 		// Db
 		rest.Route{
@@ -651,6 +1037,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/db/check",
 			HandlerFunc: a.DbCheck},
+		rest.Route{
+			Name:        "DbRepair",
+			Method:      "POST",
+			Pattern:     "/db/repair",
+			HandlerFunc: a.DbRepair},
 
 		// Logging
 		rest.Route{
@@ -681,6 +1072,12 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/operations/pending/{id:[A-Fa-f0-9]+}",
 			HandlerFunc: a.PendingOperationDetails},
+		// cancel a queued or running operation
+		rest.Route{
+			Name:        "PendingOperationCancel",
+			Method:      "POST",
+			Pattern:     "/operations/pending/{id:[A-Fa-f0-9]+}/cancel",
+			HandlerFunc: a.PendingOperationCancel},
 		// request operation clean up
 		rest.Route{
 			Name:        "PendingOperationCleanUp",
@@ -722,14 +1119,42 @@ func (a *App) Close() {
 	if a.bgcleaner != nil {
 		a.bgcleaner.Stop()
 	}
+	if a.dresync != nil {
+		a.dresync.Stop()
+	}
+	if a.backups != nil {
+		a.backups.Stop()
+	}
+	if a.asyncQueue != nil {
+		a.asyncQueue.Stop()
+	}
+	// the last changes are written to the store before the db closes
+	if a.dbMirror != nil {
+		a.dbMirror.Stop()
+	}
+	if c, ok := a.realExecutor().(executorCloser); ok {
+		c.Close()
+	}
 
 	// Close the DB
 	a.db.Close()
+	if a.dbStore != nil {
+		a.dbStore.Close()
+	}
 	logger.Info("Closed")
 }
 
+// Backup writes a copy of the db. The ETag of the copy is the id of
+// the last transaction committed, so that a client holding a copy can
+// check if the db changed with If-None-Match.
 func (a *App) Backup(w http.ResponseWriter, r *http.Request) {
 	err := a.db.View(func(tx *bolt.Tx) error {
+		etag := fmt.Sprintf(`"%v"`, tx.ID())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", `attachment; filename="heketi.db"`)
 		w.Header().Set("Content-Length", strconv.Itoa(int(tx.Size())))
@@ -741,6 +1166,28 @@ func (a *App) Backup(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// BackupList lists the snapshots of the db kept by the periodic
+// backups, most recent first.
+func (a *App) BackupList(w http.ResponseWriter, r *http.Request) {
+	if a.backups == nil {
+		http.Error(w, "Db backups are not configured", http.StatusNotFound)
+		return
+	}
+	backups, err := a.backups.List()
+	if err != nil {
+		logger.LogError("Unable to list db backups: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(api.BackupListResponse{
+		Backups: backups,
+	}); err != nil {
+		panic(err)
+	}
+}
+
 func (a *App) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Warning("Invalid path or request %v", r.URL.Path)
 	http.Error(w, "Invalid path or request", http.StatusNotFound)
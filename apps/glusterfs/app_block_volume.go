@@ -34,6 +34,14 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 		logger.LogError("validation failed: " + err.Error())
 		return
 	}
+	key, err := requestIdempotencyKey(r, msg.IdempotencyKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.LogError(err.Error())
+		return
+	}
+	// the key is tracked separately from the block volume
+	msg.IdempotencyKey = ""
 
 	if msg.Size < 1 {
 		http.Error(w, "Invalid volume size", http.StatusBadRequest)
@@ -76,7 +84,11 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 	blockVolume := NewBlockVolumeEntryFromRequest(&msg)
 
 	bvc := NewBlockVolumeCreateOperation(blockVolume, a.db)
-	if err := AsyncHttpOperation(a, w, r, bvc); err != nil {
+	err = a.runIdempotent(w, r, idempotentBlockVolume, key,
+		blockVolume.Info.Id, bvc, func() error {
+			return AsyncHttpOperation(a, w, r, bvc)
+		})
+	if err != nil {
 		OperationHttpErrorf(w, err, "Failed to allocate new block volume: %v", err)
 		return
 	}
@@ -84,17 +96,18 @@ func (a *App) BlockVolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 func (a *App) BlockVolumeList(w http.ResponseWriter, r *http.Request) {
 
-	var list api.BlockVolumeListResponse
+	q, err := newBlockVolumeListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("invalid query: " + err.Error())
+		return
+	}
 
-	err := a.db.View(func(tx *bolt.Tx) error {
+	var list *api.BlockVolumeListResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
 		var err error
-
-		list.BlockVolumes, err = ListCompleteBlockVolumes(tx)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		list, err = listBlockVolumes(tx, q)
+		return err
 	})
 
 	if err != nil {
@@ -223,3 +236,53 @@ func (a *App) BlockVolumeExpand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (a *App) BlockVolumeSetTags(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var bv *BlockVolumeEntry
+
+	// Unmarshal JSON
+	var msg api.TagsChangeRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		bv, err = NewBlockVolumeEntryFromId(tx, id)
+		if err != nil && err != ErrNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if err == ErrNotFound || !bv.Visible() {
+			// treat an invisible entry like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+		ApplyTags(bv, msg)
+		if err := bv.Save(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(bv.AllTags()); err != nil {
+		panic(err)
+	}
+}
@@ -78,6 +78,9 @@ func (a *App) ClusterSetFlags(w http.ResponseWriter, r *http.Request) {
 
 		entry.Info.File = msg.File
 		entry.Info.Block = msg.Block
+		if msg.AverageFileSize != nil {
+			entry.Info.AverageFileSize = *msg.AverageFileSize
+		}
 
 		err = entry.Save(tx)
 		if err != nil {
@@ -97,18 +100,18 @@ func (a *App) ClusterSetFlags(w http.ResponseWriter, r *http.Request) {
 
 func (a *App) ClusterList(w http.ResponseWriter, r *http.Request) {
 
-	var list api.ClusterListResponse
+	q, err := newClusterListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("invalid query: " + err.Error())
+		return
+	}
 
-	// Get all the cluster ids from the DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	var list *api.ClusterListResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
 		var err error
-
-		list.Clusters, err = ClusterList(tx)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		list, err = listClusters(tx, q)
+		return err
 	})
 
 	if err != nil {
@@ -93,6 +93,7 @@ func TestClusterSetFlags(t *testing.T) {
 	entry.Info.Id = clusterId
 	entry.Info.File = true
 	entry.Info.Block = true
+	entry.Info.AverageFileSize = 16
 
 	err := app.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BOLTDB_BUCKET_CLUSTER))
@@ -139,6 +140,29 @@ func TestClusterSetFlags(t *testing.T) {
 	tests.Assert(t, ce.Info.Id == clusterId)
 	tests.Assert(t, ce.Info.File == true)
 	tests.Assert(t, ce.Info.Block == false)
+	tests.Assert(t, ce.Info.AverageFileSize == 16,
+		"expected average file size unchanged, got:", ce.Info.AverageFileSize)
+
+	// Clear the default average file size
+	request = []byte(`{
+"file": true,
+"block": false,
+"average_file_size_kb": 0
+}`)
+	r, err = http.Post(ts.URL+"/clusters/"+clusterId+"/flags",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"Expected http status OK, got: ", http.StatusText(r.StatusCode))
+	err = app.db.View(func(tx *bolt.Tx) error {
+		c, err := NewClusterEntryFromId(tx, clusterId)
+		if err == nil {
+			ce = *c
+		}
+		return err
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, ce.Info.AverageFileSize == 0, "got:", ce.Info.AverageFileSize)
 }
 
 func TestClusterList(t *testing.T) {
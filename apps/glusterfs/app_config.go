@@ -10,9 +10,13 @@
 package glusterfs
 
 import (
+	"github.com/heketi/heketi/v10/executors/agentexec"
 	"github.com/heketi/heketi/v10/executors/injectexec"
 	"github.com/heketi/heketi/v10/executors/kubeexec"
+	"github.com/heketi/heketi/v10/executors/nodeexec"
 	"github.com/heketi/heketi/v10/executors/sshexec"
+	"github.com/heketi/heketi/v10/pkg/db/backup"
+	"github.com/heketi/heketi/v10/pkg/db/store"
 )
 
 type RetryLimitConfig struct {
@@ -26,6 +30,8 @@ type GlusterFSConfig struct {
 	Allocator    string                  `json:"allocator"`
 	SshConfig    sshexec.SshConfig       `json:"sshexec"`
 	KubeConfig   kubeexec.KubeConfig     `json:"kubeexec"`
+	NodeConfig   nodeexec.NodeConfig     `json:"nodeexec"`
+	AgentConfig  agentexec.AgentConfig   `json:"agentexec"`
 	InjectConfig injectexec.InjectConfig `json:"injectexec"`
 	Loglevel     string                  `json:"loglevel"`
 
@@ -49,11 +55,27 @@ type GlusterFSConfig struct {
 	RefreshTimeMonitorGlusterNodes uint32 `json:"refresh_time_monitor_gluster_nodes"`
 	StartTimeMonitorGlusterNodes   uint32 `json:"start_time_monitor_gluster_nodes"`
 	MaxInflightOperations          uint64 `json:"max_inflight_operations"`
+	MaxQueuedOperations            uint64 `json:"max_queued_operations"`
 
 	DisableBackgroundCleaner     bool   `json:"disable_background_cleaner"`
 	RefreshTimeBackgroundCleaner uint32 `json:"refresh_time_background_cleaner"`
 	StartTimeBackgroundCleaner   uint32 `json:"start_time_background_cleaner"`
 
+	EnableDeviceResync      bool   `json:"enable_device_resync"`
+	RefreshTimeDeviceResync uint32 `json:"refresh_time_device_resync"`
+	StartTimeDeviceResync   uint32 `json:"start_time_device_resync"`
+	MaxConcurrentResyncs    int    `json:"max_concurrent_device_resyncs"`
+
+	// seconds to keep the results of async operations that were
+	// never queried
+	AsyncQueueTTL uint32 `json:"async_queue_ttl"`
+
 	// operation retry amounts
 	RetryLimits RetryLimitConfig `json:"operation_retry_limits"`
+
+	// periodic db backups
+	DbBackup backup.Config `json:"db_backup"`
+
+	// store holding the db, of which the db file is a working copy
+	DbStore store.Config `json:"db_store"`
 }
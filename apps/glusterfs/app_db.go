@@ -16,8 +16,20 @@ import (
 
 // DbDump ... Creates a JSON output representing the state of DB
 // This is the variant to be called via the API and running in the App
+// With the cluster query parameter only the entries of that cluster
+// are written.
 func (a *App) DbDump(w http.ResponseWriter, r *http.Request) {
-	dump, err := dbDumpInternal(a.db)
+	var dump Db
+	var err error
+	if clusterId := r.URL.Query().Get("cluster"); clusterId != "" {
+		dump, err = dbDumpCluster(a.db, clusterId)
+		if err == ErrNotFound {
+			http.Error(w, "Cluster "+clusterId+" not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		dump, err = dbDumpInternal(a.db)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/db/store"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// testDbStore replaces the etcd store of the apps by a bolt store.
+func testDbStore(t *testing.T) (store.Store, func()) {
+	storefile := tests.Tempfile()
+	sdb, err := bolt.Open(storefile, 0600, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	s := store.NewBoltStore(sdb)
+
+	orig := newDbStore
+	newDbStore = func(c *store.Config) (store.Store, error) {
+		return s, nil
+	}
+	return s, func() {
+		newDbStore = orig
+		sdb.Close()
+		os.Remove(storefile)
+	}
+}
+
+func newTestDbStoreApp(t *testing.T, dbfile string) *App {
+	app, err := NewApp(&GlusterFSConfig{
+		DBfile:   dbfile,
+		Executor: "mock",
+		DbStore: store.Config{
+			Type: store.TypeEtcd,
+			Etcd: store.EtcdConfig{Endpoints: []string{"http://localhost:2379"}},
+		},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return app
+}
+
+func TestAppDbStore(t *testing.T) {
+	s, cleanup := testDbStore(t)
+	defer cleanup()
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	// the empty store is filled from the db file
+	app := newTestDbStoreApp(t, dbfile)
+	cluster := NewClusterEntryFromRequest(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{Block: true, File: true},
+	})
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		return cluster.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the change is in the store once it is committed
+	err = s.View(func(tx store.Tx) error {
+		v, err := tx.Get(BOLTDB_BUCKET_CLUSTER, cluster.Info.Id)
+		tests.Assert(t, v != nil, "expected cluster in the store")
+		v, err = tx.Get(BOLTDB_BUCKET_DBATTRIBUTE, DB_SCHEMA_VERSION)
+		tests.Assert(t, v != nil, "expected schema version in the store")
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// a new db file is loaded from the store
+	os.Remove(dbfile)
+	app = newTestDbStoreApp(t, dbfile)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, cluster.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// changes of the db file not yet written to the store are kept
+	// and written
+	other := NewClusterEntryFromRequest(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{Block: true, File: true},
+	})
+	app.dbMirror.Stop()
+	app.dbMirror = nil
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return other.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	app = newTestDbStoreApp(t, dbfile)
+	unsynced, _ := filepath.Glob(dbfile + ".unsynced-*")
+	tests.Assert(t, len(unsynced) == 0, "expected no unsynced db file, got:", unsynced)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, other.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.View(func(tx store.Tx) error {
+		v, err := tx.Get(BOLTDB_BUCKET_CLUSTER, other.Info.Id)
+		tests.Assert(t, v != nil, "expected cluster in the store")
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a db file is set aside once the store was written by another
+	// db file
+	stale := NewClusterEntryFromRequest(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{Block: true, File: true},
+	})
+	app.dbMirror.Stop()
+	app.dbMirror = nil
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return stale.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	otherfile := tests.Tempfile()
+	defer os.Remove(otherfile)
+	odb, err := OpenDB(otherfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, store.Load(odb, s) == nil)
+	err = odb.Update(func(tx *bolt.Tx) error {
+		return other.Delete(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, store.NewMirror(odb, s).Sync() == nil)
+	odb.Close()
+
+	app = newTestDbStoreApp(t, dbfile)
+	defer app.Close()
+	unsynced, _ = filepath.Glob(dbfile + ".unsynced-*")
+	tests.Assert(t, len(unsynced) == 1, "expected unsynced db file, got:", unsynced)
+	defer os.Remove(unsynced[0])
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewClusterEntryFromId(tx, stale.Info.Id)
+		tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+		_, err = NewClusterEntryFromId(tx, other.Info.Id)
+		tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+		_, err = NewClusterEntryFromId(tx, cluster.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
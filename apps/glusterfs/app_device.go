@@ -329,33 +329,27 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set state
+	setState := func() (string, error) {
+		err := device.SetState(a.db, a.executor, msg)
+		if err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+
 	// Setting the state to failed can involve long running operations
-	// and thus needs to be checked for operations throttle
+	// and thus needs to be tracked and, if the server is busy, queued.
 	// However, we don't want to block "cheap" changes like setting
 	// the item offline
-	var token string
 	if msg.State == api.EntryStateFailed {
-		var throttled bool
-		throttled, token = a.optracker.ThrottleOrToken()
-		if throttled {
-			OperationHttpErrorf(w, ErrTooManyOperations, "")
-			return
-		}
-	}
-
-	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		defer func() {
-			if msg.State == api.EntryStateFailed {
-				a.optracker.Remove(token)
-			}
-		}()
-		err = device.SetState(a.db, a.executor, msg)
+		err := AsyncHttpTracked(a, w, r, PriorityHigh, setState)
 		if err != nil {
-			return "", err
+			OperationHttpErrorf(w, err, "Failed to set state: %v", err)
 		}
-		return "", nil
-	})
+		return
+	}
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, setState)
 }
 
 func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
@@ -434,6 +428,7 @@ func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
 				device.Info.Storage.Total, info.TotalSize, device.Info.Storage.Free, info.FreeSize, device.Info.Storage.Used, info.UsedSize)
 
 			device.StorageSet(info.TotalSize, info.FreeSize, info.UsedSize)
+			device.Drift = &api.DeviceDrift{LastCheck: resyncNow().Unix()}
 
 			// Save updated device
 			err = device.Save(tx)
@@ -26,6 +26,13 @@ var (
 
 // Authorization function
 func (a *App) Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	Auth(w, r, next)
+}
+
+// Auth checks that the issuer of the token of the request may access
+// the requested path. It does not depend on an app, for servers that
+// replace their app while running.
+func Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 
 	// Value saved by the JWT middleware.
 	data := r.Context().Value("jwt")
@@ -44,6 +51,20 @@ func (a *App) Auth(w http.ResponseWriter, r *http.Request, next http.HandlerFunc
 	next(w, r)
 }
 
+// requestIssuer returns the issuer of the token the request was
+// authenticated with, or an empty string if authentication is
+// disabled.
+func requestIssuer(r *http.Request) string {
+	token, ok := r.Context().Value("jwt").(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	if claims, ok := token.Claims.(*middleware.HeketiJwtClaims); ok {
+		return claims.Issuer
+	}
+	return ""
+}
+
 // Backup database to a secret
 func (a *App) BackupToKubernetesSecret(
 	w http.ResponseWriter,
@@ -17,6 +17,7 @@ import (
 	"github.com/gorilla/mux"
 	wdb "github.com/heketi/heketi/v10/pkg/db"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/ssh"
 	"github.com/heketi/heketi/v10/pkg/utils"
 )
 
@@ -427,35 +428,27 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Setting the state to failed can involve long running operations
-	// and thus needs to be checked for operations throttle
-	// However, we don't want to block "cheap" changes like setting
-	// the item offline
-	var token string
-	if msg.State == api.EntryStateFailed {
-		var throttled bool
-		throttled, token = a.optracker.ThrottleOrToken()
-		if throttled {
-			OperationHttpErrorf(w, ErrTooManyOperations, "")
-			return
-		}
-	}
-
 	// Set state
-	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
-		defer func() {
-			if msg.State == api.EntryStateFailed {
-				a.optracker.Remove(token)
-			}
-		}()
-		err = node.SetState(a.db, a.executor, msg)
+	setState := func() (string, error) {
+		err := node.SetState(a.db, a.executor, msg)
 		if err != nil {
 			return "", err
 		}
 		return "", nil
+	}
 
-	})
-
+	// Setting the state to failed can involve long running operations
+	// and thus needs to be tracked and, if the server is busy, queued.
+	// However, we don't want to block "cheap" changes like setting
+	// the item offline
+	if msg.State == api.EntryStateFailed {
+		err := AsyncHttpTracked(a, w, r, PriorityHigh, setState)
+		if err != nil {
+			OperationHttpErrorf(w, err, "Failed to set state: %v", err)
+		}
+		return
+	}
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, setState)
 }
 
 func (a *App) NodeSetTags(w http.ResponseWriter, r *http.Request) {
@@ -505,3 +498,73 @@ func (a *App) NodeSetTags(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+func (a *App) NodeSshHostKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var resp api.NodeSshHostKeyResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		resp.Key = node.SshHostKey
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if resp.Key != "" {
+		resp.Fingerprint, err = ssh.HostKeyFingerprint(resp.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+// NodeSshHostKeyReset removes the ssh host key pinned for a node.
+// The key presented on the next connection to the node is pinned.
+func (a *App) NodeSshHostKeyReset(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var node *NodeEntry
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		node.SshHostKey = ""
+		if err := node.Save(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	if a.hostKeys != nil {
+		a.hostKeys.Forget(node.ManageHostName())
+	}
+	logger.Info("Reset ssh host key of node %v", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -44,6 +44,7 @@ func (a *App) AppOperationsInfo() (*api.OperationsInfo, error) {
 	}
 
 	info.InFlight = a.optracker.Get()
+	info.Queued = a.optracker.Queued()
 
 	return info, nil
 }
@@ -72,6 +73,7 @@ func (a *App) OperationsInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	info.InFlight = a.optracker.Get()
+	info.Queued = a.optracker.Queued()
 
 	// Write msg
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -100,6 +102,7 @@ func (a *App) PendingOperationList(w http.ResponseWriter, r *http.Request) {
 			if tracked[pop.Id] {
 				p.PendingOperations[i].SubStatus = "in-flight"
 			}
+			p.PendingOperations[i].Progress = runningOps.progress(pop.Id)
 		}
 		return nil
 	})
@@ -130,6 +133,7 @@ func (a *App) PendingOperationDetails(w http.ResponseWriter, r *http.Request) {
 			PendingOperationInfo: pop.ToInfo(),
 			Changes:              make([]api.PendingChangeInfo, len(pop.Actions)),
 		}
+		info.Progress = runningOps.progress(pop.Id)
 		for i, a := range pop.Actions {
 			info.Changes[i] = api.PendingChangeInfo{
 				Id:          a.Id,
@@ -154,6 +158,39 @@ func (a *App) PendingOperationDetails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PendingOperationCancel asks a queued or running operation to stop.
+// The operation rolls back what it has done so far, a device removal
+// keeps the bricks it already moved. An operation that has already
+// made its changes is completed and can no longer be cancelled, nor
+// can an operation running commands it can not stop between.
+// Status of the operation's async request, if any, is found at the
+// returned location.
+func (a *App) PendingOperationCancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid := vars["id"]
+
+	if err := cancelOperation(a.optracker, pid); err != nil {
+		exists := false
+		a.db.View(func(tx *bolt.Tx) error {
+			_, err := NewPendingOperationEntryFromId(tx, pid)
+			exists = (err == nil)
+			return nil
+		})
+		if !exists {
+			http.Error(w, fmt.Sprintf("Id not found: %v", pid), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if url, ok := a.asyncManager.OperationUrl(pid); ok {
+		http.Redirect(w, r, url, http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (a *App) PendingOperationCleanUp(w http.ResponseWriter, r *http.Request) {
 
 	// Unmarshal JSON
@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+func (a *App) ProfileCreate(w http.ResponseWriter, r *http.Request) {
+	var msg api.PlacementProfile
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	entry := NewProfileEntryFromRequest(&msg)
+	if err := entry.check(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.LogError("Invalid placement profile %v: %v", msg.Name, err)
+		return
+	}
+
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		_, err := NewProfileEntryFromName(tx, msg.Name)
+		if err == nil {
+			err = fmt.Errorf("Placement profile %v already exists", msg.Name)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		} else if err != ErrNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		err = entry.Save(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	logger.Info("Created placement profile %v", msg.Name)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(entry.Info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ProfileList(w http.ResponseWriter, r *http.Request) {
+	list := &api.PlacementProfileListResponse{
+		Profiles: []api.PlacementProfile{},
+	}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		names, err := ProfileList(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			entry, err := NewProfileEntryFromName(tx, name)
+			if err != nil {
+				return err
+			}
+			list.Profiles = append(list.Profiles, entry.Info)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Err(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) ProfileInfo(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var info api.PlacementProfile
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewProfileEntryFromName(tx, name)
+		if err == ErrNotFound {
+			http.Error(w, "Placement profile not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		info = entry.Info
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+// ProfileDelete removes a placement profile. The volumes created with
+// the profile keep its settings.
+func (a *App) ProfileDelete(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewProfileEntryFromName(tx, name)
+		if err == ErrNotFound {
+			http.Error(w, "Placement profile not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		err = entry.Delete(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	logger.Info("Deleted placement profile %v", name)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyProfile sets the settings of the placement profile named by a
+// volume create request on the request. It writes the http error and
+// returns false if the profile can not be applied.
+func (a *App) applyProfile(w http.ResponseWriter, req *api.VolumeCreateRequest) bool {
+	if req.Profile == "" {
+		return true
+	}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewProfileEntryFromName(tx, req.Profile)
+		if err == ErrNotFound {
+			http.Error(w, fmt.Sprintf("Placement profile %v not found", req.Profile),
+				http.StatusBadRequest)
+			logger.LogError("Placement profile %v not found", req.Profile)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		entry.Apply(req)
+		return nil
+	})
+	return err == nil
+}
@@ -0,0 +1,171 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func TestProfiles(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	_, err := c.ProfileCreate(&api.PlacementProfile{Name: "bad name"})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "validation failed"),
+		"expected validation error, got:", err)
+	_, err = c.ProfileCreate(&api.PlacementProfile{Name: "bad", TagMatch: "disk"})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "Invalid tag match rule"),
+		"expected tag match error, got:", err)
+
+	ssd := &api.PlacementProfile{
+		Name:         "ssd-strict",
+		TagMatch:     "disk=ssd",
+		ZoneChecking: "strict",
+	}
+	ssd.Durability.Type = api.DurabilityReplicate
+	ssd.Durability.Replicate.Replica = 3
+	_, err = c.ProfileCreate(ssd)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.ProfileCreate(ssd)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "already exists"),
+		"expected conflict, got:", err)
+	_, err = c.ProfileCreate(&api.PlacementProfile{
+		Name:           "hdd-bulk",
+		Description:    "bricks of at most 20GiB",
+		BrickMaxSizeGb: 20,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	list, err := c.ProfileList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Profiles) == 2, "got:", list.Profiles)
+	tests.Assert(t, list.Profiles[0].Name == "hdd-bulk", "got:", list.Profiles)
+	info, err := c.ProfileInfo("ssd-strict")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.TagMatch == "disk=ssd", "got:", info)
+	tests.Assert(t, info.Durability.Replicate.Replica == 3, "got:", info)
+
+	err = setupSampleDbWithTopology(app, 1, 3, 2, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Profile = "missing"
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not found"),
+		"expected not found error, got:", err)
+
+	// no device matches the tags of the profile
+	req.Profile = "ssd-strict"
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			d.SetTags(map[string]string{"disk": "ssd"})
+			if err := d.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.GlusterVolumeOptions = []string{"user.heketi.zone-checking none"}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.Profile == "ssd-strict", "got:", vol.Profile)
+	tests.Assert(t, vol.Durability.Type == api.DurabilityReplicate, "got:", vol.Durability)
+	tests.Assert(t, vol.Durability.Replicate.Replica == 3, "got:", vol.Durability)
+	// the options of the request come last and take precedence
+	opts := []string{}
+	for _, o := range vol.GlusterVolumeOptions {
+		if o != "" {
+			opts = append(opts, o)
+		}
+	}
+	tests.Assert(t, len(opts) == 3, "got:", opts)
+	tests.Assert(t, opts[0] == HEKETI_TAG_MATCH_KEY+" disk=ssd", "got:", opts)
+	tests.Assert(t, opts[1] == HEKETI_ZONE_CHECKING_KEY+" strict", "got:", opts)
+	tests.Assert(t, opts[2] == HEKETI_ZONE_CHECKING_KEY+" none", "got:", opts)
+
+	// the brick size limit of the profile
+	req = &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.Profile = "hdd-bulk"
+	vol, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(vol.Bricks) > 3, "got:", len(vol.Bricks))
+	for _, b := range vol.Bricks {
+		tests.Assert(t, b.Size <= 20*GB, "got:", b.Size)
+	}
+
+	// volumes keep the settings of deleted profiles
+	err = c.ProfileDelete("hdd-bulk")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = c.ProfileInfo("hdd-bulk")
+	tests.Assert(t, err != nil, "expected err != nil")
+	err = c.ProfileDelete("hdd-bulk")
+	tests.Assert(t, err != nil, "expected err != nil")
+	vol, err = c.VolumeInfo(vol.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, strings.Contains(strings.Join(vol.GlusterVolumeOptions, ","),
+		HEKETI_BRICK_MAX_SIZE_KEY+" 20"), "got:", vol.GlusterVolumeOptions)
+}
+
+func TestVolumeBrickSizeLimits(t *testing.T) {
+	v := NewVolumeEntry()
+	min, max := v.brickSizeLimits()
+	tests.Assert(t, min == BrickMinSize && max == BrickMaxSize)
+
+	// the options narrow the limits of the server
+	v.GlusterVolumeOptions = []string{
+		HEKETI_BRICK_MIN_SIZE_KEY + " 10",
+		HEKETI_BRICK_MAX_SIZE_KEY + " 100000",
+	}
+	min, max = v.brickSizeLimits()
+	tests.Assert(t, min == 10*GB, "got:", min)
+	tests.Assert(t, max == BrickMaxSize, "got:", max)
+
+	v.GlusterVolumeOptions = []string{
+		HEKETI_BRICK_MIN_SIZE_KEY + " x",
+		HEKETI_BRICK_MAX_SIZE_KEY + " 20",
+	}
+	min, max = v.brickSizeLimits()
+	tests.Assert(t, min == BrickMinSize, "got:", min)
+	tests.Assert(t, max == 20*GB, "got:", max)
+}
@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// reloadableDb is the db used by the parts of the app running in the
+// background, such as the node health monitor. The bolt db behind it
+// is replaced when a read-only app reloads its db.
+type reloadableDb struct {
+	lock sync.RWMutex
+	db   *bolt.DB
+}
+
+func newReloadableDb(db *bolt.DB) *reloadableDb {
+	return &reloadableDb{db: db}
+}
+
+func (r *reloadableDb) View(cb func(*bolt.Tx) error) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.db.View(cb)
+}
+
+func (r *reloadableDb) Update(cb func(*bolt.Tx) error) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.db.Update(cb)
+}
+
+// set replaces the bolt db once the transactions on the previous one
+// are done.
+func (r *reloadableDb) set(db *bolt.DB) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.db = db
+}
+
+// ReloadDb opens the db file of a read-only app again, such as after
+// the file was replaced with a new copy of the db of the leader, and
+// closes the db it replaces. The executor and the background tasks of
+// the app are kept. It must not be called while the app serves
+// requests.
+func (a *App) ReloadDb() error {
+	if !a.dbReadOnly {
+		return errors.New("only a read-only db can be reloaded")
+	}
+	db, err := OpenDB(DbPath(a.conf), true)
+	if err != nil {
+		return logger.LogError("Unable to open database: %v", err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		return checkDbSchemaVersion(tx)
+	})
+	if err != nil {
+		db.Close()
+		return logger.LogError("Unable to use db: %v", err)
+	}
+
+	old := a.db
+	a.db = db
+	a.sharedDb.set(db)
+	old.Close()
+	logger.Info("Reloaded db")
+	return nil
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func testSaveCluster(t *testing.T, db *bolt.DB) {
+	cluster := NewClusterEntryFromRequest(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{Block: true, File: true},
+	})
+	err := db.Update(func(tx *bolt.Tx) error {
+		return cluster.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func testClusterCount(t *testing.T, db interface {
+	View(func(*bolt.Tx) error) error
+}) int {
+	var n int
+	err := db.View(func(tx *bolt.Tx) error {
+		l, err := ClusterList(tx)
+		n = len(l)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return n
+}
+
+func TestAppReloadDb(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app, err := NewApp(&GlusterFSConfig{DBfile: dbfile, Executor: "mock"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	testSaveCluster(t, app.db)
+	err = app.ReloadDb()
+	tests.Assert(t, err != nil, "expected err != nil")
+	app.Close()
+
+	ro, err := NewApp(&GlusterFSConfig{DBfile: dbfile, Executor: "mock", DBReadOnly: true})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer ro.Close()
+	tests.Assert(t, testClusterCount(t, ro.db) == 1)
+
+	// the db file is replaced by a new copy, as by a standby
+	copyfile := tests.Tempfile()
+	defer os.Remove(copyfile)
+	db, err := OpenDB(dbfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(copyfile, 0600)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	db.Close()
+	db, err = OpenDB(copyfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	testSaveCluster(t, db)
+	db.Close()
+	err = os.Rename(copyfile, dbfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	old := ro.db
+	err = ro.ReloadDb()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, ro.db != old, "expected db opened again")
+	tests.Assert(t, testClusterCount(t, ro.db) == 2)
+	tests.Assert(t, testClusterCount(t, ro.sharedDb) == 2)
+}
@@ -10,6 +10,7 @@
 package glusterfs
 
 import (
+	"encoding/json"
 	"net/http/httptest"
 	"os"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/pkg/db/backup"
 	"github.com/heketi/heketi/v10/pkg/logging"
 	"github.com/heketi/tests"
 )
@@ -201,3 +203,81 @@ func TestAppBlockSettings(t *testing.T) {
 	tests.Assert(t, CreateBlockHostingVolumes == true)
 	tests.Assert(t, BlockHostingVolumeSize == 500)
 }
+
+func TestAppDbBackups(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	dir := tests.Tempfile()
+	defer os.RemoveAll(dir)
+
+	app, err := NewApp(&GlusterFSConfig{
+		DBfile:   dbfile,
+		Executor: "mock",
+		DbBackup: backup.Config{Dir: dir},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer app.Close()
+	// wait for the backup taken at start
+	app.backups.Stop()
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	list, err := c.BackupList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Backups) == 1, "expected 1 backup, got:", list.Backups)
+	b := list.Backups[0]
+	_, ok := b.DbAttributes[DB_GENERATION_ID]
+	tests.Assert(t, ok, "expected generation id in db attributes, got:", b.DbAttributes)
+	tests.Assert(t, CheckDbAttributes(b.DbAttributes) == nil)
+
+	// backups are only listed when configured
+	app2 := NewTestApp(tests.Tempfile())
+	defer os.Remove(app2.conf.DBfile)
+	defer app2.Close()
+	router2 := mux.NewRouter()
+	app2.SetRoutes(router2)
+	ts2 := httptest.NewServer(router2)
+	defer ts2.Close()
+	_, err = client.NewClientNoAuth(ts2.URL).BackupList()
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not configured"),
+		"expected backups not configured, got:", err)
+}
+
+func TestAppDbDumpCluster(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := NewTestApp(dbfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 2, 2, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	var clusters []string
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	out, err := c.DbDumpCluster(clusters[1])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	var dump Db
+	err = json.Unmarshal([]byte(out), &dump)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, ok := dump.Clusters[clusters[1]]
+	tests.Assert(t, ok && len(dump.Clusters) == 1, "got:", dump.Clusters)
+	tests.Assert(t, len(dump.Nodes) == 2, "got:", dump.Nodes)
+
+	_, err = c.DbDumpCluster("0123456789abcdef0123456789abcdef")
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not found"),
+		"expected not found error, got:", err)
+}
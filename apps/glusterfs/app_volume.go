@@ -40,6 +40,18 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 		logger.LogError("validation failed: " + err.Error())
 		return
 	}
+	key, err := requestIdempotencyKey(r, msg.IdempotencyKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.LogError(err.Error())
+		return
+	}
+	// the key is tracked separately from the volume
+	msg.IdempotencyKey = ""
+
+	if !a.applyProfile(w, &msg) {
+		return
+	}
 
 	switch {
 	case msg.Gid < 0:
@@ -87,13 +99,20 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 	if msg.Durability.Type == api.DurabilityEC {
 		d := msg.Durability.Disperse
-		// Place here correct combinations
 		switch {
-		case d.Data == 2 && d.Redundancy == 1:
-		case d.Data == 4 && d.Redundancy == 2:
-		case d.Data == 8 && d.Redundancy == 3:
-		case d.Data == 8 && d.Redundancy == 4:
-		default:
+		case d.Auto && d.Data != 0:
+			http.Error(w, "Disperse data can not be set with an auto geometry",
+				http.StatusBadRequest)
+			logger.LogError("Disperse data can not be set with an auto geometry")
+			return
+		case d.Auto && (d.Redundancy < 0 || d.Redundancy > maxDisperseRedundancy()):
+			http.Error(w,
+				fmt.Sprintf("Invalid disperse redundancy: %v", d.Redundancy),
+				http.StatusBadRequest)
+			logger.LogError(fmt.Sprintf("Invalid disperse redundancy: %v", d.Redundancy))
+			return
+		case d.Auto:
+		case !validDisperseGeometry(d):
 			http.Error(w,
 				fmt.Sprintf("Invalid dispersion combination: %v+%v", d.Data, d.Redundancy),
 				http.StatusBadRequest)
@@ -127,6 +146,13 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		err = checkAntiAffinity(tx, msg.AntiAffinity)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			logger.LogError(err.Error())
+			return err
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -150,7 +176,11 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 	if a.conf.RetryLimits.VolumeCreate > 0 {
 		vc.maxRetries = a.conf.RetryLimits.VolumeCreate
 	}
-	if err := AsyncHttpOperation(a, w, r, vc); err != nil {
+	err = a.runIdempotent(w, r, idempotentVolume, key, vol.Info.Id, vc,
+		func() error {
+			return AsyncHttpOperation(a, w, r, vc)
+		})
+	if err != nil {
 		OperationHttpErrorf(w, err, "Failed to allocate new volume: %v", err)
 		return
 	}
@@ -158,18 +188,18 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 
 func (a *App) VolumeList(w http.ResponseWriter, r *http.Request) {
 
-	var list api.VolumeListResponse
+	q, err := newListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("invalid query: " + err.Error())
+		return
+	}
 
-	// Get all the cluster ids from the DB
-	err := a.db.View(func(tx *bolt.Tx) error {
+	var list *api.VolumeListResponse
+	err = a.db.View(func(tx *bolt.Tx) error {
 		var err error
-
-		list.Volumes, err = ListCompleteVolumes(tx)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		list, err = listVolumes(tx, q)
+		return err
 	})
 
 	if err != nil {
@@ -424,3 +454,53 @@ func (a *App) VolumeSetBlockRestriction(w http.ResponseWriter, r *http.Request)
 		return
 	}
 }
+
+func (a *App) VolumeSetTags(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var volume *VolumeEntry
+
+	// Unmarshal JSON
+	var msg api.TagsChangeRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err != nil && err != ErrNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		if err == ErrNotFound || !volume.Visible() {
+			// treat an invisible entry like it doesn't exist
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return ErrNotFound
+		}
+		ApplyTags(volume, msg)
+		if err := volume.Save(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(volume.AllTags()); err != nil {
+		panic(err)
+	}
+}
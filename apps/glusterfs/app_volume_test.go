@@ -419,6 +419,62 @@ func TestVolumeCreateBadDispersionValues(t *testing.T) {
 	tests.Assert(t, strings.Contains(string(body), "Invalid dispersion combination"))
 }
 
+func TestVolumeCreateBadAutoDispersionValues(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// The data count is chosen by the server
+	request := []byte(`{
+        "size" : 100,
+        "durability": {
+        	"type": "disperse",
+        	"disperse": {
+            	"data" : 4,
+            	"redundancy" : 2,
+            	"auto" : true
+        	}
+    	}
+    }`)
+
+	r, err := http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	tests.Assert(t, err == nil)
+	r.Body.Close()
+	tests.Assert(t, strings.Contains(string(body), "auto geometry"), "got:", string(body))
+
+	// No supported geometry has such a redundancy
+	request = []byte(`{
+        "size" : 100,
+        "durability": {
+        	"type": "disperse",
+        	"disperse": {
+            	"redundancy" : 5,
+            	"auto" : true
+        	}
+    	}
+    }`)
+
+	r, err = http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	body, err = ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	tests.Assert(t, err == nil)
+	r.Body.Close()
+	tests.Assert(t, strings.Contains(string(body), "Invalid disperse redundancy"), "got:", string(body))
+}
+
 func TestVolumeCreateBadClusters(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
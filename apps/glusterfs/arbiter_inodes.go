@@ -0,0 +1,139 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// arbiterInodeSize is the size in bytes of the inodes of the arbiter
+// bricks, which are formatted without a limit on the space used by
+// inodes.
+const arbiterInodeSize uint64 = 512
+
+// arbiterInodeHeadroomWarning is the percent of the capacity of an
+// arbiter brick left below which the device info warns.
+var arbiterInodeHeadroomWarning int64 = 10
+
+// arbiterInodes estimates the number of files the arbiter bricks of
+// the device can hold against the number expected from the size of
+// the data bricks of their volumes and the current average file size
+// hints. As arbiter bricks are sized with one KiB per expected file
+// (see discountBrickSize) a new brick has room for about twice the
+// files expected. It returns nil if the device has no arbiter bricks,
+// and warnings for the bricks close to inode exhaustion.
+func (d *DeviceEntry) arbiterInodes(tx *bolt.Tx) (
+	*api.ArbiterInodes, []string, error) {
+
+	var (
+		inodes   *api.ArbiterInodes
+		warnings []string
+		tags     map[string]string
+	)
+	for _, id := range d.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if brick.SubType != ArbiterSubType || brick.Info.Size == 0 {
+			continue
+		}
+		v, err := NewVolumeEntryFromId(tx, brick.Info.VolumeId)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		dataBrickSize, err := v.dataBrickSize(tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if dataBrickSize == 0 {
+			continue
+		}
+
+		if tags == nil {
+			n, err := NewNodeEntryFromId(tx, d.NodeId)
+			if err != nil {
+				return nil, nil, err
+			}
+			tags = MergeTags(n, d)
+		}
+		avgFileSize, err := arbiterAverageFileSize(tx, v, tags)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// brick sizes are in KiB
+		capacity := brick.Info.Size * 1024 / arbiterInodeSize
+		expected := dataBrickSize / avgFileSize
+		headroom := (int64(capacity) - int64(expected)) * 100 / int64(capacity)
+		if inodes == nil {
+			inodes = &api.ArbiterInodes{Headroom: headroom}
+		}
+		inodes.Capacity += capacity
+		inodes.Expected += expected
+		if headroom < inodes.Headroom {
+			inodes.Headroom = headroom
+		}
+		if headroom < arbiterInodeHeadroomWarning {
+			warnings = append(warnings, fmt.Sprintf(
+				"Arbiter brick %v of volume %v is close to inode exhaustion: "+
+					"room for %v files, %v expected with an average file size of %v KiB",
+				brick.Info.Id, v.Info.Name, capacity, expected, avgFileSize))
+		}
+	}
+	return inodes, warnings, nil
+}
+
+// dataBrickSize returns the size of the largest data brick of the
+// volume.
+func (v *VolumeEntry) dataBrickSize(tx *bolt.Tx) (uint64, error) {
+	var size uint64
+	for _, id := range v.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if brick.SubType != ArbiterSubType && brick.Info.Size > size {
+			size = brick.Info.Size
+		}
+	}
+	return size, nil
+}
+
+// arbiterAverageFileSize returns the average file size to size the
+// arbiter brick of the volume on a device with the given tags. It is
+// taken from the volume options, then the tags of the device, then
+// the default of the cluster and then the default of the server.
+func arbiterAverageFileSize(tx *bolt.Tx,
+	v *VolumeEntry, tags map[string]string) (uint64, error) {
+
+	if size, ok := v.averageFileSizeOption(); ok {
+		return size, nil
+	}
+	if size, ok := AverageFileSizeTag(tags); ok {
+		return size, nil
+	}
+	c, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+	if err != nil && err != ErrNotFound {
+		return 0, err
+	}
+	if c != nil && c.Info.AverageFileSize != 0 {
+		return c.Info.AverageFileSize, nil
+	}
+	return averageFileSize, nil
+}
@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func TestArbiterBrickPlacerDeviceAverageFileSize(t *testing.T) {
+	dsrc := NewTestDeviceSource()
+	dsrc.QuickAdd("10000000", "11111111", "/dev/foobar", 100*GB)
+	dsrc.QuickAdd("20000000", "22222222", "/dev/foobar", 100*GB)
+	dsrc.QuickAdd("30000000", "33333333", "/dev/foobar", 100*GB)
+	for _, n := range dsrc.nodes {
+		n.Info.Tags = map[string]string{TAG_AVERAGE_FILE_SIZE: "16"}
+	}
+	opts := &TestPlacementOpts{
+		brickSize:       10 * GB,
+		brickSnapFactor: 1,
+		brickOwner:      "asdfasdf",
+		setSize:         3,
+		setCount:        1,
+		averageFileSize: 64 * KB,
+	}
+
+	// the average file size of the volume has priority
+	abplacer := NewArbiterBrickPlacer()
+	ba, err := abplacer.PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	size := ba.BrickSets[0].Bricks[arbiter_index].Info.Size
+	tests.Assert(t, size == 10*GB/64, "got:", size)
+
+	// the tags of the node size the arbiter brick
+	opts.averageFileSizeIsDefault = true
+	ba, err = abplacer.PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	size = ba.BrickSets[0].Bricks[arbiter_index].Info.Size
+	tests.Assert(t, size == 10*GB/16, "got:", size)
+}
+
+func TestDeviceInfoArbiterInodes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.GlusterVolumeOptions = []string{"user.heketi.arbiter true"}
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var deviceId string
+	info := func() *api.DeviceInfoResponse {
+		var info *api.DeviceInfoResponse
+		err := app.db.View(func(tx *bolt.Tx) error {
+			d, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+			info, err = d.NewInfoResponse(tx)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return info
+	}
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if b.SubType == ArbiterSubType {
+				deviceId = b.Info.DeviceId
+			} else {
+				// devices of data bricks have no arbiter inodes
+				d, err := NewDeviceEntryFromId(tx, b.Info.DeviceId)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+				dinfo, err := d.NewInfoResponse(tx)
+				tests.Assert(t, err == nil, "expected err == nil, got:", err)
+				tests.Assert(t, dinfo.ArbiterInodes == nil, "got:", dinfo.ArbiterInodes)
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, deviceId != "", "expected an arbiter brick")
+
+	// a new arbiter brick has room for twice the expected files
+	dinfo := info()
+	tests.Assert(t, dinfo.ArbiterInodes != nil)
+	tests.Assert(t, dinfo.ArbiterInodes.Expected == 100*GB/64,
+		"got:", dinfo.ArbiterInodes)
+	tests.Assert(t, dinfo.ArbiterInodes.Headroom == 50, "got:", dinfo.ArbiterInodes)
+	tests.Assert(t, len(dinfo.Warnings) == 0, "got:", dinfo.Warnings)
+
+	// smaller files by the default of the cluster exhaust the inodes
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		c, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+		if err != nil {
+			return err
+		}
+		c.Info.AverageFileSize = 32
+		return c.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	dinfo = info()
+	tests.Assert(t, dinfo.ArbiterInodes.Headroom == 0, "got:", dinfo.ArbiterInodes)
+	tests.Assert(t, len(dinfo.Warnings) == 1, "got:", dinfo.Warnings)
+
+	// the tags of the device have priority over the cluster
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, deviceId)
+		if err != nil {
+			return err
+		}
+		d.SetTags(map[string]string{TAG_AVERAGE_FILE_SIZE: "256"})
+		return d.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	dinfo = info()
+	tests.Assert(t, dinfo.ArbiterInodes.Headroom == 87, "got:", dinfo.ArbiterInodes)
+	tests.Assert(t, len(dinfo.Warnings) == 0, "got:", dinfo.Warnings)
+}
+
+func TestClusterVolumePlacementOpts(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.GlusterVolumeOptions = []string{"user.heketi.arbiter true"}
+	v := NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the placement and the replacement of bricks share the options
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		c, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+		if err != nil {
+			return err
+		}
+		c.Info.AverageFileSize = 16
+		if err := c.Save(tx); err != nil {
+			return err
+		}
+		opts, err := clusterVolumePlacementOpts(tx, v, v.Info.Cluster, 100*GB, 1)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, opts.AverageFileSize() == 16, "got:", opts.AverageFileSize())
+		tests.Assert(t, opts.AverageFileSizeIsDefault())
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the options of the volume have priority over the cluster
+	v.GlusterVolumeOptions = append(v.GlusterVolumeOptions,
+		HEKETI_AVERAGE_FILE_SIZE_KEY+" 256")
+	err = app.db.View(func(tx *bolt.Tx) error {
+		opts, err := clusterVolumePlacementOpts(tx, v, v.Info.Cluster, 100*GB, 1)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, opts.AverageFileSize() == 256, "got:", opts.AverageFileSize())
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
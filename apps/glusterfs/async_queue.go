@@ -0,0 +1,336 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/server/rest"
+)
+
+const (
+	BOLTDB_BUCKET_ASYNC_QUEUE = "ASYNC_QUEUE"
+
+	DEFAULT_ASYNC_QUEUE_TTL = 86400
+
+	asyncInterruptedMsg = "operation interrupted by server restart"
+)
+
+var (
+	asyncQueueNow func() time.Time = time.Now
+)
+
+// AsyncQueueEntry is the db representation of an asynchronous
+// operation started by the server.
+type AsyncQueueEntry struct {
+	Info rest.AsyncEntry
+}
+
+func NewAsyncQueueEntry() *AsyncQueueEntry {
+	return &AsyncQueueEntry{}
+}
+
+func NewAsyncQueueEntryFromId(tx *bolt.Tx, id string) (*AsyncQueueEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewAsyncQueueEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (a *AsyncQueueEntry) BucketName() string {
+	return BOLTDB_BUCKET_ASYNC_QUEUE
+}
+
+func (a *AsyncQueueEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(a.Info.Id) > 0)
+
+	return EntrySave(tx, a, a.Info.Id)
+}
+
+func (a *AsyncQueueEntry) Delete(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	return EntryDelete(tx, a, a.Info.Id)
+}
+
+func (a *AsyncQueueEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*a)
+
+	return buffer.Bytes(), err
+}
+
+func (a *AsyncQueueEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(a)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AsyncQueueList returns the ids of all persisted asynchronous
+// operations.
+func AsyncQueueList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_ASYNC_QUEUE)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+// AsyncQueueStore persists the asynchronous operations of the
+// server's async manager in the db.
+type AsyncQueueStore struct {
+	db wdb.DB
+	// completed entries older than ttl are removed by Collect
+	ttl time.Duration
+
+	// to stop the garbage collector
+	stop chan<- interface{}
+}
+
+func NewAsyncQueueStore(db wdb.DB, ttl uint32) *AsyncQueueStore {
+	if ttl == 0 {
+		ttl = DEFAULT_ASYNC_QUEUE_TTL
+	}
+	return &AsyncQueueStore{
+		db:  db,
+		ttl: time.Second * time.Duration(ttl),
+	}
+}
+
+func (s *AsyncQueueStore) Save(e *rest.AsyncEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		entry := NewAsyncQueueEntry()
+		entry.Info = *e
+		return entry.Save(tx)
+	})
+}
+
+func (s *AsyncQueueStore) Load(id string) (*rest.AsyncEntry, error) {
+	var e *rest.AsyncEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewAsyncQueueEntryFromId(tx, id)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		e = &entry.Info
+		return nil
+	})
+	return e, err
+}
+
+func (s *AsyncQueueStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		entry, err := NewAsyncQueueEntryFromId(tx, id)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return entry.Delete(tx)
+	})
+}
+
+// Resolve determines the outcome of the operations that were still
+// queued or pending when the server last stopped. It must be run before any
+// new operation is started. An operation whose pending operation
+// entry is gone ran to completion, unless the resource it was to
+// redirect to does not exist. All other operations were
+// interrupted and are marked as failed.
+func (s *AsyncQueueStore) Resolve() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ids, err := AsyncQueueList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			entry, err := NewAsyncQueueEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			switch entry.Info.Status {
+			case rest.AsyncQueued:
+				// never started
+				entry.Info.Status = rest.AsyncFailed
+				entry.Info.Error = asyncInterruptedMsg
+			case rest.AsyncPending:
+				if err := resolveAsyncEntry(tx, &entry.Info); err != nil {
+					return err
+				}
+			default:
+				continue
+			}
+			logger.Info("Resolved interrupted job %v as %v",
+				id, entry.Info.Status)
+			entry.Info.Updated = asyncQueueNow().Unix()
+			if err := entry.Save(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func resolveAsyncEntry(tx *bolt.Tx, e *rest.AsyncEntry) error {
+	e.Status = rest.AsyncFailed
+	e.Error = asyncInterruptedMsg
+	if e.OpId == "" {
+		// not tracked by a pending operation, nothing to go by
+		return nil
+	}
+	_, err := NewPendingOperationEntryFromId(tx, e.OpId)
+	if err == nil {
+		// the pending operation will be rolled back by the cleaner
+		return nil
+	} else if err != ErrNotFound {
+		return err
+	}
+	found, err := asyncResourceExists(tx, e.Location)
+	if err != nil {
+		return err
+	}
+	if found {
+		e.Status = rest.AsyncCompleted
+		e.Error = ""
+	}
+	return nil
+}
+
+// asyncResourceExists returns true if the resource at the given
+// url exists in the db. An empty url always exists, it is used by
+// operations that delete a resource.
+func asyncResourceExists(tx *bolt.Tx, url string) (bool, error) {
+	if url == "" {
+		return true, nil
+	}
+	parts := strings.Split(strings.Trim(url, "/"), "/")
+	if len(parts) != 2 {
+		return false, nil
+	}
+	var entry DbEntry
+	switch parts[0] {
+	case "clusters":
+		entry = NewClusterEntry()
+	case "nodes":
+		entry = NewNodeEntry()
+	case "devices":
+		entry = NewDeviceEntry()
+	case "volumes":
+		entry = NewVolumeEntry()
+	case "blockvolumes":
+		entry = NewBlockVolumeEntry()
+	default:
+		return false, nil
+	}
+	err := EntryLoad(tx, entry, parts[1])
+	if err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Collect removes the entries of operations that completed more than
+// ttl ago and were never queried. Idempotency keys older than ttl
+// are removed as well.
+func (s *AsyncQueueStore) Collect() error {
+	expired := asyncQueueNow().Add(-s.ttl).Unix()
+	removed := 0
+	keys := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		keys, err = collectIdempotencyKeys(tx, expired)
+		if err != nil {
+			return err
+		}
+		ids, err := AsyncQueueList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			entry, err := NewAsyncQueueEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if entry.Info.Status == rest.AsyncPending ||
+				entry.Info.Status == rest.AsyncQueued ||
+				entry.Info.Updated > expired {
+				continue
+			}
+			if err := entry.Delete(tx); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if removed > 0 {
+		logger.Info("Removed %v expired async queue entries", removed)
+	}
+	if keys > 0 {
+		logger.Info("Removed %v expired idempotency keys", keys)
+	}
+	return err
+}
+
+// Start creates a background goroutine that periodically removes
+// expired entries.
+func (s *AsyncQueueStore) Start() {
+	interval := s.ttl / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	stop := make(chan interface{})
+	s.stop = stop
+
+	go func() {
+		logger.Info("Started async queue garbage collector")
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				logger.Info("Stopping async queue garbage collector")
+				return
+			case <-ticker.C:
+				if err := s.Collect(); err != nil {
+					logger.LogError("Async queue garbage collector: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop the background garbage collector. It is safe to call Stop
+// more than once as the app may be closed repeatedly.
+func (s *AsyncQueueStore) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
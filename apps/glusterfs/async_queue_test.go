@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/server/rest"
+)
+
+func TestAsyncQueueStoreSaveLoad(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	s := NewAsyncQueueStore(app.db, 0)
+	tests.Assert(t, s.ttl == DEFAULT_ASYNC_QUEUE_TTL*time.Second,
+		"expected default ttl, got:", s.ttl)
+
+	e, err := s.Load("missing")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	err = s.Save(&rest.AsyncEntry{
+		Id:     "a1",
+		OpId:   "op1",
+		Status: rest.AsyncFailed,
+		Error:  "boom",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	e, err = s.Load("a1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e.OpId == "op1", "expected e.OpId == op1, got:", e.OpId)
+	tests.Assert(t, e.Error == "boom", "expected e.Error == boom, got:", e.Error)
+
+	err = s.Delete("a1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	e, err = s.Load("a1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+
+	// deleting twice is not an error
+	err = s.Delete("a1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestAsyncQueueStoreResolve(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	vol := createSampleReplicaVolumeEntry(1024, 3)
+	pop := NewPendingOperationEntry(NEW_ID)
+	pop.Type = OperationCreateVolume
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		if err := vol.Save(tx); err != nil {
+			return err
+		}
+		return pop.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	s := NewAsyncQueueStore(app.db, 0)
+	entries := []rest.AsyncEntry{
+		// not backed by an operation
+		{Id: "plain", Status: rest.AsyncPending},
+		// operation still pending in the db
+		{Id: "inflight", OpId: pop.Id, Status: rest.AsyncPending,
+			Location: "/volumes/" + vol.Info.Id},
+		// operation done, volume exists
+		{Id: "created", OpId: "gone1", Status: rest.AsyncPending,
+			Location: "/volumes/" + vol.Info.Id},
+		// operation done, volume does not exist
+		{Id: "rolledback", OpId: "gone2", Status: rest.AsyncPending,
+			Location: "/volumes/nope"},
+		// operation done, nothing to redirect to
+		{Id: "deleted", OpId: "gone3", Status: rest.AsyncPending},
+		// already completed before the restart
+		{Id: "failed", Status: rest.AsyncFailed, Error: "boom"},
+	}
+	for i := range entries {
+		err := s.Save(&entries[i])
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	err = s.Resolve()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	expect := map[string]string{
+		"plain":      rest.AsyncFailed,
+		"inflight":   rest.AsyncFailed,
+		"created":    rest.AsyncCompleted,
+		"rolledback": rest.AsyncFailed,
+		"deleted":    rest.AsyncCompleted,
+		"failed":     rest.AsyncFailed,
+	}
+	for id, status := range expect {
+		e, err := s.Load(id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, e.Status == status,
+			"expected status", status, "for", id, "got:", e.Status)
+	}
+
+	e, _ := s.Load("inflight")
+	tests.Assert(t, e.Error == asyncInterruptedMsg,
+		"expected e.Error == asyncInterruptedMsg, got:", e.Error)
+	e, _ = s.Load("created")
+	tests.Assert(t, e.Error == "", "expected e.Error == \"\", got:", e.Error)
+	e, _ = s.Load("failed")
+	tests.Assert(t, e.Error == "boom", "expected e.Error == boom, got:", e.Error)
+}
+
+func TestAsyncQueueStoreCollect(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	now := time.Now()
+	defer func() { asyncQueueNow = time.Now }()
+	asyncQueueNow = func() time.Time { return now }
+
+	s := NewAsyncQueueStore(app.db, 60)
+	old := now.Add(-2 * time.Minute).Unix()
+	for _, e := range []rest.AsyncEntry{
+		{Id: "old", Status: rest.AsyncCompleted, Updated: old},
+		{Id: "oldpending", Status: rest.AsyncPending, Updated: old},
+		{Id: "recent", Status: rest.AsyncFailed, Updated: now.Unix()},
+	} {
+		err := s.Save(&e)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	err := s.Collect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	e, _ := s.Load("old")
+	tests.Assert(t, e == nil, "expected expired entry to be removed")
+	e, _ = s.Load("oldpending")
+	tests.Assert(t, e != nil, "expected pending entry to be kept")
+	e, _ = s.Load("recent")
+	tests.Assert(t, e != nil, "expected recent entry to be kept")
+}
+
+func TestAppResolvesAsyncQueueOnStart(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	s := NewAsyncQueueStore(app.db, 0)
+	err := s.Save(&rest.AsyncEntry{Id: "j1", Status: rest.AsyncPending})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	tests.Assert(t, app.asyncQueue != nil, "expected app.asyncQueue != nil")
+	e, err := app.asyncQueue.Load("j1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e.Status == rest.AsyncFailed,
+		"expected e.Status == AsyncFailed, got:", e.Status)
+}
@@ -73,6 +73,7 @@ func NewBlockVolumeEntryFromRequest(req *api.BlockVolumeCreateRequest) *BlockVol
 	vol.Info.Id = idgen.GenUUID()
 	vol.Info.Size = req.Size
 	vol.Info.Auth = req.Auth
+	vol.Info.Tags = copyTags(req.Tags)
 
 	if req.Name == "" {
 		vol.Info.Name = "blockvol_" + vol.Info.Id
@@ -107,6 +108,18 @@ func (v *BlockVolumeEntry) Visible() bool {
 	return v.Pending.Id == ""
 }
 
+func (v *BlockVolumeEntry) AllTags() map[string]string {
+	if v.Info.Tags == nil {
+		return map[string]string{}
+	}
+	return v.Info.Tags
+}
+
+func (v *BlockVolumeEntry) SetTags(t map[string]string) error {
+	v.Info.Tags = t
+	return nil
+}
+
 func (v *BlockVolumeEntry) Save(tx *bolt.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(v.Info.Id) > 0)
@@ -130,6 +143,7 @@ func (v *BlockVolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.BlockVolumeInfoRes
 	info.Name = v.Info.Name
 	info.Hacount = v.Info.Hacount
 	info.BlockHostingVolume = v.Info.BlockHostingVolume
+	info.Tags = copyTags(v.Info.Tags)
 
 	// Handle block volumes which where created
 	// before introducing UsableSize flag in the db
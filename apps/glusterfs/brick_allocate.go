@@ -377,11 +377,17 @@ type VolumePlacementOpts struct {
 	v            *VolumeEntry
 	brickSize    uint64
 	numBrickSets int
+	// default average file size of the cluster, if any
+	clusterAverageFileSize uint64
 }
 
 func NewVolumePlacementOpts(v *VolumeEntry,
 	brickSize uint64, numBrickSets int) *VolumePlacementOpts {
-	return &VolumePlacementOpts{v, brickSize, numBrickSets}
+	return &VolumePlacementOpts{
+		v:            v,
+		brickSize:    brickSize,
+		numBrickSets: numBrickSets,
+	}
 }
 
 func (vp *VolumePlacementOpts) BrickSizes() (uint64, float64) {
@@ -405,7 +411,18 @@ func (vp *VolumePlacementOpts) SetCount() int {
 }
 
 func (vp *VolumePlacementOpts) AverageFileSize() uint64 {
-	return vp.v.GetAverageFileSize()
+	if size, ok := vp.v.averageFileSizeOption(); ok {
+		return size
+	}
+	if vp.clusterAverageFileSize != 0 {
+		return vp.clusterAverageFileSize
+	}
+	return averageFileSize
+}
+
+func (vp *VolumePlacementOpts) AverageFileSizeIsDefault() bool {
+	_, ok := vp.v.averageFileSizeOption()
+	return !ok
 }
 
 type StandardBrickPlacer struct{}
@@ -494,6 +511,20 @@ func (bp *StandardBrickPlacer) Replace(
 	}
 	newBrickEntry.SetId(brickId)
 
+	err = replaceInSets(dsrc, r, bs, index, newBrickEntry, newDeviceEntry)
+	return r, err
+}
+
+// replaceInSets fills the single pair of sets of the brick allocation
+// r with the bricks of bs, and their devices, except for the brick at
+// index that is replaced by the new brick and device.
+func replaceInSets(dsrc DeviceSource,
+	r *BrickAllocation,
+	bs *BrickSet,
+	index int,
+	newBrickEntry *BrickEntry,
+	newDeviceEntry *DeviceEntry) error {
+
 	// if this all seems like an awful lot of boilerplate
 	// and busy work, consider that in real gluster the positions
 	// of the bricks w/in the brickset are meaningful and
@@ -509,7 +540,7 @@ func (bp *StandardBrickPlacer) Replace(
 			newBricks[i] = bs.Bricks[i]
 			d, err := dsrc.Device(bs.Bricks[i].Info.DeviceId)
 			if err != nil {
-				return r, err
+				return err
 			}
 			newDevices[i] = d
 		}
@@ -519,5 +550,5 @@ func (bp *StandardBrickPlacer) Replace(
 
 	godbc.Require(r.BrickSets[0].Full())
 	godbc.Require(r.DeviceSets[0].Full())
-	return r, nil
+	return nil
 }
@@ -450,6 +450,10 @@ func (b *BrickEntry) consistencyCheck(db Db) (response DbEntryCheckResponse) {
 	} else {
 		if !sortedstrings.Has(volumeEntry.Bricks, b.Info.Id) {
 			response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Brick %v no link back to brick from volume %v", b.Info.Id, b.Info.VolumeId))
+			response.Issues = append(response.Issues, newDbIssue(DbIssueVolumeMissingBricks,
+				"volume", b.Info.VolumeId, b.Info.Id,
+				fmt.Sprintf("Volume %v does not list its brick %v", b.Info.VolumeId, b.Info.Id),
+				"Add the brick to the bricks of the volume"))
 		}
 	}
 
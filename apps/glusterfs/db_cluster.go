@@ -0,0 +1,350 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/pkg/db/store"
+)
+
+// dbDumpCluster returns the entries of one cluster: the cluster, its
+// nodes, devices, bricks, volumes and block volumes, and the pending
+// operations changing any of them. The dbattribute entries of the db
+// are included so that the dump is a db of its own.
+func dbDumpCluster(db wdb.DB, clusterId string) (Db, error) {
+	dump, err := dbDumpInternal(db)
+	if err != nil {
+		return Db{}, err
+	}
+	return filterDbCluster(dump, clusterId)
+}
+
+func filterDbCluster(dump Db, clusterId string) (Db, error) {
+	cluster, ok := dump.Clusters[clusterId]
+	if !ok {
+		return Db{}, ErrNotFound
+	}
+	part := Db{
+		Clusters:          map[string]ClusterEntry{clusterId: cluster},
+		Volumes:           map[string]VolumeEntry{},
+		Bricks:            map[string]BrickEntry{},
+		Nodes:             map[string]NodeEntry{},
+		Devices:           map[string]DeviceEntry{},
+		BlockVolumes:      map[string]BlockVolumeEntry{},
+		DbAttributes:      dump.DbAttributes,
+		PendingOperations: map[string]PendingOperationEntry{},
+	}
+	ids := map[string]bool{clusterId: true}
+
+	for id, node := range dump.Nodes {
+		if node.Info.ClusterId == clusterId {
+			part.Nodes[id] = node
+			ids[id] = true
+		}
+	}
+	for id, device := range dump.Devices {
+		if _, ok := part.Nodes[device.NodeId]; ok {
+			part.Devices[id] = device
+			ids[id] = true
+		}
+	}
+	for id, volume := range dump.Volumes {
+		if volume.Info.Cluster == clusterId {
+			part.Volumes[id] = volume
+			ids[id] = true
+		}
+	}
+	for id, brick := range dump.Bricks {
+		_, onDevice := part.Devices[brick.Info.DeviceId]
+		_, ofVolume := part.Volumes[brick.Info.VolumeId]
+		if onDevice || ofVolume {
+			part.Bricks[id] = brick
+			ids[id] = true
+		}
+	}
+	for id, bv := range dump.BlockVolumes {
+		if bv.Info.Cluster == clusterId {
+			part.BlockVolumes[id] = bv
+			ids[id] = true
+		}
+	}
+	for id, op := range dump.PendingOperations {
+		for _, a := range op.Actions {
+			if ids[a.Id] {
+				part.PendingOperations[id] = op
+				break
+			}
+		}
+	}
+	return part, nil
+}
+
+// DbDumpCluster writes the JSON dump of one cluster of the db, to be
+// merged into another db with DbMerge. If remove is set, the entries
+// of the cluster are then removed from the db.
+func DbDumpCluster(jsonfile, dbfile, clusterId string, remove bool) error {
+	db, err := OpenDB(dbfile, !remove)
+	if err != nil {
+		return fmt.Errorf("Unable to open database: %v", err)
+	}
+	defer db.Close()
+
+	dump, err := dbDumpCluster(db, clusterId)
+	if err == ErrNotFound {
+		return fmt.Errorf("Cluster %v not found in db", clusterId)
+	} else if err != nil {
+		return err
+	}
+
+	var fp *os.File
+	if jsonfile == "-" {
+		fp = os.Stdout
+	} else {
+		fp, err = os.OpenFile(jsonfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("Could not create json file: %v", err.Error())
+		}
+		defer fp.Close()
+	}
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(dump); err != nil {
+		return fmt.Errorf("Could not encode dump as JSON: %v", err.Error())
+	}
+	if fp != os.Stdout {
+		if err := fp.Sync(); err != nil {
+			return fmt.Errorf("Could not write json file: %v", err.Error())
+		}
+	}
+
+	if remove {
+		err = db.Update(func(tx *bolt.Tx) error {
+			return removeDbEntries(tx, &dump)
+		})
+		if err != nil {
+			return fmt.Errorf("Could not remove cluster from db: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeDbEntries deletes the entries of a dump from the db, along
+// with the hostname registrations of its nodes.
+func removeDbEntries(tx *bolt.Tx, dump *Db) error {
+	for _, node := range dump.Nodes {
+		if err := node.Deregister(tx); err != nil {
+			return err
+		}
+	}
+	for _, b := range dumpBuckets(dump) {
+		for _, id := range b.ids {
+			if err := store.Record(tx, b.bucket, id); err != nil {
+				return err
+			}
+			if err := tx.Bucket([]byte(b.bucket)).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+	}
+	for id := range dump.Volumes {
+		if err := unindexAntiAffinity(tx, id); err != nil {
+			return err
+		}
+	}
+	// always record a new generation id as the db contents were no
+	// longer fully under heketi's control
+	return recordNewDBGenerationID(tx)
+}
+
+type dumpBucket struct {
+	bucket string
+	kind   string
+	ids    []string
+}
+
+// dumpBuckets lists the ids of the entries of a dump by bucket,
+// except the dbattribute entries.
+func dumpBuckets(dump *Db) []dumpBucket {
+	clusters := dumpBucket{bucket: BOLTDB_BUCKET_CLUSTER, kind: "cluster"}
+	for id := range dump.Clusters {
+		clusters.ids = append(clusters.ids, id)
+	}
+	nodes := dumpBucket{bucket: BOLTDB_BUCKET_NODE, kind: "node"}
+	for id := range dump.Nodes {
+		nodes.ids = append(nodes.ids, id)
+	}
+	devices := dumpBucket{bucket: BOLTDB_BUCKET_DEVICE, kind: "device"}
+	for id := range dump.Devices {
+		devices.ids = append(devices.ids, id)
+	}
+	bricks := dumpBucket{bucket: BOLTDB_BUCKET_BRICK, kind: "brick"}
+	for id := range dump.Bricks {
+		bricks.ids = append(bricks.ids, id)
+	}
+	volumes := dumpBucket{bucket: BOLTDB_BUCKET_VOLUME, kind: "volume"}
+	for id := range dump.Volumes {
+		volumes.ids = append(volumes.ids, id)
+	}
+	blockvolumes := dumpBucket{bucket: BOLTDB_BUCKET_BLOCKVOLUME, kind: "block volume"}
+	for id := range dump.BlockVolumes {
+		blockvolumes.ids = append(blockvolumes.ids, id)
+	}
+	pendingops := dumpBucket{bucket: BOLTDB_BUCKET_PENDING_OPS, kind: "pending operation"}
+	for id := range dump.PendingOperations {
+		pendingops.ids = append(pendingops.ids, id)
+	}
+
+	buckets := []dumpBucket{clusters, nodes, devices, bricks, volumes,
+		blockvolumes, pendingops}
+	for _, b := range buckets {
+		sort.Strings(b.ids)
+	}
+	return buckets
+}
+
+// checkDumpReferences returns an error if an entry of the dump
+// refers to an entry that is not part of the dump.
+func checkDumpReferences(dump *Db) error {
+	missing := []string{}
+	for id, node := range dump.Nodes {
+		if _, ok := dump.Clusters[node.Info.ClusterId]; !ok {
+			missing = append(missing, fmt.Sprintf("cluster %v of node %v", node.Info.ClusterId, id))
+		}
+	}
+	for id, device := range dump.Devices {
+		if _, ok := dump.Nodes[device.NodeId]; !ok {
+			missing = append(missing, fmt.Sprintf("node %v of device %v", device.NodeId, id))
+		}
+	}
+	for id, brick := range dump.Bricks {
+		if _, ok := dump.Devices[brick.Info.DeviceId]; !ok {
+			missing = append(missing, fmt.Sprintf("device %v of brick %v", brick.Info.DeviceId, id))
+		}
+		if _, ok := dump.Volumes[brick.Info.VolumeId]; !ok {
+			missing = append(missing, fmt.Sprintf("volume %v of brick %v", brick.Info.VolumeId, id))
+		}
+	}
+	for id, volume := range dump.Volumes {
+		if _, ok := dump.Clusters[volume.Info.Cluster]; !ok {
+			missing = append(missing, fmt.Sprintf("cluster %v of volume %v", volume.Info.Cluster, id))
+		}
+	}
+	for id, bv := range dump.BlockVolumes {
+		if _, ok := dump.Clusters[bv.Info.Cluster]; !ok {
+			missing = append(missing, fmt.Sprintf("cluster %v of block volume %v", bv.Info.Cluster, id))
+		}
+		if _, ok := dump.Volumes[bv.Info.BlockHostingVolume]; !ok {
+			missing = append(missing, fmt.Sprintf("volume %v of block volume %v", bv.Info.BlockHostingVolume, id))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("dump is not self-contained, missing: %v",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// dbMergeInternal adds the entries of a dump to the db. It fails
+// without changing the db if an id of the dump is already used by
+// the db, or if a hostname of a node is already used by a node of
+// the db.
+func dbMergeInternal(tx *bolt.Tx, dump *Db) error {
+	if len(dump.Clusters) == 0 {
+		return fmt.Errorf("dump has no clusters")
+	}
+	attrs := map[string]string{}
+	for key, entry := range dump.DbAttributes {
+		attrs[key] = entry.Value
+	}
+	if err := CheckDbAttributes(attrs); err != nil {
+		return fmt.Errorf("dump can not be merged: %v", err)
+	}
+	if err := checkDumpReferences(dump); err != nil {
+		return err
+	}
+
+	conflicts := []string{}
+	for _, b := range dumpBuckets(dump) {
+		bucket := tx.Bucket([]byte(b.bucket))
+		if bucket == nil {
+			return fmt.Errorf("db has no %v bucket", b.bucket)
+		}
+		for _, id := range b.ids {
+			if bucket.Get([]byte(id)) != nil {
+				conflicts = append(conflicts, b.kind+" "+id)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("ids of the dump already used in the db: %v",
+			strings.Join(conflicts, ", "))
+	}
+
+	if err := saveDbEntries(tx, dump); err != nil {
+		return err
+	}
+	for _, node := range dump.Nodes {
+		if err := node.Register(tx); err != nil {
+			return err
+		}
+	}
+	if len(dump.PendingOperations) > 0 {
+		if err := PendingOperationUpgrade(tx); err != nil {
+			return err
+		}
+	}
+	// always record a new generation id on db import as the db contents
+	// were no longer fully under heketi's control
+	return recordNewDBGenerationID(tx)
+}
+
+// DbMerge adds the clusters of a JSON dump, such as one written by
+// DbDumpCluster, to an existing db file.
+func DbMerge(jsonfile string, dbfile string) error {
+	var dump Db
+
+	fp, err := os.Open(jsonfile)
+	if err != nil {
+		return fmt.Errorf("Could not open input file: %v", err.Error())
+	}
+	defer fp.Close()
+
+	if err = json.NewDecoder(fp).Decode(&dump); err != nil {
+		return fmt.Errorf("Could not decode input file as JSON: %v", err.Error())
+	}
+
+	// Merging needs a db of this version of heketi
+	if _, err := os.Stat(dbfile); err != nil {
+		return fmt.Errorf("unable to stat path given for dbfile: %v", err)
+	}
+	db, err := OpenDB(dbfile, false)
+	if err != nil {
+		return fmt.Errorf("Could not open db file: %v", err.Error())
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := checkDbSchemaVersion(tx); err != nil {
+			return err
+		}
+		if err := initializeBuckets(tx); err != nil {
+			return err
+		}
+		return dbMergeInternal(tx, &dump)
+	})
+}
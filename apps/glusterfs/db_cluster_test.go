@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/idgen"
+)
+
+func testDbFileCheck(t *testing.T, dbfile string) (DbCheckResponse, []string) {
+	db, err := OpenDB(dbfile, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+	check, err := dbCheckConsistency(db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	var clusters []string
+	db.View(func(tx *bolt.Tx) error {
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return check, clusters
+}
+
+func TestDbDumpClusterAndMerge(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	otherfile := tests.Tempfile()
+	defer os.Remove(otherfile)
+	jsonfile := tests.Tempfile()
+	defer os.Remove(jsonfile)
+
+	app := NewTestApp(dbfile)
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	app.db.View(func(tx *bolt.Tx) error {
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil && len(clusters) == 2, "got:", clusters, err)
+	for _, c := range clusters {
+		for i := 0; i < 2; i++ {
+			v := createSampleReplicaVolumeEntry(100, 3)
+			v.Info.Clusters = []string{c}
+			err = v.Create(app.db, app.executor)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+	}
+	moved := clusters[0]
+	app.Close()
+
+	// an empty db of another server
+	app = NewTestApp(otherfile)
+	app.Close()
+
+	err = DbDumpCluster(jsonfile, dbfile, "missing", false)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not found"),
+		"expected not found error, got:", err)
+
+	err = DbDumpCluster(jsonfile, dbfile, moved, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var dump Db
+	fp, err := os.Open(jsonfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = json.NewDecoder(fp).Decode(&dump)
+	fp.Close()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(dump.Clusters) == 1, "got:", len(dump.Clusters))
+	tests.Assert(t, len(dump.Nodes) == 3, "got:", len(dump.Nodes))
+	tests.Assert(t, len(dump.Devices) == 6, "got:", len(dump.Devices))
+	tests.Assert(t, len(dump.Volumes) == 2, "got:", len(dump.Volumes))
+	tests.Assert(t, len(dump.Bricks) == 6, "got:", len(dump.Bricks))
+	for _, v := range dump.Volumes {
+		tests.Assert(t, v.Info.Cluster == moved, "got:", v.Info.Cluster)
+	}
+	tests.Assert(t, checkDumpReferences(&dump) == nil)
+
+	// the cluster is gone from the source db, which is consistent
+	check, left := testDbFileCheck(t, dbfile)
+	tests.Assert(t, len(left) == 1 && left[0] != moved, "got:", left)
+	tests.Assert(t, check.TotalInconsistencies == 0, "got:", check)
+
+	err = DbMerge(jsonfile, otherfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	check, merged := testDbFileCheck(t, otherfile)
+	tests.Assert(t, len(merged) == 1 && merged[0] == moved, "got:", merged)
+	tests.Assert(t, check.TotalInconsistencies == 0, "got:", check)
+	tests.Assert(t, check.Volumes.Total == 2, "got:", check.Volumes)
+
+	// the merged db is usable
+	app = NewTestApp(otherfile)
+	v := createSampleReplicaVolumeEntry(100, 3)
+	err = v.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// merging twice conflicts and changes nothing
+	err = DbMerge(jsonfile, otherfile)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "cluster "+moved),
+		"expected id conflict error, got:", err)
+	check, _ = testDbFileCheck(t, otherfile)
+	tests.Assert(t, check.Volumes.Total == 3, "got:", check.Volumes)
+}
+
+func TestDbMergeHostnameConflict(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	jsonfile := tests.Tempfile()
+	defer os.Remove(jsonfile)
+
+	app := NewTestApp(dbfile)
+	err := setupSampleDbWithTopology(app, 1, 2, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	dump, err := dbDumpInternal(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	// the sample nodes do not register their hostnames
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		for _, n := range dump.Nodes {
+			if err := n.Register(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// the same nodes under new ids
+	dup := Db{
+		Clusters:     map[string]ClusterEntry{},
+		Nodes:        map[string]NodeEntry{},
+		DbAttributes: dump.DbAttributes,
+	}
+	for _, c := range dump.Clusters {
+		c.Info.Id = idgen.GenUUID()
+		c.Info.Nodes = nil
+		c.Info.Volumes = nil
+		dup.Clusters[c.Info.Id] = c
+		for _, n := range dump.Nodes {
+			n.Info.Id = idgen.GenUUID()
+			n.Info.ClusterId = c.Info.Id
+			n.Devices = nil
+			dup.Nodes[n.Info.Id] = n
+		}
+	}
+	fp, err := os.Create(jsonfile)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	json.NewEncoder(fp).Encode(dup)
+	fp.Close()
+
+	err = DbMerge(jsonfile, dbfile)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "already used"),
+		"expected hostname conflict, got:", err)
+	_, clusters := testDbFileCheck(t, dbfile)
+	tests.Assert(t, len(clusters) == 1, "got:", clusters)
+}
+
+func TestFilterDbClusterPendingOps(t *testing.T) {
+	dump := Db{
+		Clusters: map[string]ClusterEntry{
+			"c1": {Info: api.ClusterInfoResponse{Id: "c1"}},
+			"c2": {Info: api.ClusterInfoResponse{Id: "c2"}},
+		},
+		Volumes:           map[string]VolumeEntry{},
+		PendingOperations: map[string]PendingOperationEntry{},
+	}
+	v1 := VolumeEntry{}
+	v1.Info.Id = "v1"
+	v1.Info.Cluster = "c1"
+	dump.Volumes["v1"] = v1
+	op1 := NewPendingOperationEntry("op1")
+	op1.Actions = []PendingOperationAction{{Change: OpAddVolume, Id: "v1"}}
+	op2 := NewPendingOperationEntry("op2")
+	op2.Actions = []PendingOperationAction{{Change: OpAddVolume, Id: "v2"}}
+	dump.PendingOperations["op1"] = *op1
+	dump.PendingOperations["op2"] = *op2
+
+	part, err := filterDbCluster(dump, "c1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(part.Volumes) == 1, "got:", part.Volumes)
+	_, ok := part.PendingOperations["op1"]
+	tests.Assert(t, ok && len(part.PendingOperations) == 1,
+		"expected op1 only, got:", part.PendingOperations)
+
+	_, err = filterDbCluster(dump, "c3")
+	tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+}
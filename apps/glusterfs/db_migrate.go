@@ -0,0 +1,292 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	DB_SCHEMA_VERSION = "DB_SCHEMA_VERSION"
+
+	// DbSchemaLegacy is the schema version of dbs written by versions
+	// of heketi without schema versioning. These dbs carry no schema
+	// version entry.
+	DbSchemaLegacy = 1
+)
+
+// dbMigration changes the schema of the db from the previous version
+// to version. Schema changes that can not be undone have no down
+// function. The entries of the data bucket, created by the users, are
+// only dropped by the down function if the migration is forced.
+type dbMigration struct {
+	version     int
+	description string
+	up          func(tx *bolt.Tx) error
+	down        func(tx *bolt.Tx) error
+	data        string
+}
+
+// dbMigrations lists the schema changes since schema versioning, in
+// order. New schema changes are appended with the next version.
+var dbMigrations = []dbMigration{
+	{
+		version:     2,
+		description: "persisted async operation queue",
+		up:          createBucket(BOLTDB_BUCKET_ASYNC_QUEUE),
+		down:        deleteBucket(BOLTDB_BUCKET_ASYNC_QUEUE),
+	},
+	{
+		version:     3,
+		description: "idempotency keys of create requests",
+		up:          createBucket(BOLTDB_BUCKET_IDEMPOTENCY_KEYS),
+		down:        deleteBucket(BOLTDB_BUCKET_IDEMPOTENCY_KEYS),
+	},
+	{
+		version:     4,
+		description: "placement profiles",
+		up:          createBucket(BOLTDB_BUCKET_PROFILE),
+		down:        deleteBucket(BOLTDB_BUCKET_PROFILE),
+		data:        BOLTDB_BUCKET_PROFILE,
+	},
+	{
+		version:     5,
+		description: "index of the volumes with anti-affinity rules",
+		up:          rebuildAntiAffinityIndex,
+		down:        deleteBucket(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY),
+	},
+}
+
+// DbSchemaVersion is the schema version of the dbs written by this
+// version of heketi.
+var DbSchemaVersion = dbMigrations[len(dbMigrations)-1].version
+
+// DbSchemaInfo describes a schema version for the migrate command.
+type DbSchemaInfo struct {
+	Version     int
+	Description string
+	// the db can be migrated down from this version
+	Reversible bool
+}
+
+// DbSchemaVersions returns the schema versions known to this version
+// of heketi, oldest first.
+func DbSchemaVersions() []DbSchemaInfo {
+	versions := []DbSchemaInfo{{
+		Version:     DbSchemaLegacy,
+		Description: "schema of heketi versions without schema versioning",
+	}}
+	for _, m := range dbMigrations {
+		versions = append(versions, DbSchemaInfo{
+			Version:     m.version,
+			Description: m.description,
+			Reversible:  m.down != nil,
+		})
+	}
+	return versions
+}
+
+// minDbSchemaVersion returns the oldest schema version a db of the
+// current schema version can be migrated down to.
+func minDbSchemaVersion() int {
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		if dbMigrations[i].down == nil {
+			return dbMigrations[i].version
+		}
+	}
+	return DbSchemaLegacy
+}
+
+func createBucket(name string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		return err
+	}
+}
+
+func deleteBucket(name string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(name))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	}
+}
+
+// dbSchemaVersion returns the schema version of the db.
+func dbSchemaVersion(tx *bolt.Tx) (int, error) {
+	if tx.Bucket([]byte(BOLTDB_BUCKET_DBATTRIBUTE)) == nil {
+		return DbSchemaLegacy, nil
+	}
+	entry, err := NewDbAttributeEntryFromKey(tx, DB_SCHEMA_VERSION)
+	if err == ErrNotFound {
+		return DbSchemaLegacy, nil
+	} else if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(entry.Value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid db schema version %#v", entry.Value)
+	}
+	return v, nil
+}
+
+// setDbSchemaVersion records the schema version of the db. Legacy
+// dbs carry no version so that older versions of heketi accept them.
+func setDbSchemaVersion(tx *bolt.Tx, version int) error {
+	entry := NewDbAttributeEntry()
+	entry.Key = DB_SCHEMA_VERSION
+	if version == DbSchemaLegacy {
+		if _, err := NewDbAttributeEntryFromKey(tx, DB_SCHEMA_VERSION); err == ErrNotFound {
+			return nil
+		}
+		return entry.Delete(tx)
+	}
+	entry.Value = strconv.Itoa(version)
+	return entry.Save(tx)
+}
+
+// checkDbSchemaVersion returns an error if the db was written by a
+// newer version of heketi, with a schema this version does not know.
+func checkDbSchemaVersion(tx *bolt.Tx) error {
+	v, err := dbSchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if v > DbSchemaVersion {
+		return fmt.Errorf("The db schema version %v is newer than the schema "+
+			"version %v of this version of heketi. Run a newer version of "+
+			"heketi, or migrate the db with `heketi db migrate --to %v` of "+
+			"the version of heketi that wrote it.",
+			v, DbSchemaVersion, DbSchemaVersion)
+	}
+	return nil
+}
+
+// MigrateDbSchema migrates the db up or down to the given schema
+// version, one version at a time. Migrating down refuses to drop the
+// entries created by the users, such as placement profiles, unless
+// force is set.
+func MigrateDbSchema(tx *bolt.Tx, to int, force bool) error {
+	from, err := dbSchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if to > DbSchemaVersion {
+		return fmt.Errorf("schema version %v is newer than the schema version %v of this version of heketi",
+			to, DbSchemaVersion)
+	}
+	if from > DbSchemaVersion {
+		return checkDbSchemaVersion(tx)
+	}
+	if to < from && to < minDbSchemaVersion() {
+		return fmt.Errorf("the db can not be migrated down to schema version %v, "+
+			"the oldest schema version reachable is %v", to, minDbSchemaVersion())
+	}
+	if to < DbSchemaLegacy {
+		return fmt.Errorf("invalid schema version %v", to)
+	}
+
+	for _, m := range dbMigrations {
+		if m.version > from && m.version <= to {
+			logger.Info("Migrating db up to schema version %v: %v",
+				m.version, m.description)
+			if err := m.up(tx); err != nil {
+				return fmt.Errorf("migration to schema version %v failed: %v",
+					m.version, err)
+			}
+		}
+	}
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		m := dbMigrations[i]
+		if m.version <= from && m.version > to && m.data != "" && !force {
+			if n := bucketEntries(tx, m.data); n > 0 {
+				return fmt.Errorf("migrating down from schema version %v "+
+					"drops the %v entries of the %v bucket (%v), "+
+					"force the migration to drop them",
+					m.version, n, m.data, m.description)
+			}
+		}
+	}
+	for i := len(dbMigrations) - 1; i >= 0; i-- {
+		m := dbMigrations[i]
+		if m.version <= from && m.version > to {
+			logger.Info("Migrating db down from schema version %v: %v",
+				m.version, m.description)
+			if err := m.down(tx); err != nil {
+				return fmt.Errorf("migration from schema version %v failed: %v",
+					m.version, err)
+			}
+		}
+	}
+	if from == to {
+		return nil
+	}
+	return setDbSchemaVersion(tx, to)
+}
+
+// bucketEntries returns the number of entries of the bucket.
+func bucketEntries(tx *bolt.Tx, name string) int {
+	b := tx.Bucket([]byte(name))
+	if b == nil {
+		return 0
+	}
+	return b.Stats().KeyN
+}
+
+// MigrateDbFile writes a copy of the db at infile to outfile,
+// migrated to the given schema version. The db at infile is not
+// changed, it keeps any entries dropped by a forced migration. It
+// returns the schema version of the db at infile.
+func MigrateDbFile(infile, outfile string, to int, force bool) (int, error) {
+	if _, err := os.Stat(outfile); err == nil {
+		return 0, fmt.Errorf("%v file already exists", outfile)
+	} else if !os.IsNotExist(err) {
+		return 0, fmt.Errorf("unable to stat path given for output db: %v", err)
+	}
+
+	indb, err := OpenDB(infile, true)
+	if err != nil {
+		return 0, fmt.Errorf("Could not open db file: %v", err)
+	}
+	err = indb.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(outfile, 0600)
+	})
+	indb.Close()
+	if err != nil {
+		os.Remove(outfile)
+		return 0, fmt.Errorf("Could not copy db file: %v", err)
+	}
+
+	outdb, err := OpenDB(outfile, false)
+	if err != nil {
+		os.Remove(outfile)
+		return 0, fmt.Errorf("Could not open output db file: %v", err)
+	}
+	var from int
+	err = outdb.Update(func(tx *bolt.Tx) error {
+		from, err = dbSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		return MigrateDbSchema(tx, to, force)
+	})
+	outdb.Close()
+	if err != nil {
+		os.Remove(outfile)
+		return from, err
+	}
+	return from, nil
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func testDbSchema(t *testing.T, dbfile string) (int, map[string]bool) {
+	db, err := OpenDB(dbfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer db.Close()
+
+	var version int
+	buckets := map[string]bool{}
+	db.View(func(tx *bolt.Tx) error {
+		version, err = dbSchemaVersion(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets[string(name)] = true
+			return nil
+		})
+	})
+	return version, buckets
+}
+
+func TestDbSchemaVersionNewDb(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := NewTestApp(dbfile)
+	app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewDbAttributeEntryFromKey(tx, DB_SCHEMA_VERSION)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, entry.Value == strconv.Itoa(DbSchemaVersion),
+			"expected current schema version, got:", entry.Value)
+		return nil
+	})
+	app.Close()
+}
+
+func TestMigrateDbFile(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	legacyfile := tests.Tempfile()
+	defer os.Remove(legacyfile)
+	upfile := tests.Tempfile()
+	defer os.Remove(upfile)
+
+	app := NewTestApp(dbfile)
+	app.Close()
+
+	// down to the legacy schema
+	from, err := MigrateDbFile(dbfile, legacyfile, DbSchemaLegacy, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, from == DbSchemaVersion, "expected from current version, got:", from)
+
+	version, buckets := testDbSchema(t, legacyfile)
+	tests.Assert(t, version == DbSchemaLegacy, "expected legacy version, got:", version)
+	tests.Assert(t, !buckets[BOLTDB_BUCKET_ASYNC_QUEUE], "expected no async queue bucket")
+	tests.Assert(t, !buckets[BOLTDB_BUCKET_IDEMPOTENCY_KEYS], "expected no idempotency bucket")
+	tests.Assert(t, !buckets[BOLTDB_BUCKET_PROFILE], "expected no profile bucket")
+	tests.Assert(t, buckets[BOLTDB_BUCKET_VOLUME], "expected volume bucket kept")
+	db, err := OpenDB(legacyfile, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	db.View(func(tx *bolt.Tx) error {
+		_, err := NewDbAttributeEntryFromKey(tx, DB_SCHEMA_VERSION)
+		tests.Assert(t, err == ErrNotFound,
+			"expected no schema version on legacy db, got:", err)
+		return nil
+	})
+	db.Close()
+
+	// the source db is not changed
+	version, buckets = testDbSchema(t, dbfile)
+	tests.Assert(t, version == DbSchemaVersion, "expected current version, got:", version)
+	tests.Assert(t, buckets[BOLTDB_BUCKET_ASYNC_QUEUE], "expected async queue bucket")
+
+	// and back up
+	from, err = MigrateDbFile(legacyfile, upfile, DbSchemaVersion, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, from == DbSchemaLegacy, "expected from legacy version, got:", from)
+	version, buckets = testDbSchema(t, upfile)
+	tests.Assert(t, version == DbSchemaVersion, "expected current version, got:", version)
+	tests.Assert(t, buckets[BOLTDB_BUCKET_ASYNC_QUEUE], "expected async queue bucket")
+	tests.Assert(t, buckets[BOLTDB_BUCKET_IDEMPOTENCY_KEYS], "expected idempotency bucket")
+	tests.Assert(t, buckets[BOLTDB_BUCKET_PROFILE], "expected profile bucket")
+
+	// existing files are not overwritten
+	_, err = MigrateDbFile(dbfile, upfile, DbSchemaLegacy, false)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "already exists"),
+		"expected file exists error, got:", err)
+
+	// unknown versions are refused
+	os.Remove(upfile)
+	_, err = MigrateDbFile(dbfile, upfile, DbSchemaVersion+1, false)
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = os.Stat(upfile)
+	tests.Assert(t, os.IsNotExist(err), "expected no output file, got:", err)
+}
+
+func TestMigrateDbFileKeepsProfiles(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	downfile := tests.Tempfile()
+	defer os.Remove(downfile)
+
+	app := NewTestApp(dbfile)
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		p := NewProfileEntryFromRequest(&api.PlacementProfile{Name: "fast"})
+		return p.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	// dropping the profiles must be forced
+	_, err = MigrateDbFile(dbfile, downfile, 3, false)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "force"),
+		"expected refused migration, got:", err)
+	_, err = os.Stat(downfile)
+	tests.Assert(t, os.IsNotExist(err), "expected no output file, got:", err)
+
+	// above the profile schema they are kept
+	_, err = MigrateDbFile(dbfile, downfile, 4, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, buckets := testDbSchema(t, downfile)
+	tests.Assert(t, buckets[BOLTDB_BUCKET_PROFILE], "expected profile bucket")
+	os.Remove(downfile)
+
+	_, err = MigrateDbFile(dbfile, downfile, 3, true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	version, buckets := testDbSchema(t, downfile)
+	tests.Assert(t, version == 3, "expected version 3, got:", version)
+	tests.Assert(t, !buckets[BOLTDB_BUCKET_PROFILE], "expected no profile bucket")
+
+	// the source db keeps them
+	_, buckets = testDbSchema(t, dbfile)
+	tests.Assert(t, buckets[BOLTDB_BUCKET_PROFILE], "expected profile bucket")
+}
+
+func TestAppRefusesNewerDb(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := NewTestApp(dbfile)
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		return setDbSchemaVersion(tx, DbSchemaVersion+1)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.Close()
+
+	_, err = NewApp(&GlusterFSConfig{DBfile: dbfile, Executor: "mock"})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "is newer than"),
+		"expected newer db error, got:", err)
+
+	_, err = NewApp(&GlusterFSConfig{DBfile: dbfile, Executor: "mock", DBReadOnly: true})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "is newer than"),
+		"expected newer db error, got:", err)
+
+	err = CheckDbAttributes(map[string]string{
+		DB_SCHEMA_VERSION: strconv.Itoa(DbSchemaVersion + 1),
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
@@ -21,6 +21,20 @@ import (
 )
 
 func dbDumpInternal(db wdb.DB) (Db, error) {
+	var dump Db
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		dump, err = dbDumpTx(tx)
+		return err
+	})
+	if err != nil {
+		return Db{}, fmt.Errorf("Could not construct dump from DB: %v", err.Error())
+	}
+	return dump, nil
+}
+
+// dbDumpTx returns all entries of the db in a transaction.
+func dbDumpTx(tx *bolt.Tx) (Db, error) {
 	var dump Db
 	clusterEntryList := make(map[string]ClusterEntry, 0)
 	volEntryList := make(map[string]VolumeEntry, 0)
@@ -30,8 +44,9 @@ func dbDumpInternal(db wdb.DB) (Db, error) {
 	blockvolEntryList := make(map[string]BlockVolumeEntry, 0)
 	dbattributeEntryList := make(map[string]DbAttributeEntry, 0)
 	pendingOpEntryList := make(map[string]PendingOperationEntry, 0)
+	profileEntryList := make(map[string]ProfileEntry, 0)
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := func() error {
 
 		logger.Debug("volume bucket")
 
@@ -189,10 +204,26 @@ func dbDumpInternal(db wdb.DB) (Db, error) {
 			}
 		}
 
+		if b := tx.Bucket([]byte(BOLTDB_BUCKET_PROFILE)); b != nil {
+			profiles, err := ProfileList(tx)
+			if err != nil {
+				return err
+			}
+
+			for _, name := range profiles {
+				logger.Debug("adding profile entry %v", name)
+				entry, err := NewProfileEntryFromName(tx, name)
+				if err != nil {
+					return err
+				}
+				profileEntryList[name] = *entry
+			}
+		}
+
 		return nil
-	})
+	}()
 	if err != nil {
-		return Db{}, fmt.Errorf("Could not construct dump from DB: %v", err.Error())
+		return Db{}, err
 	}
 
 	dump.Clusters = clusterEntryList
@@ -203,6 +234,7 @@ func dbDumpInternal(db wdb.DB) (Db, error) {
 	dump.BlockVolumes = blockvolEntryList
 	dump.DbAttributes = dbattributeEntryList
 	dump.PendingOperations = pendingOpEntryList
+	dump.Profiles = profileEntryList
 
 	return dump, nil
 }
@@ -283,67 +315,8 @@ func DbCreate(jsonfile string, dbfile string) error {
 	}
 
 	err = dbhandle.Update(func(tx *bolt.Tx) error {
-		for _, cluster := range dump.Clusters {
-			logger.Debug("adding cluster entry %v", cluster.Info.Id)
-			err := cluster.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save cluster bucket: %v", err.Error())
-			}
-		}
-		for _, volume := range dump.Volumes {
-			logger.Debug("adding volume entry %v", volume.Info.Id)
-			// When serializing to JSON we skipped volume.Durability
-			// Hence, while creating volume entry, we populate it
-			durability := volume.Info.Durability.Type
-			switch {
-
-			case durability == api.DurabilityReplicate:
-				volume.Durability = NewVolumeReplicaDurability(&volume.Info.Durability.Replicate)
-
-			case durability == api.DurabilityEC:
-				volume.Durability = NewVolumeDisperseDurability(&volume.Info.Durability.Disperse)
-
-			case durability == api.DurabilityDistributeOnly || durability == "":
-				volume.Durability = NewNoneDurability()
-
-			default:
-				return fmt.Errorf("Not a known volume durability type: %v", durability)
-			}
-
-			// Set the default values accordingly
-			volume.Durability.SetDurability()
-			err := volume.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save volume bucket: %v", err.Error())
-			}
-		}
-		for _, brick := range dump.Bricks {
-			logger.Debug("adding brick entry %v", brick.Info.Id)
-			err := brick.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save brick bucket: %v", err.Error())
-			}
-		}
-		for _, node := range dump.Nodes {
-			logger.Debug("adding node entry %v", node.Info.Id)
-			err := node.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save node bucket: %v", err.Error())
-			}
-		}
-		for _, device := range dump.Devices {
-			logger.Debug("adding device entry %v", device.Info.Id)
-			err := device.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save device bucket: %v", err.Error())
-			}
-		}
-		for _, blockvolume := range dump.BlockVolumes {
-			logger.Debug("adding blockvolume entry %v", blockvolume.Info.Id)
-			err := blockvolume.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save blockvolume bucket: %v", err.Error())
-			}
+		if err := saveDbEntries(tx, &dump); err != nil {
+			return err
 		}
 		for _, dbattribute := range dump.DbAttributes {
 			logger.Debug("adding dbattribute entry %v", dbattribute.Key)
@@ -352,13 +325,6 @@ func DbCreate(jsonfile string, dbfile string) error {
 				return fmt.Errorf("Could not save dbattribute bucket: %v", err.Error())
 			}
 		}
-		for _, pendingop := range dump.PendingOperations {
-			logger.Debug("adding pending operation entry %v", pendingop.Id)
-			err := pendingop.Save(tx)
-			if err != nil {
-				return fmt.Errorf("Could not save pending operation bucket: %v", err.Error())
-			}
-		}
 		// always record a new generation id on db import as the db contents
 		// were no longer fully under heketi's control
 		logger.Debug("recording new DB generation ID")
@@ -374,6 +340,88 @@ func DbCreate(jsonfile string, dbfile string) error {
 	return nil
 }
 
+// saveDbEntries saves the entries of a dump, except the dbattribute
+// entries, to the db.
+func saveDbEntries(tx *bolt.Tx, dump *Db) error {
+	for _, cluster := range dump.Clusters {
+		logger.Debug("adding cluster entry %v", cluster.Info.Id)
+		err := cluster.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save cluster bucket: %v", err.Error())
+		}
+	}
+	for _, volume := range dump.Volumes {
+		logger.Debug("adding volume entry %v", volume.Info.Id)
+		// When serializing to JSON we skipped volume.Durability
+		// Hence, while creating volume entry, we populate it
+		durability := volume.Info.Durability.Type
+		switch {
+
+		case durability == api.DurabilityReplicate:
+			volume.Durability = NewVolumeReplicaDurability(&volume.Info.Durability.Replicate)
+
+		case durability == api.DurabilityEC:
+			volume.Durability = NewVolumeDisperseDurability(&volume.Info.Durability.Disperse)
+
+		case durability == api.DurabilityDistributeOnly || durability == "":
+			volume.Durability = NewNoneDurability()
+
+		default:
+			return fmt.Errorf("Not a known volume durability type: %v", durability)
+		}
+
+		// Set the default values accordingly
+		volume.Durability.SetDurability()
+		err := volume.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save volume bucket: %v", err.Error())
+		}
+	}
+	for _, brick := range dump.Bricks {
+		logger.Debug("adding brick entry %v", brick.Info.Id)
+		err := brick.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save brick bucket: %v", err.Error())
+		}
+	}
+	for _, node := range dump.Nodes {
+		logger.Debug("adding node entry %v", node.Info.Id)
+		err := node.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save node bucket: %v", err.Error())
+		}
+	}
+	for _, device := range dump.Devices {
+		logger.Debug("adding device entry %v", device.Info.Id)
+		err := device.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save device bucket: %v", err.Error())
+		}
+	}
+	for _, blockvolume := range dump.BlockVolumes {
+		logger.Debug("adding blockvolume entry %v", blockvolume.Info.Id)
+		err := blockvolume.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save blockvolume bucket: %v", err.Error())
+		}
+	}
+	for _, pendingop := range dump.PendingOperations {
+		logger.Debug("adding pending operation entry %v", pendingop.Id)
+		err := pendingop.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save pending operation bucket: %v", err.Error())
+		}
+	}
+	for _, profile := range dump.Profiles {
+		logger.Debug("adding profile entry %v", profile.Info.Name)
+		err := profile.Save(tx)
+		if err != nil {
+			return fmt.Errorf("Could not save profile bucket: %v", err.Error())
+		}
+	}
+	return nil
+}
+
 func DeleteBricksWithEmptyPath(db wdb.DB, all bool, clusterIDs []string, nodeIDs []string, deviceIDs []string) error {
 
 	for _, id := range clusterIDs {
@@ -485,6 +533,12 @@ func dbCheckConsistency(db *bolt.DB) (response DbCheckResponse, err error) {
 		return response, fmt.Errorf("Could not construct dump from DB: %v", err.Error())
 	}
 
+	response = dbCheckDump(dump)
+	return
+}
+
+// dbCheckDump ... checks the entries of a db dump.
+func dbCheckDump(dump Db) (response DbCheckResponse) {
 	response.Volumes = dbCheckVolumes(dump)
 	response.TotalInconsistencies += len(response.Volumes.Inconsistencies)
 	response.Clusters = dbCheckClusters(dump)
@@ -500,6 +554,12 @@ func dbCheckConsistency(db *bolt.DB) (response DbCheckResponse, err error) {
 	response.PendingOperations = dbCheckPendingOps(dump)
 	response.TotalInconsistencies += len(response.PendingOperations.Inconsistencies)
 
+	for _, b := range []DbBucketCheckResponse{
+		response.Volumes, response.Clusters, response.Nodes, response.Devices,
+		response.BlockVolumes, response.Bricks, response.PendingOperations} {
+		response.TotalIssues += len(b.Issues)
+	}
+
 	return
 }
 
@@ -516,6 +576,7 @@ func dbCheckVolumes(dump Db) (volumesCheckResponse DbBucketCheckResponse) {
 
 		if len(volumeCheckResponse.Inconsistencies) > 0 {
 			volumesCheckResponse.Inconsistencies = append(volumesCheckResponse.Inconsistencies, volumeCheckResponse.Inconsistencies...)
+			volumesCheckResponse.Issues = append(volumesCheckResponse.Issues, volumeCheckResponse.Issues...)
 			volumesCheckResponse.NotOk++
 		} else {
 			volumesCheckResponse.Ok++
@@ -535,6 +596,7 @@ func dbCheckClusters(dump Db) (clustersCheckResponse DbBucketCheckResponse) {
 
 		if len(clusterCheckResponse.Inconsistencies) > 0 {
 			clustersCheckResponse.Inconsistencies = append(clustersCheckResponse.Inconsistencies, clusterCheckResponse.Inconsistencies...)
+			clustersCheckResponse.Issues = append(clustersCheckResponse.Issues, clusterCheckResponse.Issues...)
 			clustersCheckResponse.NotOk++
 		} else {
 			clustersCheckResponse.Ok++
@@ -554,6 +616,7 @@ func dbCheckNodes(dump Db) (nodesCheckResponse DbBucketCheckResponse) {
 
 		if len(nodeCheckResponse.Inconsistencies) > 0 {
 			nodesCheckResponse.Inconsistencies = append(nodesCheckResponse.Inconsistencies, nodeCheckResponse.Inconsistencies...)
+			nodesCheckResponse.Issues = append(nodesCheckResponse.Issues, nodeCheckResponse.Issues...)
 			nodesCheckResponse.NotOk++
 		} else {
 			nodesCheckResponse.Ok++
@@ -573,6 +636,7 @@ func dbCheckDevices(dump Db) (devicesCheckResponse DbBucketCheckResponse) {
 
 		if len(deviceCheckResponse.Inconsistencies) > 0 {
 			devicesCheckResponse.Inconsistencies = append(devicesCheckResponse.Inconsistencies, deviceCheckResponse.Inconsistencies...)
+			devicesCheckResponse.Issues = append(devicesCheckResponse.Issues, deviceCheckResponse.Issues...)
 			devicesCheckResponse.NotOk++
 		} else {
 			devicesCheckResponse.Ok++
@@ -593,6 +657,7 @@ func dbCheckBlockVolumes(dump Db) (blockVolumesCheckResponse DbBucketCheckRespon
 		}
 		if len(blockVolumeCheckResponse.Inconsistencies) > 0 {
 			blockVolumesCheckResponse.Inconsistencies = append(blockVolumesCheckResponse.Inconsistencies, blockVolumeCheckResponse.Inconsistencies...)
+			blockVolumesCheckResponse.Issues = append(blockVolumesCheckResponse.Issues, blockVolumeCheckResponse.Issues...)
 			blockVolumesCheckResponse.NotOk++
 		} else {
 			blockVolumesCheckResponse.Ok++
@@ -614,6 +679,7 @@ func dbCheckBricks(dump Db) (bricksCheckResponse DbBucketCheckResponse) {
 
 		if len(brickCheckResponse.Inconsistencies) > 0 {
 			bricksCheckResponse.Inconsistencies = append(bricksCheckResponse.Inconsistencies, brickCheckResponse.Inconsistencies...)
+			bricksCheckResponse.Issues = append(bricksCheckResponse.Issues, brickCheckResponse.Issues...)
 			bricksCheckResponse.NotOk++
 		} else {
 			bricksCheckResponse.Ok++
@@ -632,6 +698,7 @@ func dbCheckPendingOps(dump Db) (pendingOpsCheckResponse DbBucketCheckResponse)
 
 		if len(pendingOpCheckResponse.Inconsistencies) > 0 {
 			pendingOpsCheckResponse.Inconsistencies = append(pendingOpsCheckResponse.Inconsistencies, pendingOpCheckResponse.Inconsistencies...)
+			pendingOpsCheckResponse.Issues = append(pendingOpsCheckResponse.Issues, pendingOpCheckResponse.Issues...)
 			pendingOpsCheckResponse.NotOk++
 		} else {
 			pendingOpsCheckResponse.Ok++
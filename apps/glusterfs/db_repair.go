@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+// dbIssueNotFoundError is returned when issues to repair are not
+// reported by a check of the current db.
+type dbIssueNotFoundError struct {
+	ids []string
+}
+
+func (e *dbIssueNotFoundError) Error() string {
+	return fmt.Sprintf("issues not found in the db: %v", strings.Join(e.ids, ", "))
+}
+
+// dbCheckIssues returns the issues reported by a check of the db,
+// by id.
+func dbCheckIssues(tx *bolt.Tx) (map[string]DbIssue, error) {
+	dump, err := dbDumpTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	check := dbCheckDump(dump)
+	issues := map[string]DbIssue{}
+	for _, b := range []DbBucketCheckResponse{
+		check.Volumes, check.Clusters, check.Nodes, check.Devices,
+		check.BlockVolumes, check.Bricks, check.PendingOperations} {
+		for _, issue := range b.Issues {
+			issues[issue.Id] = issue
+		}
+	}
+	return issues, nil
+}
+
+// dbRepairIssues applies the fixes of the given issues. All of the
+// issues must be reported by a check of the db in the transaction,
+// otherwise nothing is repaired.
+func dbRepairIssues(tx *bolt.Tx, ids []string) ([]string, error) {
+	issues, err := dbCheckIssues(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []DbIssue{}
+	seen := map[string]bool{}
+	missing := []string{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if issue, ok := issues[id]; ok {
+			selected = append(selected, issue)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &dbIssueNotFoundError{missing}
+	}
+
+	repaired := []string{}
+	for _, issue := range selected {
+		if err := repairDbIssue(tx, issue); err != nil {
+			return nil, fmt.Errorf("Unable to repair %v: %v", issue.Id, err)
+		}
+		logger.Info("Repaired db issue %v", issue.Id)
+		repaired = append(repaired, issue.Id)
+	}
+	return repaired, nil
+}
+
+func repairDbIssue(tx *bolt.Tx, issue DbIssue) error {
+	switch issue.Type {
+	case DbIssueDanglingBrickRef:
+		switch issue.EntryType {
+		case "volume":
+			v, err := NewVolumeEntryFromId(tx, issue.EntryId)
+			if err != nil {
+				return err
+			}
+			v.BrickDelete(issue.RefId)
+			return v.Save(tx)
+		case "device":
+			d, err := NewDeviceEntryFromId(tx, issue.EntryId)
+			if err != nil {
+				return err
+			}
+			d.BrickDelete(issue.RefId)
+			return d.Save(tx)
+		}
+	case DbIssueVolumeMissingBricks:
+		v, err := NewVolumeEntryFromId(tx, issue.EntryId)
+		if err != nil {
+			return err
+		}
+		v.BrickAdd(issue.RefId)
+		return v.Save(tx)
+	case DbIssueDeviceUsedSize:
+		d, err := NewDeviceEntryFromId(tx, issue.EntryId)
+		if err != nil {
+			return err
+		}
+		var used uint64
+		for _, id := range d.Bricks {
+			b, err := NewBrickEntryFromId(tx, id)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			used += b.TpSize + b.PoolMetadataSize
+		}
+		if used > d.Info.Storage.Total {
+			return fmt.Errorf("bricks of device %v exceed its size", d.Info.Id)
+		}
+		d.StorageSet(d.Info.Storage.Total, d.Info.Storage.Total-used, used)
+		return d.Save(tx)
+	case DbIssueOrphanPendingOp:
+		p, err := NewPendingOperationEntryFromId(tx, issue.EntryId)
+		if err != nil {
+			return err
+		}
+		return p.Delete(tx)
+	}
+	return fmt.Errorf("no fix for %v of %v", issue.Type, issue.EntryType)
+}
+
+// backupBeforeRepair takes a backup of the db and returns its name.
+// Without periodic backups configured the db is copied next to the
+// db file.
+func (a *App) backupBeforeRepair() (string, error) {
+	if a.backups != nil {
+		info, err := a.backups.Snapshot(a.db)
+		if err != nil {
+			return "", err
+		}
+		if info != nil {
+			return info.Name, nil
+		}
+		// the db did not change since the last backup
+		backups, err := a.backups.List()
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backup of the db found")
+		}
+		return backups[0].Name, nil
+	}
+
+	path := fmt.Sprintf("%v.repair-%v", DbPath(a.conf), time.Now().Unix())
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// DbRepair ... Applies the fixes of issues reported by the db check.
+// A backup of the db is taken first, and the fixes are applied in
+// a single transaction.
+func (a *App) DbRepair(w http.ResponseWriter, r *http.Request) {
+	var msg api.DbRepairRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	err = msg.Validate()
+	if err != nil {
+		http.Error(w, "validation failed: "+err.Error(), http.StatusBadRequest)
+		logger.LogError("validation failed: " + err.Error())
+		return
+	}
+
+	backup, err := a.backupBeforeRepair()
+	if err != nil {
+		logger.LogError("Unable to back up the db before repair: %v", err)
+		http.Error(w, "Unable to back up the db: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Backed up the db to %v before repair", backup)
+
+	var repaired []string
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		repaired, err = dbRepairIssues(tx, msg.Issues)
+		if _, ok := err.(*dbIssueNotFoundError); ok {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(api.DbRepairResponse{
+		Backup:   backup,
+		Repaired: repaired,
+	}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/idgen"
+)
+
+func testCheckIssueIds(t *testing.T, app *App) []string {
+	check, err := dbCheckConsistency(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ids := []string{}
+	for _, b := range []DbBucketCheckResponse{
+		check.Volumes, check.Clusters, check.Nodes, check.Devices,
+		check.BlockVolumes, check.Bricks, check.PendingOperations} {
+		for _, issue := range b.Issues {
+			ids = append(ids, issue.Id)
+		}
+	}
+	tests.Assert(t, check.TotalIssues == len(ids),
+		"expected", len(ids), "issues, got:", check.TotalIssues)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestDbRepair(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+
+	app := NewTestApp(dbfile)
+	defer app.Close()
+	err := setupSampleDbWithTopology(app, 1, 3, 1, 5*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := createSampleReplicaVolumeEntry(100, 3)
+	err = v.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(testCheckIssueIds(t, app)) == 0)
+
+	// break the db
+	var brickId, deviceId, danglingId string
+	op := NewPendingOperationEntry(NEW_ID)
+	op.Type = OperationCreateVolume
+	op.Actions = []PendingOperationAction{{Change: OpAddVolume, Id: idgen.GenUUID()}}
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		vol, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		brickId = vol.Bricks[0]
+		vol.BrickDelete(brickId)
+		if err := vol.Save(tx); err != nil {
+			return err
+		}
+
+		brick, err := NewBrickEntryFromId(tx, brickId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		deviceId = brick.Info.DeviceId
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		danglingId = idgen.GenUUID()
+		device.BrickAdd(danglingId)
+		device.StorageAllocate(1024)
+		if err := device.Save(tx); err != nil {
+			return err
+		}
+		return op.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	expected := []string{
+		string(DbIssueDanglingBrickRef) + "/" + deviceId + "/" + danglingId,
+		string(DbIssueDeviceUsedSize) + "/" + deviceId,
+		string(DbIssueOrphanPendingOp) + "/" + op.Id,
+		string(DbIssueVolumeMissingBricks) + "/" + v.Info.Id + "/" + brickId,
+	}
+	sort.Strings(expected)
+	ids := testCheckIssueIds(t, app)
+	tests.Assert(t, strings.Join(ids, " ") == strings.Join(expected, " "),
+		"expected", expected, "got:", ids)
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	_, err = c.DbRepair(&api.DbRepairRequest{})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "validation failed"),
+		"expected validation error, got:", err)
+
+	// an unknown issue repairs nothing
+	_, err = c.DbRepair(&api.DbRepairRequest{
+		Issues: []string{ids[0], "orphan-pending-op/missing"},
+	})
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not found"),
+		"expected not found error, got:", err)
+	tests.Assert(t, len(testCheckIssueIds(t, app)) == 4)
+
+	resp, err := c.DbRepair(&api.DbRepairRequest{Issues: ids})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(resp.Repaired) == 4, "got:", resp.Repaired)
+	tests.Assert(t, strings.HasPrefix(resp.Backup, dbfile+".repair-"),
+		"got:", resp.Backup)
+	defer os.Remove(resp.Backup)
+	_, err = os.Stat(resp.Backup)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	check, err := dbCheckConsistency(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, check.TotalInconsistencies == 0, "got:", check)
+	tests.Assert(t, check.TotalIssues == 0, "got:", check)
+}
@@ -12,6 +12,10 @@ package glusterfs
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/boltdb/bolt"
 	"github.com/lpabon/godbc"
@@ -24,6 +28,7 @@ var (
 		DB_GENERATION_ID,
 		DB_HAS_PENDING_OPS_BUCKET,
 		DB_DEVICE_HAS_ID_META,
+		DB_SCHEMA_VERSION,
 	}
 )
 
@@ -117,3 +122,54 @@ func mapDbAtrributeKeys() map[string]bool {
 	}
 	return m
 }
+
+// DbAttributes returns the dbattribute entries of the db as a map of
+// keys to values. A db without a dbattribute bucket has no entries.
+func DbAttributes(tx *bolt.Tx) (map[string]string, error) {
+	attrs := map[string]string{}
+	if tx.Bucket([]byte(BOLTDB_BUCKET_DBATTRIBUTE)) == nil {
+		return attrs, nil
+	}
+	keys, err := DbAttributeList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		entry, err := NewDbAttributeEntryFromKey(tx, key)
+		if err != nil {
+			return nil, err
+		}
+		attrs[key] = entry.Value
+	}
+	return attrs, nil
+}
+
+// CheckDbAttributes returns an error if a db with the given
+// dbattribute entries was written by a newer version of heketi,
+// that added entries this version does not know about or uses a
+// newer schema version.
+func CheckDbAttributes(attrs map[string]string) error {
+	if v, ok := attrs[DB_SCHEMA_VERSION]; ok {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid db schema version %#v", v)
+		}
+		if version > DbSchemaVersion {
+			return fmt.Errorf("db schema version %v is newer than the schema version %v of this version of heketi",
+				version, DbSchemaVersion)
+		}
+	}
+	known := mapDbAtrributeKeys()
+	unknown := []string{}
+	for key := range attrs {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown db attributes: %v",
+			strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ package glusterfs
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boltdb/bolt"
@@ -61,3 +62,36 @@ func TestValidDbAttributeKeys(t *testing.T) {
 		return nil
 	})
 }
+
+func TestDbAttributes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	app.db.View(func(tx *bolt.Tx) error {
+		attrs, err := DbAttributes(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, attrs[DB_HAS_PENDING_OPS_BUCKET] == "yes",
+			"expected pending ops attribute, got:", attrs)
+		tests.Assert(t, CheckDbAttributes(attrs) == nil,
+			"expected db attributes compatible")
+		return nil
+	})
+
+	app.db.Update(func(tx *bolt.Tx) error {
+		entry := NewDbAttributeEntry()
+		entry.Key = "LOVELY_FISH"
+		entry.Value = "no"
+		return entry.Save(tx)
+	})
+	app.db.View(func(tx *bolt.Tx) error {
+		attrs, err := DbAttributes(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		err = CheckDbAttributes(attrs)
+		tests.Assert(t, err != nil && strings.Contains(err.Error(), "LOVELY_FISH"),
+			"expected unknown attribute error, got:", err)
+		return nil
+	})
+}
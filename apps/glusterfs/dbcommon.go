@@ -32,21 +32,68 @@ type Db struct {
 	BlockVolumes      map[string]BlockVolumeEntry      `json:"blockvolumeentries"`
 	DbAttributes      map[string]DbAttributeEntry      `json:"dbattributeentries"`
 	PendingOperations map[string]PendingOperationEntry `json:"pendingoperations"`
+	Profiles          map[string]ProfileEntry          `json:"profiles,omitempty"`
+}
+
+//DbIssueType ... names a kind of inconsistency that can be repaired.
+type DbIssueType string
+
+const (
+	// a volume or device lists a brick that is not in the db
+	DbIssueDanglingBrickRef DbIssueType = "dangling-brick-reference"
+	// the used size of a device differs from the size of its bricks
+	DbIssueDeviceUsedSize DbIssueType = "device-used-size-mismatch"
+	// a brick of a volume is not listed by the volume
+	DbIssueVolumeMissingBricks DbIssueType = "volume-missing-bricks"
+	// no entry is left for a pending operation to act on
+	DbIssueOrphanPendingOp DbIssueType = "orphan-pending-op"
+)
+
+//DbIssue ... is an inconsistency of a db entry, with the fix applied
+//by the db repair.
+type DbIssue struct {
+	// identifies the issue in a db repair request
+	Id   string      `json:"id"`
+	Type DbIssueType `json:"type"`
+	// the entry changed by the fix, and the entry it refers to
+	EntryType   string `json:"entrytype"`
+	EntryId     string `json:"entryid"`
+	RefId       string `json:"refid,omitempty"`
+	Description string `json:"description"`
+	Fix         string `json:"fix"`
+}
+
+func newDbIssue(t DbIssueType, entryType, entryId, refId, description, fix string) DbIssue {
+	id := string(t) + "/" + entryId
+	if refId != "" {
+		id += "/" + refId
+	}
+	return DbIssue{
+		Id:          id,
+		Type:        t,
+		EntryType:   entryType,
+		EntryId:     entryId,
+		RefId:       refId,
+		Description: description,
+		Fix:         fix,
+	}
 }
 
 //DbEntryCheckResponse ... is summary of check on a db entry.
 type DbEntryCheckResponse struct {
-	Pending         bool     `json:"pending"`
-	Inconsistencies []string `json:"inconsistencies"`
+	Pending         bool      `json:"pending"`
+	Inconsistencies []string  `json:"inconsistencies"`
+	Issues          []DbIssue `json:"issues,omitempty"`
 }
 
 //DbBucketCheckResponse ... is summary of check on a db bucket.
 type DbBucketCheckResponse struct {
-	Total           int      `json:"total"`
-	Pending         int      `json:"pending"`
-	Ok              int      `json:"ok"`
-	NotOk           int      `json:"notok"`
-	Inconsistencies []string `json:"inconsistencies"`
+	Total           int       `json:"total"`
+	Pending         int       `json:"pending"`
+	Ok              int       `json:"ok"`
+	NotOk           int       `json:"notok"`
+	Inconsistencies []string  `json:"inconsistencies"`
+	Issues          []DbIssue `json:"issues,omitempty"`
 }
 
 //DbCheckResponse ... is the output of db check. It lists a summary of db state
@@ -61,6 +108,8 @@ type DbCheckResponse struct {
 	DbAttributes         DbBucketCheckResponse `json:"dbattributes"`
 	PendingOperations    DbBucketCheckResponse `json:"pendingoperations"`
 	TotalInconsistencies int                   `json:"totalinconsistencies"`
+	// inconsistencies that the db repair can fix
+	TotalIssues int `json:"totalissues"`
 }
 
 func initializeBuckets(tx *bolt.Tx) error {
@@ -117,6 +166,30 @@ func initializeBuckets(tx *bolt.Tx) error {
 		return err
 	}
 
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_ASYNC_QUEUE))
+	if err != nil {
+		logger.LogError("Unable to create async queue bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_IDEMPOTENCY_KEYS))
+	if err != nil {
+		logger.LogError("Unable to create idempotency keys bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_PROFILE))
+	if err != nil {
+		logger.LogError("Unable to create profile bucket in DB")
+		return err
+	}
+
+	_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY))
+	if err != nil {
+		logger.LogError("Unable to create volume anti-affinity bucket in DB")
+		return err
+	}
+
 	return nil
 }
 
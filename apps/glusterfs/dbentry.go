@@ -12,6 +12,8 @@ package glusterfs
 import (
 	"github.com/boltdb/bolt"
 	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/pkg/db/store"
 )
 
 type DbEntry interface {
@@ -41,7 +43,12 @@ func EntryRegister(tx *bolt.Tx, entry DbEntry, key string, value []byte) ([]byte
 	}
 
 	// Key does not exist.  We can save it
-	err := b.Put([]byte(key), value)
+	err := store.Record(tx, entry.BucketName(), key)
+	if err != nil {
+		logger.Err(err)
+		return nil, err
+	}
+	err = b.Put([]byte(key), value)
 	if err != nil {
 		logger.Err(err)
 		return nil, err
@@ -90,6 +97,11 @@ func EntrySave(tx *bolt.Tx, entry DbEntry, key string) error {
 	}
 
 	// Save data using the id as the key
+	err = store.Record(tx, entry.BucketName(), key)
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
 	err = b.Put([]byte(key), buffer)
 	if err != nil {
 		logger.Err(err)
@@ -112,7 +124,12 @@ func EntryDelete(tx *bolt.Tx, entry DbEntry, key string) error {
 	}
 
 	// Delete key
-	err := b.Delete([]byte(key))
+	err := store.Record(tx, entry.BucketName(), key)
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+	err = b.Delete([]byte(key))
 	if err != nil {
 		logger.LogError("Unable to delete key [%v] in db: %v", key, err.Error())
 		return err
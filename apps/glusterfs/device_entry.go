@@ -35,6 +35,9 @@ type DeviceEntry struct {
 	Bricks     sort.StringSlice
 	NodeId     string
 	ExtentSize uint64
+
+	// last recorded difference between tracked and actual free space
+	Drift *api.DeviceDrift
 }
 
 func DeviceList(tx *bolt.Tx) ([]string, error) {
@@ -244,6 +247,10 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 	info.PvUUID = d.Info.PvUUID
 	info.Paths = make([]string, len(d.Info.Paths))
 	copy(info.Paths, d.Info.Paths)
+	if d.Drift != nil {
+		drift := *d.Drift
+		info.Drift = &drift
+	}
 
 	// Add each drive information
 	for _, id := range d.Bricks {
@@ -259,6 +266,13 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 		info.Bricks = append(info.Bricks, *brickinfo)
 	}
 
+	inodes, warnings, err := d.arbiterInodes(tx)
+	if err != nil {
+		return nil, err
+	}
+	info.ArbiterInodes = inodes
+	info.Warnings = warnings
+
 	return info, nil
 }
 
@@ -641,6 +655,10 @@ func (d *DeviceEntry) consistencyCheck(db Db) (response DbEntryCheckResponse) {
 	for _, brick := range d.Bricks {
 		if brickEntry, found := db.Bricks[brick]; !found {
 			response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Device %v unknown brick %v", d.Info.Id, brick))
+			response.Issues = append(response.Issues, newDbIssue(DbIssueDanglingBrickRef,
+				"device", d.Info.Id, brick,
+				fmt.Sprintf("Device %v unknown brick %v", d.Info.Id, brick),
+				"Remove the brick from the bricks of the device"))
 		} else {
 			if brickEntry.Info.DeviceId != d.Info.Id {
 				response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Device %v no link back to device from brick %v", d.Info.Id, brick))
@@ -655,6 +673,12 @@ func (d *DeviceEntry) consistencyCheck(db Db) (response DbEntryCheckResponse) {
 	}
 	if aggregateBricksSize != d.Info.Storage.Used {
 		response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Device %v size values differ Used(%v) != aggregateBricksSize(%v)", d.Info.Id, d.Info.Storage.Used, aggregateBricksSize))
+		if aggregateBricksSize <= d.Info.Storage.Total {
+			response.Issues = append(response.Issues, newDbIssue(DbIssueDeviceUsedSize,
+				"device", d.Info.Id, "",
+				fmt.Sprintf("Device %v used size %v differs from the size of its bricks %v", d.Info.Id, d.Info.Storage.Used, aggregateBricksSize),
+				fmt.Sprintf("Set the used size of the device to %v and the free size to %v", aggregateBricksSize, d.Info.Storage.Total-aggregateBricksSize)))
+		}
 	}
 
 	return
@@ -0,0 +1,241 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/executors"
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+const (
+	DEFAULT_DEVICE_RESYNC_CONCURRENCY = 4
+)
+
+var (
+	resyncNow func() time.Time = time.Now
+)
+
+type deviceResyncTarget struct {
+	deviceId string
+	host     string
+	handle   *executors.DeviceVgHandle
+	// free space tracked when the device was selected
+	free uint64
+}
+
+// DeviceResyncMonitor periodically compares the storage accounting
+// of all devices in the db with the state reported by the device's
+// node and records the difference (drift) on each device entry.
+// It does not change the tracked storage values themselves, that
+// remains the task of an explicit device resync.
+type DeviceResyncMonitor struct {
+	// tunables
+	StartInterval time.Duration
+	CheckInterval time.Duration
+	Concurrency   int
+
+	db   wdb.DB
+	exec executors.Executor
+
+	// to stop the monitor
+	stop chan<- interface{}
+}
+
+func NewDeviceResyncMonitor(reftime, starttime uint32, concurrency int,
+	db wdb.DB, e executors.Executor) *DeviceResyncMonitor {
+
+	if concurrency <= 0 {
+		concurrency = DEFAULT_DEVICE_RESYNC_CONCURRENCY
+	}
+	return &DeviceResyncMonitor{
+		db:            db,
+		exec:          e,
+		StartInterval: time.Second * time.Duration(starttime),
+		CheckInterval: time.Second * time.Duration(reftime),
+		Concurrency:   concurrency,
+	}
+}
+
+// Refresh checks every eligible device once, running at most
+// Concurrency checks in parallel. Devices that can not be checked
+// are logged and skipped.
+func (m *DeviceResyncMonitor) Refresh() error {
+	logger.Info("Starting device resync check")
+	targets, err := m.toCheck()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan bool, m.Concurrency)
+	for _, t := range targets {
+		wg.Add(1)
+		sem <- true
+		go func(t deviceResyncTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := m.checkDevice(t); err != nil {
+				logger.Warning("Unable to check device %v: %v",
+					t.deviceId, err)
+			}
+		}(t)
+	}
+	wg.Wait()
+	logger.Info("Checked %v devices for storage drift", len(targets))
+	return nil
+}
+
+func (m *DeviceResyncMonitor) checkDevice(t deviceResyncTarget) error {
+	info, err := m.exec.GetDeviceInfo(t.host, t.handle)
+	if err != nil {
+		return err
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, t.deviceId)
+		if err == ErrNotFound {
+			// device was removed in the meantime
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// an operation may have started, or even completed, since
+		// the device was selected, so the size read from the node
+		// may not match what the db tracks. The difference is
+		// expected in that case, so skip the device. Checked in the
+		// transaction saving the drift, so that no operation can
+		// start in between.
+		pdevs, err := mapPendingDevices(tx)
+		if err != nil {
+			return err
+		}
+		if pdevs[t.deviceId] || device.Info.Storage.Free != t.free {
+			logger.Debug("Device %v changed while checked, skipping", t.deviceId)
+			return nil
+		}
+		diff := int64(info.FreeSize) - int64(device.Info.Storage.Free)
+		if diff != 0 {
+			logger.Warning("Device %v free size drift: tracked %v, actual %v",
+				device.Info.Id, device.Info.Storage.Free, info.FreeSize)
+		}
+		device.Drift = &api.DeviceDrift{
+			FreeDiff:  diff,
+			LastCheck: resyncNow().Unix(),
+		}
+		return device.Save(tx)
+	})
+}
+
+// toCheck returns the devices that are currently eligible to
+// be checked. Devices that are failed, on nodes that are not
+// online, or have pending operations are skipped.
+func (m *DeviceResyncMonitor) toCheck() ([]deviceResyncTarget, error) {
+	targets := []deviceResyncTarget{}
+	err := m.db.View(func(tx *bolt.Tx) error {
+		pdevs, err := mapPendingDevices(tx)
+		if err != nil {
+			return err
+		}
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if device.State == api.EntryStateFailed || pdevs[id] {
+				continue
+			}
+			node, err := NewNodeEntryFromId(tx, device.NodeId)
+			if err != nil {
+				return err
+			}
+			if !node.isOnline() {
+				continue
+			}
+			targets = append(targets, deviceResyncTarget{
+				deviceId: id,
+				host:     node.ManageHostName(),
+				handle:   device.ToHandle(),
+				free:     device.Info.Storage.Free,
+			})
+		}
+		return nil
+	})
+	return targets, err
+}
+
+// Start creates a background goroutine to run periodic device checks.
+func (m *DeviceResyncMonitor) Start() {
+	startTimer := time.NewTimer(m.StartInterval)
+	ticker := time.NewTicker(m.CheckInterval)
+	stop := make(chan interface{})
+	m.stop = stop
+
+	go func() {
+		logger.Info("Started background device resync monitor")
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				logger.Info("Stopping background device resync monitor")
+				return
+			case <-startTimer.C:
+				if err := m.Refresh(); err != nil {
+					logger.LogError("Background device resync: %v", err)
+				}
+			case <-ticker.C:
+				if err := m.Refresh(); err != nil {
+					logger.LogError("Background device resync: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop the background device resync monitor.
+func (m *DeviceResyncMonitor) Stop() {
+	m.stop <- true
+}
+
+// mapPendingDevices returns a map of the ids of all devices that
+// are referenced by pending bricks or pending device removes.
+func mapPendingDevices(tx *bolt.Tx) (map[string]bool, error) {
+	pdevs := map[string]bool{}
+	pb, err := MapPendingBricks(tx)
+	if err != nil {
+		return nil, err
+	}
+	for brickId := range pb {
+		b, err := NewBrickEntryFromId(tx, brickId)
+		if err != nil {
+			return nil, err
+		}
+		pdevs[b.Info.DeviceId] = true
+	}
+	pdr, err := MapPendingDeviceRemoves(tx)
+	if err != nil {
+		return nil, err
+	}
+	for deviceId := range pdr {
+		pdevs[deviceId] = true
+	}
+	return pdevs, nil
+}
@@ -0,0 +1,209 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func TestDeviceResyncMonitorRecordsDrift(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// report 1GiB less free space than the db tracks
+	app.xo.MockGetDeviceInfo = func(host string, dh *executors.DeviceVgHandle) (*executors.DeviceInfo, error) {
+		d := &executors.DeviceInfo{}
+		d.TotalSize = 1 * TB
+		d.FreeSize = 1*TB - 1*GB
+		d.UsedSize = 1 * GB
+		d.ExtentSize = 4096
+		return d, nil
+	}
+
+	m := NewDeviceResyncMonitor(1, 0, 2, app.db, app.executor)
+	err = m.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(dl) == 6, "expected len(dl) == 6, got:", len(dl))
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, d.Drift != nil, "expected d.Drift != nil")
+			tests.Assert(t, d.Drift.FreeDiff == -int64(GB),
+				"expected d.Drift.FreeDiff == -GB, got:", d.Drift.FreeDiff)
+			// tracked storage values are not modified
+			tests.Assert(t, d.Info.Storage.Free == 1*TB,
+				"expected d.Info.Storage.Free == 1*TB, got:", d.Info.Storage.Free)
+
+			info, err := d.NewInfoResponse(tx)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, info.Drift != nil, "expected info.Drift != nil")
+			tests.Assert(t, info.Drift.FreeDiff == -int64(GB),
+				"expected info.Drift.FreeDiff == -GB, got:", info.Drift.FreeDiff)
+		}
+		return nil
+	})
+}
+
+func TestDeviceResyncMonitorSkipsFailed(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var failedId string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		d, err := NewDeviceEntryFromId(tx, dl[0])
+		if err != nil {
+			return err
+		}
+		d.State = api.EntryStateFailed
+		failedId = d.Info.Id
+		return d.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	checked := 0
+	app.xo.MockGetDeviceInfo = func(host string, dh *executors.DeviceVgHandle) (*executors.DeviceInfo, error) {
+		checked++
+		d := &executors.DeviceInfo{}
+		d.TotalSize = 1 * TB
+		d.FreeSize = 1 * TB
+		d.ExtentSize = 4096
+		return d, nil
+	}
+
+	m := NewDeviceResyncMonitor(1, 0, 1, app.db, app.executor)
+	err = m.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, checked == 2, "expected checked == 2, got:", checked)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		d, err := NewDeviceEntryFromId(tx, failedId)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, d.Drift == nil, "expected d.Drift == nil, got:", d.Drift)
+		return nil
+	})
+}
+
+func TestDeviceResyncMonitorSkipsChangedDevices(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var changedId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		changedId = dl[0]
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// while the first device is read, an operation starts and another
+	// one completed on the changed device
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	vc := NewVolumeCreateOperation(NewVolumeEntryFromRequest(req), app.db)
+	started := false
+	app.xo.MockGetDeviceInfo = func(host string, dh *executors.DeviceVgHandle) (*executors.DeviceInfo, error) {
+		if !started {
+			started = true
+			err := vc.Build()
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			err = app.db.Update(func(tx *bolt.Tx) error {
+				d, err := NewDeviceEntryFromId(tx, changedId)
+				if err != nil {
+					return err
+				}
+				d.StorageAllocate(1 * GB)
+				return d.Save(tx)
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+		d := &executors.DeviceInfo{}
+		d.TotalSize = 1 * TB
+		d.FreeSize = 1 * TB
+		d.ExtentSize = 4096
+		return d, nil
+	}
+
+	m := NewDeviceResyncMonitor(1, 0, 1, app.db, app.executor)
+	err = m.Refresh()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		pdevs, err := mapPendingDevices(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(pdevs) > 0, "expected pending devices")
+		dl, err := DeviceList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		checked := 0
+		for _, id := range dl {
+			d, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			if pdevs[id] || id == changedId {
+				tests.Assert(t, d.Drift == nil,
+					"expected no drift on changed device, got:", d.Drift)
+				continue
+			}
+			tests.Assert(t, d.Drift != nil && d.Drift.FreeDiff == 0,
+				"expected no drift recorded, got:", d.Drift)
+			checked++
+		}
+		tests.Assert(t, checked > 0, "expected some devices checked")
+		return nil
+	})
+}
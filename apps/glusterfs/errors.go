@@ -31,5 +31,8 @@ var (
 	ErrNoStorage    = errors.New("No online storage devices in cluster")
 
 	// returned by code related to operations load
-	ErrTooManyOperations = errors.New("Server handling too many operations")
+	ErrTooManyOperations  = errors.New("Server handling too many operations")
+	ErrOperationCancelled = errors.New("Operation cancelled")
+	ErrCancelTooLate      = errors.New("Operation already made its changes, too late to cancel")
+	ErrCancelRunning      = errors.New("Operation is running commands that can not be interrupted, too late to cancel")
 )
@@ -0,0 +1,282 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/pkg/db/store"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+const (
+	BOLTDB_BUCKET_IDEMPOTENCY_KEYS = "IDEMPOTENCY_KEYS"
+
+	idempotentVolume      = "volume"
+	idempotentBlockVolume = "blockvolume"
+)
+
+// IdempotencyKeyEntry records the id of the resource created by a
+// request carrying a client supplied idempotency key.
+type IdempotencyKeyEntry struct {
+	Key        string
+	Kind       string
+	ResourceId string
+	// id of the operation creating the resource
+	OpId    string
+	Created int64
+}
+
+func NewIdempotencyKeyEntry(kind, key string) *IdempotencyKeyEntry {
+	return &IdempotencyKeyEntry{
+		Key:  key,
+		Kind: kind,
+	}
+}
+
+func NewIdempotencyKeyEntryFromKey(tx *bolt.Tx, kind, key string) (*IdempotencyKeyEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewIdempotencyKeyEntry(kind, key)
+	err := EntryLoad(tx, entry, entry.dbKey())
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// dbKey returns the key of the entry in the db. The same client
+// key may be used for different kinds of resources.
+func (k *IdempotencyKeyEntry) dbKey() string {
+	return k.Kind + "/" + k.Key
+}
+
+func (k *IdempotencyKeyEntry) BucketName() string {
+	return BOLTDB_BUCKET_IDEMPOTENCY_KEYS
+}
+
+func (k *IdempotencyKeyEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(k.Key) > 0)
+	godbc.Require(len(k.Kind) > 0)
+
+	return EntrySave(tx, k, k.dbKey())
+}
+
+func (k *IdempotencyKeyEntry) Delete(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	return EntryDelete(tx, k, k.dbKey())
+}
+
+func (k *IdempotencyKeyEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*k)
+
+	return buffer.Bytes(), err
+}
+
+func (k *IdempotencyKeyEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(k)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// resourceUrl returns the location of the resource created with
+// the key.
+func (k *IdempotencyKeyEntry) resourceUrl() string {
+	switch k.Kind {
+	case idempotentBlockVolume:
+		return "/blockvolumes/" + k.ResourceId
+	default:
+		return "/volumes/" + k.ResourceId
+	}
+}
+
+// pendingId returns the id of the pending operation of the resource
+// created with the key, and false if the resource no longer exists.
+func (k *IdempotencyKeyEntry) pendingId(tx *bolt.Tx) (string, bool, error) {
+	switch k.Kind {
+	case idempotentVolume:
+		v, err := NewVolumeEntryFromId(tx, k.ResourceId)
+		if err == ErrNotFound {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		return v.Pending.Id, true, nil
+	case idempotentBlockVolume:
+		bv, err := NewBlockVolumeEntryFromId(tx, k.ResourceId)
+		if err == ErrNotFound {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+		return bv.Pending.Id, true, nil
+	}
+	return "", false, fmt.Errorf("unknown idempotency key kind: %v", k.Kind)
+}
+
+// IdempotencyKeyList returns the db keys of all idempotency keys.
+func IdempotencyKeyList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_IDEMPOTENCY_KEYS)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+// collectIdempotencyKeys removes the idempotency keys created before
+// the given unix time.
+func collectIdempotencyKeys(tx *bolt.Tx, before int64) (int, error) {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_IDEMPOTENCY_KEYS))
+	if b == nil {
+		return 0, ErrAccessList
+	}
+	expired := [][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		entry := &IdempotencyKeyEntry{}
+		if err := entry.Unmarshal(v); err != nil {
+			return err
+		}
+		if entry.Created < before {
+			expired = append(expired, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range expired {
+		err := store.Record(tx, BOLTDB_BUCKET_IDEMPOTENCY_KEYS, string(k))
+		if err != nil {
+			return 0, err
+		}
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// requestIdempotencyKey returns the idempotency key of a create
+// request, taken from either the header or the request body.
+func requestIdempotencyKey(r *http.Request, field string) (string, error) {
+	header := r.Header.Get(api.IdempotencyKeyHeader)
+	if header == "" {
+		return field, nil
+	}
+	if field != "" && field != header {
+		return "", fmt.Errorf(
+			"%v header does not match idempotency_key of request",
+			api.IdempotencyKeyHeader)
+	}
+	if err := api.ValidateIdempotencyKey(header); err != nil {
+		return "", err
+	}
+	return header, nil
+}
+
+// runIdempotent calls start to begin the creation of the resource
+// of the given kind and id by the operation op, unless an earlier
+// request with the same idempotency key is still queued or running or
+// created a resource that still exists. In that case the earlier
+// request is replayed: the caller is sent to the status of its
+// operation or to the existing resource. The key is saved by op
+// together with its pending state.
+func (a *App) runIdempotent(w http.ResponseWriter, r *http.Request,
+	kind, key, id string, op KeyedOperation, start func() error) error {
+
+	if key == "" {
+		return start()
+	}
+
+	// serializes requests with keys so that concurrent retries
+	// can not both start creating a resource
+	a.idempotencyLock.Lock()
+	defer a.idempotencyLock.Unlock()
+
+	if replayed, err := a.replayIdempotent(w, r, kind, key); err != nil || replayed {
+		return err
+	}
+
+	entry := NewIdempotencyKeyEntry(kind, key)
+	entry.ResourceId = id
+	entry.OpId = op.Id()
+	entry.Created = asyncQueueNow().Unix()
+	op.setIdempotencyKey(entry)
+	return start()
+}
+
+func (a *App) replayIdempotent(w http.ResponseWriter, r *http.Request,
+	kind, key string) (bool, error) {
+
+	var (
+		entry   *IdempotencyKeyEntry
+		pending string
+		exists  bool
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = NewIdempotencyKeyEntryFromKey(tx, kind, key)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		pending, exists, err = entry.pendingId(tx)
+		return err
+	})
+	if err != nil || entry == nil {
+		return false, err
+	}
+	// the operation is looked up first as a queued create has not
+	// saved its resource yet
+	if runningOps.tracked(entry.OpId) {
+		if url, ok := a.asyncManager.OperationUrl(entry.OpId); ok {
+			logger.Info("Replaying %v create operation with idempotency key %v",
+				kind, key)
+			http.Redirect(w, r, url, http.StatusAccepted)
+			return true, nil
+		}
+	}
+	if !exists {
+		// a key whose resource is gone is replaced by the new request
+		return false, nil
+	}
+
+	logger.Info("Replaying %v create with idempotency key %v", kind, key)
+	if pending != "" {
+		if url, ok := a.asyncManager.OperationUrl(pending); ok {
+			http.Redirect(w, r, url, http.StatusAccepted)
+			return true, nil
+		}
+		// the operation was interrupted and awaits clean up
+		http.Error(w, fmt.Sprintf(
+			"%v with idempotency key %v is pending clean up", kind, key),
+			http.StatusConflict)
+		return true, nil
+	}
+	location := entry.resourceUrl()
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+		return location, nil
+	})
+	return true, nil
+}
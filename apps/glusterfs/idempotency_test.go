@@ -0,0 +1,347 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func newIdempotencyTestServer(t *testing.T, tmpfile string) (*App, *httptest.Server) {
+	app := NewTestApp(tmpfile)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return app, ts
+}
+
+func volumeCount(t *testing.T, app *App) int {
+	var count int
+	app.db.View(func(tx *bolt.Tx) error {
+		vl, err := VolumeList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		count = len(vl)
+		return nil
+	})
+	return count
+}
+
+func TestVolumeCreateIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	req.IdempotencyKey = "pvc-1234"
+
+	v1, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v1.IdempotencyKey == "",
+		"expected key not to be stored on volume, got:", v1.IdempotencyKey)
+
+	// a retry returns the existing volume
+	v2, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v1.Id == v2.Id, "expected same volume, got:", v1.Id, v2.Id)
+	tests.Assert(t, volumeCount(t, app) == 1,
+		"expected one volume, got:", volumeCount(t, app))
+
+	// a different key creates a new volume
+	req.IdempotencyKey = "pvc-5678"
+	v3, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v3.Id != v1.Id, "expected a new volume")
+
+	// once the volume is deleted the key can be reused
+	err = c.VolumeDelete(v1.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	req.IdempotencyKey = "pvc-1234"
+	v4, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v4.Id != v1.Id, "expected a new volume")
+	tests.Assert(t, volumeCount(t, app) == 2,
+		"expected two volumes, got:", volumeCount(t, app))
+}
+
+func TestVolumeCreateIdempotencyKeyHeader(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	// hold the first create in the executor
+	release := make(chan bool)
+	defer close(release)
+	mockVolumeCreate := app.xo.MockVolumeCreate
+	app.xo.MockVolumeCreate = func(host string, v *executors.VolumeRequest) (*executors.Volume, error) {
+		<-release
+		return mockVolumeCreate(host, v)
+	}
+
+	post := func(body string) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/volumes",
+			bytes.NewBufferString(body))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.IdempotencyKeyHeader, "abc")
+		r, err := http.DefaultClient.Do(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return r
+	}
+
+	r := post(`{"size": 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	location := r.Header.Get("Location")
+
+	// a retry while the create is running gets the same queue entry
+	r = post(`{"size": 10}`)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == location,
+		"expected", location, "got:", r.Header.Get("Location"))
+
+	// header and body must agree
+	r = post(`{"size": 10, "idempotency_key": "xyz"}`)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest,
+		"expected r.StatusCode == http.StatusBadRequest, got:", r.StatusCode)
+
+	release <- true
+	for {
+		r, err := http.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	tests.Assert(t, volumeCount(t, app) == 1,
+		"expected one volume, got:", volumeCount(t, app))
+}
+
+func TestVolumeCreateIdempotencyKeyQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+	app.optracker.Limit = 1
+
+	// hold the running create in the executor
+	release := make(chan bool)
+	mockVolumeCreate := app.xo.MockVolumeCreate
+	app.xo.MockVolumeCreate = func(host string, v *executors.VolumeRequest) (*executors.Volume, error) {
+		<-release
+		return mockVolumeCreate(host, v)
+	}
+
+	post := func(key string) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/volumes",
+			bytes.NewBufferString(`{"size": 10}`))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(api.IdempotencyKeyHeader, key)
+		}
+		r, err := http.DefaultClient.Do(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusAccepted,
+			"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+		return r
+	}
+	wait := func(location string) {
+		for {
+			r, err := http.Get(ts.URL + location)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			if r.Header.Get("X-Pending") != "true" {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	running := post("").Header.Get("Location")
+	queued := post("abc").Header.Get("Location")
+	tests.Assert(t, app.optracker.Queued() == 1,
+		"expected one queued operation, got:", app.optracker.Queued())
+
+	// the key is saved with the operation id while queued
+	app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewIdempotencyKeyEntryFromKey(tx, idempotentVolume, "abc")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, entry.OpId != "", "expected operation id to be saved")
+		return nil
+	})
+
+	// a retry gets the queued operation instead of starting a new one
+	r := post("abc")
+	tests.Assert(t, r.Header.Get("Location") == queued,
+		"expected", queued, "got:", r.Header.Get("Location"))
+	tests.Assert(t, app.optracker.Queued() == 1,
+		"expected one queued operation, got:", app.optracker.Queued())
+
+	release <- true
+	wait(running)
+	release <- true
+	wait(queued)
+	tests.Assert(t, volumeCount(t, app) == 2,
+		"expected two volumes, got:", volumeCount(t, app))
+}
+
+func TestVolumeCreateIdempotencyKeyBuildFails(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	// no cluster can hold the volume
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100 * 1024
+	req.IdempotencyKey = "pvc-1234"
+	_, err := c.VolumeCreate(req)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// the key is only saved with the pending operation
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewIdempotencyKeyEntryFromKey(tx, idempotentVolume, "pvc-1234")
+		tests.Assert(t, err == ErrNotFound, "expected err == ErrNotFound, got:", err)
+		return nil
+	})
+}
+
+func TestVolumeCreateOperationSavesIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 10
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+	entry := NewIdempotencyKeyEntry(idempotentVolume, "pvc-1234")
+	entry.ResourceId = vol.Info.Id
+	entry.OpId = vc.Id()
+	vc.setIdempotencyKey(entry)
+
+	err := vc.Build()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewIdempotencyKeyEntryFromKey(tx, idempotentVolume, "pvc-1234")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, entry.OpId == vc.Id(), "expected", vc.Id(), "got:", entry.OpId)
+		pending, exists, err := entry.pendingId(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, exists, "expected volume to exist")
+		tests.Assert(t, pending == vc.Id(), "expected", vc.Id(), "got:", pending)
+		return nil
+	})
+}
+
+func TestBlockVolumeCreateIdempotencyKey(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app, ts := newIdempotencyTestServer(t, tmpfile)
+	defer app.Close()
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.BlockVolumeCreateRequest{}
+	req.Size = 10
+	req.IdempotencyKey = "pvc-1234"
+
+	bv1, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bv2, err := c.BlockVolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bv1.Id == bv2.Id, "expected same block volume, got:", bv1.Id, bv2.Id)
+
+	// the same key may be used for a file volume
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 10
+	vreq.IdempotencyKey = "pvc-1234"
+	v, err := c.VolumeCreate(vreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v.Id != bv1.BlockHostingVolume, "expected a new volume")
+	tests.Assert(t, volumeCount(t, app) == 2,
+		"expected hosting and new volume, got:", volumeCount(t, app))
+}
+
+func TestCollectIdempotencyKeys(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		for i, key := range []string{"old", "new"} {
+			e := NewIdempotencyKeyEntry(idempotentVolume, key)
+			e.ResourceId = "v"
+			e.Created = int64(100 * (i + 1))
+			if err := e.Save(tx); err != nil {
+				return err
+			}
+		}
+		n, err := collectIdempotencyKeys(tx, 150)
+		tests.Assert(t, n == 1, "expected n == 1, got:", n)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewIdempotencyKeyEntryFromKey(tx, idempotentVolume, "old")
+		tests.Assert(t, err == ErrNotFound, "expected ErrNotFound, got:", err)
+		_, err = NewIdempotencyKeyEntryFromKey(tx, idempotentVolume, "new")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return nil
+	})
+}
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	tests.Assert(t, api.ValidateIdempotencyKey("") == nil)
+	tests.Assert(t, api.ValidateIdempotencyKey("ns:pvc-1.a_b") == nil)
+	tests.Assert(t, api.ValidateIdempotencyKey("a b") != nil)
+	tests.Assert(t, api.ValidateIdempotencyKey(string(make([]byte, 129))) != nil)
+}
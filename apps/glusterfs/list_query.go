@@ -0,0 +1,271 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// listQuery is the parsed query of a list request.
+type listQuery struct {
+	api.ListQuery
+	selector TagSelector
+}
+
+// newListQuery parses and validates the query parameters of a list
+// request.
+func newListQuery(v url.Values) (*listQuery, error) {
+	q, err := api.ParseListQuery(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	sel, err := ParseTagSelector(q.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return &listQuery{ListQuery: q, selector: sel}, nil
+}
+
+// newBlockVolumeListQuery parses the query of a block volume list
+// request. Block volumes have no durability to filter on.
+func newBlockVolumeListQuery(v url.Values) (*listQuery, error) {
+	q, err := newListQuery(v)
+	if err != nil {
+		return nil, err
+	}
+	if q.Durability != "" {
+		return nil, fmt.Errorf("block volumes can not be filtered by %v",
+			api.ListQueryDurability)
+	}
+	return q, nil
+}
+
+// newClusterListQuery parses the query of a cluster list request.
+// Clusters can only be paged, not filtered.
+func newClusterListQuery(v url.Values) (*listQuery, error) {
+	q, err := newListQuery(v)
+	if err != nil {
+		return nil, err
+	}
+	if q.filtered() {
+		return nil, fmt.Errorf("clusters can not be filtered")
+	}
+	return q, nil
+}
+
+// filtered returns true if the query filters out some items.
+func (q *listQuery) filtered() bool {
+	return q.Cluster != "" || q.NamePrefix != "" || q.MinSize != 0 ||
+		q.MaxSize != 0 || q.Durability != "" || len(q.selector) > 0
+}
+
+// sizeMatches returns true if size is within the range of the query.
+func (q *listQuery) sizeMatches(size int) bool {
+	return size >= q.MinSize && (q.MaxSize == 0 || size <= q.MaxSize)
+}
+
+func (q *listQuery) matchesVolume(v *VolumeEntry) bool {
+	return (q.Cluster == "" || v.Info.Cluster == q.Cluster) &&
+		strings.HasPrefix(v.Info.Name, q.NamePrefix) &&
+		q.sizeMatches(v.Info.Size) &&
+		(q.Durability == "" || v.Info.Durability.Type == q.Durability) &&
+		q.selector.Matches(v)
+}
+
+func (q *listQuery) matchesBlockVolume(bv *BlockVolumeEntry) bool {
+	return (q.Cluster == "" || bv.Info.Cluster == q.Cluster) &&
+		strings.HasPrefix(bv.Info.Name, q.NamePrefix) &&
+		q.sizeMatches(bv.Info.Size) &&
+		q.selector.Matches(bv)
+}
+
+// page returns the ids following the cursor that are accepted by
+// match, up to the limit of the query, and the cursor of the next page.
+// The cursor is the last id of the page and is only set if more ids
+// match.
+func (q *listQuery) page(ids []string,
+	match func(id string) (bool, error)) ([]string, string, error) {
+
+	sort.Strings(ids)
+	start := sort.SearchStrings(ids, q.Cursor)
+	if start < len(ids) && ids[start] == q.Cursor {
+		start++
+	}
+
+	page := []string{}
+	for _, id := range ids[start:] {
+		ok, err := match(id)
+		if err != nil {
+			return nil, "", err
+		}
+		if !ok {
+			continue
+		}
+		if q.Limit > 0 && len(page) == q.Limit {
+			return page, page[len(page)-1], nil
+		}
+		page = append(page, id)
+	}
+	return page, "", nil
+}
+
+// listVolumes returns the page of complete volumes selected by the
+// query.
+func listVolumes(tx *bolt.Tx, q *listQuery) (*api.VolumeListResponse, error) {
+	ids, err := ListCompleteVolumes(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*VolumeEntry{}
+	load := func(id string) (*VolumeEntry, error) {
+		if v, ok := entries[id]; ok {
+			return v, nil
+		}
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		entries[id] = v
+		return v, nil
+	}
+
+	var list api.VolumeListResponse
+	list.Volumes, list.Next, err = q.page(ids, func(id string) (bool, error) {
+		if !q.filtered() {
+			return true, nil
+		}
+		v, err := load(id)
+		if err != nil {
+			return false, err
+		}
+		return q.matchesVolume(v), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Detail {
+		list.Details = make([]api.VolumeInfoResponse, 0, len(list.Volumes))
+		for _, id := range list.Volumes {
+			v, err := load(id)
+			if err != nil {
+				return nil, err
+			}
+			info, err := v.NewInfoResponse(tx)
+			if err != nil {
+				return nil, err
+			}
+			if err := UpdateVolumeInfoComplete(tx, info); err != nil {
+				return nil, err
+			}
+			list.Details = append(list.Details, *info)
+		}
+	}
+	return &list, nil
+}
+
+// listBlockVolumes returns the page of complete block volumes selected
+// by the query.
+func listBlockVolumes(tx *bolt.Tx, q *listQuery) (*api.BlockVolumeListResponse, error) {
+	ids, err := ListCompleteBlockVolumes(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*BlockVolumeEntry{}
+	load := func(id string) (*BlockVolumeEntry, error) {
+		if bv, ok := entries[id]; ok {
+			return bv, nil
+		}
+		bv, err := NewBlockVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		entries[id] = bv
+		return bv, nil
+	}
+
+	var list api.BlockVolumeListResponse
+	list.BlockVolumes, list.Next, err = q.page(ids, func(id string) (bool, error) {
+		if !q.filtered() {
+			return true, nil
+		}
+		bv, err := load(id)
+		if err != nil {
+			return false, err
+		}
+		return q.matchesBlockVolume(bv), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Detail {
+		list.Details = make([]api.BlockVolumeInfoResponse, 0, len(list.BlockVolumes))
+		for _, id := range list.BlockVolumes {
+			bv, err := load(id)
+			if err != nil {
+				return nil, err
+			}
+			info, err := bv.NewInfoResponse(tx)
+			if err != nil {
+				return nil, err
+			}
+			list.Details = append(list.Details, *info)
+		}
+	}
+	return &list, nil
+}
+
+// listClusters returns the page of clusters selected by the query.
+func listClusters(tx *bolt.Tx, q *listQuery) (*api.ClusterListResponse, error) {
+	ids, err := ClusterList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list api.ClusterListResponse
+	list.Clusters, list.Next, err = q.page(ids, func(id string) (bool, error) {
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Detail {
+		list.Details = make([]api.ClusterInfoResponse, 0, len(list.Clusters))
+		for _, id := range list.Clusters {
+			c, err := NewClusterEntryFromId(tx, id)
+			if err != nil {
+				return nil, err
+			}
+			info, err := c.NewClusterInfoResponse(tx)
+			if err != nil {
+				return nil, err
+			}
+			if err := UpdateClusterInfoComplete(tx, info); err != nil {
+				return nil, err
+			}
+			list.Details = append(list.Details, *info)
+		}
+	}
+	return &list, nil
+}
@@ -0,0 +1,290 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+func getVolumeList(t *testing.T, url string) *api.VolumeListResponse {
+	r, err := http.Get(url)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+	var list api.VolumeListResponse
+	err = utils.GetJsonFromResponse(r, &list)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return &list
+}
+
+func TestVolumeListQuery(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 2, 3, 2, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var clusters []string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// volumes 0-5 alternate between the clusters, grow in size and
+	// only the even ones are replicated
+	for i := 0; i < 6; i++ {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 1 + i
+		req.Name = fmt.Sprintf("pvc_%v", i)
+		req.Clusters = []string{clusters[i%2]}
+		if i%2 == 0 {
+			req.Durability.Type = api.DurabilityReplicate
+			req.Durability.Replicate.Replica = 3
+		} else {
+			req.Durability.Type = api.DurabilityDistributeOnly
+		}
+		if i < 3 {
+			req.Tags = map[string]string{"namespace": "ns1"}
+		}
+		v := NewVolumeEntryFromRequest(req)
+		err := v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1
+	req.Name = "other"
+	req.Clusters = []string{clusters[0]}
+	err = NewVolumeEntryFromRequest(req).Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	list := getVolumeList(t, ts.URL+"/volumes")
+	tests.Assert(t, len(list.Volumes) == 7,
+		"expected len(list.Volumes) == 7, got:", len(list.Volumes))
+	tests.Assert(t, sort.StringsAreSorted(list.Volumes))
+	tests.Assert(t, len(list.Details) == 0,
+		"expected len(list.Details) == 0, got:", len(list.Details))
+	tests.Assert(t, list.Next == "", `expected list.Next == "", got:`, list.Next)
+
+	t.Run("filters", func(t *testing.T) {
+		checks := []struct {
+			query string
+			count int
+		}{
+			{"cluster=" + clusters[0], 4},
+			{"cluster=" + clusters[1], 3},
+			{"name_prefix=pvc_", 6},
+			{"name_prefix=oth", 1},
+			{"min_size=3", 4},
+			{"max_size=2", 3},
+			{"min_size=2&max_size=4", 3},
+			{"durability=replicate", 3},
+			{"durability=none", 3},
+			{"selector=namespace=ns1", 3},
+			{"selector=!namespace&name_prefix=pvc_", 3},
+			{"cluster=" + clusters[0] + "&durability=replicate&min_size=2", 2},
+		}
+		for _, c := range checks {
+			l := getVolumeList(t, ts.URL+"/volumes?"+c.query)
+			tests.Assert(t, len(l.Volumes) == c.count,
+				"expected", c.count, "volumes for", c.query, "got:", len(l.Volumes))
+		}
+	})
+
+	t.Run("detail", func(t *testing.T) {
+		l := getVolumeList(t, ts.URL+"/volumes?detail=true&name_prefix=pvc_")
+		tests.Assert(t, len(l.Details) == len(l.Volumes),
+			"expected len(l.Details) == len(l.Volumes), got:",
+			len(l.Details), len(l.Volumes))
+		for i, id := range l.Volumes {
+			tests.Assert(t, l.Details[i].Id == id,
+				"expected l.Details[i].Id == id, got:", l.Details[i].Id, id)
+			tests.Assert(t, len(l.Details[i].Bricks) > 0,
+				"expected bricks in details of", id)
+			tests.Assert(t, l.Details[i].Mount.GlusterFS.MountPoint != "",
+				"expected mount point in details of", id)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		var ids []string
+		cursor := ""
+		pages := 0
+		for {
+			l := getVolumeList(t,
+				ts.URL+"/volumes?limit=3&detail=true&cursor="+cursor)
+			tests.Assert(t, len(l.Volumes) <= 3,
+				"expected len(l.Volumes) <= 3, got:", len(l.Volumes))
+			tests.Assert(t, len(l.Details) == len(l.Volumes))
+			ids = append(ids, l.Volumes...)
+			pages++
+			if l.Next == "" {
+				break
+			}
+			cursor = l.Next
+		}
+		tests.Assert(t, pages == 3, "expected pages == 3, got:", pages)
+		tests.Assert(t, len(ids) == len(list.Volumes),
+			"expected len(ids) == len(list.Volumes), got:", len(ids))
+		for i := range ids {
+			tests.Assert(t, ids[i] == list.Volumes[i],
+				"expected ids[i] == list.Volumes[i], got:", ids[i], list.Volumes[i])
+		}
+
+		// a full last page has no next cursor
+		l := getVolumeList(t, ts.URL+"/volumes?limit=7")
+		tests.Assert(t, len(l.Volumes) == 7 && l.Next == "",
+			"expected a single page, got:", l.Volumes, l.Next)
+
+		// the cursor of a page of filtered volumes
+		l = getVolumeList(t, ts.URL+"/volumes?limit=2&durability=none")
+		tests.Assert(t, len(l.Volumes) == 2 && l.Next == l.Volumes[1],
+			"expected next page, got:", l.Volumes, l.Next)
+		l = getVolumeList(t, ts.URL+"/volumes?limit=2&durability=none&cursor="+l.Next)
+		tests.Assert(t, len(l.Volumes) == 1 && l.Next == "",
+			"expected last page, got:", l.Volumes, l.Next)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, query := range []string{
+			"limit=x",
+			"limit=-1",
+			"detail=maybe",
+			"min_size=3&max_size=2",
+			"durability=mirror",
+			"cluster=abc",
+			"selector==ns1",
+		} {
+			r, err := http.Get(ts.URL + "/volumes?" + query)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, r.StatusCode == http.StatusBadRequest,
+				"expected http.StatusBadRequest for", query, "got:", r.StatusCode)
+		}
+	})
+}
+
+func TestBlockVolumeListQuery(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 2*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	for i := 0; i < 4; i++ {
+		req := &api.BlockVolumeCreateRequest{}
+		req.Size = 1 + i
+		req.Name = fmt.Sprintf("blk_%v", i)
+		bv := NewBlockVolumeEntryFromRequest(req)
+		err := bv.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	r, err := http.Get(ts.URL + "/blockvolumes?min_size=2&limit=2&detail=true")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+	var list api.BlockVolumeListResponse
+	err = utils.GetJsonFromResponse(r, &list)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.BlockVolumes) == 2,
+		"expected len(list.BlockVolumes) == 2, got:", len(list.BlockVolumes))
+	tests.Assert(t, len(list.Details) == 2,
+		"expected len(list.Details) == 2, got:", len(list.Details))
+	tests.Assert(t, list.Details[0].Size >= 2,
+		"expected list.Details[0].Size >= 2, got:", list.Details[0].Size)
+	tests.Assert(t, list.Next == list.BlockVolumes[1],
+		"expected list.Next == list.BlockVolumes[1], got:", list.Next)
+
+	r, err = http.Get(ts.URL + "/blockvolumes?durability=none")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest,
+		"expected r.StatusCode == http.StatusBadRequest, got:", r.StatusCode)
+}
+
+func TestClusterListQuery(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app, 3, 1, 1, 500*GB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	var ids []string
+	cursor := ""
+	for {
+		r, err := http.Get(ts.URL + "/clusters?limit=2&detail=true&cursor=" + cursor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK,
+			"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+		var list api.ClusterListResponse
+		err = utils.GetJsonFromResponse(r, &list)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(list.Details) == len(list.Clusters))
+		for i, id := range list.Clusters {
+			tests.Assert(t, list.Details[i].Id == id)
+			tests.Assert(t, len(list.Details[i].Nodes) == 1,
+				"expected len(list.Details[i].Nodes) == 1, got:",
+				len(list.Details[i].Nodes))
+		}
+		ids = append(ids, list.Clusters...)
+		if list.Next == "" {
+			break
+		}
+		cursor = list.Next
+	}
+	tests.Assert(t, len(ids) == 3, "expected len(ids) == 3, got:", len(ids))
+	tests.Assert(t, sort.StringsAreSorted(ids))
+
+	r, err := http.Get(ts.URL + "/clusters?name_prefix=foo")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest,
+		"expected r.StatusCode == http.StatusBadRequest, got:", r.StatusCode)
+}
@@ -29,6 +29,10 @@ type NodeEntry struct {
 
 	Info    api.NodeInfo
 	Devices sort.StringSlice
+
+	// ssh host key of the node pinned on first use, in the
+	// authorized_keys format
+	SshHostKey string
 }
 
 func NewNodeEntry() *NodeEntry {
@@ -0,0 +1,196 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/ssh"
+)
+
+const (
+	// pending keys not used for this long are dropped
+	pendingHostKeyTTL = time.Hour
+	// at most this many pending keys are kept, the least recently
+	// used are dropped first
+	maxPendingHostKeys = 1024
+)
+
+// NodeHostKeyStore keeps the ssh host keys pinned by the executor
+// on the node entries of the hosts. Keys seen for a host before its
+// node entry is saved (eg. while the node is being added) are kept
+// in memory and moved to the node entry on the next connection. Keys
+// that can not be saved, as on a read-only db, are kept in memory as
+// well, so that pinning never fails the connection.
+type NodeHostKeyStore struct {
+	db wdb.DB
+	// keys are only kept in memory
+	ReadOnly bool
+
+	lock    sync.Mutex
+	pending map[string]*pendingHostKey
+	now     func() time.Time
+}
+
+type pendingHostKey struct {
+	key      string
+	lastUsed time.Time
+}
+
+func NewNodeHostKeyStore(db wdb.DB) *NodeHostKeyStore {
+	return &NodeHostKeyStore{
+		db:      db,
+		pending: map[string]*pendingHostKey{},
+		now:     time.Now,
+	}
+}
+
+// nodeByManageHost returns the node whose manage hostname is host
+// or nil if no such node is saved in the db.
+func nodeByManageHost(tx *bolt.Tx, host string) (*NodeEntry, error) {
+	n := &NodeEntry{}
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_NODE))
+	if b == nil {
+		return nil, ErrDbAccess
+	}
+	id := b.Get([]byte(n.registerManageKey(host)))
+	if id == nil {
+		return nil, nil
+	}
+	node, err := NewNodeEntryFromId(tx, string(id))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return node, err
+}
+
+func (s *NodeHostKeyStore) PinnedHostKey(host string) (string, error) {
+	var key string
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		node, err := nodeByManageHost(tx, host)
+		if err != nil || node == nil {
+			return err
+		}
+		found = true
+		key = node.SshHostKey
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if found && (key != "" || !s.ReadOnly) {
+		// an unpinned node is checked against any pending key
+		// when the key is pinned
+		return key, nil
+	}
+	return s.pendingKey(host), nil
+}
+
+func (s *NodeHostKeyStore) PinHostKey(host, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if p := s.pendingKey(host); p != "" && p != key {
+		return s.mismatch(host, key)
+	}
+	if s.ReadOnly {
+		s.setPending(host, key)
+		return nil
+	}
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		node, err := nodeByManageHost(tx, host)
+		if err != nil || node == nil {
+			return err
+		}
+		found = true
+		if node.SshHostKey != "" && node.SshHostKey != key {
+			return s.mismatch(host, key)
+		}
+		logger.Info("Pinning ssh host key for node %v", node.Info.Id)
+		node.SshHostKey = key
+		return node.Save(tx)
+	})
+	if _, ok := err.(*ssh.HostKeyMismatchError); ok {
+		return err
+	}
+	if err != nil {
+		// saved on a later connection
+		logger.Warning("Unable to save ssh host key of %v, keeping it in memory: %v",
+			host, err)
+		found = false
+	}
+	if found {
+		delete(s.pending, host)
+	} else {
+		s.setPending(host, key)
+	}
+	return nil
+}
+
+// pendingKey returns the pending key of host, if it was used recently
+// enough. Must be called with the lock held.
+func (s *NodeHostKeyStore) pendingKey(host string) string {
+	p, ok := s.pending[host]
+	if !ok {
+		return ""
+	}
+	now := s.now()
+	if now.Sub(p.lastUsed) >= pendingHostKeyTTL {
+		delete(s.pending, host)
+		return ""
+	}
+	p.lastUsed = now
+	return p.key
+}
+
+// setPending keeps key as the pending key of host, dropping expired
+// keys and, past the limit, the least recently used ones. Must be
+// called with the lock held.
+func (s *NodeHostKeyStore) setPending(host, key string) {
+	now := s.now()
+	for h, p := range s.pending {
+		if now.Sub(p.lastUsed) >= pendingHostKeyTTL {
+			delete(s.pending, h)
+		}
+	}
+	for len(s.pending) >= maxPendingHostKeys {
+		oldest := ""
+		for h, p := range s.pending {
+			if oldest == "" || p.lastUsed.Before(s.pending[oldest].lastUsed) {
+				oldest = h
+			}
+		}
+		delete(s.pending, oldest)
+	}
+	s.pending[host] = &pendingHostKey{key: key, lastUsed: now}
+}
+
+// Forget drops any pending key for host.
+func (s *NodeHostKeyStore) Forget(host string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.pending, host)
+}
+
+func (s *NodeHostKeyStore) mismatch(host, key string) error {
+	fp, err := ssh.HostKeyFingerprint(key)
+	if err != nil {
+		fp = "unknown"
+	}
+	return logger.Err(&ssh.HostKeyMismatchError{Host: host, Fingerprint: fp})
+}
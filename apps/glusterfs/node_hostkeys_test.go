@@ -0,0 +1,281 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+	cssh "golang.org/x/crypto/ssh"
+
+	"github.com/heketi/heketi/v10/executors/injectexec"
+	"github.com/heketi/heketi/v10/executors/mockexec"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/idgen"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/ssh"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+func newTestSshHostKey(t *testing.T) string {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	key, err := cssh.NewPublicKey(pub)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return ssh.MarshalHostKey(key)
+}
+
+func newTestHostKeyNode() *NodeEntry {
+	node := NewNodeEntry()
+	node.Info.Id = idgen.GenUUID()
+	node.Info.ClusterId = "123"
+	node.Info.Hostnames.Manage = sort.StringSlice{"manage.system"}
+	node.Info.Hostnames.Storage = sort.StringSlice{"storage.system"}
+	return node
+}
+
+func TestNodeHostKeyStorePending(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	store := NewNodeHostKeyStore(app.db)
+	key1 := newTestSshHostKey(t)
+	key2 := newTestSshHostKey(t)
+
+	// the node is not in the db yet, the key is kept in memory
+	k, err := store.PinnedHostKey("manage.system")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, k == "", "expected k == \"\", got:", k)
+	err = store.PinHostKey("manage.system", key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	k, err = store.PinnedHostKey("manage.system")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, k == key1, "expected k == key1, got:", k)
+
+	node := newTestHostKeyNode()
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		if err := node.Register(tx); err != nil {
+			return err
+		}
+		return node.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a different key than the pending one is rejected
+	err = store.PinHostKey("manage.system", key2)
+	_, ok := err.(*ssh.HostKeyMismatchError)
+	tests.Assert(t, ok, "expected HostKeyMismatchError, got:", err)
+
+	// the pending key moves to the node entry
+	err = store.PinHostKey("manage.system", key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		n, err := NewNodeEntryFromId(tx, node.Info.Id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, n.SshHostKey == key1,
+			"expected n.SshHostKey == key1, got:", n.SshHostKey)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(store.pending) == 0,
+		"expected len(store.pending) == 0, got:", len(store.pending))
+}
+
+// failingUpdateDb fails all the write transactions on the db.
+type failingUpdateDb struct {
+	*bolt.DB
+}
+
+func (d failingUpdateDb) Update(func(*bolt.Tx) error) error {
+	return ErrDbAccess
+}
+
+func TestNodeHostKeyStoreUnsaved(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	node := newTestHostKeyNode()
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		if err := node.Register(tx); err != nil {
+			return err
+		}
+		return node.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	key1 := newTestSshHostKey(t)
+	key2 := newTestSshHostKey(t)
+
+	for _, store := range []*NodeHostKeyStore{
+		// read-only, as on a standby
+		{db: app.db, ReadOnly: true},
+		// the db refuses the write
+		{db: failingUpdateDb{app.db}},
+	} {
+		store.pending = map[string]*pendingHostKey{}
+		store.now = time.Now
+
+		// the key is kept in memory and the connection goes on
+		err = store.PinHostKey("manage.system", key1)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if store.ReadOnly {
+			k, err := store.PinnedHostKey("manage.system")
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, k == key1, "expected k == key1, got:", k)
+		}
+		err = store.PinHostKey("manage.system", key2)
+		_, ok := err.(*ssh.HostKeyMismatchError)
+		tests.Assert(t, ok, "expected HostKeyMismatchError, got:", err)
+
+		err = app.db.View(func(tx *bolt.Tx) error {
+			n, err := NewNodeEntryFromId(tx, node.Info.Id)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			tests.Assert(t, n.SshHostKey == "",
+				"expected no pinned key, got:", n.SshHostKey)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+}
+
+func TestNodeHostKeyStorePendingExpiry(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	store := NewNodeHostKeyStore(app.db)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	key1 := newTestSshHostKey(t)
+	key2 := newTestSshHostKey(t)
+
+	err := store.PinHostKey("a.system", key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a key in use is kept
+	now = now.Add(pendingHostKeyTTL / 2)
+	k, _ := store.PinnedHostKey("a.system")
+	tests.Assert(t, k == key1, "expected k == key1, got:", k)
+	now = now.Add(pendingHostKeyTTL / 2)
+	k, _ = store.PinnedHostKey("a.system")
+	tests.Assert(t, k == key1, "expected k == key1, got:", k)
+
+	// an unused key expires
+	now = now.Add(pendingHostKeyTTL)
+	k, _ = store.PinnedHostKey("a.system")
+	tests.Assert(t, k == "", "expected expired key, got:", k)
+	err = store.PinHostKey("a.system", key2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the least recently used keys are dropped past the limit
+	for i := 0; i < maxPendingHostKeys; i++ {
+		now = now.Add(time.Millisecond)
+		err = store.PinHostKey(fmt.Sprintf("host%v.system", i), key1)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	tests.Assert(t, len(store.pending) == maxPendingHostKeys,
+		"expected len(store.pending) == maxPendingHostKeys, got:", len(store.pending))
+	k, _ = store.PinnedHostKey("a.system")
+	tests.Assert(t, k == "", "expected dropped key, got:", k)
+	k, _ = store.PinnedHostKey("host1.system")
+	tests.Assert(t, k == key1, "expected k == key1, got:", k)
+}
+
+func TestNodeSshHostKeyApi(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	key := newTestSshHostKey(t)
+	node := newTestHostKeyNode()
+	node.SshHostKey = key
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		if err := node.Register(tx); err != nil {
+			return err
+		}
+		return node.Save(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	r, err := http.Get(ts.URL + "/nodes/" + node.Info.Id + "/sshhostkey")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+	var resp api.NodeSshHostKeyResponse
+	err = utils.GetJsonFromResponse(r, &resp)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Key == key, "expected resp.Key == key, got:", resp.Key)
+	fp, _ := ssh.HostKeyFingerprint(key)
+	tests.Assert(t, resp.Fingerprint == fp,
+		"expected resp.Fingerprint == fp, got:", resp.Fingerprint)
+
+	req, err := http.NewRequest("DELETE",
+		ts.URL+"/nodes/"+node.Info.Id+"/sshhostkey", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent,
+		"expected r.StatusCode == http.StatusNoContent, got:", r.StatusCode)
+
+	k, err := app.hostKeys.PinnedHostKey("manage.system")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, k == "", "expected k == \"\", got:", k)
+
+	r, err = http.Get(ts.URL + "/nodes/" + idgen.GenUUID() + "/sshhostkey")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound,
+		"expected r.StatusCode == http.StatusNotFound, got:", r.StatusCode)
+}
+
+type hostKeyTestExecutor struct {
+	*mockexec.MockExecutor
+	store ssh.HostKeyStore
+}
+
+func (e *hostKeyTestExecutor) SetHostKeyStore(store ssh.HostKeyStore) {
+	e.store = store
+}
+
+func TestInitHostKeysInjectExecutor(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	x := &hostKeyTestExecutor{MockExecutor: m}
+	app.executor = injectexec.NewInjectExecutor(x, &injectexec.InjectConfig{})
+
+	// the store reaches the executor wrapped for injection
+	app.initHostKeys()
+	tests.Assert(t, x.store != nil, "expected the host key store to be set")
+	tests.Assert(t, x.store == app.hostKeys)
+}
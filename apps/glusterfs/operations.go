@@ -117,6 +117,17 @@ type FailableOperation interface {
 	MarkFailed() error
 }
 
+// KeyedOperation is any operation that can be started with a client
+// idempotency key. The key is saved in the transaction that builds the
+// operation, or that records it as queued, so that a retry of the
+// request always finds the operation it started.
+type KeyedOperation interface {
+	Operation
+
+	setIdempotencyKey(k *IdempotencyKeyEntry)
+	saveIdempotencyKey(tx *bolt.Tx) error
+}
+
 type noRetriesOperation struct{}
 
 func (n *noRetriesOperation) MaxRetries() int {
@@ -128,6 +139,8 @@ func (n *noRetriesOperation) MaxRetries() int {
 type OperationManager struct {
 	db wdb.DB
 	op *PendingOperationEntry
+	// idempotency key the operation was requested with, if any
+	idempotencyKey *IdempotencyKeyEntry
 }
 
 // Id returns the id of this operation's pending operation entry.
@@ -135,6 +148,19 @@ func (om *OperationManager) Id() string {
 	return om.op.Id
 }
 
+func (om *OperationManager) setIdempotencyKey(k *IdempotencyKeyEntry) {
+	om.idempotencyKey = k
+}
+
+// saveIdempotencyKey saves the idempotency key of the operation, if
+// it has one, within the given transaction.
+func (om *OperationManager) saveIdempotencyKey(tx *bolt.Tx) error {
+	if om.idempotencyKey == nil {
+		return nil
+	}
+	return om.idempotencyKey.Save(tx)
+}
+
 // MarkFailed marks the pending operation entry associated with
 // the operation as failed.
 func (om *OperationManager) MarkFailed() error {
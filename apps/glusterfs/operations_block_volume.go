@@ -147,7 +147,7 @@ func (bvc *BlockVolumeCreateOperation) Build() error {
 		if e := bvc.op.Save(tx); e != nil {
 			return e
 		}
-		return nil
+		return bvc.saveIdempotencyKey(tx)
 	})
 }
 
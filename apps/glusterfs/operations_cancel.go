@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// runningOp is the in-memory state of a running operation.
+type runningOp struct {
+	cancelled bool
+	committed bool
+	// the exec of the operation stops at its checkpoints, as set by
+	// the first exec of the operation
+	stoppable    bool
+	stoppableSet bool
+	progress     api.OperationProgress
+}
+
+// opCancels records the operations running in the server, whether
+// they have been asked to stop and how far they have come.
+// Operations check for a cancellation between their steps. It is not
+// part of the App as operations nested within other operations are
+// run without one.
+type opCancels struct {
+	lock sync.Mutex
+	ops  map[string]*runningOp
+}
+
+var runningOps = &opCancels{ops: map[string]*runningOp{}}
+
+// track records that the operation id is running. The returned
+// function must be called once the operation is done. Tracking an
+// operation that is already tracked does nothing so that the first
+// caller decides how long a cancellation request is honored.
+func (c *opCancels) track(id string) func() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.ops[id]; ok {
+		return func() {}
+	}
+	c.ops[id] = &runningOp{}
+	return func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		delete(c.ops, id)
+	}
+}
+
+// cancel asks the running operation id to stop. It returns an error
+// if the operation is not running, has already made its changes or
+// runs commands it can not stop between.
+func (c *opCancels) cancel(id string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	if !ok {
+		return fmt.Errorf("Operation %v is not running", id)
+	}
+	if op.committed {
+		return ErrCancelTooLate
+	}
+	if op.progress.Phase == PhaseExec && !op.stoppable {
+		return ErrCancelRunning
+	}
+	op.cancelled = true
+	return nil
+}
+
+// startExec records that the operation id runs its exec step, which
+// stops at its checkpoints if stoppable is set. Operations nested
+// within the operation keep the setting of the first exec. It returns
+// true, without starting the exec, if the operation was asked to stop.
+func (c *opCancels) startExec(id string, stoppable bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	if !ok {
+		return false
+	}
+	if op.cancelled {
+		return true
+	}
+	if !op.stoppableSet {
+		op.stoppable = stoppable
+		op.stoppableSet = true
+	}
+	op.progress.Phase = PhaseExec
+	op.progress.Command = ""
+	op.progress.Updated = asyncQueueNow().Unix()
+	return false
+}
+
+// stopExec returns true if the exec step of the operation id must
+// stop at its next checkpoint.
+func (c *opCancels) stopExec(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	return ok && op.cancelled && op.stoppable && op.progress.Phase == PhaseExec
+}
+
+// commit records that the operation id made its changes and can no
+// longer be cancelled. It returns true if a cancellation was requested
+// too late to be honored.
+func (c *opCancels) commit(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	if !ok {
+		return false
+	}
+	op.committed = true
+	return op.cancelled
+}
+
+// tracked returns true if the operation id is queued or running.
+func (c *opCancels) tracked(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.ops[id]
+	return ok
+}
+
+// cancelled returns true if the operation id was asked to stop.
+func (c *opCancels) cancelled(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	return ok && op.cancelled
+}
+
+// cancelOperation asks the operation id to stop, whether it is
+// waiting in the queue of the tracker or already running.
+func cancelOperation(ot *OpTracker, id string) error {
+	if ot.Dequeue(id) {
+		logger.Info("Cancelled queued operation [%v]", id)
+		return nil
+	}
+	if err := runningOps.cancel(id); err != nil {
+		return err
+	}
+	logger.Info("Requested cancellation of operation [%v]", id)
+	return nil
+}
@@ -159,7 +159,14 @@ func (dro *DeviceRemoveOperation) migrateBricks(
 	if err != nil {
 		return err
 	}
-	for _, brickId := range toEvict {
+	for i, brickId := range toEvict {
+		runningOps.setItems(dro.op.Id, "bricks", i, len(toEvict))
+		// stop between bricks if asked to, the bricks already
+		// evicted stay on their new devices
+		if runningOps.cancelled(dro.op.Id) {
+			logger.Info("%v cancelled with bricks left on device", dro.Label())
+			return ErrOperationCancelled
+		}
 		nestedOp := newRemoveBrickComboOperation(
 			dro,
 			NewBrickEvictOperation(brickId, dro.db, dro.healCheck))
@@ -168,6 +175,7 @@ func (dro *DeviceRemoveOperation) migrateBricks(
 			return err
 		}
 	}
+	runningOps.setItems(dro.op.Id, "bricks", len(toEvict), len(toEvict))
 	return nil
 }
 
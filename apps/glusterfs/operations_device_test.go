@@ -1164,3 +1164,94 @@ func TestDeviceRemoveOperationChildOpCleanup(t *testing.T) {
 		return nil
 	})
 }
+
+func TestDeviceRemoveOperationCancel(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		3,    // devices_per_node,
+		8*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 5; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	// grab the device with the most bricks
+	var d *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			e, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if d == nil || len(e.Bricks) > len(d.Bricks) {
+				d = e
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bricks := len(d.Bricks)
+	tests.Assert(t, bricks >= 2, "expected at least two bricks, got:", bricks)
+
+	err = d.SetState(app.db, app.executor, api.StateRequest{State: api.EntryStateOffline})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// cancel the removal while the first brick is moved
+	dro := NewDeviceRemoveOperation(d.Info.Id, app.db, api.HealCheckEnable)
+	replaced := 0
+	mockReplace := app.xo.MockVolumeReplaceBrick
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		replaced++
+		runningOps.cancel(dro.Id())
+		return mockReplace(host, volume, oldBrick, newBrick)
+	}
+
+	err = RunOperation(dro, app.executor)
+	tests.Assert(t, err == ErrOperationCancelled,
+		"expected err == ErrOperationCancelled, got:", err)
+	tests.Assert(t, replaced == 1, "expected replaced == 1, got:", replaced)
+	tests.Assert(t, !runningOps.cancelled(dro.Id()),
+		"expected operation to no longer be tracked")
+
+	// the moved brick stays moved, the rest stays on the device
+	err = app.db.View(func(tx *bolt.Tx) error {
+		l, err := PendingOperationList(tx)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(l) == 0, "expected len(l) == 0, got:", len(l))
+		d, err = NewDeviceEntryFromId(tx, d.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(d.Bricks) == bricks-1,
+		"expected", bricks-1, "bricks, got:", len(d.Bricks))
+	tests.Assert(t, d.State == api.EntryStateOffline,
+		"expected device to stay offline, got:", d.State)
+}
@@ -28,16 +28,44 @@ const (
 	TrackClean
 )
 
+// OpPriority orders operations waiting in the OpTracker's queue.
+type OpPriority int
+
+const (
+	// creates, the bulk of the work when provisioning
+	PriorityLow OpPriority = iota
+	PriorityNormal
+	// deletes and removals, which free or repair storage
+	PriorityHigh
+)
+
+// queuedOp is an operation waiting for the tracker to admit it.
+type queuedOp struct {
+	id       string
+	priority OpPriority
+	issuer   string
+	seq      uint64
+	ready    chan struct{}
+}
+
 // OpTracker is used to track and manage how many operations are being
-// processed by the server.
+// processed by the server. Operations over the limit may wait in a
+// queue, they are admitted by priority and, within a priority, such
+// that issuers with fewer running operations go first.
 type OpTracker struct {
 	// configuration
 	Limit uint64
+	// maximum number of waiting operations
+	QueueLimit uint64
 
 	// internals
 	lock      sync.RWMutex
 	normalOps map[string]bool
 	bgOps     map[string]bool
+	// issuers of admitted operations
+	issuers map[string]string
+	queue   []*queuedOp
+	seq     uint64
 }
 
 func newOpTracker(limit uint64) *OpTracker {
@@ -45,12 +73,13 @@ func newOpTracker(limit uint64) *OpTracker {
 		Limit:     limit,
 		normalOps: make(map[string]bool),
 		bgOps:     make(map[string]bool),
+		issuers:   make(map[string]string),
 	}
 }
 
 func (ot *OpTracker) insert(id string, c OpClass) error {
 	godbc.Require(id != "", "id must not be empty")
-	if ot.normalOps[id] || ot.bgOps[id] {
+	if ot.normalOps[id] || ot.bgOps[id] || ot.queued(id) >= 0 {
 		logger.Debug("id [%v] already tracked", id)
 		return ErrConflict
 	}
@@ -78,6 +107,8 @@ func (ot *OpTracker) Remove(id string) {
 	godbc.Require(ot.normalOps[id] || ot.bgOps[id], "id not tracked", id)
 	delete(ot.normalOps, id)
 	delete(ot.bgOps, id)
+	delete(ot.issuers, id)
+	ot.admit()
 }
 
 // Get returns the number of operations currently tracked.
@@ -87,8 +118,15 @@ func (ot *OpTracker) Get() uint64 {
 	return uint64(len(ot.normalOps) + len(ot.bgOps))
 }
 
+// Queued returns the number of operations waiting to be admitted.
+func (ot *OpTracker) Queued() uint64 {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	return uint64(len(ot.queue))
+}
+
 // Tracked returns a mapping of tracked IDs to booleans.
-// Booleans are always true.
+// Booleans are always true. Queued operations are not included.
 func (ot *OpTracker) Tracked() map[string]bool {
 	ot.lock.RLock()
 	defer ot.lock.RUnlock()
@@ -106,7 +144,8 @@ func (ot *OpTracker) Tracked() map[string]bool {
 // ThrottleOrAdd returns true if adding the operation would put
 // the number of operations over the limit, otherwise it adds
 // the operation and returns false. ThrottleOrAdd exists to perform
-// the check and set atomically.
+// the check and set atomically. Operations are also throttled
+// while other operations wait in the queue.
 func (ot *OpTracker) ThrottleOrAdd(id string, c OpClass) bool {
 	ot.lock.Lock()
 	defer ot.lock.Unlock()
@@ -126,6 +165,11 @@ func (ot *OpTracker) ThrottleOrAdd(id string, c OpClass) bool {
 			"operations in-flight (%v) exceeds limit (%v)", n, ot.Limit)
 		return true
 	}
+	if len(ot.queue) > 0 {
+		logger.Warning(
+			"operations waiting in queue (%v)", len(ot.queue))
+		return true
+	}
 	err := ot.insert(id, c)
 	if err == ErrConflict {
 		logger.Warning("operation [%v] already tracked, throttling", id)
@@ -136,6 +180,150 @@ func (ot *OpTracker) ThrottleOrAdd(id string, c OpClass) bool {
 	return false
 }
 
+// AddOrQueue adds the operation if the number of operations is below
+// the limit and no other operation is waiting, in which case the
+// returned channel is nil. Otherwise the operation is queued and
+// the returned channel is closed once the operation is admitted.
+// ErrTooManyOperations is returned if the queue is full.
+func (ot *OpTracker) AddOrQueue(id string, p OpPriority, issuer string) (<-chan struct{}, error) {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	if uint64(len(ot.normalOps)) < ot.Limit && len(ot.queue) == 0 {
+		if err := ot.insert(id, TrackNormal); err != nil {
+			return nil, err
+		}
+		ot.issuers[id] = issuer
+		return nil, nil
+	}
+	if uint64(len(ot.queue)) >= ot.QueueLimit {
+		logger.Warning(
+			"operations in queue (%v) exceeds limit (%v)",
+			len(ot.queue), ot.QueueLimit)
+		return nil, ErrTooManyOperations
+	}
+	if ot.normalOps[id] || ot.bgOps[id] || ot.queued(id) >= 0 {
+		return nil, ErrConflict
+	}
+	ot.seq++
+	q := &queuedOp{
+		id:       id,
+		priority: p,
+		issuer:   issuer,
+		seq:      ot.seq,
+		ready:    make(chan struct{}),
+	}
+	ot.queue = append(ot.queue, q)
+	return q.ready, nil
+}
+
+// Position returns the place of the operation in the order that the
+// waiting operations would be admitted in, starting at 1. It returns
+// 0 if the operation is not waiting.
+func (ot *OpTracker) Position(id string) int {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	for i, q := range ot.order() {
+		if q.id == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Dequeue removes a waiting operation from the queue without
+// admitting it. Its channel is closed but the operation is not
+// tracked. It returns false if the operation is not waiting.
+func (ot *OpTracker) Dequeue(id string) bool {
+	ot.lock.Lock()
+	defer ot.lock.Unlock()
+	i := ot.queued(id)
+	if i < 0 {
+		return false
+	}
+	q := ot.queue[i]
+	ot.queue = append(ot.queue[:i], ot.queue[i+1:]...)
+	close(q.ready)
+	return true
+}
+
+// admitted returns true if the operation is tracked, as it is after
+// leaving the queue unless it was removed by Dequeue.
+func (ot *OpTracker) admitted(id string) bool {
+	ot.lock.RLock()
+	defer ot.lock.RUnlock()
+	return ot.normalOps[id]
+}
+
+// queued returns the index of the operation in the queue or -1.
+func (ot *OpTracker) queued(id string) int {
+	for i, q := range ot.queue {
+		if q.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// running returns the number of admitted operations per issuer.
+func (ot *OpTracker) running() map[string]int {
+	counts := map[string]int{}
+	for _, issuer := range ot.issuers {
+		counts[issuer]++
+	}
+	return counts
+}
+
+// nextQueuedOp returns the index of the next operation to admit from
+// queue, given the number of running operations of each issuer.
+func nextQueuedOp(queue []*queuedOp, counts map[string]int) int {
+	best := 0
+	for i, q := range queue[1:] {
+		b := queue[best]
+		switch {
+		case q.priority != b.priority:
+			if q.priority > b.priority {
+				best = i + 1
+			}
+		case counts[q.issuer] != counts[b.issuer]:
+			if counts[q.issuer] < counts[b.issuer] {
+				best = i + 1
+			}
+		case q.seq < b.seq:
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// order returns the waiting operations in the order they would be
+// admitted in if no other operations were added.
+func (ot *OpTracker) order() []*queuedOp {
+	counts := ot.running()
+	queue := append([]*queuedOp{}, ot.queue...)
+	out := make([]*queuedOp, 0, len(queue))
+	for len(queue) > 0 {
+		i := nextQueuedOp(queue, counts)
+		q := queue[i]
+		queue = append(queue[:i], queue[i+1:]...)
+		counts[q.issuer]++
+		out = append(out, q)
+	}
+	return out
+}
+
+// admit starts waiting operations while below the limit.
+func (ot *OpTracker) admit() {
+	for uint64(len(ot.normalOps)) < ot.Limit && len(ot.queue) > 0 {
+		i := nextQueuedOp(ot.queue, ot.running())
+		q := ot.queue[i]
+		ot.queue = append(ot.queue[:i], ot.queue[i+1:]...)
+		ot.normalOps[q.id] = true
+		ot.issuers[q.id] = q.issuer
+		logger.Info("Admitted queued operation [%v]", q.id)
+		close(q.ready)
+	}
+}
+
 // ThrottleOrToken exists for use cases where throttling is required
 // but a pre-existing unique identifier does not. It will return
 // true and an empty-string if the number of operations is over the limit,
@@ -154,13 +342,30 @@ func runOperationAfterBuild(o Operation,
 
 	label := o.Label()
 	max_tries := o.MaxRetries() + 1
+	defer runningOps.track(o.Id())()
+	executor = newProgressExecutor(executor, o.Id())
 
 	for attempt := 1; ; attempt++ {
 		logger.Info("Trying %v (attempt #%v/%v)", label, attempt, max_tries)
 
+		if runningOps.startExec(o.Id(), execStoppable(o)) {
+			logger.Info("%v cancelled before exec", label)
+			runningOps.setPhase(o.Id(), PhaseRollback)
+			if rerr := o.Rollback(executor); rerr != nil {
+				logger.LogError("%v Rollback error: %v", label, rerr)
+				markFailedIfSupported(o)
+			}
+			return ErrOperationCancelled
+		}
+
 		err = o.Exec(executor)
 		if err == nil {
-			// success, exit
+			// the changes are made, a cancellation can no longer
+			// be honored without destroying them
+			if runningOps.commit(o.Id()) {
+				logger.Warning("%v cancellation came too late, "+
+					"operation completed", label)
+			}
 			break
 		}
 
@@ -171,12 +376,18 @@ func runOperationAfterBuild(o Operation,
 			err = oerr.OriginalError
 		}
 
+		runningOps.setPhase(o.Id(), PhaseRollback)
 		if rerr := o.Rollback(executor); rerr != nil {
 			logger.LogError("%v Rollback error: %v", label, rerr)
 			markFailedIfSupported(o)
 			return err
 		}
 
+		if runningOps.cancelled(o.Id()) {
+			logger.Info("%v cancelled, not retrying", label)
+			return ErrOperationCancelled
+		}
+
 		if attempt >= max_tries {
 			logger.LogError("Max tries (%v) consumed", max_tries)
 			return err
@@ -189,6 +400,7 @@ func runOperationAfterBuild(o Operation,
 
 		logger.Info("Retrying %v", label)
 
+		runningOps.setPhase(o.Id(), PhaseBuild)
 		if err := o.Build(); err != nil {
 			logger.LogError("%v Build Failed: %v", label, err)
 			return err
@@ -196,45 +408,178 @@ func runOperationAfterBuild(o Operation,
 	}
 
 	// if we reach this, we have succeeded
+	runningOps.setPhase(o.Id(), PhaseFinalize)
 	return o.Finalize()
 }
 
+// execStoppable returns true if the exec step of the operation can be
+// stopped between its commands. Operations creating storage stop
+// before their next brick or volume command, as their rollback undoes
+// a partial exec, and a device removal stops before its next brick.
+// The exec of other operations runs to its end once started.
+func execStoppable(op Operation) bool {
+	switch op.(type) {
+	case *VolumeCreateOperation, *BlockVolumeCreateOperation,
+		*VolumeExpandOperation, *VolumeCloneOperation,
+		*DeviceRemoveOperation:
+		return true
+	}
+	return false
+}
+
+// operationPriority returns the priority an operation is queued
+// with. Operations freeing or repairing storage go ahead of the ones
+// consuming it so that they are not starved during mass provisioning.
+func operationPriority(op Operation) OpPriority {
+	switch op.(type) {
+	case *VolumeDeleteOperation, *BlockVolumeDeleteOperation,
+		*DeviceRemoveOperation, *BrickEvictOperation:
+		return PriorityHigh
+	case *VolumeCreateOperation, *BlockVolumeCreateOperation,
+		*VolumeCloneOperation:
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
 // AsyncHttpOperation runs all the steps of an operation with the long-running
 // parts wrapped in an async http function. If AsyncHttpOperation returns nil
 // then it has started the async function and the caller should respond to the
 // client with success - otherwise an error object is returned. In the async
 // function the Exec and Finalize or Rollback steps of the operation will be
-// performed.
+// performed. If the server is busy the operation is queued and its Build
+// step is performed in the async function as well, once it is admitted.
 func AsyncHttpOperation(app *App,
 	w http.ResponseWriter,
 	r *http.Request,
 	op Operation) error {
 
-	// check if the request needs to be rate limited
-	if app.optracker.ThrottleOrAdd(op.Id(), TrackNormal) {
-		return ErrTooManyOperations
-	}
-
-	label := op.Label()
-	if err := op.Build(); err != nil {
-		logger.LogError("%v Build Failed: %v", label, err)
-		// creating the operation db data failed. this is no longer
-		// an in-flight operation
-		app.optracker.Remove(op.Id())
+	ready, err := app.optracker.AddOrQueue(
+		op.Id(), operationPriority(op), requestIssuer(r))
+	if err != nil {
 		return err
 	}
+	// track the operation from the start so that it can be
+	// cancelled while it waits or is built
+	untrack := runningOps.track(op.Id())
+	cancel := func() error {
+		return cancelOperation(app.optracker, op.Id())
+	}
 
-	app.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+	label := op.Label()
+	run := func() (string, error) {
 		// decrement the op counter once the operation is done
 		// either success or failure
 		defer app.optracker.Remove(op.Id())
+		defer untrack()
 		logger.Info("Started async operation: %v", label)
 		if err := runOperationAfterBuild(op, app.executor); err != nil {
 			return "", err
 		}
 
 		return op.ResourceUrl(), nil
-	})
+	}
+
+	if ready == nil {
+		runningOps.setPhase(op.Id(), PhaseBuild)
+		if err := op.Build(); err != nil {
+			logger.LogError("%v Build Failed: %v", label, err)
+			// creating the operation db data failed. this is no longer
+			// an in-flight operation
+			app.optracker.Remove(op.Id())
+			untrack()
+			return err
+		}
+		app.asyncManager.AsyncHttpRedirectOperation(w, r,
+			op.Id(), op.ResourceUrl(), cancel, run)
+		return nil
+	}
+
+	if ko, ok := op.(KeyedOperation); ok {
+		// the operation is not built until it leaves the queue,
+		// record its key now
+		if err := app.db.Update(ko.saveIdempotencyKey); err != nil {
+			logger.LogError("%v unable to save idempotency key: %v", label, err)
+			if !app.optracker.Dequeue(op.Id()) {
+				app.optracker.Remove(op.Id())
+			}
+			untrack()
+			return err
+		}
+	}
+	logger.Info("Queued operation [%v]: %v", op.Id(), label)
+	runningOps.setPhase(op.Id(), PhaseQueued)
+	app.asyncManager.AsyncHttpRedirectQueued(w, r,
+		op.Id(), op.ResourceUrl(),
+		func() int { return app.optracker.Position(op.Id()) },
+		cancel,
+		func(started func()) (string, error) {
+			<-ready
+			if !app.optracker.admitted(op.Id()) {
+				untrack()
+				return "", ErrOperationCancelled
+			}
+			if runningOps.cancelled(op.Id()) {
+				// cancelled as it left the queue
+				app.optracker.Remove(op.Id())
+				untrack()
+				return "", ErrOperationCancelled
+			}
+			runningOps.setPhase(op.Id(), PhaseBuild)
+			if err := op.Build(); err != nil {
+				logger.LogError("%v Build Failed: %v", label, err)
+				app.optracker.Remove(op.Id())
+				untrack()
+				return "", err
+			}
+			started()
+			return run()
+		})
+	return nil
+}
+
+// AsyncHttpTracked runs f in an async http function as a tracked
+// operation of the given priority, for long running requests that
+// are not implemented as a single Operation. Like AsyncHttpOperation
+// f waits in the queue if the server is busy.
+func AsyncHttpTracked(app *App,
+	w http.ResponseWriter,
+	r *http.Request,
+	p OpPriority,
+	f func() (string, error)) error {
+
+	token := idgen.GenUUID()
+	ready, err := app.optracker.AddOrQueue(token, p, requestIssuer(r))
+	if err != nil {
+		return err
+	}
+	run := func() (string, error) {
+		defer app.optracker.Remove(token)
+		return f()
+	}
+
+	if ready == nil {
+		app.asyncManager.AsyncHttpRedirectFunc(w, r, run)
+		return nil
+	}
+	// only waiting requests can be cancelled, once f runs the
+	// operations it starts must be cancelled by their own ids
+	app.asyncManager.AsyncHttpRedirectQueued(w, r, "", "",
+		func() int { return app.optracker.Position(token) },
+		func() error {
+			if !app.optracker.Dequeue(token) {
+				return fmt.Errorf("Request has started, cancel its pending operations instead")
+			}
+			return nil
+		},
+		func(started func()) (string, error) {
+			<-ready
+			if !app.optracker.admitted(token) {
+				return "", ErrOperationCancelled
+			}
+			started()
+			return run()
+		})
 	return nil
 }
 
@@ -10,11 +10,20 @@
 package glusterfs
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/heketi/tests"
 
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/heketi/v10/pkg/idgen"
+	"github.com/heketi/heketi/v10/server/rest"
 )
 
 func TestOpTrackerCounts(t *testing.T) {
@@ -207,3 +216,298 @@ func TestOpTrackerAssertions(t *testing.T) {
 	})
 	tests.Assert(t, ot.Get() == 3)
 }
+
+func isReady(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestOpTrackerQueuePriority(t *testing.T) {
+	ot := newOpTracker(1)
+	ot.QueueLimit = 10
+
+	ready, err := ot.AddOrQueue("run", PriorityNormal, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, ready == nil, "expected operation to be admitted")
+
+	create, err := ot.AddOrQueue("create", PriorityLow, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, create != nil, "expected operation to be queued")
+	del, err := ot.AddOrQueue("delete", PriorityHigh, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, del != nil, "expected operation to be queued")
+
+	tests.Assert(t, ot.Queued() == 2, "expected ot.Queued() == 2, got:", ot.Queued())
+	tests.Assert(t, ot.Position("delete") == 1,
+		"expected delete first, got:", ot.Position("delete"))
+	tests.Assert(t, ot.Position("create") == 2,
+		"expected create second, got:", ot.Position("create"))
+	tests.Assert(t, ot.Position("run") == 0,
+		"expected running op not to be queued, got:", ot.Position("run"))
+
+	// queued operations are not tracked yet
+	tests.Assert(t, !ot.Tracked()["delete"], "expected delete not tracked")
+
+	ot.Remove("run")
+	tests.Assert(t, isReady(del), "expected delete to be admitted")
+	tests.Assert(t, !isReady(create), "expected create to wait")
+	tests.Assert(t, ot.Get() == 1, "expected ot.Get() == 1, got:", ot.Get())
+	tests.Assert(t, ot.Position("create") == 1,
+		"expected create first, got:", ot.Position("create"))
+
+	ot.Remove("delete")
+	tests.Assert(t, isReady(create), "expected create to be admitted")
+	tests.Assert(t, ot.Queued() == 0, "expected ot.Queued() == 0, got:", ot.Queued())
+}
+
+func TestOpTrackerQueueFairness(t *testing.T) {
+	ot := newOpTracker(2)
+	ot.QueueLimit = 10
+
+	for _, id := range []string{"a1", "a2"} {
+		ready, err := ot.AddOrQueue(id, PriorityLow, "admin")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, ready == nil, "expected operation to be admitted")
+	}
+	a3, _ := ot.AddOrQueue("a3", PriorityLow, "admin")
+	a4, _ := ot.AddOrQueue("a4", PriorityLow, "admin")
+	u1, _ := ot.AddOrQueue("u1", PriorityLow, "user")
+
+	// the issuer without running operations goes first
+	tests.Assert(t, ot.Position("u1") == 1,
+		"expected u1 first, got:", ot.Position("u1"))
+	tests.Assert(t, ot.Position("a3") == 2,
+		"expected a3 second, got:", ot.Position("a3"))
+	tests.Assert(t, ot.Position("a4") == 3,
+		"expected a4 third, got:", ot.Position("a4"))
+
+	ot.Remove("a1")
+	tests.Assert(t, isReady(u1), "expected u1 to be admitted")
+	tests.Assert(t, !isReady(a3), "expected a3 to wait")
+	ot.Remove("a2")
+	tests.Assert(t, isReady(a3), "expected a3 to be admitted")
+	tests.Assert(t, !isReady(a4), "expected a4 to wait")
+}
+
+func TestOpTrackerQueueLimit(t *testing.T) {
+	ot := newOpTracker(1)
+	ot.QueueLimit = 1
+
+	_, err := ot.AddOrQueue("run", PriorityNormal, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = ot.AddOrQueue("q1", PriorityNormal, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = ot.AddOrQueue("q2", PriorityHigh, "")
+	tests.Assert(t, err == ErrTooManyOperations,
+		"expected err == ErrTooManyOperations, got:", err)
+	_, err = ot.AddOrQueue("q1", PriorityNormal, "")
+	tests.Assert(t, err == ErrTooManyOperations,
+		"expected err == ErrTooManyOperations, got:", err)
+
+	// other operations may not jump the queue
+	ot.Limit = 5
+	tests.Assert(t, ot.ThrottleOrAdd("bg", TrackClean),
+		"expected ThrottleOrAdd to throttle while ops are queued")
+}
+
+func TestAsyncHttpOperationQueued(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	app.optracker.Limit = 1
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 10
+	vol := NewVolumeEntryFromRequest(vreq)
+	err = vol.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// hold the creates in the executor
+	release := make(chan bool, 2)
+	mockVolumeCreate := app.xo.MockVolumeCreate
+	app.xo.MockVolumeCreate = func(host string, v *executors.VolumeRequest) (*executors.Volume, error) {
+		<-release
+		return mockVolumeCreate(host, v)
+	}
+
+	create := func() string {
+		r, err := http.Post(ts.URL+"/volumes", "application/json",
+			bytes.NewBufferString(`{"size": 10}`))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusAccepted,
+			"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+		return r.Header.Get("Location")
+	}
+	position := func(location string) string {
+		r, err := http.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return r.Header.Get(rest.QueuePositionHeader)
+	}
+
+	running := create()
+	queued := create()
+	tests.Assert(t, position(running) == "",
+		"expected no queue position, got:", position(running))
+	tests.Assert(t, position(queued) == "1",
+		"expected queue position 1, got:", position(queued))
+
+	// a delete goes ahead of the queued create
+	req, err := http.NewRequest("DELETE", ts.URL+"/volumes/"+vol.Info.Id, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	deleted := r.Header.Get("Location")
+	tests.Assert(t, position(deleted) == "1",
+		"expected queue position 1, got:", position(deleted))
+	tests.Assert(t, position(queued) == "2",
+		"expected queue position 2, got:", position(queued))
+
+	release <- true
+	release <- true
+	for _, location := range []string{running, deleted, queued} {
+		for {
+			r, err := http.Get(ts.URL + location)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			if r.Header.Get("X-Pending") != "true" {
+				tests.Assert(t, r.StatusCode == http.StatusOK ||
+					r.StatusCode == http.StatusNoContent,
+					"expected success, got:", r.StatusCode)
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+	tests.Assert(t, app.optracker.Get() == 0,
+		"expected no tracked operations, got:", app.optracker.Get())
+}
+
+func TestOpTrackerDequeue(t *testing.T) {
+	ot := newOpTracker(1)
+	ot.QueueLimit = 10
+
+	_, err := ot.AddOrQueue("run", PriorityNormal, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	q1, _ := ot.AddOrQueue("q1", PriorityNormal, "")
+	q2, _ := ot.AddOrQueue("q2", PriorityNormal, "")
+
+	tests.Assert(t, ot.Dequeue("q1"), "expected q1 to be dequeued")
+	tests.Assert(t, isReady(q1), "expected q1 to be released")
+	tests.Assert(t, !ot.admitted("q1"), "expected q1 not to be admitted")
+	tests.Assert(t, !ot.Dequeue("q1"), "expected q1 to be gone")
+	tests.Assert(t, !ot.Dequeue("run"), "expected running op not to be dequeued")
+	tests.Assert(t, ot.Position("q2") == 1,
+		"expected q2 at position 1, got:", ot.Position("q2"))
+
+	ot.Remove("run")
+	tests.Assert(t, isReady(q2), "expected q2 to be admitted")
+	tests.Assert(t, ot.admitted("q2"), "expected q2 to be admitted")
+}
+
+func TestAsyncHttpOperationCancel(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	app.optracker.Limit = 1
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// hold the running create in the executor
+	release := make(chan bool, 1)
+	mockVolumeCreate := app.xo.MockVolumeCreate
+	app.xo.MockVolumeCreate = func(host string, v *executors.VolumeRequest) (*executors.Volume, error) {
+		<-release
+		return mockVolumeCreate(host, v)
+	}
+
+	create := func() string {
+		r, err := http.Post(ts.URL+"/volumes", "application/json",
+			bytes.NewBufferString(`{"size": 10}`))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusAccepted,
+			"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+		return r.Header.Get("Location")
+	}
+	wait := func(location string) *http.Response {
+		for {
+			r, err := http.Get(ts.URL + location)
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+			if r.Header.Get("X-Pending") != "true" {
+				return r
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	running := create()
+	queued := create()
+
+	// a queued operation is removed from the queue
+	req, err := http.NewRequest("DELETE", ts.URL+queued, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, err := http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	r = wait(queued)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError,
+		"expected r.StatusCode == http.StatusInternalServerError, got:", r.StatusCode)
+	tests.Assert(t, app.optracker.Queued() == 0,
+		"expected empty queue, got:", app.optracker.Queued())
+
+	// a running operation is cancelled by its pending operation id
+	var opId string
+	for id := range app.optracker.Tracked() {
+		opId = id
+	}
+	r, err = http.Post(ts.URL+"/operations/pending/"+opId+"/cancel", "", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == running,
+		"expected", running, "got:", r.Header.Get("Location"))
+
+	// the create was already under way and completes
+	release <- true
+	r = wait(running)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+	tests.Assert(t, volumeCount(t, app) == 1,
+		"expected create to complete, got:", volumeCount(t, app))
+
+	// nothing left to cancel
+	r, err = http.Post(ts.URL+"/operations/pending/"+opId+"/cancel", "", nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound,
+		"expected r.StatusCode == http.StatusNotFound, got:", r.StatusCode)
+}
@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// Phases reported in the progress of a running operation
+const (
+	PhaseQueued   = "queued"
+	PhaseBuild    = "build"
+	PhaseExec     = "exec"
+	PhaseRollback = "rollback"
+	PhaseFinalize = "finalize"
+)
+
+// update applies f to the progress of the operation id, if it is
+// running.
+func (c *opCancels) update(id string, f func(p *api.OperationProgress)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	if !ok {
+		return
+	}
+	f(&op.progress)
+	op.progress.Updated = asyncQueueNow().Unix()
+}
+
+// setPhase records that the operation id entered the given phase.
+func (c *opCancels) setPhase(id, phase string) {
+	c.update(id, func(p *api.OperationProgress) {
+		p.Phase = phase
+		p.Command = ""
+	})
+}
+
+// setItems records that the operation id has done done out of total
+// items of the given kind.
+func (c *opCancels) setItems(id, items string, done, total int) {
+	c.update(id, func(p *api.OperationProgress) {
+		p.Items = items
+		p.Done = done
+		p.Total = total
+	})
+}
+
+// setCommand records the executor command the operation id runs.
+func (c *opCancels) setCommand(id, command string) {
+	c.update(id, func(p *api.OperationProgress) {
+		p.Command = command
+	})
+}
+
+// progress returns a copy of the progress of the operation id or nil
+// if the operation is not running or has not reported any progress.
+func (c *opCancels) progress(id string) *api.OperationProgress {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	op, ok := c.ops[id]
+	if !ok || op.progress.Phase == "" {
+		return nil
+	}
+	p := op.progress
+	return &p
+}
+
+// progressExecutor records the commands that change the storage in
+// the progress of the operation running them. Other commands are
+// passed through unrecorded. The commands creating storage are the
+// checkpoints where a stoppable exec stops once cancelled.
+type progressExecutor struct {
+	executors.Executor
+	opId string
+}
+
+func newProgressExecutor(e executors.Executor, opId string) executors.Executor {
+	return &progressExecutor{Executor: e, opId: opId}
+}
+
+func (e *progressExecutor) record(command, host, target string) {
+	runningOps.setCommand(e.opId,
+		fmt.Sprintf("%v %v on %v", command, target, host))
+}
+
+// checkpoint returns ErrOperationCancelled if the exec of the
+// operation must stop before running the command.
+func (e *progressExecutor) checkpoint(command string) error {
+	if runningOps.stopExec(e.opId) {
+		logger.Info("Operation [%v] cancelled before %v", e.opId, command)
+		return ErrOperationCancelled
+	}
+	return nil
+}
+
+func (e *progressExecutor) DeviceSetup(host, device, vgid string,
+	destroy bool) (*executors.DeviceInfo, error) {
+
+	e.record("DeviceSetup", host, device)
+	return e.Executor.DeviceSetup(host, device, vgid, destroy)
+}
+
+func (e *progressExecutor) DeviceTeardown(host string,
+	dh *executors.DeviceVgHandle) error {
+
+	e.record("DeviceTeardown", host, dh.VgId)
+	return e.Executor.DeviceTeardown(host, dh)
+}
+
+func (e *progressExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	if err := e.checkpoint("BrickCreate"); err != nil {
+		return nil, err
+	}
+	e.record("BrickCreate", host, brick.Name)
+	return e.Executor.BrickCreate(host, brick)
+}
+
+func (e *progressExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) (bool, error) {
+
+	e.record("BrickDestroy", host, brick.Name)
+	return e.Executor.BrickDestroy(host, brick)
+}
+
+func (e *progressExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	if err := e.checkpoint("VolumeCreate"); err != nil {
+		return nil, err
+	}
+	e.record("VolumeCreate", host, volume.Name)
+	return e.Executor.VolumeCreate(host, volume)
+}
+
+func (e *progressExecutor) VolumeDestroy(host string, volume string) error {
+	e.record("VolumeDestroy", host, volume)
+	return e.Executor.VolumeDestroy(host, volume)
+}
+
+func (e *progressExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	if err := e.checkpoint("VolumeExpand"); err != nil {
+		return nil, err
+	}
+	e.record("VolumeExpand", host, volume.Name)
+	return e.Executor.VolumeExpand(host, volume)
+}
+
+func (e *progressExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	e.record("VolumeReplaceBrick", host, volume)
+	return e.Executor.VolumeReplaceBrick(host, volume, oldBrick, newBrick)
+}
+
+func (e *progressExecutor) VolumeClone(host string,
+	vsr *executors.VolumeCloneRequest) (*executors.Volume, error) {
+
+	if err := e.checkpoint("VolumeClone"); err != nil {
+		return nil, err
+	}
+	e.record("VolumeClone", host, vsr.Volume)
+	return e.Executor.VolumeClone(host, vsr)
+}
+
+func (e *progressExecutor) HealInfo(host string,
+	volume string) (*executors.HealInfo, error) {
+
+	e.record("HealInfo", host, volume)
+	return e.Executor.HealInfo(host, volume)
+}
+
+func (e *progressExecutor) BlockVolumeCreate(host string,
+	blockVolume *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	if err := e.checkpoint("BlockVolumeCreate"); err != nil {
+		return nil, err
+	}
+	e.record("BlockVolumeCreate", host, blockVolume.Name)
+	return e.Executor.BlockVolumeCreate(host, blockVolume)
+}
+
+func (e *progressExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	e.record("BlockVolumeDestroy", host, blockVolumeName)
+	return e.Executor.BlockVolumeDestroy(host,
+		blockHostingVolumeName, blockVolumeName)
+}
+
+func (e *progressExecutor) BlockVolumeExpand(host string,
+	blockHostingVolumeName string, blockVolumeName string, newSize int) error {
+
+	e.record("BlockVolumeExpand", host, blockVolumeName)
+	return e.Executor.BlockVolumeExpand(host,
+		blockHostingVolumeName, blockVolumeName, newSize)
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func TestOperationProgress(t *testing.T) {
+	tests.Assert(t, runningOps.progress("p1") == nil,
+		"expected no progress for unknown operation")
+
+	untrack := runningOps.track("p1")
+	tests.Assert(t, runningOps.progress("p1") == nil,
+		"expected no progress before a phase is set")
+
+	runningOps.setPhase("p1", PhaseExec)
+	runningOps.setItems("p1", "bricks", 2, 5)
+	runningOps.setCommand("p1", "BrickCreate b1 on h1")
+	p := runningOps.progress("p1")
+	tests.Assert(t, p != nil, "expected progress")
+	tests.Assert(t, p.Phase == PhaseExec, "expected exec phase, got:", p.Phase)
+	tests.Assert(t, p.Done == 2 && p.Total == 5,
+		"expected 2/5, got:", p.Done, p.Total)
+	tests.Assert(t, p.Command == "BrickCreate b1 on h1",
+		"expected command, got:", p.Command)
+
+	// a new phase drops the command but keeps the items
+	runningOps.setPhase("p1", PhaseRollback)
+	p = runningOps.progress("p1")
+	tests.Assert(t, p.Command == "", "expected no command, got:", p.Command)
+	tests.Assert(t, p.Items == "bricks", "expected bricks, got:", p.Items)
+
+	untrack()
+	tests.Assert(t, runningOps.progress("p1") == nil,
+		"expected no progress once done")
+}
+
+func TestDeviceRemoveOperationProgress(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		3,    // devices_per_node,
+		8*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vreq := &api.VolumeCreateRequest{}
+	vreq.Size = 100
+	vreq.Durability.Type = api.DurabilityReplicate
+	vreq.Durability.Replicate.Replica = 3
+	for i := 0; i < 5; i++ {
+		v := NewVolumeEntryFromRequest(vreq)
+		err = v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	var d *DeviceEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		dl, err := DeviceList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range dl {
+			e, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if d == nil || len(e.Bricks) > len(d.Bricks) {
+				d = e
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bricks := len(d.Bricks)
+
+	err = d.SetState(app.db, app.executor, api.StateRequest{State: api.EntryStateOffline})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// look at the progress as each brick is moved
+	dro := NewDeviceRemoveOperation(d.Info.Id, app.db, api.HealCheckEnable)
+	seen := []api.OperationProgress{}
+	mockReplace := app.xo.MockVolumeReplaceBrick
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+		r, err := http.Get(ts.URL + "/operations/pending/" + dro.Id())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		var info api.PendingOperationDetails
+		err = json.NewDecoder(r.Body).Decode(&info)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, info.Progress != nil, "expected progress")
+		seen = append(seen, *info.Progress)
+		return mockReplace(host, volume, oldBrick, newBrick)
+	}
+
+	err = RunOperation(dro, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(seen) == bricks,
+		"expected", bricks, "updates, got:", len(seen))
+	for i, p := range seen {
+		tests.Assert(t, p.Phase == PhaseExec, "expected exec phase, got:", p.Phase)
+		tests.Assert(t, p.Items == "bricks", "expected bricks, got:", p.Items)
+		tests.Assert(t, p.Done == i, "expected", i, "done, got:", p.Done)
+		tests.Assert(t, p.Total == bricks,
+			"expected", bricks, "total, got:", p.Total)
+		tests.Assert(t, strings.HasPrefix(p.Command, "VolumeReplaceBrick"),
+			"expected replace brick command, got:", p.Command)
+	}
+	tests.Assert(t, runningOps.progress(dro.Id()) == nil,
+		"expected no progress once done")
+}
@@ -419,6 +419,78 @@ func TestRunOperationExecRetryRollbackFail(t *testing.T) {
 		"expected build_cc == 1, got:", build_cc)
 }
 
+func TestRunOperationCancelAfterExec(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	app := NewTestApp(tmpfile)
+
+	o := &testOperation{label: "X"}
+	o.rurl = "/myresource"
+	o.exec = func() error {
+		// the exec of the operation can not be stopped once started
+		err := runningOps.cancel(o.Id())
+		tests.Assert(t, err == ErrCancelRunning,
+			"expected err == ErrCancelRunning, got:", err)
+		return nil
+	}
+	rollback_cc := 0
+	o.rollback = func() error {
+		rollback_cc++
+		return nil
+	}
+	finalize_cc := 0
+	o.finalize = func() error {
+		finalize_cc++
+		err := runningOps.cancel(o.Id())
+		tests.Assert(t, err == ErrCancelTooLate,
+			"expected err == ErrCancelTooLate, got:", err)
+		return nil
+	}
+	e := RunOperation(o, app.executor)
+	tests.Assert(t, e == nil, "expected e == nil, got:", e)
+	tests.Assert(t, rollback_cc == 0,
+		"expected rollback_cc == 0, got:", rollback_cc)
+	tests.Assert(t, finalize_cc == 1,
+		"expected finalize_cc == 1, got:", finalize_cc)
+}
+
+func TestRunOperationCancelBetweenRetries(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+	app := NewTestApp(tmpfile)
+
+	o := &testOperation{label: "X"}
+	o.rurl = "/myresource"
+	o.retryMax = 4
+	exec_cc := 0
+	o.exec = func() error {
+		exec_cc++
+		return OperationRetryError{
+			OriginalError: fmt.Errorf("foobar"),
+		}
+	}
+	rollback_cc := 0
+	o.rollback = func() error {
+		rollback_cc++
+		err := runningOps.cancel(o.Id())
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return nil
+	}
+	build_cc := 0
+	o.build = func() error {
+		build_cc++
+		return nil
+	}
+	e := RunOperation(o, app.executor)
+	tests.Assert(t, e == ErrOperationCancelled,
+		"expected e == ErrOperationCancelled, got:", e)
+	tests.Assert(t, exec_cc == 1, "expected exec_cc == 1, got:", exec_cc)
+	tests.Assert(t, rollback_cc == 1,
+		"expected rollback_cc == 1, got:", rollback_cc)
+	tests.Assert(t, build_cc == 1,
+		"expected build_cc == 1, got:", build_cc)
+}
+
 func TestRunOperationExecRetryThenBuildFail(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -102,7 +102,7 @@ func (vc *VolumeCreateOperation) Build() error {
 		if e := vc.op.Save(tx); e != nil {
 			return e
 		}
-		return nil
+		return vc.saveIdempotencyKey(tx)
 	})
 }
 
@@ -472,6 +472,73 @@ func TestVolumeCreateOperationBasics(t *testing.T) {
 		vc.ResourceUrl())
 }
 
+func TestVolumeCreateOperationCancelDuringExec(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	vol := NewVolumeEntryFromRequest(req)
+	vc := NewVolumeCreateOperation(vol, app.db)
+
+	// cancelled while the bricks are created, the volume is not
+	var lock sync.Mutex
+	cancelErrs := []error{}
+	brickCreate := app.xo.MockBrickCreate
+	app.xo.MockBrickCreate = func(host string,
+		brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+		lock.Lock()
+		cancelErrs = append(cancelErrs, runningOps.cancel(vc.Id()))
+		lock.Unlock()
+		return brickCreate(host, brick)
+	}
+	volumeCreates := 0
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+		volumeCreates++
+		return &executors.Volume{}, nil
+	}
+
+	err = RunOperation(vc, app.executor)
+	tests.Assert(t, err == ErrOperationCancelled,
+		"expected err == ErrOperationCancelled, got:", err)
+	tests.Assert(t, len(cancelErrs) > 0 && cancelErrs[0] == nil,
+		"expected cancellation accepted, got:", cancelErrs)
+	tests.Assert(t, volumeCreates == 0,
+		"expected volumeCreates == 0, got:", volumeCreates)
+
+	// the bricks already created were rolled back
+	app.db.View(func(tx *bolt.Tx) error {
+		vl, e := VolumeList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(vl) == 0, "expected len(vl) == 0, got", len(vl))
+		bl, e := BrickList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(bl) == 0, "expected len(bl) == 0, got", len(bl))
+		pol, e := PendingOperationList(tx)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, len(pol) == 0, "expected len(pol) == 0, got", len(pol))
+		return nil
+	})
+}
+
 // Test that volume create operations can retry with some
 // "bad nodes" and still succeed overall.
 func TestVolumeCreateOperationRetrying(t *testing.T) {
@@ -1284,3 +1351,97 @@ func TestVolumeCreateLimits(t *testing.T) {
 	})
 
 }
+
+func TestVolumeCloneExpandOperation(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockVolumeClone = func(host string, vcr *executors.VolumeCloneRequest) (*executors.Volume, error) {
+		orig, _ := mockVolumeInfoFromDb(app.db, vcr.Volume)
+		clone := &executors.Volume{VolumeName: vcr.Clone, ID: vcr.Clone}
+		for _, b := range orig.Bricks.BrickList {
+			clone.Bricks.BrickList = append(clone.Bricks.BrickList,
+				executors.Brick{Name: b.Name + "_clone"})
+		}
+		return clone, nil
+	}
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 1024
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+
+	vol := NewVolumeEntryFromRequest(req)
+	err = vol.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vc := NewVolumeCloneOperation(vol, app.db, "myclone")
+	err = RunOperation(vc, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the clone is expanded like the volume it was cloned from
+	var clone *VolumeEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clone, err = NewVolumeEntryFromId(tx, vc.clone.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, clone.Durability != nil, "expected clone.Durability != nil")
+
+	ve := NewVolumeExpandOperation(clone, app.db, 100)
+	err = RunOperation(ve, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.db.View(func(tx *bolt.Tx) error {
+		v, e := NewVolumeEntryFromId(tx, clone.Info.Id)
+		tests.Assert(t, e == nil, "expected e == nil, got", e)
+		tests.Assert(t, v.Info.Size == 1124, "expected size 1124, got:", v.Info.Size)
+		tests.Assert(t, len(v.Bricks) == 6, "expected len(v.Bricks) == 6, got:", len(v.Bricks))
+		return nil
+	})
+}
+
+func TestUpdateCloneBrickPathsMismatch(t *testing.T) {
+	bricks := []*BrickEntry{}
+	orig := &executors.Volume{}
+	for i := 0; i < 3; i++ {
+		b := NewBrickEntry(100, 10, 5, "d", "n", 0, "v")
+		b.Info.Path = fmt.Sprintf("/brick%v", i)
+		bricks = append(bricks, b)
+		orig.Bricks.BrickList = append(orig.Bricks.BrickList,
+			executors.Brick{Name: "host:" + b.Info.Path})
+	}
+
+	// the clone has lost a brick
+	clone := &executors.Volume{ID: "clone"}
+	clone.Bricks.BrickList = orig.Bricks.BrickList[:2]
+	err := updateCloneBrickPaths(bricks, orig, clone)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, strings.Contains(err.Error(), "clone bricks"),
+		"expected clone bricks error, got:", err)
+
+	clone.Bricks.BrickList = []executors.Brick{}
+	for _, b := range orig.Bricks.BrickList {
+		clone.Bricks.BrickList = append(clone.Bricks.BrickList,
+			executors.Brick{Name: b.Name + "_clone"})
+	}
+	err = updateCloneBrickPaths(bricks, orig, clone)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bricks[1].Info.Path == "/brick1_clone", "got:", bricks[1].Info.Path)
+}
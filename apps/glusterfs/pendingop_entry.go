@@ -476,9 +476,53 @@ func (p *PendingOperationEntry) consistencyCheck(db Db) (response DbEntryCheckRe
 			response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Pending Op %v unexpected change type %v", p.Id, action.Change))
 		}
 	}
+	if p.orphaned(db) {
+		response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Pending Op %v has no entries left to act on", p.Id))
+		response.Issues = append(response.Issues, newDbIssue(DbIssueOrphanPendingOp,
+			"pendingop", p.Id, "",
+			fmt.Sprintf("Pending Op %v has no entries left to act on", p.Id),
+			"Remove the pending operation"))
+	}
 	return
 }
 
+// orphaned returns true if none of the entries changed by the
+// pending operation is left in the db.
+func (p *PendingOperationEntry) orphaned(db Db) bool {
+	for _, action := range p.Actions {
+		switch action.Change {
+		case OpAddBrick, OpDeleteBrick:
+			if db.Bricks[action.Id].Pending.Id == p.Id {
+				return false
+			}
+		case OpAddVolume, OpDeleteVolume, OpCloneVolume, OpSnapshotVolume, OpAddVolumeClone:
+			if db.Volumes[action.Id].Pending.Id == p.Id {
+				return false
+			}
+		case OpAddBlockVolume, OpDeleteBlockVolume:
+			if db.BlockVolumes[action.Id].Pending.Id == p.Id {
+				return false
+			}
+		case OpExpandVolume:
+			if _, found := db.Volumes[action.Id]; found {
+				return false
+			}
+		case OpExpandBlockVolume:
+			if _, found := db.BlockVolumes[action.Id]; found {
+				return false
+			}
+		case OpRemoveDevice:
+			if _, found := db.Devices[action.Id]; found {
+				return false
+			}
+		default:
+			// unknown changes may refer to anything
+			return false
+		}
+	}
+	return true
+}
+
 func findChange(actions []PendingOperationAction, c PendingChangeType) int {
 	for i, action := range actions {
 		if action.Change == c {
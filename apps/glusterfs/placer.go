@@ -52,6 +52,10 @@ type PlacementOpts interface {
 	SetCount() int
 	// AverageFileSize returns the average file size for the volume
 	AverageFileSize() uint64
+	// AverageFileSizeIsDefault returns true if the average file size
+	// was not provided for the volume, and may be overridden by the
+	// tags of the device hosting an arbiter brick
+	AverageFileSizeIsDefault() bool
 }
 
 // DeviceFilter functions can be defined by the caller of a
@@ -44,6 +44,9 @@ type arbiterOpts struct {
 	// used to determine if the device should be
 	// updated with the brick ID
 	recordBrick bool
+	// size of the data bricks, set if the size of the arbiter
+	// brick depends on the tags of the device
+	dataBrickSize uint64
 }
 
 func newArbiterOpts(opts PlacementOpts) *arbiterOpts {
@@ -59,12 +62,42 @@ func newArbiterOpts(opts PlacementOpts) *arbiterOpts {
 
 func (aopts *arbiterOpts) discount(index int) (err error) {
 	if index == arbiter_index {
+		dataBrickSize := aopts.brickSize
 		aopts.brickSize, err = discountBrickSize(
-			aopts.brickSize, aopts.o.AverageFileSize())
+			dataBrickSize, aopts.o.AverageFileSize())
+		if err == nil && aopts.o.AverageFileSizeIsDefault() {
+			aopts.dataBrickSize = dataBrickSize
+		}
 	}
 	return
 }
 
+// discountForDevice sizes the arbiter brick by the average file size
+// tag of the device or its node, if any. It returns tryPlaceAgain if
+// the brick can not be sized for the device.
+func (aopts *arbiterOpts) discountForDevice(
+	dsrc DeviceSource, device *DeviceEntry) error {
+
+	if aopts.dataBrickSize == 0 {
+		return nil
+	}
+	n, err := dsrc.Node(device.NodeId)
+	if err != nil {
+		return err
+	}
+	size, ok := AverageFileSizeTag(MergeTags(n, device))
+	if !ok {
+		size = aopts.o.AverageFileSize()
+	}
+	aopts.brickSize, err = discountBrickSize(aopts.dataBrickSize, size)
+	if err != nil {
+		logger.Debug("Unable to size arbiter brick for device %v: %v",
+			device.Info.Id, err)
+		return tryPlaceAgain
+	}
+	return nil
+}
+
 // NewArbiterBrickPlacer returns a new placer for bricks in
 // a volume that supports the arbiter feature.
 func NewArbiterBrickPlacer() *ArbiterBrickPlacer {
@@ -223,8 +256,11 @@ func (bp *ArbiterBrickPlacer) placeBrickInSet(
 			return err
 		}
 
-		err = bp.tryPlaceBrickOnDevice(
-			opts, pred, bs, ds, index, device)
+		err = opts.discountForDevice(dsrc, device)
+		if err == nil {
+			err = bp.tryPlaceBrickOnDevice(
+				opts, pred, bs, ds, index, device)
+		}
 		switch err {
 		case tryPlaceAgain:
 			continue
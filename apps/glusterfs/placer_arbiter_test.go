@@ -109,6 +109,8 @@ type TestPlacementOpts struct {
 	setSize         int
 	setCount        int
 	averageFileSize uint64
+	// the average file size is a default that device tags override
+	averageFileSizeIsDefault bool
 }
 
 func (tpo *TestPlacementOpts) BrickSizes() (uint64, float64) {
@@ -135,6 +137,10 @@ func (tpo *TestPlacementOpts) AverageFileSize() uint64 {
 	return tpo.averageFileSize
 }
 
+func (tpo *TestPlacementOpts) AverageFileSizeIsDefault() bool {
+	return tpo.averageFileSizeIsDefault
+}
+
 func TestTestDeviceSource(t *testing.T) {
 	dsrc := NewTestDeviceSource()
 	dsrc.QuickAdd(
@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lpabon/godbc"
+)
+
+// Weights of the scores of the devices considered by the capacity
+// placer. Free space dominates, so that larger and emptier devices
+// receive the bricks first. Placing a brick in a zone not yet used by
+// its set outweighs both other scores.
+const (
+	capacityFreeWeight   = 1.0
+	capacityBricksWeight = 0.25
+	capacityZoneWeight   = 2.0
+)
+
+// CapacityBrickPlacer is a Brick Placer implementation that places
+// each brick on the device with the best score, instead of following
+// the pseudo-random order of the simple allocator ring. Devices are
+// scored by their free space left after the brick is placed, by the
+// number of bricks they host and by whether their zone is already
+// used by the brick set. This keeps small devices from filling up
+// long before large ones in clusters of heterogeneous devices.
+type CapacityBrickPlacer struct{}
+
+// NewCapacityBrickPlacer returns a new placer for bricks in
+// heterogeneous clusters.
+func NewCapacityBrickPlacer() *CapacityBrickPlacer {
+	return &CapacityBrickPlacer{}
+}
+
+func (bp *CapacityBrickPlacer) PlaceAll(
+	dsrc DeviceSource,
+	opts PlacementOpts,
+	pred DeviceFilter) (
+	*BrickAllocation, error) {
+
+	r := &BrickAllocation{
+		BrickSets:  []*BrickSet{},
+		DeviceSets: []*DeviceSet{},
+	}
+
+	candidates, err := capacityCandidates(dsrc)
+	if err != nil {
+		return r, err
+	}
+
+	ssize := opts.SetSize()
+	for sn := 0; sn < opts.SetCount(); sn++ {
+		logger.Info("Allocating brick set #%v", sn)
+
+		bs := NewBrickSet(ssize)
+		ds := NewDeviceSet(ssize)
+		for i := 0; i < ssize; i++ {
+			brick, device, err := bp.placeBrick(
+				dsrc, opts, pred, candidates, bs)
+			if err != nil {
+				return r, err
+			}
+			bs.Add(brick)
+			ds.Add(device)
+			device.BrickAdd(brick.Id())
+		}
+		r.BrickSets = append(r.BrickSets, bs)
+		r.DeviceSets = append(r.DeviceSets, ds)
+	}
+
+	return r, nil
+}
+
+func (bp *CapacityBrickPlacer) Replace(
+	dsrc DeviceSource,
+	opts PlacementOpts,
+	pred DeviceFilter,
+	bs *BrickSet,
+	index int) (
+	*BrickAllocation, error) {
+
+	if index < 0 || index >= bs.SetSize {
+		return nil, fmt.Errorf(
+			"brick replace index out of bounds (got %v, set size %v)",
+			index, bs.SetSize)
+	}
+	logger.Info("Replace brick in brick set %v with index %v",
+		bs, index)
+
+	r := &BrickAllocation{
+		BrickSets:  []*BrickSet{NewBrickSet(bs.SetSize)},
+		DeviceSets: []*DeviceSet{NewDeviceSet(bs.SetSize)},
+	}
+
+	candidates, err := capacityCandidates(dsrc)
+	if err != nil {
+		return r, err
+	}
+
+	// the remaining bricks of the set, without changing bs
+	others := NewBrickSet(bs.SetSize)
+	for i, b := range bs.Bricks {
+		if i != index {
+			others.Add(b)
+		}
+	}
+
+	brick, device, err := bp.placeBrick(dsrc, opts, pred, candidates, others)
+	if err != nil {
+		return r, err
+	}
+
+	err = replaceInSets(dsrc, r, bs, index, brick, device)
+	return r, err
+}
+
+// placeBrick allocates a brick for the set bs on the candidate device
+// with the best score.
+func (bp *CapacityBrickPlacer) placeBrick(
+	dsrc DeviceSource,
+	opts PlacementOpts,
+	pred DeviceFilter,
+	candidates []string,
+	bs *BrickSet) (*BrickEntry, *DeviceEntry, error) {
+
+	zones := map[int]bool{}
+	nodes := map[string]bool{}
+	for _, b := range bs.Bricks {
+		node, err := dsrc.Node(b.Info.NodeId)
+		if err != nil {
+			return nil, nil, err
+		}
+		zones[node.Info.Zone] = true
+		nodes[node.Info.Id] = true
+	}
+
+	brickSize, snapFactor := opts.BrickSizes()
+	scored := []deviceScore{}
+	var maxFree uint64
+	for _, id := range candidates {
+		device, err := dsrc.Device(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if nodes[device.NodeId] {
+			continue
+		}
+		if pred != nil && !pred(bs, device) {
+			continue
+		}
+		sn := device.SpaceNeeded(brickSize, snapFactor)
+		if !device.StorageCheck(sn.Total) {
+			continue
+		}
+		node, err := dsrc.Node(device.NodeId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		free := device.Info.Storage.Free - sn.Total
+		if free > maxFree {
+			maxFree = free
+		}
+		scored = append(scored, deviceScore{
+			device:  device,
+			free:    free,
+			newZone: !zones[node.Info.Zone],
+		})
+	}
+	if len(scored) == 0 {
+		return nil, nil, ErrNoSpace
+	}
+
+	for i := range scored {
+		scored[i].score = scored[i].compute(maxFree)
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].device.Info.Id < scored[j].device.Info.Id
+	})
+
+	best := scored[0].device
+	brick := tryAllocateBrickOnDevice(opts, pred, best, bs)
+	godbc.Check(brick != nil, "space was checked on", best.Info.Id)
+	logger.Debug("Placing brick %v on device %v with score %.3f",
+		brick.Id(), best.Info.Id, scored[0].score)
+	return brick, best, nil
+}
+
+// deviceScore holds the inputs of the score of a device for the
+// placement of a brick.
+type deviceScore struct {
+	device  *DeviceEntry
+	free    uint64
+	newZone bool
+	score   float64
+}
+
+// compute returns the score of the device, maxFree being the largest
+// free space left among the devices considered.
+func (s deviceScore) compute(maxFree uint64) float64 {
+	score := capacityBricksWeight / float64(1+len(s.device.Bricks))
+	if maxFree > 0 {
+		score += capacityFreeWeight * float64(s.free) / float64(maxFree)
+	}
+	if s.newZone {
+		score += capacityZoneWeight
+	}
+	return score
+}
+
+// capacityCandidates returns the ids of the devices of the device
+// source. The entries themselves must be looked up with Device, which
+// returns the entries updated by the bricks placed so far.
+func capacityCandidates(dsrc DeviceSource) ([]string, error) {
+	dnl, err := dsrc.Devices()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(dnl))
+	for _, dan := range dnl {
+		ids = append(ids, dan.Device.Info.Id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func TestCapacityPlacerPreferLargeDevices(t *testing.T) {
+	dsrc := NewTestDeviceSource()
+	dsrc.QuickAdd("n1", "d1", "/dev/x", 100*GB)
+	dsrc.QuickAdd("n2", "d2", "/dev/x", 100*GB)
+	dsrc.QuickAdd("n3", "d3", "/dev/x", 100*GB)
+	dsrc.QuickAdd("n4", "d4", "/dev/x", 1*TB)
+
+	opts := &TestPlacementOpts{
+		brickSize:       10 * GB,
+		brickSnapFactor: 1,
+		setSize:         3,
+		setCount:        4,
+		averageFileSize: 64 * KB,
+	}
+
+	ba, err := NewCapacityBrickPlacer().PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(ba.BrickSets) == 4,
+		"expected len(ba.BrickSets) == 4, got:", len(ba.BrickSets))
+	for _, ds := range ba.DeviceSets {
+		tests.Assert(t, len(ds.Devices) == 3,
+			"expected len(ds.Devices) == 3, got:", len(ds.Devices))
+		// the large device gets a brick of every set
+		tests.Assert(t, ds.Devices[0].Info.Id == "d4",
+			"expected ds.Devices[0].Info.Id == \"d4\", got:",
+			ds.Devices[0].Info.Id)
+		nodes := map[string]bool{}
+		for _, d := range ds.Devices {
+			nodes[d.NodeId] = true
+		}
+		tests.Assert(t, len(nodes) == 3, "expected 3 nodes, got:", nodes)
+	}
+	tests.Assert(t, len(dsrc.devices["d4"].Bricks) == 4,
+		"expected 4 bricks on d4, got:", len(dsrc.devices["d4"].Bricks))
+
+	// the small devices are filled evenly
+	for _, id := range []string{"d1", "d2", "d3"} {
+		tests.Assert(t, len(dsrc.devices[id].Bricks) == 2 ||
+			len(dsrc.devices[id].Bricks) == 3,
+			"expected 2 or 3 bricks on", id, "got:",
+			len(dsrc.devices[id].Bricks))
+	}
+}
+
+func TestCapacityPlacerPreferNewZones(t *testing.T) {
+	dsrc := NewTestDeviceSource()
+	dsrc.QuickAdd("n1", "d1", "/dev/x", 1*TB)
+	dsrc.QuickAdd("n2", "d2", "/dev/x", 1*TB)
+	dsrc.QuickAdd("n3", "d3", "/dev/x", 100*GB)
+	dsrc.nodes["n3"].Info.Zone = 2
+
+	opts := &TestPlacementOpts{
+		brickSize:       10 * GB,
+		brickSnapFactor: 1,
+		setSize:         2,
+		setCount:        1,
+		averageFileSize: 64 * KB,
+	}
+
+	ba, err := NewCapacityBrickPlacer().PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ds := ba.DeviceSets[0]
+	tests.Assert(t, ds.Devices[0].Info.Id == "d1",
+		"expected ds.Devices[0].Info.Id == \"d1\", got:", ds.Devices[0].Info.Id)
+	tests.Assert(t, ds.Devices[1].Info.Id == "d3",
+		"expected ds.Devices[1].Info.Id == \"d3\", got:", ds.Devices[1].Info.Id)
+}
+
+func TestCapacityPlacerNoSpace(t *testing.T) {
+	dsrc := NewTestDeviceSource()
+	dsrc.QuickAdd("n1", "d1", "/dev/x", 100*GB)
+	dsrc.QuickAdd("n2", "d2", "/dev/x", 100*GB)
+	dsrc.QuickAdd("n3", "d3", "/dev/x", 5*GB)
+
+	opts := &TestPlacementOpts{
+		brickSize:       10 * GB,
+		brickSnapFactor: 1,
+		setSize:         3,
+		setCount:        1,
+		averageFileSize: 64 * KB,
+	}
+
+	_, err := NewCapacityBrickPlacer().PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == ErrNoSpace, "expected err == ErrNoSpace, got:", err)
+
+	// the filter is applied to the devices
+	opts.setSize = 2
+	_, err = NewCapacityBrickPlacer().PlaceAll(dsrc, opts,
+		func(bs *BrickSet, d *DeviceEntry) bool {
+			return d.Info.Id != "d2"
+		})
+	tests.Assert(t, err == ErrNoSpace, "expected err == ErrNoSpace, got:", err)
+}
+
+func TestCapacityPlacerReplace(t *testing.T) {
+	dsrc := NewTestDeviceSource()
+	dsrc.QuickAdd("n1", "d1", "/dev/x", 500*GB)
+	dsrc.QuickAdd("n2", "d2", "/dev/x", 400*GB)
+	dsrc.QuickAdd("n3", "d3", "/dev/x", 300*GB)
+	dsrc.QuickAdd("n4", "d4", "/dev/x", 200*GB)
+
+	opts := &TestPlacementOpts{
+		brickSize:       10 * GB,
+		brickSnapFactor: 1,
+		setSize:         3,
+		setCount:        1,
+		averageFileSize: 64 * KB,
+	}
+
+	bp := NewCapacityBrickPlacer()
+	ba, err := bp.PlaceAll(dsrc, opts, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bs := ba.BrickSets[0]
+	tests.Assert(t, ba.DeviceSets[0].Devices[2].Info.Id == "d3",
+		"expected ba.DeviceSets[0].Devices[2].Info.Id == \"d3\", got:",
+		ba.DeviceSets[0].Devices[2].Info.Id)
+	orig := append([]*BrickEntry{}, bs.Bricks...)
+
+	_, err = bp.Replace(dsrc, opts, nil, bs, 3)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// the device of the replaced brick is filtered out as when
+	// replacing the brick of a failed device
+	ba, err = bp.Replace(dsrc, opts,
+		func(bs *BrickSet, d *DeviceEntry) bool {
+			return d.Info.Id != "d1"
+		}, bs, 0)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	rbs := ba.BrickSets[0]
+	rds := ba.DeviceSets[0]
+	tests.Assert(t, len(rbs.Bricks) == 3,
+		"expected len(rbs.Bricks) == 3, got:", len(rbs.Bricks))
+	tests.Assert(t, rds.Devices[0].Info.Id == "d4",
+		"expected rds.Devices[0].Info.Id == \"d4\", got:", rds.Devices[0].Info.Id)
+	tests.Assert(t, rbs.Bricks[0].Info.DeviceId == "d4",
+		"expected rbs.Bricks[0].Info.DeviceId == \"d4\", got:",
+		rbs.Bricks[0].Info.DeviceId)
+	for i := 1; i < 3; i++ {
+		tests.Assert(t, rbs.Bricks[i] == orig[i],
+			"expected brick", i, "to be kept")
+	}
+	// the original set is not modified
+	for i := range orig {
+		tests.Assert(t, bs.Bricks[i] == orig[i],
+			"expected original brick", i, "to be unchanged")
+	}
+}
+
+func TestPlacerForVolumeAllocator(t *testing.T) {
+	orig := BrickAllocator
+	defer func() {
+		BrickAllocator = orig
+	}()
+
+	v := NewVolumeEntryFromRequest(&api.VolumeCreateRequest{Size: 1})
+
+	BrickAllocator = BRICK_ALLOCATOR_SIMPLE
+	_, ok := PlacerForVolume(v).(*StandardBrickPlacer)
+	tests.Assert(t, ok, "expected a StandardBrickPlacer")
+
+	BrickAllocator = "invalid"
+	_, ok = PlacerForVolume(v).(*StandardBrickPlacer)
+	tests.Assert(t, ok, "expected a StandardBrickPlacer")
+
+	BrickAllocator = BRICK_ALLOCATOR_CAPACITY
+	_, ok = PlacerForVolume(v).(*CapacityBrickPlacer)
+	tests.Assert(t, ok, "expected a CapacityBrickPlacer")
+
+	// arbiter volumes keep their own placer
+	v.GlusterVolumeOptions = []string{"user.heketi.arbiter true"}
+	_, ok = PlacerForVolume(v).(*ArbiterBrickPlacer)
+	tests.Assert(t, ok, "expected an ArbiterBrickPlacer")
+}
@@ -20,3 +20,15 @@ const (
 var (
 	ZoneChecking = ZONE_CHECKING_NONE
 )
+
+type BrickAllocatorStrategy string
+
+const (
+	BRICK_ALLOCATOR_UNSET    BrickAllocatorStrategy = ""
+	BRICK_ALLOCATOR_SIMPLE   BrickAllocatorStrategy = "simple"
+	BRICK_ALLOCATOR_CAPACITY BrickAllocatorStrategy = "capacity"
+)
+
+var (
+	BrickAllocator = BRICK_ALLOCATOR_SIMPLE
+)
@@ -13,5 +13,15 @@ func PlacerForVolume(v *VolumeEntry) BrickPlacer {
 	if v.HasArbiterOption() {
 		return NewArbiterBrickPlacer()
 	}
+
+	switch BrickAllocator {
+	case BRICK_ALLOCATOR_CAPACITY:
+		return NewCapacityBrickPlacer()
+	case BRICK_ALLOCATOR_SIMPLE, BRICK_ALLOCATOR_UNSET:
+	default:
+		logger.Warning(
+			"BrickAllocator set to unknown value '%v', "+
+				"treating as 'simple'", BrickAllocator)
+	}
 	return NewStandardBrickPlacer()
 }
@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+const (
+	BOLTDB_BUCKET_PROFILE = "PROFILE"
+)
+
+// ProfileEntry stores a named placement profile.
+type ProfileEntry struct {
+	Info api.PlacementProfile
+}
+
+func NewProfileEntry() *ProfileEntry {
+	return &ProfileEntry{}
+}
+
+func NewProfileEntryFromRequest(req *api.PlacementProfile) *ProfileEntry {
+	godbc.Require(req != nil)
+
+	entry := NewProfileEntry()
+	entry.Info = *req
+	entry.Info.GlusterVolumeOptions = append([]string{},
+		req.GlusterVolumeOptions...)
+	return entry
+}
+
+func NewProfileEntryFromName(tx *bolt.Tx, name string) (*ProfileEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewProfileEntry()
+	err := EntryLoad(tx, entry, name)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (p *ProfileEntry) BucketName() string {
+	return BOLTDB_BUCKET_PROFILE
+}
+
+func (p *ProfileEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(p.Info.Name) > 0)
+
+	return EntrySave(tx, p, p.Info.Name)
+}
+
+func (p *ProfileEntry) Delete(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	return EntryDelete(tx, p, p.Info.Name)
+}
+
+func (p *ProfileEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*p)
+
+	return buffer.Bytes(), err
+}
+
+func (p *ProfileEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// check returns an error if the settings of the profile could not be
+// used to create volumes.
+func (p *ProfileEntry) check() error {
+	if p.Info.TagMatch != "" {
+		if _, err := ParseTagMatchingRule(p.Info.TagMatch); err != nil {
+			return err
+		}
+	}
+	d := p.Info.Durability
+	switch d.Type {
+	case "", api.DurabilityDistributeOnly:
+	case api.DurabilityReplicate:
+		if d.Replicate.Replica > 3 {
+			return fmt.Errorf("Invalid replica value")
+		}
+	case api.DurabilityEC:
+		if !d.Disperse.Auto && !validDisperseGeometry(d.Disperse) {
+			return fmt.Errorf("Invalid dispersion combination: %v+%v",
+				d.Disperse.Data, d.Disperse.Redundancy)
+		}
+	default:
+		return fmt.Errorf("Unknown durability type")
+	}
+	return nil
+}
+
+// volumeOptions returns the volume options set on the volumes created
+// with the profile.
+func (p *ProfileEntry) volumeOptions() []string {
+	opts := append([]string{}, p.Info.GlusterVolumeOptions...)
+	if p.Info.TagMatch != "" {
+		opts = append(opts, HEKETI_TAG_MATCH_KEY+" "+p.Info.TagMatch)
+	}
+	if p.Info.ZoneChecking != "" {
+		opts = append(opts, HEKETI_ZONE_CHECKING_KEY+" "+p.Info.ZoneChecking)
+	}
+	if p.Info.BrickMinSizeGb != 0 {
+		opts = append(opts,
+			fmt.Sprintf("%v %v", HEKETI_BRICK_MIN_SIZE_KEY, p.Info.BrickMinSizeGb))
+	}
+	if p.Info.BrickMaxSizeGb != 0 {
+		opts = append(opts,
+			fmt.Sprintf("%v %v", HEKETI_BRICK_MAX_SIZE_KEY, p.Info.BrickMaxSizeGb))
+	}
+	return opts
+}
+
+// Apply sets the settings of the profile on a volume create request.
+// The options of the request come after those of the profile, so
+// that they take precedence.
+func (p *ProfileEntry) Apply(req *api.VolumeCreateRequest) {
+	if req.Durability.Type == "" {
+		req.Durability = p.Info.Durability
+	}
+	req.GlusterVolumeOptions = append(p.volumeOptions(),
+		req.GlusterVolumeOptions...)
+}
+
+// ProfileList returns the names of all placement profiles.
+func ProfileList(tx *bolt.Tx) ([]string, error) {
+	list := EntryKeys(tx, BOLTDB_BUCKET_PROFILE)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
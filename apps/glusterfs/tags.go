@@ -10,12 +10,17 @@
 package glusterfs
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 )
 
 // Well-known tags
 const (
-	TAG_ARBITER string = "arbiter"
+	TAG_ARBITER           string = "arbiter"
+	TAG_AVERAGE_FILE_SIZE string = "average-file-size"
 )
 
 // Well-known tag values
@@ -101,3 +106,108 @@ func ArbiterTag(t map[string]string) string {
 		return TAG_VAL_ARBITER_SUPPORTED
 	}
 }
+
+// AverageFileSizeTag returns the average file size in KiB from the
+// given tag map. The second return value is false if the tag is not
+// present or is not a positive number.
+func AverageFileSizeTag(t map[string]string) (uint64, bool) {
+	v, ok := t[TAG_AVERAGE_FILE_SIZE]
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || size == 0 {
+		logger.Warning("Ignoring invalid %v tag value: %v",
+			TAG_AVERAGE_FILE_SIZE, v)
+		return 0, false
+	}
+	return size, true
+}
+
+type tagSelectorOp int
+
+const (
+	tagSelectEquals tagSelectorOp = iota
+	tagSelectNotEquals
+	tagSelectExists
+	tagSelectNotExists
+)
+
+type tagRequirement struct {
+	name  string
+	op    tagSelectorOp
+	value string
+}
+
+// TagSelector selects the taggable items matching all of its
+// requirements. An empty selector matches every item.
+type TagSelector []tagRequirement
+
+// ParseTagSelector parses a comma separated list of requirements on
+// tags, in the style of kubernetes label selectors:
+//
+//	name=value or name==value  the tag is set to value
+//	name!=value                the tag is not set to value
+//	name                       the tag is set
+//	!name                      the tag is not set
+func ParseTagSelector(s string) (TagSelector, error) {
+	var sel TagSelector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var req tagRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = tagRequirement{name: kv[0], op: tagSelectNotEquals, value: kv[1]}
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			req = tagRequirement{name: kv[0], op: tagSelectEquals, value: kv[1]}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = tagRequirement{name: kv[0], op: tagSelectEquals, value: kv[1]}
+		case strings.HasPrefix(part, "!"):
+			req = tagRequirement{name: part[1:], op: tagSelectNotExists}
+		default:
+			req = tagRequirement{name: part, op: tagSelectExists}
+		}
+		req.name = strings.TrimSpace(req.name)
+		req.value = strings.TrimSpace(req.value)
+		err := api.ValidateTags(map[string]string{req.name: req.value})
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", part, err)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches returns true if the tags of t meet all the requirements of
+// the selector.
+func (sel TagSelector) Matches(t Taggable) bool {
+	tags := t.AllTags()
+	for _, req := range sel {
+		v, ok := tags[req.name]
+		switch req.op {
+		case tagSelectEquals:
+			if !ok || v != req.value {
+				return false
+			}
+		case tagSelectNotEquals:
+			if ok && v == req.value {
+				return false
+			}
+		case tagSelectExists:
+			if !ok {
+				return false
+			}
+		case tagSelectNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
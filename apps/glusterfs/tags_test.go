@@ -215,3 +215,56 @@ func TestArbiterTag(t *testing.T) {
 	tests.Assert(t, a == TAG_VAL_ARBITER_SUPPORTED,
 		"expected a == TAG_VAL_ARBITER_SUPPORTED, got", a)
 }
+
+func TestParseTagSelector(t *testing.T) {
+	sel, err := ParseTagSelector("")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(sel) == 0, "expected len(sel) == 0, got:", len(sel))
+
+	sel, err = ParseTagSelector("namespace=ns1, pvc, !archived,tier!=gold,a==b")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(sel) == 5, "expected len(sel) == 5, got:", len(sel))
+	tests.Assert(t, sel[0].name == "namespace" && sel[0].value == "ns1" &&
+		sel[0].op == tagSelectEquals, "unexpected requirement:", sel[0])
+	tests.Assert(t, sel[1].name == "pvc" && sel[1].op == tagSelectExists,
+		"unexpected requirement:", sel[1])
+	tests.Assert(t, sel[2].name == "archived" && sel[2].op == tagSelectNotExists,
+		"unexpected requirement:", sel[2])
+	tests.Assert(t, sel[3].name == "tier" && sel[3].value == "gold" &&
+		sel[3].op == tagSelectNotEquals, "unexpected requirement:", sel[3])
+	tests.Assert(t, sel[4].name == "a" && sel[4].value == "b" &&
+		sel[4].op == tagSelectEquals, "unexpected requirement:", sel[4])
+
+	_, err = ParseTagSelector("=foo")
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+	_, err = ParseTagSelector("foo,,bar")
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+	_, err = ParseTagSelector("!")
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+}
+
+func TestTagSelectorMatches(t *testing.T) {
+	tt := &testTaggable{T: map[string]string{
+		"namespace": "ns1",
+		"pvc":       "claim1",
+	}}
+
+	matches := func(s string) bool {
+		sel, err := ParseTagSelector(s)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return sel.Matches(tt)
+	}
+	tests.Assert(t, matches(""))
+	tests.Assert(t, matches("namespace=ns1"))
+	tests.Assert(t, matches("namespace=ns1,pvc"))
+	tests.Assert(t, matches("namespace!=ns2,!archived"))
+	tests.Assert(t, !matches("namespace=ns2"))
+	tests.Assert(t, !matches("namespace=ns1,archived"))
+	tests.Assert(t, !matches("!pvc"))
+	tests.Assert(t, !matches("pvc!=claim1"))
+
+	// items without tags only match negative requirements
+	tt.T = nil
+	tests.Assert(t, matches("!pvc,namespace!=ns1"))
+	tests.Assert(t, !matches("pvc"))
+}
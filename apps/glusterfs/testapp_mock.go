@@ -11,6 +11,8 @@ package glusterfs
 
 import (
 	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/executors/mockexec"
 )
 
 func NewTestApp(dbfile string) *App {
@@ -28,3 +30,10 @@ func NewTestApp(dbfile string) *App {
 
 	return app
 }
+
+// MockExecutor returns the mock executor of an app created by
+// NewTestApp, letting tests outside of this package change its
+// behavior.
+func (a *App) MockExecutor() *mockexec.MockExecutor {
+	return a.xo
+}
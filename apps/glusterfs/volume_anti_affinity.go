@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/pkg/db/store"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+const (
+	// index of the ids of the volumes having an anti-affinity rule
+	BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY = "VOLUME_ANTI_AFFINITY"
+)
+
+func copyAntiAffinity(a *api.VolumeAntiAffinity) *api.VolumeAntiAffinity {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Volumes = append([]string{}, a.Volumes...)
+	return &c
+}
+
+// checkAntiAffinity returns an error if the anti-affinity rule of a
+// volume create request names volumes that do not exist or has an
+// invalid selector.
+func checkAntiAffinity(tx *bolt.Tx, a *api.VolumeAntiAffinity) error {
+	if a == nil {
+		return nil
+	}
+	for _, id := range a.Volumes {
+		_, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			return fmt.Errorf("Anti-affinity volume %v not found", id)
+		} else if err != nil {
+			return err
+		}
+	}
+	if _, err := ParseTagSelector(a.Selector); err != nil {
+		return fmt.Errorf("Invalid anti-affinity selector: %v", err)
+	}
+	return nil
+}
+
+// indexAntiAffinity adds the volume to the index of the volumes having
+// an anti-affinity rule, or removes it if it has none.
+func (v *VolumeEntry) indexAntiAffinity(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY))
+	if b == nil {
+		return ErrDbAccess
+	}
+	indexed := b.Get([]byte(v.Info.Id)) != nil
+	if indexed == (v.Info.AntiAffinity != nil) {
+		return nil
+	}
+	if indexed {
+		return unindexAntiAffinity(tx, v.Info.Id)
+	}
+	if err := store.Record(tx, BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY, v.Info.Id); err != nil {
+		return err
+	}
+	return b.Put([]byte(v.Info.Id), []byte("1"))
+}
+
+// unindexAntiAffinity removes the volume from the index of the volumes
+// having an anti-affinity rule.
+func unindexAntiAffinity(tx *bolt.Tx, id string) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY))
+	if b == nil {
+		return ErrDbAccess
+	}
+	if b.Get([]byte(id)) == nil {
+		return nil
+	}
+	if err := store.Record(tx, BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY, id); err != nil {
+		return err
+	}
+	return b.Delete([]byte(id))
+}
+
+// rebuildAntiAffinityIndex fills the index of the volumes having an
+// anti-affinity rule from the volumes of the db.
+func rebuildAntiAffinityIndex(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(
+		[]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY)); err != nil {
+		return err
+	}
+	vols, err := VolumeList(tx)
+	if err != nil {
+		return err
+	}
+	for _, id := range vols {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := v.indexAntiAffinity(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// antiAffinityCandidates returns the ids of the volumes the volume may
+// have to be kept apart from: the volumes its rule may name and the
+// volumes having a rule themselves. Only a rule with a selector needs
+// all the volumes to be read.
+func (v *VolumeEntry) antiAffinityCandidates(tx *bolt.Tx) ([]string, error) {
+	a := v.Info.AntiAffinity
+	if tx.Bucket([]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY)) == nil ||
+		(a != nil && a.Selector != "") {
+		// read-only dbs of older schema versions have no index
+		return VolumeList(tx)
+	}
+	ids := EntryKeys(tx, BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY)
+	if a != nil {
+		ids = append(ids, a.Volumes...)
+	}
+	return ids, nil
+}
+
+// antiAffinityScope returns the scope of the anti-affinity rule of
+// the volume.
+func (v *VolumeEntry) antiAffinityScope() string {
+	if v.Info.AntiAffinity == nil || v.Info.AntiAffinity.Scope == "" {
+		return api.AntiAffinityScopeNode
+	}
+	return v.Info.AntiAffinity.Scope
+}
+
+// avoids returns true if the anti-affinity rule of the volume names
+// the other volume, by id or by its tags.
+func (v *VolumeEntry) avoids(other *VolumeEntry) bool {
+	a := v.Info.AntiAffinity
+	if a == nil || v.Info.Id == other.Info.Id {
+		return false
+	}
+	for _, id := range a.Volumes {
+		if id == other.Info.Id {
+			return true
+		}
+	}
+	if a.Selector == "" {
+		return false
+	}
+	sel, err := ParseTagSelector(a.Selector)
+	if err != nil {
+		logger.Warning("Ignoring invalid anti-affinity selector of volume %v: %v",
+			v.Info.Id, err)
+		return false
+	}
+	return sel.Matches(other)
+}
+
+// antiAffinityFilter returns a device filter rejecting the nodes, or
+// devices, holding bricks of the volumes the volume must be kept apart
+// from. The rule applies both ways: the volume also avoids the volumes
+// whose rule names it. The filter is nil if there is nothing to avoid.
+func (v *VolumeEntry) antiAffinityFilter(db wdb.RODB) (DeviceFilter, error) {
+	nodes := map[string]bool{}
+	devices := map[string]bool{}
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := v.antiAffinityCandidates(tx)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{v.Info.Id: true}
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			other, err := NewVolumeEntryFromId(tx, id)
+			if err == ErrNotFound {
+				// named by a rule, but deleted since
+				continue
+			} else if err != nil {
+				return err
+			}
+			scope := ""
+			if v.avoids(other) {
+				scope = v.antiAffinityScope()
+			}
+			if other.avoids(v) && scope != api.AntiAffinityScopeNode {
+				scope = other.antiAffinityScope()
+			}
+			if scope == "" {
+				continue
+			}
+			for _, brickId := range other.BricksIds() {
+				brick, err := NewBrickEntryFromId(tx, brickId)
+				if err != nil {
+					return err
+				}
+				if scope == api.AntiAffinityScopeNode {
+					nodes[brick.Info.NodeId] = true
+				} else {
+					devices[brick.Info.DeviceId] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 && len(devices) == 0 {
+		return nil, nil
+	}
+	return func(bs *BrickSet, d *DeviceEntry) bool {
+		return !nodes[d.NodeId] && !devices[d.Info.Id]
+	}, nil
+}
@@ -0,0 +1,323 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func antiAffinityVolumeRequest(a *api.VolumeAntiAffinity) *api.VolumeCreateRequest {
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	req.AntiAffinity = a
+	return req
+}
+
+// volumePlacement returns the nodes and devices holding the bricks
+// of a volume.
+func volumePlacement(t *testing.T, app *App, id string) (
+	nodes, devices map[string]bool) {
+
+	nodes = map[string]bool{}
+	devices = map[string]bool{}
+	err := app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, brickId := range v.BricksIds() {
+			b, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return err
+			}
+			nodes[b.Info.NodeId] = true
+			devices[b.Info.DeviceId] = true
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return
+}
+
+func sharesAny(a, b map[string]bool) bool {
+	for k := range a {
+		if b[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVolumeAntiAffinityCreate(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		6,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	va := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(nil))
+	err = va.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	nodesA, _ := volumePlacement(t, app, va.Info.Id)
+	tests.Assert(t, len(nodesA) == 3, "got:", nodesA)
+
+	vb := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(
+		&api.VolumeAntiAffinity{Volumes: []string{va.Info.Id}}))
+	err = vb.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	nodesB, _ := volumePlacement(t, app, vb.Info.Id)
+	tests.Assert(t, !sharesAny(nodesA, nodesB), "got:", nodesA, nodesB)
+
+	// no node is left apart from both volumes
+	vc := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(
+		&api.VolumeAntiAffinity{Volumes: []string{va.Info.Id, vb.Info.Id}}))
+	err = vc.Create(app.db, app.executor)
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// the device scope only keeps the devices apart
+	vd := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(
+		&api.VolumeAntiAffinity{
+			Volumes: []string{va.Info.Id, vb.Info.Id},
+			Scope:   api.AntiAffinityScopeDevice,
+		}))
+	err = vd.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, devicesA := volumePlacement(t, app, va.Info.Id)
+	_, devicesB := volumePlacement(t, app, vb.Info.Id)
+	_, devicesD := volumePlacement(t, app, vd.Info.Id)
+	tests.Assert(t, !sharesAny(devicesA, devicesD), "got:", devicesA, devicesD)
+	tests.Assert(t, !sharesAny(devicesB, devicesD), "got:", devicesB, devicesD)
+}
+
+func TestVolumeAntiAffinitySelector(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		6,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the primary avoids the replica, which does not exist yet
+	req := antiAffinityVolumeRequest(&api.VolumeAntiAffinity{
+		Selector: "app=db,role=replica",
+	})
+	req.Tags = map[string]string{"app": "db", "role": "primary"}
+	primary := NewVolumeEntryFromRequest(req)
+	err = primary.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the replica has no rule but is selected by the one of the primary
+	req = antiAffinityVolumeRequest(nil)
+	req.Tags = map[string]string{"app": "db", "role": "replica"}
+	replica := NewVolumeEntryFromRequest(req)
+	err = replica.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	nodesP, _ := volumePlacement(t, app, primary.Info.Id)
+	nodesR, _ := volumePlacement(t, app, replica.Info.Id)
+	tests.Assert(t, !sharesAny(nodesP, nodesR), "got:", nodesP, nodesR)
+
+	// volumes not selected are placed anywhere
+	v := NewVolumeEntry()
+	v.Info.Id = "other"
+	f, err := v.antiAffinityFilter(app.db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, f == nil, "expected f == nil")
+}
+
+func TestVolumeAntiAffinityEvict(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		7,    // nodes_per_cluster
+		1,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	va := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(nil))
+	err = va.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	vb := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(
+		&api.VolumeAntiAffinity{Volumes: []string{va.Info.Id}}))
+	err = vb.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.Volume, error) {
+		return mockVolumeInfoFromDb(app.db, volume)
+	}
+	app.xo.MockHealInfo = func(host string, volume string) (*executors.HealInfo, error) {
+		return mockHealStatusFromDb(app.db, volume)
+	}
+
+	// the brick of the first volume may not move next to the second
+	nodesB, _ := volumePlacement(t, app, vb.Info.Id)
+	for i := 0; i < 3; i++ {
+		nodesA, _ := volumePlacement(t, app, va.Info.Id)
+		tests.Assert(t, !sharesAny(nodesA, nodesB), "got:", nodesA, nodesB)
+
+		var brickId string
+		err = app.db.View(func(tx *bolt.Tx) error {
+			v, err := NewVolumeEntryFromId(tx, va.Info.Id)
+			brickId = v.BricksIds()[i]
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		beo := NewBrickEvictOperation(brickId, app.db, api.HealCheckEnable)
+		err = RunOperation(beo, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	nodesA, _ := volumePlacement(t, app, va.Info.Id)
+	tests.Assert(t, !sharesAny(nodesA, nodesB), "got:", nodesA, nodesB)
+}
+
+func TestVolumeCreateBadAntiAffinity(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	err := setupSampleDbWithTopology(app, 1, 3, 2, 2*TB)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	req := antiAffinityVolumeRequest(&api.VolumeAntiAffinity{
+		Volumes: []string{"abc"},
+	})
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "validation failed"),
+		"expected validation error, got:", err)
+
+	req.AntiAffinity = &api.VolumeAntiAffinity{Scope: "zone"}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "validation failed"),
+		"expected validation error, got:", err)
+
+	req.AntiAffinity = &api.VolumeAntiAffinity{
+		Volumes: []string{"e1ba4f3a8c9f4ba3a3c7d8f1d2c3b4a5"},
+	}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "not found"),
+		"expected not found error, got:", err)
+
+	req.AntiAffinity = &api.VolumeAntiAffinity{Selector: "!"}
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "selector"),
+		"expected selector error, got:", err)
+
+	req.AntiAffinity = &api.VolumeAntiAffinity{Selector: "app=db"}
+	vol, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vol.AntiAffinity != nil && vol.AntiAffinity.Selector == "app=db",
+		"got:", vol.AntiAffinity)
+}
+
+func TestVolumeAntiAffinityIndex(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		6,    // nodes_per_cluster
+		2,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	indexed := func() []string {
+		var ids []string
+		app.db.View(func(tx *bolt.Tx) error {
+			ids = EntryKeys(tx, BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY)
+			return nil
+		})
+		return ids
+	}
+
+	va := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(nil))
+	err = va.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(indexed()) == 0, "expected empty index, got:", indexed())
+
+	// without any rule no volume is a candidate
+	err = app.db.View(func(tx *bolt.Tx) error {
+		ids, err := va.antiAffinityCandidates(tx)
+		tests.Assert(t, len(ids) == 0, "expected no candidates, got:", ids)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	vb := NewVolumeEntryFromRequest(antiAffinityVolumeRequest(
+		&api.VolumeAntiAffinity{Volumes: []string{va.Info.Id}}))
+	err = vb.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ids := indexed()
+	tests.Assert(t, len(ids) == 1 && ids[0] == vb.Info.Id, "got:", ids)
+
+	// the rule of vb still keeps va apart from it, through the index
+	f, err := va.antiAffinityFilter(app.db)
+	tests.Assert(t, err == nil && f != nil, "expected a filter, got:", err)
+
+	// the index is rebuilt by the schema migration
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(BOLTDB_BUCKET_VOLUME_ANTI_AFFINITY)); err != nil {
+			return err
+		}
+		return rebuildAntiAffinityIndex(tx)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ids = indexed()
+	tests.Assert(t, len(ids) == 1 && ids[0] == vb.Info.Id, "got:", ids)
+
+	err = vb.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(indexed()) == 0, "expected empty index, got:", indexed())
+}
@@ -11,6 +11,7 @@ package glusterfs
 
 import (
 	"encoding/gob"
+	"fmt"
 
 	"github.com/heketi/heketi/v10/executors"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
@@ -26,19 +27,117 @@ func init() {
 	gob.Register(&VolumeDisperseDurability{})
 }
 
+// disperseGeometries lists the data and redundancy combinations
+// supported for disperse volumes.
+var disperseGeometries = []api.DisperseDurability{
+	{Data: 2, Redundancy: 1},
+	{Data: 4, Redundancy: 2},
+	{Data: 8, Redundancy: 3},
+	{Data: 8, Redundancy: 4},
+}
+
+func validDisperseGeometry(d api.DisperseDurability) bool {
+	for _, g := range disperseGeometries {
+		if g.Data == d.Data && g.Redundancy == d.Redundancy {
+			return true
+		}
+	}
+	return false
+}
+
+// maxDisperseRedundancy returns the highest redundancy of the
+// supported geometries.
+func maxDisperseRedundancy() int {
+	max := 0
+	for _, g := range disperseGeometries {
+		if g.Redundancy > max {
+			max = g.Redundancy
+		}
+	}
+	return max
+}
+
+// noDisperseGeometryError is returned when none of the supported
+// geometries fits in the failure domains of a cluster.
+type noDisperseGeometryError struct {
+	redundancy int
+	domains    int
+}
+
+func (e noDisperseGeometryError) Error() string {
+	return fmt.Sprintf("No disperse geometry with a redundancy of at least %v "+
+		"fits in %v failure domains", e.redundancy, e.domains)
+}
+
+// chooseDisperseGeometry returns the supported geometry with at least
+// the given redundancy whose sets fit in the given number of failure
+// domains. The geometry with the best ratio of data to bricks is
+// preferred, then the one with the highest redundancy.
+func chooseDisperseGeometry(redundancy, domains int) (
+	api.DisperseDurability, error) {
+
+	var (
+		best  api.DisperseDurability
+		found bool
+	)
+	for _, g := range disperseGeometries {
+		if g.Redundancy < redundancy || g.Data+g.Redundancy > domains {
+			continue
+		}
+		if !found {
+			best, found = g, true
+			continue
+		}
+		// compare g.Data/(g.Data+g.Redundancy) to the best ratio
+		lhs := g.Data * (best.Data + best.Redundancy)
+		rhs := best.Data * (g.Data + g.Redundancy)
+		if lhs > rhs || (lhs == rhs && g.Redundancy > best.Redundancy) {
+			best = g
+		}
+	}
+	if !found {
+		return best, noDisperseGeometryError{redundancy, domains}
+	}
+	return best, nil
+}
+
 type VolumeDisperseDurability struct {
 	api.DisperseDurability
+
+	// minRedundancy is the redundancy requested for a volume whose
+	// geometry is chosen by the server.
+	minRedundancy int
 }
 
 func NewVolumeDisperseDurability(d *api.DisperseDurability) *VolumeDisperseDurability {
 	v := &VolumeDisperseDurability{}
 	v.Data = d.Data
 	v.Redundancy = d.Redundancy
+	v.Auto = d.Auto
+	if v.Auto {
+		v.minRedundancy = d.Redundancy
+	}
 
 	return v
 }
 
+// ChooseGeometry sets the geometry of a volume created with the auto
+// mode for the given number of failure domains.
+func (d *VolumeDisperseDurability) ChooseGeometry(domains int) error {
+	g, err := chooseDisperseGeometry(d.minRedundancy, domains)
+	if err != nil {
+		return err
+	}
+	d.Data = g.Data
+	d.Redundancy = g.Redundancy
+	return nil
+}
+
 func (d *VolumeDisperseDurability) SetDurability() {
+	if d.Auto {
+		// chosen by the server when the bricks are allocated
+		return
+	}
 	if d.Data == 0 {
 		d.Data = DEFAULT_EC_DATA
 	}
@@ -76,6 +175,9 @@ func (d *VolumeDisperseDurability) BrickSizeGenerator(size uint64) func() (int,
 }
 
 func (d *VolumeDisperseDurability) MinVolumeSize() uint64 {
+	if d.Auto && d.Data == 0 {
+		return BrickMinSize * uint64(disperseGeometries[0].Data)
+	}
 	return BrickMinSize * uint64(d.Data)
 }
 
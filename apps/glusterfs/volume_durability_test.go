@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/tests"
 )
 
@@ -343,3 +344,51 @@ func TestDisperseDurabilityMinVolumeSize(t *testing.T) {
 
 	tests.Assert(t, minvolsize == BrickMinSize*8)
 }
+
+func TestChooseDisperseGeometry(t *testing.T) {
+	for _, c := range []struct {
+		redundancy, domains int
+		data, chosen        int
+	}{
+		{0, 3, 2, 1},
+		{1, 6, 4, 2},
+		{2, 6, 4, 2},
+		{2, 11, 8, 3},
+		{0, 20, 8, 3},
+		{4, 12, 8, 4},
+		{2, 3, 0, 0},
+		{1, 2, 0, 0},
+	} {
+		g, err := chooseDisperseGeometry(c.redundancy, c.domains)
+		if c.data == 0 {
+			_, ok := err.(noDisperseGeometryError)
+			tests.Assert(t, ok, "expected noDisperseGeometryError for", c, "got:", err)
+			continue
+		}
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, g.Data == c.data && g.Redundancy == c.chosen,
+			"for", c, "got:", g)
+	}
+}
+
+func TestDisperseDurabilityAuto(t *testing.T) {
+	r := NewVolumeDisperseDurability(&api.DisperseDurability{
+		Redundancy: 2,
+		Auto:       true,
+	})
+	r.SetDurability()
+	tests.Assert(t, r.Data == 0)
+	tests.Assert(t, r.MinVolumeSize() == BrickMinSize*2)
+
+	err := r.ChooseGeometry(8)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Data == 4 && r.Redundancy == 2, "got:", r.DisperseDurability)
+	tests.Assert(t, r.BricksInSet() == 6)
+
+	// the requested redundancy remains the minimum
+	err = r.ChooseGeometry(4)
+	tests.Assert(t, err != nil)
+	err = r.ChooseGeometry(11)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Data == 8 && r.Redundancy == 3, "got:", r.DisperseDurability)
+}
@@ -47,6 +47,8 @@ const (
 	HEKETI_AVERAGE_FILE_SIZE_KEY = "user.heketi.average-file-size"
 	HEKETI_ZONE_CHECKING_KEY     = "user.heketi.zone-checking"
 	HEKETI_TAG_MATCH_KEY         = "user.heketi.device-tag-match"
+	HEKETI_BRICK_MIN_SIZE_KEY    = "user.heketi.brick-min-size-gb"
+	HEKETI_BRICK_MAX_SIZE_KEY    = "user.heketi.brick-max-size-gb"
 )
 
 var (
@@ -97,6 +99,9 @@ func NewVolumeEntryFromRequest(req *api.VolumeCreateRequest) *VolumeEntry {
 	vol.Info.Snapshot = req.Snapshot
 	vol.Info.Size = req.Size
 	vol.Info.Block = req.Block
+	vol.Info.Tags = copyTags(req.Tags)
+	vol.Info.Profile = req.Profile
+	vol.Info.AntiAffinity = copyAntiAffinity(req.AntiAffinity)
 
 	// Set default durability values
 	durability := vol.Info.Durability.Type
@@ -203,6 +208,8 @@ func NewVolumeEntryFromClone(v *VolumeEntry, name string) *VolumeEntry {
 	entry.Info.Cluster = v.Info.Cluster
 	entry.Info.Durability = v.Info.Durability
 	entry.Info.Durability.Type = v.Info.Durability.Type
+	// clones are expanded like the volume they are cloned from
+	entry.Durability = v.Durability
 	entry.Info.Gid = v.Info.Gid
 	entry.Info.Mount = v.Info.Mount
 	entry.Info.Size = v.Info.Size
@@ -225,11 +232,17 @@ func (v *VolumeEntry) Save(tx *bolt.Tx) error {
 	godbc.Require(tx != nil)
 	godbc.Require(len(v.Info.Id) > 0)
 
-	return EntrySave(tx, v, v.Info.Id)
+	if err := EntrySave(tx, v, v.Info.Id); err != nil {
+		return err
+	}
+	return v.indexAntiAffinity(tx)
 }
 
 func (v *VolumeEntry) Delete(tx *bolt.Tx) error {
-	return EntryDelete(tx, v, v.Info.Id)
+	if err := EntryDelete(tx, v, v.Info.Id); err != nil {
+		return err
+	}
+	return unindexAntiAffinity(tx, v.Info.Id)
 }
 
 func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, error) {
@@ -249,6 +262,9 @@ func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, err
 	info.Block = v.Info.Block
 	info.BlockInfo = v.Info.BlockInfo
 	info.Gid = v.Info.Gid
+	info.Tags = copyTags(v.Info.Tags)
+	info.Profile = v.Info.Profile
+	info.AntiAffinity = copyAntiAffinity(v.Info.AntiAffinity)
 
 	for _, brickid := range v.BricksIds() {
 		brick, err := NewBrickEntryFromId(tx, brickid)
@@ -319,15 +335,25 @@ func (v *VolumeEntry) HasArbiterOption() bool {
 
 // GetAverageFileSize returns averageFileSize provided by user or default averageFileSize
 func (v *VolumeEntry) GetAverageFileSize() uint64 {
+	if size, ok := v.averageFileSizeOption(); ok {
+		return size
+	}
+	return averageFileSize
+}
+
+// averageFileSizeOption returns the average file size provided by
+// the user for the volume. The second return value is false if
+// none was provided.
+func (v *VolumeEntry) averageFileSizeOption() (uint64, bool) {
 	value := v.volOptsMap()[HEKETI_AVERAGE_FILE_SIZE_KEY]
 	if size, e := strconv.ParseUint(value, 10, 64); e == nil {
 		if size == 0 {
 			logger.LogError("Average File Size cannot be zero, using default file size %v", averageFileSize)
-			return averageFileSize
+			return 0, false
 		}
-		return size
+		return size, true
 	}
-	return averageFileSize
+	return 0, false
 }
 
 // GetZoneCheckingStrategy returns a ZoneCheckingStrategy based on
@@ -348,6 +374,32 @@ func (v *VolumeEntry) GetTagMatchingRule() (*TagMatchingRule, error) {
 	return ParseTagMatchingRule(value)
 }
 
+// brickSizeLimits returns the limits of the size of the bricks of the
+// volume. The limits of the server may be narrowed by volume options.
+func (v *VolumeEntry) brickSizeLimits() (min, max uint64) {
+	min, max = BrickMinSize, BrickMaxSize
+	om := v.volOptsMap()
+	if value, ok := om[HEKETI_BRICK_MIN_SIZE_KEY]; ok {
+		gb, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			logger.Warning("Ignoring invalid %v value %#v",
+				HEKETI_BRICK_MIN_SIZE_KEY, value)
+		} else if gb*GB > min {
+			min = gb * GB
+		}
+	}
+	if value, ok := om[HEKETI_BRICK_MAX_SIZE_KEY]; ok {
+		gb, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || gb == 0 {
+			logger.Warning("Ignoring invalid %v value %#v",
+				HEKETI_BRICK_MAX_SIZE_KEY, value)
+		} else if gb*GB < max {
+			max = gb * GB
+		}
+	}
+	return
+}
+
 func (v *VolumeEntry) BrickAdd(id string) {
 	godbc.Require(!sortedstrings.Has(v.Bricks, id))
 
@@ -475,6 +527,16 @@ func (v *VolumeEntry) tryAllocateBricks(
 
 	cerr := ClusterErrorMap{}
 	for _, cluster := range possibleClusters {
+		err = v.chooseDisperseGeometry(db, cluster)
+		if _, ok := err.(noDisperseGeometryError); ok {
+			logger.Debug("Cluster %v can not accommodate volume "+
+				"(%v), trying next cluster", cluster, err)
+			cerr.Add(cluster, err)
+			continue
+		} else if err != nil {
+			return
+		}
+
 		// Check this cluster for space
 		brick_entries, err = v.allocBricksInCluster(db, cluster, v.Info.Size)
 
@@ -851,6 +913,18 @@ func (v *VolumeEntry) Visible() bool {
 	return v.Pending.Id == ""
 }
 
+func (v *VolumeEntry) AllTags() map[string]string {
+	if v.Info.Tags == nil {
+		return map[string]string{}
+	}
+	return v.Info.Tags
+}
+
+func (v *VolumeEntry) SetTags(t map[string]string) error {
+	v.Info.Tags = t
+	return nil
+}
+
 func volumeNameExistsInCluster(tx *bolt.Tx, cluster *ClusterEntry,
 	name string) (found bool, e error) {
 	for _, volumeId := range cluster.Info.Volumes {
@@ -1011,6 +1085,11 @@ func updateCloneBrickPaths(bricks []*BrickEntry,
 			len(pathIndex), len(bricks))
 	}
 
+	if len(clone.Bricks.BrickList) != len(orig.Bricks.BrickList) {
+		return fmt.Errorf(
+			"Unexpected number of clone bricks. %v clone bricks, %v bricks",
+			len(clone.Bricks.BrickList), len(orig.Bricks.BrickList))
+	}
 	for i, b := range orig.Bricks.BrickList {
 		c := clone.Bricks.BrickList[i]
 		origPath := strings.Split(b.Name, ":")[1]
@@ -1113,6 +1192,10 @@ func (v *VolumeEntry) consistencyCheck(db Db) (response DbEntryCheckResponse) {
 	for _, brick := range v.Bricks {
 		if brickEntry, found := db.Bricks[brick]; !found {
 			response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Volume %v unknown brick %v", v.Info.Id, brick))
+			response.Issues = append(response.Issues, newDbIssue(DbIssueDanglingBrickRef,
+				"volume", v.Info.Id, brick,
+				fmt.Sprintf("Volume %v unknown brick %v", v.Info.Id, brick),
+				"Remove the brick from the bricks of the volume"))
 		} else {
 			if brickEntry.Info.VolumeId != v.Info.Id {
 				response.Inconsistencies = append(response.Inconsistencies, fmt.Sprintf("Volume %v no link back to volume from brick %v", v.Info.Id, brick))
@@ -28,6 +28,7 @@ func (v *VolumeEntry) allocBricksInCluster(db wdb.DB,
 	// Note: subsequent calls to gen need to return decreasing
 	//       brick sizes in order for the following code to work!
 	gen := v.Durability.BrickSizeGenerator(size)
+	minBrickSize, maxBrickSize := v.brickSizeLimits()
 
 	// Try decreasing possible brick sizes until space is found
 	for {
@@ -37,6 +38,16 @@ func (v *VolumeEntry) allocBricksInCluster(db wdb.DB,
 			logger.Err(err)
 			return nil, err
 		}
+		if brick_size > maxBrickSize {
+			logger.Debug("brick size %v over the limit of the volume %v",
+				brick_size, maxBrickSize)
+			continue
+		}
+		if brick_size < minBrickSize {
+			logger.Debug("brick size %v under the limit of the volume %v",
+				brick_size, minBrickSize)
+			return nil, ErrMinimumBrickSize
+		}
 
 		num_bricks := sets * v.Durability.BricksInSet()
 
@@ -262,12 +273,7 @@ func (v *VolumeEntry) prepForBrickReplacement(db wdb.DB,
 func (v *VolumeEntry) generateDeviceFilter(db wdb.RODB, dsrc DeviceSource) (DeviceFilter, error) {
 
 	var filter DeviceFilter = nil
-	zoneChecking := v.GetZoneCheckingStrategy()
-	if zoneChecking == ZONE_CHECKING_UNSET {
-		zoneChecking = ZoneChecking
-	}
-
-	switch zoneChecking {
+	switch zoneChecking := v.zoneChecking(); zoneChecking {
 	case ZONE_CHECKING_STRICT:
 		dzm, err := NewDeviceZoneMapFromDb(db)
 		if err != nil {
@@ -291,9 +297,70 @@ func (v *VolumeEntry) generateDeviceFilter(db wdb.RODB, dsrc DeviceSource) (Devi
 		filter = appendDeviceFilter(filter, tagMatchingRule.GetFilter(dsrc))
 	}
 
+	antiAffinity, err := v.antiAffinityFilter(db)
+	if err != nil {
+		return nil, err
+	} else if antiAffinity != nil {
+		logger.Debug("Configuring an anti-affinity device filter")
+		filter = appendDeviceFilter(filter, antiAffinity)
+	}
+
 	return filter, nil
 }
 
+// zoneChecking returns the zone checking strategy of the volume,
+// falling back to the one of the server.
+func (v *VolumeEntry) zoneChecking() ZoneCheckingStrategy {
+	zoneChecking := v.GetZoneCheckingStrategy()
+	if zoneChecking == ZONE_CHECKING_UNSET {
+		zoneChecking = ZoneChecking
+	}
+	return zoneChecking
+}
+
+// chooseDisperseGeometry sets the geometry of a disperse volume
+// created with the auto mode for the cluster. Each brick of a set
+// needs its own node, and its own zone under strict zone checking,
+// so these are the failure domains the sets must fit in. It does
+// nothing for other volumes.
+func (v *VolumeEntry) chooseDisperseGeometry(db wdb.RODB, cluster string) error {
+	d, ok := v.Durability.(*VolumeDisperseDurability)
+	if !ok || !d.Auto {
+		return nil
+	}
+
+	var domains int
+	err := db.View(func(tx *bolt.Tx) error {
+		dnl, err := NewClusterDeviceSource(tx, cluster).Devices()
+		if err != nil {
+			return err
+		}
+		nodes := map[string]bool{}
+		zones := map[int]bool{}
+		for _, dan := range dnl {
+			nodes[dan.Node.Info.Id] = true
+			zones[dan.Node.Info.Zone] = true
+		}
+		domains = len(nodes)
+		if v.zoneChecking() == ZONE_CHECKING_STRICT {
+			domains = len(zones)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := d.ChooseGeometry(domains); err != nil {
+		return err
+	}
+	logger.Info("Chose disperse geometry %v+%v for volume %v on cluster %v",
+		d.Data, d.Redundancy, v.Info.Id, cluster)
+	v.Info.Durability.Disperse.Data = d.Data
+	v.Info.Durability.Disperse.Redundancy = d.Redundancy
+	return nil
+}
+
 func (v *VolumeEntry) allocBrickReplacement(db wdb.DB,
 	oldBrickEntry *BrickEntry,
 	oldDeviceEntry *DeviceEntry,
@@ -324,11 +391,14 @@ func (v *VolumeEntry) allocBrickReplacement(db wdb.DB,
 			return diffDevice(bs, d)
 		}
 
+		opts, err := clusterVolumePlacementOpts(tx, v, v.Info.Cluster,
+			oldBrickEntry.Info.Size, bs.SetSize)
+		if err != nil {
+			return err
+		}
+
 		placer := PlacerForVolume(v)
-		r, err = placer.Replace(
-			dsrc,
-			NewVolumePlacementOpts(v, oldBrickEntry.Info.Size, bs.SetSize),
-			deviceFilter, bs, index)
+		r, err = placer.Replace(dsrc, opts, deviceFilter, bs, index)
 		if err == ErrNoSpace {
 			// swap error conditions to better match the intent
 			return ErrNoReplacement
@@ -510,11 +580,16 @@ func (v *VolumeEntry) allocBricks(
 	}()
 
 	// mimic the previous unconditional db update behavior
-	opts := NewVolumePlacementOpts(v, brick_size, bricksets)
 	err := db.Update(func(tx *bolt.Tx) error {
 		dsrc := NewClusterDeviceSource(tx, cluster)
 		placer := PlacerForVolume(v)
 
+		opts, err := clusterVolumePlacementOpts(tx, v, cluster,
+			brick_size, bricksets)
+		if err != nil {
+			return err
+		}
+
 		txdb := wdb.WrapTx(tx)
 		deviceFilter, err := v.generateDeviceFilter(txdb, dsrc)
 		if err != nil {
@@ -554,6 +629,20 @@ func (v *VolumeEntry) allocBricks(
 	return brick_entries, nil
 }
 
+// clusterVolumePlacementOpts returns the placement options of the
+// volume in the cluster, with the defaults of the cluster.
+func clusterVolumePlacementOpts(tx *bolt.Tx, v *VolumeEntry, cluster string,
+	brickSize uint64, numBrickSets int) (*VolumePlacementOpts, error) {
+
+	c, err := NewClusterEntryFromId(tx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	opts := NewVolumePlacementOpts(v, brickSize, numBrickSets)
+	opts.clusterAverageFileSize = c.Info.AverageFileSize
+	return opts, nil
+}
+
 func appendDeviceFilter(f1, f2 DeviceFilter) DeviceFilter {
 	if f1 == nil {
 		return f2
@@ -3028,6 +3028,79 @@ func TestVolumeCreateTooFewZones(t *testing.T) {
 	})
 }
 
+func TestVolumeCreateDisperseAuto(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	origZoneChecking := ZoneChecking
+	defer func() {
+		ZoneChecking = origZoneChecking
+	}()
+
+	err := setupSampleDbWithTopologyWithZones(app,
+		1,    // clusters
+		3,    // zones_per_cluster
+		6,    // nodes_per_cluster
+		4,    // devices_per_node,
+		2*TB, // disksize)
+	)
+	tests.Assert(t, err == nil, "expected err == nil, got", err)
+
+	autoRequest := func(redundancy int) *api.VolumeCreateRequest {
+		req := &api.VolumeCreateRequest{}
+		req.Size = 100
+		req.Durability.Type = api.DurabilityEC
+		req.Durability.Disperse.Redundancy = redundancy
+		req.Durability.Disperse.Auto = true
+		return req
+	}
+
+	t.Run("ZoneChecking none", func(t *testing.T) {
+		// six nodes fit a 4+2 geometry
+		ZoneChecking = ZONE_CHECKING_NONE
+		v := NewVolumeEntryFromRequest(autoRequest(2))
+		err := v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+		var info *api.VolumeInfoResponse
+		err = app.db.View(func(tx *bolt.Tx) error {
+			entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+			if err != nil {
+				return err
+			}
+			info, err = entry.NewInfoResponse(tx)
+			return err
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		d := info.Durability.Disperse
+		tests.Assert(t, d.Auto && d.Data == 4 && d.Redundancy == 2, "got:", d)
+		tests.Assert(t, len(info.Bricks)%6 == 0, "got:", len(info.Bricks))
+	})
+
+	t.Run("ZoneChecking strict", func(t *testing.T) {
+		// the sets must fit in three zones
+		ZoneChecking = ZONE_CHECKING_STRICT
+		v := NewVolumeEntryFromRequest(autoRequest(1))
+		err := v.Create(app.db, app.executor)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		d := v.Info.Durability.Disperse
+		tests.Assert(t, d.Data == 2 && d.Redundancy == 1, "got:", d)
+		tests.Assert(t, len(v.Bricks)%3 == 0, "got:", len(v.Bricks))
+	})
+
+	t.Run("ZoneChecking strict redundancy 2", func(t *testing.T) {
+		ZoneChecking = ZONE_CHECKING_STRICT
+		v := NewVolumeEntryFromRequest(autoRequest(2))
+		err := v.Create(app.db, app.executor)
+		tests.Assert(t, err != nil && strings.Contains(err.Error(), "3 failure domains"),
+			"expected geometry error, got:", err)
+	})
+}
+
 //
 // Test the result of brick placement on an unbalanced node/device distribution.
 // This is to prove that without strict zone mode, we will end up with
@@ -16,6 +16,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/heketi/v10/pkg/utils"
 )
 
@@ -47,3 +48,75 @@ func (c *Client) BackupDb(w io.Writer) error {
 
 	return err
 }
+
+// BackupDbIfChanged writes a copy of the db to w unless the db did
+// not change since the copy with the given tag. It returns the tag of
+// the copy written and true, or false if the db did not change.
+func (c *Client) BackupDbIfChanged(w io.Writer, tag string) (string, bool, error) {
+	// Create a request
+	req, err := http.NewRequest("GET", c.host+"/backup/db", nil)
+	if err != nil {
+		return "", false, err
+	}
+	if tag != "" {
+		req.Header.Set("If-None-Match", tag)
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotModified {
+		return tag, false, nil
+	}
+	if r.StatusCode != http.StatusOK {
+		return "", false, utils.GetErrorFromResponse(r)
+	}
+
+	// Read data from response
+	_, err = io.Copy(w, r.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return r.Header.Get("ETag"), true, nil
+}
+
+// BackupList returns the snapshots of the db kept by the periodic
+// backups of the server, most recent first.
+func (c *Client) BackupList() (*api.BackupListResponse, error) {
+	req, err := http.NewRequest("GET", c.host+"/backups", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var backups api.BackupListResponse
+	err = utils.GetJsonFromResponse(r, &backups)
+	if err != nil {
+		return nil, err
+	}
+	return &backups, nil
+}
@@ -70,10 +70,24 @@ func (c *Client) BlockVolumeCreate(request *api.BlockVolumeCreateRequest) (
 }
 
 func (c *Client) BlockVolumeList() (*api.BlockVolumeListResponse, error) {
+	return c.BlockVolumeListWithSelector("")
+}
+
+// BlockVolumeListWithSelector returns the ids of the block volumes
+// whose tags match the selector, such as "owner=ns1,!archived". An
+// empty selector matches all of them.
+func (c *Client) BlockVolumeListWithSelector(selector string) (*api.BlockVolumeListResponse, error) {
+	return c.BlockVolumeListWithQuery(&api.ListQuery{Selector: selector})
+}
+
+// BlockVolumeListWithQuery returns the page of block volumes selected
+// by the query. See api.ListQuery.
+func (c *Client) BlockVolumeListWithQuery(q *api.ListQuery) (*api.BlockVolumeListResponse, error) {
 	req, err := http.NewRequest("GET", c.host+"/blockvolumes", nil)
 	if err != nil {
 		return nil, err
 	}
+	req.URL.RawQuery = q.Values().Encode()
 
 	err = c.setToken(req)
 	if err != nil {
@@ -210,3 +224,35 @@ func (c *Client) BlockVolumeExpand(id string, request *api.BlockVolumeExpandRequ
 
 	return &blockvolume, nil
 }
+
+func (c *Client) BlockVolumeSetTags(id string, request *api.TagsChangeRequest) error {
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/blockvolumes/"+id+"/tags",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -320,6 +321,11 @@ func (c *Client) retryOperationDo(req *http.Request) (*http.Response, error) {
 	var r *http.Response
 	for i := 0; i <= c.opts.RetryCount; i++ {
 		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+		// allow the body to be sent again when the request is
+		// redirected, such as by a standby server to the leader
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(requestBody)), nil
+		}
 		r, err = c.doBasic(req)
 		if err != nil {
 			return nil, err
@@ -13,6 +13,7 @@
 package client
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"net/http"
@@ -1354,3 +1355,204 @@ func TestCustomHttpClientFakeFailingPerformer(t *testing.T) {
 
 	tests.Assert(t, counter >= 2, "expected counter >= 2, got:", counter)
 }
+
+func TestVolumeTags(t *testing.T) {
+	db := tests.Tempfile()
+	defer os.Remove(db)
+
+	// Create the app
+	app := glusterfs.NewTestApp(db)
+	defer app.Close()
+
+	// Setup the server
+	ts := setupHeketiServer(app)
+	defer ts.Close()
+
+	// Create cluster
+	c := newTestClient(ts.URL, "admin", TEST_ADMIN_KEY)
+	tests.Assert(t, c != nil)
+	cluster_req := &api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{
+			Block: true,
+			File:  true,
+		},
+	}
+	cluster, err := c.ClusterCreate(cluster_req)
+	tests.Assert(t, err == nil)
+
+	for n := 0; n < 3; n++ {
+		nodeReq := &api.NodeAddRequest{}
+		nodeReq.ClusterId = cluster.Id
+		nodeReq.Hostnames.Manage = []string{"manage" + fmt.Sprintf("%v", n)}
+		nodeReq.Hostnames.Storage = []string{"storage" + fmt.Sprintf("%v", n)}
+		nodeReq.Zone = n + 1
+
+		node, err := c.NodeAdd(nodeReq)
+		tests.Assert(t, err == nil)
+
+		deviceReq := &api.DeviceAddRequest{}
+		deviceReq.Name = "/dev/by-magic/id:" + idgen.GenUUID()
+		deviceReq.NodeId = node.Id
+		err = c.DeviceAdd(deviceReq)
+		tests.Assert(t, err == nil)
+	}
+
+	// Create tagged and untagged volumes
+	volumeReq := &api.VolumeCreateRequest{}
+	volumeReq.Size = 10
+	volumeReq.Tags = map[string]string{
+		"namespace": "ns1",
+		"pvc":       "claim1",
+	}
+	v1, err := c.VolumeCreate(volumeReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v1.Tags["pvc"] == "claim1",
+		`expected v1.Tags["pvc"] == "claim1", got:`, v1.Tags["pvc"])
+
+	volumeReq = &api.VolumeCreateRequest{}
+	volumeReq.Size = 10
+	v2, err := c.VolumeCreate(volumeReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(v2.Tags) == 0,
+		"expected len(v2.Tags) == 0, got:", len(v2.Tags))
+
+	list, err := c.VolumeListWithSelector("namespace=ns1")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Volumes[0] == v1.Id,
+		"expected list.Volumes == [v1.Id], got:", list.Volumes)
+
+	list, err = c.VolumeListWithSelector("!pvc")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Volumes[0] == v2.Id,
+		"expected list.Volumes == [v2.Id], got:", list.Volumes)
+
+	list, err = c.VolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 2,
+		"expected len(list.Volumes) == 2, got:", len(list.Volumes))
+
+	_, err = c.VolumeListWithSelector("=ns1")
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+
+	list, err = c.VolumeListWithQuery(&api.ListQuery{
+		Selector: "pvc",
+		Limit:    1,
+		Detail:   true,
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Details) == 1 && list.Details[0].Id == v1.Id,
+		"expected list.Details == [v1], got:", list.Details)
+	tests.Assert(t, list.Next == "", `expected list.Next == "", got:`, list.Next)
+
+	list, err = c.VolumeListWithQuery(&api.ListQuery{Limit: 1})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Next == list.Volumes[0],
+		"expected a first page, got:", list.Volumes, list.Next)
+	list, err = c.VolumeListWithQuery(&api.ListQuery{Limit: 1, Cursor: list.Next})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 1 && list.Next == "",
+		"expected a last page, got:", list.Volumes, list.Next)
+
+	// tag the second volume
+	err = c.VolumeSetTags(v2.Id, &api.TagsChangeRequest{
+		Change: api.UpdateTags,
+		Tags:   map[string]string{"namespace": "ns2"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err := c.VolumeInfo(v2.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Tags["namespace"] == "ns2",
+		`expected info.Tags["namespace"] == "ns2", got:`, info.Tags["namespace"])
+
+	list, err = c.VolumeListWithSelector("namespace")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Volumes) == 2,
+		"expected len(list.Volumes) == 2, got:", len(list.Volumes))
+
+	err = c.VolumeSetTags(v1.Id, &api.TagsChangeRequest{
+		Change: api.DeleteTags,
+		Tags:   map[string]string{"pvc": ""},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	info, err = c.VolumeInfo(v1.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(info.Tags) == 1,
+		"expected len(info.Tags) == 1, got:", len(info.Tags))
+
+	err = c.VolumeSetTags(idgen.GenUUID(), &api.TagsChangeRequest{
+		Change: api.UpdateTags,
+		Tags:   map[string]string{"namespace": "ns2"},
+	})
+	tests.Assert(t, err != nil, "expected err != nil, got:", err)
+
+	// block volumes
+	volumeReq = &api.VolumeCreateRequest{}
+	volumeReq.Size = 10
+	volumeReq.Block = true
+	_, err = c.VolumeCreate(volumeReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	blockReq := &api.BlockVolumeCreateRequest{}
+	blockReq.Size = 1
+	blockReq.Tags = map[string]string{"pvc": "claim2"}
+	bv, err := c.BlockVolumeCreate(blockReq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bv.Tags["pvc"] == "claim2",
+		`expected bv.Tags["pvc"] == "claim2", got:`, bv.Tags["pvc"])
+
+	blist, err := c.BlockVolumeListWithSelector("pvc=claim2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(blist.BlockVolumes) == 1,
+		"expected len(blist.BlockVolumes) == 1, got:", len(blist.BlockVolumes))
+
+	err = c.BlockVolumeSetTags(bv.Id, &api.TagsChangeRequest{
+		Change: api.SetTags,
+		Tags:   map[string]string{"pvc": "claim3"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	blist, err = c.BlockVolumeListWithSelector("pvc=claim2")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(blist.BlockVolumes) == 0,
+		"expected len(blist.BlockVolumes) == 0, got:", len(blist.BlockVolumes))
+	binfo, err := c.BlockVolumeInfo(bv.Id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, binfo.Tags["pvc"] == "claim3",
+		`expected binfo.Tags["pvc"] == "claim3", got:`, binfo.Tags["pvc"])
+}
+
+func TestBackupDbIfChanged(t *testing.T) {
+	db := tests.Tempfile()
+	defer os.Remove(db)
+
+	// Create the app
+	app := glusterfs.NewTestApp(db)
+	defer app.Close()
+
+	// Setup the server
+	ts := setupHeketiServer(app)
+	defer ts.Close()
+
+	c := newTestClient(ts.URL, "admin", TEST_ADMIN_KEY)
+	tests.Assert(t, c != nil)
+
+	var backup bytes.Buffer
+	tag, changed, err := c.BackupDbIfChanged(&backup, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, changed, "expected changed")
+	tests.Assert(t, tag != "", "expected a tag")
+	tests.Assert(t, backup.Len() > 0, "expected a copy of the db")
+
+	backup.Reset()
+	tag2, changed, err := c.BackupDbIfChanged(&backup, tag)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !changed, "expected not changed")
+	tests.Assert(t, tag2 == tag, "expected same tag, got:", tag2, tag)
+	tests.Assert(t, backup.Len() == 0, "expected no copy of the db")
+
+	_, err = c.ClusterCreate(&api.ClusterCreateRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tag2, changed, err = c.BackupDbIfChanged(&backup, tag)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, changed, "expected changed")
+	tests.Assert(t, tag2 != tag, "expected new tag, got:", tag2)
+}
@@ -131,12 +131,19 @@ func (c *Client) ClusterInfo(id string) (*api.ClusterInfoResponse, error) {
 }
 
 func (c *Client) ClusterList() (*api.ClusterListResponse, error) {
+	return c.ClusterListWithQuery(&api.ListQuery{})
+}
+
+// ClusterListWithQuery returns the page of clusters selected by the
+// query. Clusters can only be paged, not filtered.
+func (c *Client) ClusterListWithQuery(q *api.ListQuery) (*api.ClusterListResponse, error) {
 
 	// Create request
 	req, err := http.NewRequest("GET", c.host+"/clusters", nil)
 	if err != nil {
 		return nil, err
 	}
+	req.URL.RawQuery = q.Values().Encode()
 
 	// Set token
 	err = c.setToken(req)
@@ -13,15 +13,29 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/heketi/v10/pkg/utils"
 )
 
 // DbDump provides a JSON representation of current state of DB
 func (c *Client) DbDump() (string, error) {
-	req, err := http.NewRequest("GET", c.host+"/db/dump", nil)
+	return c.dbDump(c.host + "/db/dump")
+}
+
+// DbDumpCluster provides a JSON representation of the entries of one
+// cluster of the DB, which can be merged into another DB
+func (c *Client) DbDumpCluster(id string) (string, error) {
+	return c.dbDump(c.host + "/db/dump?cluster=" + url.QueryEscape(id))
+}
+
+func (c *Client) dbDump(endpoint string) (string, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return "", err
 	}
@@ -82,3 +96,43 @@ func (c *Client) DbCheck() (string, error) {
 	respJSON := string(respBytes)
 	return respJSON, nil
 }
+
+// DbRepair applies the fixes of issues reported by the DB check
+func (c *Client) DbRepair(request *api.DbRepairRequest) (*api.DbRepairResponse, error) {
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/db/repair",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var repair api.DbRepairResponse
+	err = utils.GetJsonFromResponse(r, &repair)
+	if err != nil {
+		return nil, err
+	}
+	return &repair, nil
+}
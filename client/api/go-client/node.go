@@ -216,3 +216,58 @@ func (c *Client) NodeSetTags(id string, request *api.TagsChangeRequest) error {
 	}
 	return nil
 }
+
+func (c *Client) NodeSshHostKey(id string) (*api.NodeSshHostKeyResponse, error) {
+	req, err := http.NewRequest("GET", c.host+"/nodes/"+id+"/sshhostkey", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var key api.NodeSshHostKeyResponse
+	err = utils.GetJsonFromResponse(r, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (c *Client) NodeSshHostKeyReset(id string) error {
+	req, err := http.NewRequest("DELETE", c.host+"/nodes/"+id+"/sshhostkey", nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+	return nil
+}
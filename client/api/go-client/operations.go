@@ -159,3 +159,30 @@ func (c *Client) PendingOperationCleanUp(
 	}
 	return nil
 }
+
+// PendingOperationCancel asks the server to stop a queued or running
+// operation. The server accepts the request and stops the operation
+// in the background; it does not wait for the rollback to complete.
+func (c *Client) PendingOperationCancel(id string) error {
+	req, err := http.NewRequest("POST",
+		c.host+"/operations/pending/"+id+"/cancel", nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), as published by the Free Software Foundation,
+// or under the Apache License, Version 2.0 <LICENSE-APACHE2 or
+// http://www.apache.org/licenses/LICENSE-2.0>.
+//
+// You may not use this file except in compliance with those terms.
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+func (c *Client) ProfileCreate(request *api.PlacementProfile) (*api.PlacementProfile, error) {
+
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/profiles",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusCreated {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var profile api.PlacementProfile
+	err = utils.GetJsonFromResponse(r, &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (c *Client) ProfileInfo(name string) (*api.PlacementProfile, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/profiles/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var profile api.PlacementProfile
+	err = utils.GetJsonFromResponse(r, &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (c *Client) ProfileList() (*api.PlacementProfileListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/profiles", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get list
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var profiles api.PlacementProfileListResponse
+	err = utils.GetJsonFromResponse(r, &profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profiles, nil
+}
+
+func (c *Client) ProfileDelete(name string) error {
+
+	// Create DELETE request
+	req, err := http.NewRequest("DELETE", c.host+"/profiles/"+name, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
@@ -184,12 +184,26 @@ func (c *Client) VolumeExpand(id string, request *api.VolumeExpandRequest) (
 }
 
 func (c *Client) VolumeList() (*api.VolumeListResponse, error) {
+	return c.VolumeListWithSelector("")
+}
+
+// VolumeListWithSelector returns the ids of the volumes whose tags match
+// the selector, such as "owner=ns1,!archived". An empty selector
+// matches all of them.
+func (c *Client) VolumeListWithSelector(selector string) (*api.VolumeListResponse, error) {
+	return c.VolumeListWithQuery(&api.ListQuery{Selector: selector})
+}
+
+// VolumeListWithQuery returns the page of volumes selected by the
+// query. See api.ListQuery.
+func (c *Client) VolumeListWithQuery(q *api.ListQuery) (*api.VolumeListResponse, error) {
 
 	// Create request
 	req, err := http.NewRequest("GET", c.host+"/volumes", nil)
 	if err != nil {
 		return nil, err
 	}
+	req.URL.RawQuery = q.Values().Encode()
 
 	// Set token
 	err = c.setToken(req)
@@ -335,3 +349,35 @@ func (c *Client) VolumeClone(id string, request *api.VolumeCloneRequest) (*api.V
 
 	return &volume, nil
 }
+
+func (c *Client) VolumeSetTags(id string, request *api.TagsChangeRequest) error {
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/tags",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+	return nil
+}
@@ -15,8 +15,12 @@ import (
 	"fmt"
 	"strings"
 
+	client "github.com/heketi/heketi/v10/client/api/go-client"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/kubernetes"
 	"github.com/spf13/cobra"
+	kubeapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 var (
@@ -25,6 +29,16 @@ var (
 	bv_auth     bool
 	bv_clusters string
 	bv_ha       int
+	bv_tags     string
+	bv_selector string
+
+	bvListCluster    string
+	bvListNamePrefix string
+	bvListMinSize    int
+	bvListMaxSize    int
+
+	bvKubePv              bool
+	bvKubeSecretNamespace string
 
 	bvNewSize int
 	bvId      string
@@ -37,6 +51,8 @@ func init() {
 	blockVolumeCommand.AddCommand(blockVolumeInfoCommand)
 	blockVolumeCommand.AddCommand(blockVolumeListCommand)
 	blockVolumeCommand.AddCommand(blockVolumeExpandCommand)
+	blockVolumeCommand.AddCommand(blockVolumeSetTagsCommand)
+	blockVolumeCommand.AddCommand(blockVolumeRmTagsCommand)
 
 	blockVolumeCreateCommand.Flags().IntVar(&bv_size, "size", 0,
 		"\n\tSize of volume in GiB")
@@ -52,15 +68,43 @@ func init() {
 			"\n\ton any of the configured clusters which have the available space."+
 			"\n\tProviding a set of clusters will ensure Heketi allocates storage"+
 			"\n\tfor this volume only in the clusters specified.")
+	blockVolumeCreateCommand.Flags().BoolVar(&bvKubePv, "persistent-volume", false,
+		"\n\tOptional: Output to standard out an iSCSI persistent volume JSON file"+
+			"\n\tfor OpenShift or Kubernetes. If authentication is enabled the"+
+			"\n\tSecret holding the CHAP credentials is included.")
+	blockVolumeCreateCommand.Flags().StringVar(&bvKubeSecretNamespace,
+		"persistent-volume-secret-namespace", "default",
+		"\n\tOptional: Namespace of the CHAP Secret of the persistent volume")
 	blockVolumeExpandCommand.Flags().IntVar(&bvNewSize, "new-size", 0,
 		"\n\tNet new size of block volume in GiB")
 	blockVolumeExpandCommand.Flags().StringVar(&bvId, "blockvolume", "",
 		"\n\tId of block volume to expand")
+	blockVolumeCreateCommand.Flags().StringVar(&bv_tags, "tags", "",
+		"\n\tOptional: Comma separated list of tag:value pairs set on the volume,"+
+			"\n\tsuch as the namespace and claim owning it.")
+	blockVolumeListCommand.Flags().StringVar(&bv_selector, "selector", "",
+		"\n\tOptional: Only list the block volumes whose tags match the selector."+
+			"\n\tComma separated list of requirements: tag=value, tag!=value,"+
+			"\n\ttag (tag is set) and !tag (tag is not set).")
+	blockVolumeListCommand.Flags().StringVar(&bvListCluster, "cluster", "",
+		"\n\tOptional: Only list the block volumes of this cluster.")
+	blockVolumeListCommand.Flags().StringVar(&bvListNamePrefix, "name-prefix", "",
+		"\n\tOptional: Only list the block volumes whose name starts with this prefix.")
+	blockVolumeListCommand.Flags().IntVar(&bvListMinSize, "min-size", 0,
+		"\n\tOptional: Only list the block volumes of at least this size in GiB.")
+	blockVolumeListCommand.Flags().IntVar(&bvListMaxSize, "max-size", 0,
+		"\n\tOptional: Only list the block volumes of at most this size in GiB.")
+	blockVolumeSetTagsCommand.Flags().BoolP("exact", "e", false,
+		"Set the object to this exact set of tags. Overwrites existing tags.")
+	blockVolumeRmTagsCommand.Flags().Bool("all", false,
+		"Remove all tags.")
 	blockVolumeCreateCommand.SilenceUsage = true
 	blockVolumeDeleteCommand.SilenceUsage = true
 	blockVolumeInfoCommand.SilenceUsage = true
 	blockVolumeListCommand.SilenceUsage = true
 	blockVolumeExpandCommand.SilenceUsage = true
+	blockVolumeSetTagsCommand.SilenceUsage = true
+	blockVolumeRmTagsCommand.SilenceUsage = true
 }
 
 var blockVolumeCommand = &cobra.Command{
@@ -87,6 +131,13 @@ var blockVolumeCreateCommand = &cobra.Command{
   * Create a 100GiB block volume specifying two specific clusters auth enabled:
       $ heketi-cli blockvolume create --size=100 --auth \
         --clusters=0995098e1284ddccb46c7752d142c832,60d46d518074b13a04ce1022c8c7193c
+
+  * Create a 100GiB block volume with auth enabled and output the
+    persistent volume and CHAP secret to use it from Kubernetes:
+      $ heketi-cli blockvolume create --size=100 --auth --persistent-volume
+
+  * Create a 100GiB block volume tagged with the claim it was created for:
+      $ heketi-cli blockvolume create --size=100 --tags=namespace:ns1,pvc:claim1
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if bv_size == 0 {
@@ -104,6 +155,14 @@ var blockVolumeCreateCommand = &cobra.Command{
 			req.Name = bv_volname
 		}
 
+		if bv_tags != "" {
+			tags, err := parseTags(strings.Split(bv_tags, ","))
+			if err != nil {
+				return err
+			}
+			req.Tags = tags
+		}
+
 		if bv_ha >= 0 {
 			req.Hacount = bv_ha
 		} else {
@@ -120,7 +179,28 @@ var blockVolumeCreateCommand = &cobra.Command{
 			return err
 		}
 
-		if options.Json {
+		if bvKubePv {
+			// Create PV, preceded by its secret if it needs one
+			list := &kubeapi.List{}
+			list.Kind = "List"
+			list.APIVersion = "v1"
+			secret := kubernetes.BlockVolumeToSecret(blockvolume,
+				"", bvKubeSecretNamespace)
+			if secret != nil {
+				list.Items = append(list.Items,
+					runtime.RawExtension{Object: secret})
+			}
+			pv := kubernetes.BlockVolumeToPv(blockvolume,
+				"", "", bvKubeSecretNamespace)
+			list.Items = append(list.Items, runtime.RawExtension{Object: pv})
+
+			// Convert to JSON
+			data, err := json.MarshalIndent(list, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, string(data))
+		} else if options.Json {
 			data, err := json.Marshal(blockvolume)
 			if err != nil {
 				return err
@@ -208,10 +288,14 @@ var blockVolumeInfoCommand = &cobra.Command{
 }
 
 var blockVolumeListCommand = &cobra.Command{
-	Use:     "list",
-	Short:   "Lists the volumes managed by Heketi",
-	Long:    "Lists the volumes managed by Heketi",
-	Example: "  $ heketi-cli blockvolume list",
+	Use:   "list",
+	Short: "Lists the volumes managed by Heketi",
+	Long:  "Lists the volumes managed by Heketi",
+	Example: `  $ heketi-cli blockvolume list
+
+  * List the block volumes created for claims in namespace ns1:
+      $ heketi-cli blockvolume list --selector=namespace=ns1,pvc
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create a client
 		heketi, err := newHeketiClient()
@@ -219,36 +303,67 @@ var blockVolumeListCommand = &cobra.Command{
 			return err
 		}
 
-		// List volumes
-		list, err := heketi.BlockVolumeList()
-		if err != nil {
-			return err
+		// List volumes a page at a time, along with their information
+		q := &api.ListQuery{
+			Cluster:    bvListCluster,
+			NamePrefix: bvListNamePrefix,
+			MinSize:    bvListMinSize,
+			MaxSize:    bvListMaxSize,
+			Selector:   bv_selector,
+			Limit:      listPageSize,
+			Detail:     !options.Json,
+		}
+		all := &api.BlockVolumeListResponse{BlockVolumes: []string{}}
+		for {
+			list, err := heketi.BlockVolumeListWithQuery(q)
+			if err != nil {
+				return err
+			}
+			if options.Json {
+				all.BlockVolumes = append(all.BlockVolumes, list.BlockVolumes...)
+			} else if err := printBlockVolumeList(heketi, list); err != nil {
+				return err
+			}
+			if list.Next == "" {
+				break
+			}
+			q.Cursor = list.Next
 		}
 
 		if options.Json {
-			data, err := json.Marshal(list)
+			data, err := json.Marshal(all)
 			if err != nil {
 				return err
 			}
 			fmt.Fprintf(stdout, string(data))
-		} else {
-			for _, id := range list.BlockVolumes {
-				volume, err := heketi.BlockVolumeInfo(id)
-				if err != nil {
-					return err
-				}
-
-				fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v\n",
-					id,
-					volume.Cluster,
-					volume.Name)
-			}
 		}
 
 		return nil
 	},
 }
 
+func printBlockVolumeList(heketi *client.Client, list *api.BlockVolumeListResponse) error {
+	for i, id := range list.BlockVolumes {
+		// servers not supporting details only return ids
+		var volume *api.BlockVolumeInfoResponse
+		if i < len(list.Details) {
+			volume = &list.Details[i]
+		} else {
+			var err error
+			volume, err = heketi.BlockVolumeInfo(id)
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v\n",
+			id,
+			volume.Cluster,
+			volume.Name)
+	}
+	return nil
+}
+
 var blockVolumeExpandCommand = &cobra.Command{
 	Use:   "expand",
 	Short: "Expand an existing block volume",
@@ -302,3 +417,34 @@ var blockVolumeExpandCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var blockVolumeSetTagsCommand = &cobra.Command{
+	Use:     "settags [blockvolume_id] tag1:value1 tag2:value2...",
+	Short:   "Sets tags on a block volume",
+	Long:    "Sets user-controlled metadata tags on a block volume",
+	Example: "  $ heketi-cli blockvolume settags 886a86a868711bef83001 pvc:claim1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		return setTagsCommand(cmd, heketi.BlockVolumeSetTags)
+	},
+}
+
+var blockVolumeRmTagsCommand = &cobra.Command{
+	Use:     "rmtags [blockvolume_id] tag1:value1 tag2:value2...",
+	Aliases: []string{"deltags", "removetags"},
+	Short:   "Removes tags from a block volume",
+	Long:    "Removes user-controlled metadata tags on a block volume",
+	Example: "  $ heketi-cli blockvolume rmtags 886a86a868711bef83001 pvc",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		return rmTagsCommand(cmd, heketi.BlockVolumeSetTags)
+	},
+}
@@ -16,15 +16,18 @@ import (
 	"strconv"
 	"strings"
 
+	client "github.com/heketi/heketi/v10/client/api/go-client"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cl_block     bool
-	cl_file      bool
-	cl_block_str string
-	cl_file_str  string
+	cl_block        bool
+	cl_file         bool
+	cl_block_str    string
+	cl_file_str     string
+	cl_avg_size     uint64
+	cl_avg_size_str string
 )
 
 func init() {
@@ -45,6 +48,10 @@ func init() {
 			"\n\tregular file volumes on the cluster to be created."+
 			"\n\tThis is enabled by default. Use '--file=false' to"+
 			"\n\tdisable creation of file volumes on this cluster.")
+	clusterCreateCommand.Flags().Uint64Var(&cl_avg_size, "average-file-size-kb", 0,
+		"\n\tOptional: Default average file size in KiB used to size the"+
+			"\n\tarbiter bricks of the volumes of the cluster, unless set by"+
+			"\n\tthe volume or the tags of the device.")
 
 	clusterSetFlagsCommand.Flags().StringVar(&cl_block_str, "block", "",
 		"\n\tOptional: Allow the user to control the possibility of creating"+
@@ -56,6 +63,10 @@ func init() {
 			"\n\tregular file volumes on the cluster. Use '--file=true'"+
 			"\n\tto enable and '--file=false' to disable creation of"+
 			"\n\tfile volumes on this cluster.")
+	clusterSetFlagsCommand.Flags().StringVar(&cl_avg_size_str, "average-file-size-kb", "",
+		"\n\tOptional: Default average file size in KiB used to size the"+
+			"\n\tarbiter bricks of the volumes of the cluster. Use"+
+			"\n\t'--average-file-size-kb=0' to clear the default.")
 
 	clusterCreateCommand.SilenceUsage = true
 	clusterDeleteCommand.SilenceUsage = true
@@ -87,6 +98,7 @@ var clusterCreateCommand = &cobra.Command{
 		req := &api.ClusterCreateRequest{}
 		req.File = cl_file
 		req.Block = cl_block
+		req.AverageFileSize = cl_avg_size
 
 		// Create a client to talk to Heketi
 		heketi, err := newHeketiClient()
@@ -123,6 +135,9 @@ var clusterSetFlagsCommand = &cobra.Command{
 
   * Enable the creation of block volumes on a cluster:
       $ heketi-cli cluster set --block=true 886a86a868711bef83001
+
+  * Size arbiter bricks for an average file size of 16KiB:
+      $ heketi-cli cluster setflags --average-file-size-kb=16 886a86a868711bef83001
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		s := cmd.Flags().Args()
@@ -130,8 +145,8 @@ var clusterSetFlagsCommand = &cobra.Command{
 			return errors.New("Cluster id missing")
 		}
 
-		if cl_block_str == "" && cl_file_str == "" {
-			return errors.New("At least one of --file or --block must be specified.")
+		if cl_block_str == "" && cl_file_str == "" && cl_avg_size_str == "" {
+			return errors.New("At least one of --file, --block or --average-file-size-kb must be specified.")
 		}
 
 		clusterId := cmd.Flags().Arg(0)
@@ -166,6 +181,14 @@ var clusterSetFlagsCommand = &cobra.Command{
 			}
 		}
 
+		if cl_avg_size_str != "" {
+			size, err := strconv.ParseUint(cl_avg_size_str, 10, 64)
+			if err != nil {
+				return err
+			}
+			req.AverageFileSize = &size
+		}
+
 		err = heketi.ClusterSetFlags(clusterId, req)
 		if err != nil {
 			return err
@@ -245,6 +268,10 @@ var clusterInfoCommand = &cobra.Command{
 			fmt.Fprintf(stdout, "\nVolumes:\n%v", strings.Join(info.Volumes, "\n"))
 			fmt.Fprintf(stdout, "\nBlock: %v\n", info.Block)
 			fmt.Fprintf(stdout, "\nFile: %v\n", info.File)
+			if info.AverageFileSize != 0 {
+				fmt.Fprintf(stdout, "\nAverage File Size (KiB): %v\n",
+					info.AverageFileSize)
+			}
 		}
 
 		return nil
@@ -263,41 +290,69 @@ var clusterListCommand = &cobra.Command{
 			return err
 		}
 
-		// List clusters
-		list, err := heketi.ClusterList()
-		if err != nil {
-			return err
+		// List clusters a page at a time, along with their information
+		q := &api.ListQuery{
+			Limit:  listPageSize,
+			Detail: !options.Json,
+		}
+		all := &api.ClusterListResponse{Clusters: []string{}}
+		if !options.Json {
+			fmt.Fprintf(stdout, "Clusters:\n")
+		}
+		for {
+			list, err := heketi.ClusterListWithQuery(q)
+			if err != nil {
+				return err
+			}
+			if options.Json {
+				all.Clusters = append(all.Clusters, list.Clusters...)
+			} else if err := printClusterList(heketi, list); err != nil {
+				return err
+			}
+			if list.Next == "" {
+				break
+			}
+			q.Cursor = list.Next
 		}
 
 		if options.Json {
-			data, err := json.Marshal(list)
+			data, err := json.Marshal(all)
 			if err != nil {
 				return err
 			}
 			fmt.Fprintf(stdout, string(data))
-		} else {
-			fmt.Fprintf(stdout, "Clusters:\n")
-			for _, clusterid := range list.Clusters {
-				cluster, err := heketi.ClusterInfo(clusterid)
-				if err != nil {
-					return err
-				}
-
-				usagestr := ""
-				if cluster.File {
-					usagestr = "[file]"
-				}
-				if cluster.Block {
-					usagestr = usagestr + "[block]"
-				}
-				if usagestr == "" {
-					usagestr = "[]"
-				}
-
-				fmt.Fprintf(stdout, "Id:%v %v\n", clusterid, usagestr)
-			}
 		}
 
 		return nil
 	},
 }
+
+func printClusterList(heketi *client.Client, list *api.ClusterListResponse) error {
+	for i, clusterid := range list.Clusters {
+		// servers not supporting details only return ids
+		var cluster *api.ClusterInfoResponse
+		if i < len(list.Details) {
+			cluster = &list.Details[i]
+		} else {
+			var err error
+			cluster, err = heketi.ClusterInfo(clusterid)
+			if err != nil {
+				return err
+			}
+		}
+
+		usagestr := ""
+		if cluster.File {
+			usagestr = "[file]"
+		}
+		if cluster.Block {
+			usagestr = usagestr + "[block]"
+		}
+		if usagestr == "" {
+			usagestr = "[]"
+		}
+
+		fmt.Fprintf(stdout, "Id:%v %v\n", clusterid, usagestr)
+	}
+	return nil
+}
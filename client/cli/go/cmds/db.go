@@ -10,17 +10,35 @@
 package cmds
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dumpCluster  string
+	repairIssues []string
+)
+
 func init() {
 	RootCmd.AddCommand(dbCommand)
 	dbCommand.AddCommand(dumpDbCommand)
+	dumpDbCommand.Flags().StringVar(&dumpCluster, "cluster", "",
+		"\n\tOptional: Only dump the entries of this cluster, to be merged"+
+			"\n\tinto another db with heketi db import --merge.")
 	dumpDbCommand.SilenceUsage = true
 	dbCommand.AddCommand(checkDbCommand)
 	checkDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(repairDbCommand)
+	repairDbCommand.Flags().StringArrayVar(&repairIssues, "issue", nil,
+		"\n\tId of an issue reported by heketi-cli db check to repair."+
+			"\n\tMay be given multiple times.")
+	repairDbCommand.SilenceUsage = true
+	dbCommand.AddCommand(backupsDbCommand)
+	backupsDbCommand.SilenceUsage = true
 }
 
 var dbCommand = &cobra.Command{
@@ -30,17 +48,26 @@ var dbCommand = &cobra.Command{
 }
 
 var dumpDbCommand = &cobra.Command{
-	Use:     "dump",
-	Short:   "dumps the database in json format",
-	Long:    "dumps the database in json format",
-	Example: "  $ heketi-cli db dump",
+	Use:   "dump",
+	Short: "dumps the database in json format",
+	Long:  "dumps the database in json format",
+	Example: `  * Dump the database
+      $ heketi-cli db dump
+
+  * Dump the entries of one cluster
+      $ heketi-cli db dump --cluster=886a86a868711bef83001`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		heketi, err := newHeketiClient()
 		if err != nil {
 			return err
 		}
 
-		dump, err := heketi.DbDump()
+		var dump string
+		if dumpCluster != "" {
+			dump, err = heketi.DbDumpCluster(dumpCluster)
+		} else {
+			dump, err = heketi.DbDump()
+		}
 		if err != nil {
 			return err
 		}
@@ -72,3 +99,77 @@ var checkDbCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var repairDbCommand = &cobra.Command{
+	Use:   "repair",
+	Short: "repairs issues reported by the db check",
+	Long: "applies the fixes of issues reported by the db check, after\n" +
+		"taking a backup of the db",
+	Example: `  * Repair two issues
+      $ heketi-cli db repair \
+          --issue=orphan-pending-op/a7bd5d3bf2b7e0d0ac5bf68a6c6ab1b4 \
+          --issue=device-used-size-mismatch/5f6b0f3f9a2e8d4c1b7a6e5d4c3b2a19`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(repairIssues) == 0 {
+			return fmt.Errorf("Missing issues to repair")
+		}
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		resp, err := heketi.DbRepair(&api.DbRepairRequest{Issues: repairIssues})
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(resp)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+			return nil
+		}
+		fmt.Fprintf(stdout, "Backup of the db: %v\n", resp.Backup)
+		for _, id := range resp.Repaired {
+			fmt.Fprintf(stdout, "Repaired: %v\n", id)
+		}
+		return nil
+	},
+}
+
+var backupsDbCommand = &cobra.Command{
+	Use:     "backups",
+	Short:   "lists the backups of the database",
+	Long:    "lists the backups of the database kept by the server, most recent first",
+	Example: "  $ heketi-cli db backups",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		list, err := heketi.BackupList()
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+			return nil
+		}
+		for _, b := range list.Backups {
+			fmt.Fprintf(stdout, "%v\tTime:%v\tSize:%v\tCompressed:%v\n",
+				b.Name,
+				time.Unix(b.Time, 0).UTC().Format(time.RFC3339),
+				b.Size,
+				b.Compressed)
+		}
+		return nil
+	},
+}
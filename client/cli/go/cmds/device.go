@@ -250,6 +250,19 @@ var deviceInfoCommand = &cobra.Command{
 			fmt.Fprintf(stdout, "Physical Volume UUID: %v\n", info.PvUUID)
 			fmt.Fprintf(stdout, "Known Paths: %v\n",
 				strings.Join(info.Paths, " "))
+			if info.Drift != nil {
+				fmt.Fprintf(stdout, "Free Size Drift (GiB): %.2f\n",
+					float64(info.Drift.FreeDiff)/(1024*1024))
+			}
+			if info.ArbiterInodes != nil {
+				fmt.Fprintf(stdout, "Arbiter Inodes: capacity %v, expected %v, headroom %v%%\n",
+					info.ArbiterInodes.Capacity,
+					info.ArbiterInodes.Expected,
+					info.ArbiterInodes.Headroom)
+			}
+			for _, w := range info.Warnings {
+				fmt.Fprintf(stdout, "Warning: %v\n", w)
+			}
 			if len(info.Tags) != 0 {
 				fmt.Fprintf(stdout, "Tags:\n")
 				for k, v := range info.Tags {
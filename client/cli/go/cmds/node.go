@@ -37,6 +37,8 @@ func init() {
 	nodeCommand.AddCommand(nodeRemoveCommand)
 	nodeCommand.AddCommand(nodeSetTagsCommand)
 	nodeCommand.AddCommand(nodeRmTagsCommand)
+	nodeCommand.AddCommand(nodeHostKeyCommand)
+	nodeHostKeyCommand.AddCommand(nodeHostKeyResetCommand)
 	nodeAddCommand.Flags().IntVar(&zone, "zone", 0, "The zone in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&clusterId, "cluster", "", "The cluster in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&managmentHostNames, "management-host-name", "", "Management host name")
@@ -51,6 +53,8 @@ func init() {
 	nodeListCommand.SilenceUsage = true
 	nodeRemoveCommand.SilenceUsage = true
 	nodeSetTagsCommand.SilenceUsage = true
+	nodeHostKeyCommand.SilenceUsage = true
+	nodeHostKeyResetCommand.SilenceUsage = true
 }
 
 var nodeCommand = &cobra.Command{
@@ -375,6 +379,70 @@ var nodeRmTagsCommand = &cobra.Command{
 	},
 }
 
+var nodeHostKeyCommand = &cobra.Command{
+	Use:     "hostkey [node_id]",
+	Short:   "Shows the ssh host key pinned for a node",
+	Long:    "Shows the ssh host key pinned for a node",
+	Example: "  $ heketi-cli node hostkey 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		key, err := heketi.NodeSshHostKey(nodeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else if key.Key == "" {
+			fmt.Fprintf(stdout, "No ssh host key pinned for node %v\n", nodeId)
+		} else {
+			fmt.Fprintf(stdout, "Fingerprint: %v\nKey: %v\n",
+				key.Fingerprint, key.Key)
+		}
+		return nil
+	},
+}
+
+var nodeHostKeyResetCommand = &cobra.Command{
+	Use:   "reset [node_id]",
+	Short: "Removes the ssh host key pinned for a node",
+	Long: "Removes the ssh host key pinned for a node. The key presented " +
+		"on the next connection to the node will be pinned.",
+	Example: "  $ heketi-cli node hostkey reset 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Node id missing")
+		}
+		nodeId := cmd.Flags().Arg(0)
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+
+		err = heketi.NodeSshHostKeyReset(nodeId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Ssh host key of node %v has been reset\n", nodeId)
+		}
+		return err
+	},
+}
+
 func printNodeInfo(w io.Writer, info *api.NodeInfoResponse) {
 	fmt.Fprintf(stdout, "Node Id: %v\n"+
 		"State: %v\n"+
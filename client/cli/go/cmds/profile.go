@@ -0,0 +1,281 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pf_description  string
+	pf_tag_match    string
+	pf_zone_check   string
+	pf_durability   string
+	pf_replica      int
+	pf_disperseData int
+	pf_redundancy   int
+	pf_disperseAuto bool
+	pf_brickMinSize int
+	pf_brickMaxSize int
+	pf_volOptions   string
+)
+
+func init() {
+	RootCmd.AddCommand(profileCommand)
+	profileCommand.AddCommand(profileCreateCommand)
+	profileCommand.AddCommand(profileDeleteCommand)
+	profileCommand.AddCommand(profileListCommand)
+	profileCommand.AddCommand(profileInfoCommand)
+
+	profileCreateCommand.Flags().StringVar(&pf_description, "description", "",
+		"\n\tOptional: Description of the profile.")
+	profileCreateCommand.Flags().StringVar(&pf_tag_match, "tag-match", "",
+		"\n\tOptional: Place the bricks only on devices matching the"+
+			"\n\ttag rule, such as 'disk=ssd' or 'disk!=hdd'.")
+	profileCreateCommand.Flags().StringVar(&pf_zone_check, "zone-checking", "",
+		"\n\tOptional: Zone checking strategy of the volumes:"+
+			"\n\tnone or strict.")
+	profileCreateCommand.Flags().StringVar(&pf_durability, "durability", "",
+		"\n\tOptional: Default durability type of the volumes: none,"+
+			"\n\treplicate or disperse.")
+	profileCreateCommand.Flags().IntVar(&pf_replica, "replica", 3,
+		"\n\tReplica value for durability type 'replicate'.")
+	profileCreateCommand.Flags().IntVar(&pf_disperseData, "disperse-data", 4,
+		"\n\tOptional: Dispersion value for durability type 'disperse'.")
+	profileCreateCommand.Flags().IntVar(&pf_redundancy, "redundancy", 2,
+		"\n\tOptional: Redundancy value for durability type 'disperse'.")
+	profileCreateCommand.Flags().BoolVar(&pf_disperseAuto, "disperse-auto", false,
+		"\n\tOptional: Let the server choose the geometry of volumes of"+
+			"\n\tdurability type 'disperse'.")
+	profileCreateCommand.Flags().IntVar(&pf_brickMinSize, "brick-min-size-gb", 0,
+		"\n\tOptional: Minimum size of the bricks in GiB.")
+	profileCreateCommand.Flags().IntVar(&pf_brickMaxSize, "brick-max-size-gb", 0,
+		"\n\tOptional: Maximum size of the bricks in GiB.")
+	profileCreateCommand.Flags().StringVar(&pf_volOptions, "gluster-volume-options", "",
+		"\n\tOptional: Comma separated list of volume options set on"+
+			"\n\tthe volumes.")
+
+	profileCreateCommand.SilenceUsage = true
+	profileDeleteCommand.SilenceUsage = true
+	profileInfoCommand.SilenceUsage = true
+	profileListCommand.SilenceUsage = true
+}
+
+var profileCommand = &cobra.Command{
+	Use:   "profile",
+	Short: "Heketi placement profile management",
+	Long:  "Heketi Placement Profile Management",
+}
+
+var profileCreateCommand = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a placement profile",
+	Long:  "Create a placement profile",
+	Example: `  * Create a profile placing replica 3 volumes on ssd devices
+    in three zones:
+      $ heketi-cli profile create ssd-strict --tag-match=disk=ssd \
+        --zone-checking=strict --durability=replicate --replica=3
+
+  * Create a profile placing large bricks on hdd devices:
+      $ heketi-cli profile create hdd-bulk --tag-match=disk=hdd \
+        --brick-min-size-gb=100
+
+  * Create a volume with a profile:
+      $ heketi-cli volume create --size=100 --profile=ssd-strict
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Profile name missing")
+		}
+
+		req := &api.PlacementProfile{
+			Name:           cmd.Flags().Arg(0),
+			Description:    pf_description,
+			TagMatch:       pf_tag_match,
+			ZoneChecking:   pf_zone_check,
+			BrickMinSizeGb: pf_brickMinSize,
+			BrickMaxSizeGb: pf_brickMaxSize,
+		}
+		switch api.DurabilityType(pf_durability) {
+		case "":
+		case api.DurabilityReplicate:
+			req.Durability.Type = api.DurabilityReplicate
+			req.Durability.Replicate.Replica = pf_replica
+		case api.DurabilityEC:
+			req.Durability.Type = api.DurabilityEC
+			if pf_disperseAuto {
+				req.Durability.Disperse.Auto = true
+				if cmd.Flags().Changed("redundancy") {
+					req.Durability.Disperse.Redundancy = pf_redundancy
+				}
+			} else {
+				req.Durability.Disperse.Data = pf_disperseData
+				req.Durability.Disperse.Redundancy = pf_redundancy
+			}
+		default:
+			req.Durability.Type = api.DurabilityType(pf_durability)
+		}
+		if pf_volOptions != "" {
+			req.GlusterVolumeOptions = strings.Split(pf_volOptions, ",")
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		profile, err := heketi.ProfileCreate(req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(profile)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			fmt.Fprintf(stdout, "Profile: %v\n", profile.Name)
+		}
+		return nil
+	},
+}
+
+var profileDeleteCommand = &cobra.Command{
+	Use:     "delete [name]",
+	Short:   "Delete a placement profile",
+	Long:    "Delete a placement profile. Volumes created with the profile keep its settings.",
+	Example: "  $ heketi-cli profile delete ssd-strict",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Profile name missing")
+		}
+		name := cmd.Flags().Arg(0)
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		err = heketi.ProfileDelete(name)
+		if err == nil {
+			fmt.Fprintf(stdout, "Profile %v deleted\n", name)
+		}
+		return err
+	},
+}
+
+var profileInfoCommand = &cobra.Command{
+	Use:     "info [name]",
+	Short:   "Retrieves information about a placement profile",
+	Long:    "Retrieves information about a placement profile",
+	Example: "  $ heketi-cli profile info ssd-strict",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Profile name missing")
+		}
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		profile, err := heketi.ProfileInfo(cmd.Flags().Arg(0))
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(profile)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			printProfile(profile)
+		}
+		return nil
+	},
+}
+
+var profileListCommand = &cobra.Command{
+	Use:     "list",
+	Short:   "Lists the placement profiles",
+	Long:    "Lists the placement profiles",
+	Example: "  $ heketi-cli profile list",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		list, err := heketi.ProfileList()
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+		} else {
+			for _, profile := range list.Profiles {
+				fmt.Fprintf(stdout, "%v\t%v\n", profile.Name, profile.Description)
+			}
+		}
+		return nil
+	},
+}
+
+func printProfile(p *api.PlacementProfile) {
+	fmt.Fprintf(stdout, "Name: %v\n", p.Name)
+	if p.Description != "" {
+		fmt.Fprintf(stdout, "Description: %v\n", p.Description)
+	}
+	if p.TagMatch != "" {
+		fmt.Fprintf(stdout, "Tag Match: %v\n", p.TagMatch)
+	}
+	if p.ZoneChecking != "" {
+		fmt.Fprintf(stdout, "Zone Checking: %v\n", p.ZoneChecking)
+	}
+	switch p.Durability.Type {
+	case api.DurabilityReplicate:
+		fmt.Fprintf(stdout, "Durability: replicate %v\n",
+			p.Durability.Replicate.Replica)
+	case api.DurabilityEC:
+		if p.Durability.Disperse.Auto {
+			fmt.Fprintf(stdout, "Durability: disperse auto, redundancy %v\n",
+				p.Durability.Disperse.Redundancy)
+		} else {
+			fmt.Fprintf(stdout, "Durability: disperse %v+%v\n",
+				p.Durability.Disperse.Data, p.Durability.Disperse.Redundancy)
+		}
+	case api.DurabilityDistributeOnly:
+		fmt.Fprintf(stdout, "Durability: none\n")
+	}
+	if p.BrickMinSizeGb != 0 {
+		fmt.Fprintf(stdout, "Brick Min Size (GiB): %v\n", p.BrickMinSizeGb)
+	}
+	if p.BrickMaxSizeGb != 0 {
+		fmt.Fprintf(stdout, "Brick Max Size (GiB): %v\n", p.BrickMaxSizeGb)
+	}
+	if len(p.GlusterVolumeOptions) != 0 {
+		fmt.Fprintf(stdout, "Gluster Volume Options: %v\n",
+			strings.Join(p.GlusterVolumeOptions, ","))
+	}
+}
@@ -13,9 +13,11 @@
 package cmds
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"text/template"
+	"time"
 
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 
@@ -37,6 +39,7 @@ var operationsCommand = &cobra.Command{
 var opInfoTemplate = `Operation Counts:
   Total: {{.Total}}
   In-Flight: {{.InFlight}}
+  Queued: {{.Queued}}
   New: {{.New}}
   Failed: {{.Failed}}
   Stale: {{.Stale}}
@@ -46,6 +49,10 @@ var popListTemplate = `
 {{- range .PendingOperations -}}
 Id:{{.Id}}  Type:{{.TypeName}}  Status:
 {{- if eq .Status ""}}New{{ else }}{{.Status}}{{end}} {{.SubStatus}}
+{{- with .Progress}}  Phase:{{.Phase}}
+{{- if .Total}}  {{.Items}}:{{.Done}}/{{.Total}}{{end}}
+{{- if .Command}}  Command:{{.Command}}{{end}}
+{{- end}}
 {{ end -}}
 `
 
@@ -53,6 +60,15 @@ var popDetailsTemplate = `
 Id: {{.Id}}
 Type: {{.TypeName}}
 Status: {{if eq .Status ""}}New{{ else }}{{.Status}}{{end}} {{.SubStatus}}
+{{- with .Progress}}
+Phase: {{.Phase}}
+{{- if .Total}}
+Progress: {{.Done}}/{{.Total}} {{.Items}}
+{{- end}}
+{{- if .Command}}
+Command: {{.Command}}
+{{- end}}
+{{- end}}
 Changes:
 {{- range .Changes }}
     {{.Description}}: {{.Id}}
@@ -167,6 +183,76 @@ var operationsCleanUpCommand = &cobra.Command{
 	},
 }
 
+var operationsCancelCommand = &cobra.Command{
+	Use:     "cancel [operation-id]",
+	Short:   "Cancel a queued or running operation",
+	Long:    "Cancel a queued or running operation",
+	Example: `  $ heketi-cli server operations cancel 886a86a868711bef83001`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("Operation id missing")
+		}
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		err = heketi.PendingOperationCancel(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Operation %v cancellation requested\n", args[0])
+		return nil
+	},
+}
+
+var watchInterval int
+
+var operationsWatchCommand = &cobra.Command{
+	Use:   "watch [operation-id]",
+	Short: "Follow the progress of pending operations",
+	Long: "Follow the progress of pending operations until they are done.\n" +
+		"If an operation id is given only that operation is followed.",
+	Example: `  $ heketi-cli server operations watch
+  $ heketi-cli server operations watch --interval=10 886a86a868711bef83001`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if watchInterval < 1 {
+			return fmt.Errorf("Interval must be at least one second")
+		}
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		t, err := template.New("popList").Parse(popListTemplate)
+		if err != nil {
+			return err
+		}
+		for {
+			popList, err := heketi.PendingOperationList()
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				ops := []api.PendingOperationInfo{}
+				for _, op := range popList.PendingOperations {
+					if op.Id == args[0] {
+						ops = append(ops, op)
+					}
+				}
+				popList.PendingOperations = ops
+			}
+			if len(popList.PendingOperations) == 0 {
+				fmt.Fprintln(os.Stdout, "No pending operations")
+				return nil
+			}
+			fmt.Fprintf(os.Stdout, "%v\n", time.Now().Format(time.RFC3339))
+			if err := t.Execute(os.Stdout, popList); err != nil {
+				return err
+			}
+			time.Sleep(time.Duration(watchInterval) * time.Second)
+		}
+	},
+}
+
 var modeCommand = &cobra.Command{
 	Use:   "mode",
 	Short: "Manage server mode",
@@ -214,6 +300,38 @@ var setModeCommand = &cobra.Command{
 	},
 }
 
+var haCommand = &cobra.Command{
+	Use:     "ha",
+	Short:   "Print high availability status of server",
+	Long:    "Print the role of the server in high availability mode and its leader",
+	Example: `  $ heketi-cli server ha`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		status, err := heketi.HaStatus()
+		if err != nil {
+			return err
+		}
+		if options.Json {
+			data, err := json.Marshal(status)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, string(data))
+			return nil
+		}
+		fmt.Fprintf(stdout, "Identity: %v\nRole: %v\nLeader: %v\nLeader Address: %v\n",
+			status.Identity, status.Role, status.Leader, status.LeaderAddress)
+		if status.LastSync != 0 {
+			fmt.Fprintf(stdout, "Last Sync: %v\n",
+				time.Unix(status.LastSync, 0).Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
 var stateCommand = &cobra.Command{
 	Use:   "state",
 	Short: "View and/or modify state of server",
@@ -260,6 +378,12 @@ func init() {
 	operationsListCommand.SilenceUsage = true
 	operationsCommand.AddCommand(operationsCleanUpCommand)
 	operationsCleanUpCommand.SilenceUsage = true
+	operationsCommand.AddCommand(operationsCancelCommand)
+	operationsCancelCommand.SilenceUsage = true
+	operationsCommand.AddCommand(operationsWatchCommand)
+	operationsWatchCommand.Flags().IntVar(&watchInterval, "interval", 5,
+		"\n\tSeconds to wait between updates")
+	operationsWatchCommand.SilenceUsage = true
 	// admin mode command(s)
 	serverCommand.AddCommand(modeCommand)
 	modeCommand.SilenceUsage = true
@@ -267,6 +391,9 @@ func init() {
 	getModeCommand.SilenceUsage = true
 	modeCommand.AddCommand(setModeCommand)
 	setModeCommand.SilenceUsage = true
+	// high availability command(s)
+	serverCommand.AddCommand(haCommand)
+	haCommand.SilenceUsage = true
 	// state command(s)
 	serverCommand.AddCommand(stateCommand)
 	stateCommand.SilenceUsage = true
@@ -20,6 +20,10 @@ import (
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 )
 
+// listPageSize is the number of items requested at once by the list
+// commands.
+const listPageSize = 1000
+
 func setTagsCommand(cmd *cobra.Command,
 	submitTags func(id string, r *api.TagsChangeRequest) error) error {
 
@@ -39,15 +43,9 @@ func setTagsCommand(cmd *cobra.Command,
 
 	id = s[0]
 
-	newTags := map[string]string{}
-	for _, t := range s[1:] {
-		parts := strings.SplitN(t, ":", 2)
-		if len(parts) < 2 {
-			return fmt.Errorf(
-				"expected colon (:) between tag name and value, got: %v",
-				t)
-		}
-		newTags[parts[0]] = parts[1]
+	newTags, err := parseTags(s[1:])
+	if err != nil {
+		return err
 	}
 
 	var req *api.TagsChangeRequest
@@ -60,6 +58,21 @@ func setTagsCommand(cmd *cobra.Command,
 	return submitTags(id, req)
 }
 
+// parseTags converts a list of "tag:value" strings into a map of tags.
+func parseTags(l []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, t := range l {
+		parts := strings.SplitN(t, ":", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf(
+				"expected colon (:) between tag name and value, got: %v",
+				t)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
+
 func rmTagsCommand(cmd *cobra.Command,
 	submitTags func(id string, r *api.TagsChangeRequest) error) error {
 
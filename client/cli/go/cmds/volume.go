@@ -17,6 +17,7 @@ import (
 	"strings"
 	"text/template"
 
+	client "github.com/heketi/heketi/v10/client/api/go-client"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
 	"github.com/heketi/heketi/v10/pkg/kubernetes"
 	"github.com/spf13/cobra"
@@ -29,6 +30,7 @@ var (
 	replica              int
 	disperseData         int
 	redundancy           int
+	disperseAuto         bool
 	gid                  int64
 	snapshotFactor       float64
 	clusters             string
@@ -39,6 +41,17 @@ var (
 	kubePv               bool
 	glusterVolumeOptions string
 	block                bool
+	volumeTags           string
+	volumeProfile        string
+	antiAffinityVolumes  string
+	antiAffinitySelector string
+	antiAffinityScope    string
+	volumeSelector       string
+	volumeListCluster    string
+	volumeListNamePrefix string
+	volumeListMinSize    int
+	volumeListMaxSize    int
+	volumeListDurability string
 )
 
 func init() {
@@ -52,6 +65,8 @@ func init() {
 	volumeBlockHostingRestrictionCommand.AddCommand(volumeBlockHostingRestrictionUnlockCommand)
 	volumeBlockHostingRestrictionCommand.AddCommand(volumeBlockHostingRestrictionLockCommand)
 	volumeCommand.AddCommand(volumeEndpointCommand)
+	volumeCommand.AddCommand(volumeSetTagsCommand)
+	volumeCommand.AddCommand(volumeRmTagsCommand)
 	volumeEndpointCommand.AddCommand(volumeEndpointPatchCommand)
 
 	volumeCreateCommand.Flags().IntVar(&size, "size", 0,
@@ -71,6 +86,10 @@ func init() {
 		"\n\tOptional: Dispersion value for durability type 'disperse'.")
 	volumeCreateCommand.Flags().IntVar(&redundancy, "redundancy", 2,
 		"\n\tOptional: Redundancy value for durability type 'disperse'.")
+	volumeCreateCommand.Flags().BoolVar(&disperseAuto, "disperse-auto", false,
+		"\n\tOptional: Let the server choose the geometry of a volume of"+
+			"\n\tdurability type 'disperse' from the nodes and zones of the"+
+			"\n\tcluster. The redundancy, if given, is the minimum redundancy.")
 	volumeCreateCommand.Flags().Float64Var(&snapshotFactor, "snapshot-factor", 1.0,
 		"\n\tOptional: Amount of storage to allocate for snapshot support."+
 			"\n\tMust be greater 1.0.  For example if a 10TiB volume requires 5TiB of"+
@@ -100,6 +119,41 @@ func init() {
 	volumeCreateCommand.Flags().BoolVar(&block, "block", false,
 		"\n\tOptional: Create a block-hosting volume. Intended to host"+
 			"\n\tloopback files to be exported as block devices.")
+	volumeCreateCommand.Flags().StringVar(&volumeTags, "tags", "",
+		"\n\tOptional: Comma separated list of tag:value pairs set on the volume,"+
+			"\n\tsuch as the namespace and claim owning it.")
+	volumeCreateCommand.Flags().StringVar(&volumeProfile, "profile", "",
+		"\n\tOptional: Name of the placement profile of the volume. The"+
+			"\n\tdurability of the profile is used unless --durability is"+
+			"\n\tgiven.")
+	volumeCreateCommand.Flags().StringVar(&antiAffinityVolumes, "anti-affinity-volumes", "",
+		"\n\tOptional: Comma separated list of ids of the volumes the bricks"+
+			"\n\tof the volume must not share nodes (or devices) with.")
+	volumeCreateCommand.Flags().StringVar(&antiAffinitySelector, "anti-affinity-selector", "",
+		"\n\tOptional: Keep the bricks of the volume apart from the volumes"+
+			"\n\twhose tags match the selector, such as 'app=db'.")
+	volumeCreateCommand.Flags().StringVar(&antiAffinityScope, "anti-affinity-scope", "",
+		"\n\tOptional: Scope of the anti-affinity of the volume: node"+
+			"\n\t(default) or device.")
+	volumeListCommand.Flags().StringVar(&volumeSelector, "selector", "",
+		"\n\tOptional: Only list the volumes whose tags match the selector."+
+			"\n\tComma separated list of requirements: tag=value, tag!=value,"+
+			"\n\ttag (tag is set) and !tag (tag is not set).")
+	volumeListCommand.Flags().StringVar(&volumeListCluster, "cluster", "",
+		"\n\tOptional: Only list the volumes of this cluster.")
+	volumeListCommand.Flags().StringVar(&volumeListNamePrefix, "name-prefix", "",
+		"\n\tOptional: Only list the volumes whose name starts with this prefix.")
+	volumeListCommand.Flags().IntVar(&volumeListMinSize, "min-size", 0,
+		"\n\tOptional: Only list the volumes of at least this size in GiB.")
+	volumeListCommand.Flags().IntVar(&volumeListMaxSize, "max-size", 0,
+		"\n\tOptional: Only list the volumes of at most this size in GiB.")
+	volumeListCommand.Flags().StringVar(&volumeListDurability, "durability", "",
+		"\n\tOptional: Only list the volumes of this durability type:"+
+			"\n\tnone, replicate or disperse.")
+	volumeSetTagsCommand.Flags().BoolP("exact", "e", false,
+		"Set the object to this exact set of tags. Overwrites existing tags.")
+	volumeRmTagsCommand.Flags().Bool("all", false,
+		"Remove all tags.")
 	volumeCreateCommand.SilenceUsage = true
 	volumeDeleteCommand.SilenceUsage = true
 	volumeExpandCommand.SilenceUsage = true
@@ -108,6 +162,8 @@ func init() {
 	volumeBlockHostingRestrictionCommand.SilenceUsage = true
 	volumeEndpointCommand.SilenceUsage = true
 	volumeEndpointPatchCommand.SilenceUsage = true
+	volumeSetTagsCommand.SilenceUsage = true
+	volumeRmTagsCommand.SilenceUsage = true
 
 	volumeCommand.AddCommand(volumeCloneCommand)
 	volumeCloneCommand.Flags().StringVar(&volname, "name", "",
@@ -145,8 +201,21 @@ var volumeCreateCommand = &cobra.Command{
       $ heketi-cli volume create --size=100 --durability=disperse --snapshot-factor=1.25 \
         --disperse-data=8 --redundancy=3
 
+  * Create a 100GiB erasure coded volume with a redundancy of at least 2
+    on the geometry that best fits the cluster:
+      $ heketi-cli volume create --size=100 --durability=disperse \
+        --disperse-auto --redundancy=2
+
   * Create a 100GiB distributed volume which supports performance related volume options.
       $ heketi-cli volume create --size=100 --durability=none --gluster-volume-options="performance.rda-cache-limit 10MB","performance.nl-cache-positive-entry no"
+
+  * Create a 100GiB replica 3 volume tagged with the claim it was created for:
+      $ heketi-cli volume create --size=100 --tags=namespace:ns1,pvc:claim1
+
+  * Create a 100GiB replica 3 volume on other nodes than the volumes
+    tagged app=db:
+      $ heketi-cli volume create --size=100 --tags=app:db \
+        --anti-affinity-selector=app=db
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check volume size
@@ -167,7 +236,18 @@ var volumeCreateCommand = &cobra.Command{
 		req.Durability.Replicate.Replica = replica
 		req.Durability.Disperse.Data = disperseData
 		req.Durability.Disperse.Redundancy = redundancy
+		if disperseAuto {
+			req.Durability.Disperse.Auto = true
+			req.Durability.Disperse.Data = 0
+			if !cmd.Flags().Changed("redundancy") {
+				req.Durability.Disperse.Redundancy = 0
+			}
+		}
 		req.Block = block
+		req.Profile = volumeProfile
+		if volumeProfile != "" && !cmd.Flags().Changed("durability") {
+			req.Durability = api.VolumeDurabilityInfo{}
+		}
 
 		// Check clusters
 		if clusters != "" {
@@ -188,6 +268,27 @@ var volumeCreateCommand = &cobra.Command{
 			req.Name = volname
 		}
 
+		// Set tags if specified
+		if volumeTags != "" {
+			tags, err := parseTags(strings.Split(volumeTags, ","))
+			if err != nil {
+				return err
+			}
+			req.Tags = tags
+		}
+
+		if antiAffinityVolumes != "" || antiAffinitySelector != "" {
+			req.AntiAffinity = &api.VolumeAntiAffinity{
+				Selector: antiAffinitySelector,
+				Scope:    antiAffinityScope,
+			}
+			if antiAffinityVolumes != "" {
+				req.AntiAffinity.Volumes = strings.Split(antiAffinityVolumes, ",")
+			}
+		} else if antiAffinityScope != "" {
+			return errors.New("--anti-affinity-scope requires anti-affinity volumes or a selector")
+		}
+
 		if snapshotFactor > 1.0 {
 			req.Snapshot.Factor = float32(snapshotFactor)
 			req.Snapshot.Enable = true
@@ -492,10 +593,34 @@ Replica Count: {{.Durability.Replicate.Replica}}
 {{- else if eq .Durability.Type "disperse" }}
 Disperse Data Count: {{.Durability.Disperse.Data}}
 Disperse Redundancy Count: {{.Durability.Disperse.Redundancy}}
+{{- if .Durability.Disperse.Auto }}
+Disperse Geometry: auto
+{{- end}}
 {{- end}}
 {{- if .Snapshot.Enable }}
 Snapshot Factor: {{.Snapshot.Factor | printf "%.2f"}}
-{{end}}
+{{- end}}
+{{- if .Profile }}
+Placement Profile: {{.Profile}}
+{{- end}}
+{{- with .AntiAffinity }}
+{{- if .Volumes }}
+Anti-Affinity Volumes: {{ join .Volumes "," }}
+{{- end}}
+{{- if .Selector }}
+Anti-Affinity Selector: {{.Selector}}
+{{- end}}
+{{- if .Scope }}
+Anti-Affinity Scope: {{.Scope}}
+{{- end}}
+{{- end}}
+{{- if .Tags }}
+Tags:
+{{- range $k, $v := .Tags }}
+  {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+
 `
 
 func printVolumeInfo(volume *api.VolumeInfoResponse) {
@@ -512,6 +637,7 @@ func printVolumeInfo(volume *api.VolumeInfoResponse) {
 				return 0
 			}
 		},
+		"join": strings.Join,
 	}
 	t, err := template.New("volume").Funcs(fm).Parse(volumeTemplate)
 	if err != nil {
@@ -524,10 +650,18 @@ func printVolumeInfo(volume *api.VolumeInfoResponse) {
 }
 
 var volumeListCommand = &cobra.Command{
-	Use:     "list",
-	Short:   "Lists the volumes managed by Heketi",
-	Long:    "Lists the volumes managed by Heketi",
-	Example: "  $ heketi-cli volume list",
+	Use:   "list",
+	Short: "Lists the volumes managed by Heketi",
+	Long:  "Lists the volumes managed by Heketi",
+	Example: `  $ heketi-cli volume list
+
+  * List the volumes created for claims in namespace ns1:
+      $ heketi-cli volume list --selector=namespace=ns1,pvc
+
+  * List the replicated volumes of at least 100GiB of a cluster:
+      $ heketi-cli volume list --cluster=0995098e1284ddccb46c7752d142c832 \
+        --durability=replicate --min-size=100
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create a client
 		heketi, err := newHeketiClient()
@@ -535,41 +669,73 @@ var volumeListCommand = &cobra.Command{
 			return err
 		}
 
-		// List volumes
-		list, err := heketi.VolumeList()
-		if err != nil {
-			return err
+		// List volumes a page at a time, along with their information
+		q := &api.ListQuery{
+			Cluster:    volumeListCluster,
+			NamePrefix: volumeListNamePrefix,
+			MinSize:    volumeListMinSize,
+			MaxSize:    volumeListMaxSize,
+			Durability: api.DurabilityType(volumeListDurability),
+			Selector:   volumeSelector,
+			Limit:      listPageSize,
+			Detail:     !options.Json,
+		}
+		all := &api.VolumeListResponse{Volumes: []string{}}
+		for {
+			list, err := heketi.VolumeListWithQuery(q)
+			if err != nil {
+				return err
+			}
+			if options.Json {
+				all.Volumes = append(all.Volumes, list.Volumes...)
+			} else if err := printVolumeList(heketi, list); err != nil {
+				return err
+			}
+			if list.Next == "" {
+				break
+			}
+			q.Cursor = list.Next
 		}
 
 		if options.Json {
-			data, err := json.Marshal(list)
+			data, err := json.Marshal(all)
 			if err != nil {
 				return err
 			}
 			fmt.Fprintf(stdout, string(data))
-		} else {
-			for _, id := range list.Volumes {
-				volume, err := heketi.VolumeInfo(id)
-				if err != nil {
-					return err
-				}
-
-				blockstr := ""
-				if volume.Block {
-					blockstr = " [block]"
-				}
-				fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v%v\n",
-					id,
-					volume.Cluster,
-					volume.Name,
-					blockstr)
-			}
 		}
 
 		return nil
 	},
 }
 
+func printVolumeList(heketi *client.Client, list *api.VolumeListResponse) error {
+	for i, id := range list.Volumes {
+		// servers not supporting details only return ids
+		var volume *api.VolumeInfoResponse
+		if i < len(list.Details) {
+			volume = &list.Details[i]
+		} else {
+			var err error
+			volume, err = heketi.VolumeInfo(id)
+			if err != nil {
+				return err
+			}
+		}
+
+		blockstr := ""
+		if volume.Block {
+			blockstr = " [block]"
+		}
+		fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v%v\n",
+			id,
+			volume.Cluster,
+			volume.Name,
+			blockstr)
+	}
+	return nil
+}
+
 var volumeCloneCommand = &cobra.Command{
 	Use:     "clone",
 	Short:   "Creates a clone",
@@ -657,3 +823,34 @@ var volumeEndpointPatchCommand = &cobra.Command{
 		return err
 	},
 }
+
+var volumeSetTagsCommand = &cobra.Command{
+	Use:     "settags [volume_id] tag1:value1 tag2:value2...",
+	Short:   "Sets tags on a volume",
+	Long:    "Sets user-controlled metadata tags on a volume",
+	Example: "  $ heketi-cli volume settags 886a86a868711bef83001 pvc:claim1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		return setTagsCommand(cmd, heketi.VolumeSetTags)
+	},
+}
+
+var volumeRmTagsCommand = &cobra.Command{
+	Use:     "rmtags [volume_id] tag1:value1 tag2:value2...",
+	Aliases: []string{"deltags", "removetags"},
+	Short:   "Removes tags from a volume",
+	Long:    "Removes user-controlled metadata tags on a volume",
+	Example: "  $ heketi-cli volume rmtags 886a86a868711bef83001 pvc",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		heketi, err := newHeketiClient()
+		if err != nil {
+			return err
+		}
+		return rmTagsCommand(cmd, heketi.VolumeSetTags)
+	},
+}
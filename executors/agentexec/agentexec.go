@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/executors/cmdexec"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+const (
+	DefaultPort = "8443"
+)
+
+// AgentExecutor is a command based executor that sends batches of
+// commands to the heketi node agent running on each node, over
+// mutually authenticated TLS. It needs neither sshd on the nodes
+// nor access to the Kubernetes API server.
+type AgentExecutor struct {
+	cmdexec.CmdExecutor
+
+	config *AgentConfig
+	client *http.Client
+	scheme string
+	port   string
+}
+
+func setWithEnvVariables(config *AgentConfig) {
+	var env string
+
+	env = os.Getenv("HEKETI_NODE_AGENT_PORT")
+	if "" != env {
+		config.Port = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_CERT_FILE")
+	if "" != env {
+		config.CertFile = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_KEY_FILE")
+	if "" != env {
+		config.KeyFile = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_CA_FILE")
+	if "" != env {
+		config.CAFile = env
+	}
+
+	env = os.Getenv("HEKETI_FSTAB")
+	if "" != env {
+		config.Fstab = env
+	}
+
+	env = os.Getenv("HEKETI_MOUNT_OPTS")
+	if "" != env {
+		config.MountOpts = env
+	}
+
+	env = os.Getenv("HEKETI_SNAPSHOT_LIMIT")
+	if "" != env {
+		i, err := strconv.Atoi(env)
+		if err == nil {
+			config.SnapShotLimit = i
+		}
+	}
+}
+
+func NewAgentExecutor(config *AgentConfig) (*AgentExecutor, error) {
+	// Override configuration
+	setWithEnvVariables(config)
+
+	tlsConfig, err := nodeagent.ClientTLSConfig(config.TLSFiles)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid node agent TLS configuration: %v", err)
+	}
+
+	a := &AgentExecutor{}
+	a.CmdExecutor.Init(&config.CmdConfig)
+	a.RemoteExecutor = a
+
+	if config.Port == "" {
+		a.port = DefaultPort
+	} else {
+		a.port = config.Port
+	}
+
+	if config.Fstab == "" {
+		a.Fstab = "/etc/fstab"
+	} else {
+		a.Fstab = config.Fstab
+	}
+
+	if config.MountOpts == "" {
+		a.MountOpts = cmdexec.DefaultMountOpts
+	} else {
+		a.MountOpts = config.MountOpts
+	}
+
+	a.BackupLVM = config.BackupLVM
+	a.config = config
+	a.scheme = "https"
+	a.client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	godbc.Ensure(a.config == config)
+	godbc.Ensure(a.port != "")
+	godbc.Ensure(a.Fstab != "")
+	godbc.Ensure(a.MountOpts != "")
+
+	return a, nil
+}
+
+func (a *AgentExecutor) ExecCommands(
+	host string, commands rex.Cmds, timeoutMinutes int) (rex.Results, error) {
+
+	// Throttle
+	a.AccessConnection(host)
+	defer a.FreeConnection(host)
+
+	body, err := json.Marshal(nodeagent.NewExecRequest(commands, timeoutMinutes))
+	if err != nil {
+		return nil, err
+	}
+
+	// each command gets its own timeout on the agent, allow for all
+	// of them plus some slack for the transport itself
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Minute*time.Duration(timeoutMinutes*len(commands)+1))
+	defer cancel()
+
+	url := fmt.Sprintf("%v://%v%v",
+		a.scheme, net.JoinHostPort(host, a.port), nodeagent.ExecRoute)
+	req, err := http.NewRequestWithContext(
+		ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := a.client.Do(req)
+	if err != nil {
+		a.Logger().LogError("Failed to reach node agent on [%v]: %v", host, err)
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	var resp nodeagent.ExecResponse
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Invalid response from node agent on %v: %v",
+			host, err)
+	}
+	return resp.ToResults()
+}
+
+func (a *AgentExecutor) RebalanceOnExpansion() bool {
+	return a.config.RebalanceOnExpansion
+}
+
+func (a *AgentExecutor) SnapShotLimit() int {
+	return a.config.SnapShotLimit
+}
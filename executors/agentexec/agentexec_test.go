@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/executors/cmdexec"
+	"github.com/heketi/heketi/v10/executors/localexec"
+	"github.com/heketi/heketi/v10/executors/mockexec"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+)
+
+// newTestExecutor returns an agent executor talking plain http to
+// an agent that runs commands locally, and the agent's host.
+func newTestExecutor(t *testing.T) (*AgentExecutor, string, func()) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	l, err := localexec.NewLocalExecutor(&localexec.LocalConfig{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	agent := nodeagent.NewServer(m)
+	agent.SetCommandRunner(l)
+	router := mux.NewRouter()
+	agent.SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	u, err := url.Parse(ts.URL)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	host, port, err := net.SplitHostPort(u.Host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	config := &AgentConfig{}
+	a := &AgentExecutor{
+		config: config,
+		client: &http.Client{},
+		scheme: "http",
+		port:   port,
+	}
+	a.CmdExecutor.Init(&config.CmdConfig)
+	a.RemoteExecutor = a
+	a.Fstab = "/etc/fstab"
+	a.MountOpts = cmdexec.DefaultMountOpts
+	return a, host, ts.Close
+}
+
+func TestNewAgentExecutorMissingTLS(t *testing.T) {
+	_, err := NewAgentExecutor(&AgentConfig{})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestAgentExecutorExecCommands(t *testing.T) {
+	a, host, done := newTestExecutor(t)
+	defer done()
+
+	results, err := a.ExecCommands(host, rex.Cmds{
+		rex.ToCmd("echo hello"),
+		rex.ToCmd("echo oops >&2; exit 3"),
+		rex.ToCmd("echo never"),
+	}, 1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(results) == 3, "expected len(results) == 3, got:", len(results))
+	tests.Assert(t, results[0].Ok(), "expected results[0].Ok()")
+	tests.Assert(t, results[0].Output == "hello\n",
+		"expected results[0].Output == hello, got:", results[0].Output)
+	tests.Assert(t, !results[1].Ok(), "expected !results[1].Ok()")
+	tests.Assert(t, results[1].ExitStatus == 3,
+		"expected results[1].ExitStatus == 3, got:", results[1].ExitStatus)
+	tests.Assert(t, strings.TrimSpace(results[1].Error()) == "oops",
+		"expected results[1].Error() == oops, got:", results[1].Error())
+	tests.Assert(t, !results[2].Completed, "expected !results[2].Completed")
+}
+
+func TestAgentExecutorBadRequest(t *testing.T) {
+	a, host, done := newTestExecutor(t)
+	defer done()
+
+	_, err := a.ExecCommands(host, rex.Cmds{}, 1)
+	tests.Assert(t, err != nil, "expected err != nil")
+}
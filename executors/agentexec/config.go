@@ -0,0 +1,22 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package agentexec
+
+import (
+	"github.com/heketi/heketi/v10/executors/cmdexec"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+)
+
+type AgentConfig struct {
+	cmdexec.CmdConfig
+	nodeagent.TLSFiles
+
+	Port string `json:"port"`
+}
@@ -69,6 +69,11 @@ func NewInjectExecutor(
 	return ie
 }
 
+// RealExecutor returns the executor wrapped by the inject executor.
+func (ie *InjectExecutor) RealExecutor() executors.Executor {
+	return ie.realExecutor
+}
+
 // Wrap takes a command transport and returns a wrapped transport that
 // runs the commands passing through the transport through the
 // hooks.
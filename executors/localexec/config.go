@@ -0,0 +1,18 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package localexec
+
+import (
+	"github.com/heketi/heketi/v10/executors/cmdexec"
+)
+
+type LocalConfig struct {
+	cmdexec.CmdConfig
+}
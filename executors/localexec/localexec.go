@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package localexec
+
+import (
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/v10/executors/cmdexec"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/local"
+)
+
+// LocalExecutor is a command based executor that runs all commands
+// on the system it is running on, ignoring the host it is given.
+// It is meant to be run by the node agent on a storage node.
+type LocalExecutor struct {
+	cmdexec.CmdExecutor
+
+	config *LocalConfig
+	exec   *local.LocalExec
+}
+
+func NewLocalExecutor(config *LocalConfig) (*LocalExecutor, error) {
+	l := &LocalExecutor{}
+	l.CmdExecutor.Init(&config.CmdConfig)
+	l.RemoteExecutor = l
+
+	if config.Fstab == "" {
+		l.Fstab = "/etc/fstab"
+	} else {
+		l.Fstab = config.Fstab
+	}
+
+	if config.MountOpts == "" {
+		l.MountOpts = cmdexec.DefaultMountOpts
+	} else {
+		l.MountOpts = config.MountOpts
+	}
+
+	l.BackupLVM = config.BackupLVM
+	l.config = config
+	l.exec = local.NewLocalExec(l.Logger())
+
+	godbc.Ensure(l.Fstab != "")
+	godbc.Ensure(l.MountOpts != "")
+
+	return l, nil
+}
+
+func (l *LocalExecutor) ExecCommands(
+	host string, commands rex.Cmds, timeoutMinutes int) (rex.Results, error) {
+
+	// Throttle
+	l.AccessConnection(host)
+	defer l.FreeConnection(host)
+
+	return l.exec.ExecCommands(commands, timeoutMinutes, l.config.Sudo)
+}
+
+func (l *LocalExecutor) RebalanceOnExpansion() bool {
+	return l.config.RebalanceOnExpansion
+}
+
+func (l *LocalExecutor) SnapShotLimit() int {
+	return l.config.SnapShotLimit
+}
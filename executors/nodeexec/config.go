@@ -0,0 +1,22 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeexec
+
+import (
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+)
+
+type NodeConfig struct {
+	nodeagent.TLSFiles
+
+	Port string `json:"port"`
+	// timeout, in minutes, for a single operation on a node agent
+	TimeoutMinutes int `json:"timeout_minutes"`
+}
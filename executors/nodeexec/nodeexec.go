@@ -0,0 +1,442 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/logging"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+	"github.com/heketi/heketi/v10/pkg/utils"
+)
+
+const (
+	DefaultPort           = "8443"
+	DefaultTimeoutMinutes = 10
+)
+
+var (
+	logger = logging.NewLogger("[nodeexec]", logging.LEVEL_DEBUG)
+)
+
+// NodeExecutor sends typed operation requests to a heketi node
+// agent running on each node, over mutually authenticated TLS.
+// Unlike the command based executors it never sends shell
+// commands to the nodes.
+type NodeExecutor struct {
+	config *NodeConfig
+	client *http.Client
+	scheme string
+	port   string
+}
+
+func setWithEnvVariables(config *NodeConfig) {
+	var env string
+
+	env = os.Getenv("HEKETI_NODE_AGENT_PORT")
+	if "" != env {
+		config.Port = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_CERT_FILE")
+	if "" != env {
+		config.CertFile = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_KEY_FILE")
+	if "" != env {
+		config.KeyFile = env
+	}
+
+	env = os.Getenv("HEKETI_NODE_AGENT_CA_FILE")
+	if "" != env {
+		config.CAFile = env
+	}
+}
+
+func NewNodeExecutor(config *NodeConfig) (*NodeExecutor, error) {
+	setWithEnvVariables(config)
+
+	tlsConfig, err := nodeagent.ClientTLSConfig(config.TLSFiles)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid node agent TLS configuration: %v", err)
+	}
+
+	n := &NodeExecutor{
+		config: config,
+		scheme: "https",
+		port:   config.Port,
+	}
+	if n.port == "" {
+		n.port = DefaultPort
+	}
+	timeout := config.TimeoutMinutes
+	if timeout <= 0 {
+		timeout = DefaultTimeoutMinutes
+	}
+	n.client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		Timeout:   time.Minute * time.Duration(timeout),
+	}
+	return n, nil
+}
+
+// call sends the request for the named operation to the agent on
+// host and decodes the result into out, if out is not nil.
+func (n *NodeExecutor) call(host, op string, req, out interface{}) error {
+	if req == nil {
+		req = nodeagent.NoArgs{}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%v://%v%v%v",
+		n.scheme, net.JoinHostPort(host, n.port), nodeagent.OpsRoute, op)
+	logger.Debug("Will run operation [%v] on [%v]", op, host)
+	r, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.LogError("Failed to reach node agent on [%v]: %v", host, err)
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	var resp nodeagent.Response
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return fmt.Errorf("Invalid response from node agent on %v: %v",
+			host, err)
+	}
+	if resp.Error != nil {
+		err := resp.Error.Err()
+		logger.LogError("Failed to run operation [%v] on [%v]: %v",
+			op, host, err)
+		return err
+	}
+	if out != nil && len(resp.Result) != 0 {
+		return json.Unmarshal(resp.Result, out)
+	}
+	return nil
+}
+
+func (n *NodeExecutor) GlusterdCheck(host string) error {
+	return n.call(host, nodeagent.OpGlusterdCheck, nil, nil)
+}
+
+func (n *NodeExecutor) PeerProbe(host, newnode string) error {
+	return n.call(host, nodeagent.OpPeerProbe,
+		nodeagent.NameRequest{Name: newnode}, nil)
+}
+
+func (n *NodeExecutor) PeerDetach(host, detachnode string) error {
+	return n.call(host, nodeagent.OpPeerDetach,
+		nodeagent.NameRequest{Name: detachnode}, nil)
+}
+
+func (n *NodeExecutor) DeviceSetup(host, device, vgid string,
+	destroy bool) (*executors.DeviceInfo, error) {
+
+	var info executors.DeviceInfo
+	err := n.call(host, nodeagent.OpDeviceSetup,
+		nodeagent.DeviceSetupRequest{Device: device, VgId: vgid, Destroy: destroy},
+		&info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (n *NodeExecutor) GetDeviceInfo(host string,
+	dh *executors.DeviceVgHandle) (*executors.DeviceInfo, error) {
+
+	var info executors.DeviceInfo
+	err := n.call(host, nodeagent.OpGetDeviceInfo,
+		nodeagent.DeviceRequest{Handle: dh}, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (n *NodeExecutor) DeviceTeardown(host string,
+	dh *executors.DeviceVgHandle) error {
+
+	return n.call(host, nodeagent.OpDeviceTeardown,
+		nodeagent.DeviceRequest{Handle: dh}, nil)
+}
+
+func (n *NodeExecutor) DeviceForget(host string,
+	dh *executors.DeviceVgHandle) error {
+
+	return n.call(host, nodeagent.OpDeviceForget,
+		nodeagent.DeviceRequest{Handle: dh}, nil)
+}
+
+func (n *NodeExecutor) BrickCreate(host string,
+	brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+
+	var info executors.BrickInfo
+	if err := n.call(host, nodeagent.OpBrickCreate, brick, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (n *NodeExecutor) BrickDestroy(host string,
+	brick *executors.BrickRequest) (bool, error) {
+
+	var spaceReclaimed bool
+	err := n.call(host, nodeagent.OpBrickDestroy, brick, &spaceReclaimed)
+	return spaceReclaimed, err
+}
+
+func (n *NodeExecutor) VolumeCreate(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	var v executors.Volume
+	if err := n.call(host, nodeagent.OpVolumeCreate, volume, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) VolumeDestroy(host string, volume string) error {
+	return n.call(host, nodeagent.OpVolumeDestroy,
+		nodeagent.NameRequest{Name: volume}, nil)
+}
+
+func (n *NodeExecutor) VolumeDestroyCheck(host, volume string) error {
+	return n.call(host, nodeagent.OpVolumeDestroyCheck,
+		nodeagent.NameRequest{Name: volume}, nil)
+}
+
+func (n *NodeExecutor) VolumeExpand(host string,
+	volume *executors.VolumeRequest) (*executors.Volume, error) {
+
+	var v executors.Volume
+	if err := n.call(host, nodeagent.OpVolumeExpand, volume, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	return n.call(host, nodeagent.OpVolumeReplaceBrick,
+		nodeagent.ReplaceBrickRequest{
+			Volume:   volume,
+			OldBrick: oldBrick,
+			NewBrick: newBrick,
+		}, nil)
+}
+
+func (n *NodeExecutor) VolumeInfo(host string,
+	volume string) (*executors.Volume, error) {
+
+	var v executors.Volume
+	err := n.call(host, nodeagent.OpVolumeInfo,
+		nodeagent.NameRequest{Name: volume}, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) VolumesInfo(host string) (*executors.VolInfo, error) {
+	var v executors.VolInfo
+	if err := n.call(host, nodeagent.OpVolumesInfo, nil, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) VolumeClone(host string,
+	vcr *executors.VolumeCloneRequest) (*executors.Volume, error) {
+
+	var v executors.Volume
+	if err := n.call(host, nodeagent.OpVolumeClone, vcr, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) VolumeSnapshot(host string,
+	vsr *executors.VolumeSnapshotRequest) (*executors.Snapshot, error) {
+
+	var s executors.Snapshot
+	if err := n.call(host, nodeagent.OpVolumeSnapshot, vsr, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (n *NodeExecutor) VolumeModify(host string,
+	mod *executors.VolumeModifyRequest) error {
+
+	return n.call(host, nodeagent.OpVolumeModify, mod, nil)
+}
+
+func (n *NodeExecutor) SnapshotCloneVolume(host string,
+	scr *executors.SnapshotCloneRequest) (*executors.Volume, error) {
+
+	var v executors.Volume
+	if err := n.call(host, nodeagent.OpSnapshotCloneVolume, scr, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (n *NodeExecutor) SnapshotCloneBlockVolume(host string,
+	scr *executors.SnapshotCloneRequest) (*executors.BlockVolumeInfo, error) {
+
+	var bv executors.BlockVolumeInfo
+	err := n.call(host, nodeagent.OpSnapshotCloneBlockVolume, scr, &bv)
+	if err != nil {
+		return nil, err
+	}
+	return &bv, nil
+}
+
+func (n *NodeExecutor) SnapshotDestroy(host string, snapshot string) error {
+	return n.call(host, nodeagent.OpSnapshotDestroy,
+		nodeagent.NameRequest{Name: snapshot}, nil)
+}
+
+func (n *NodeExecutor) HealInfo(host string,
+	volume string) (*executors.HealInfo, error) {
+
+	var h executors.HealInfo
+	err := n.call(host, nodeagent.OpHealInfo,
+		nodeagent.NameRequest{Name: volume}, &h)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (n *NodeExecutor) SetLogLevel(level string) {
+	switch level {
+	case "none":
+		logger.SetLevel(logging.LEVEL_NOLOG)
+	case "critical":
+		logger.SetLevel(logging.LEVEL_CRITICAL)
+	case "error":
+		logger.SetLevel(logging.LEVEL_ERROR)
+	case "warning":
+		logger.SetLevel(logging.LEVEL_WARNING)
+	case "info":
+		logger.SetLevel(logging.LEVEL_INFO)
+	case "debug":
+		logger.SetLevel(logging.LEVEL_DEBUG)
+	}
+}
+
+func (n *NodeExecutor) BlockVolumeCreate(host string,
+	bvr *executors.BlockVolumeRequest) (*executors.BlockVolumeInfo, error) {
+
+	var bv executors.BlockVolumeInfo
+	if err := n.call(host, nodeagent.OpBlockVolumeCreate, bvr, &bv); err != nil {
+		return nil, err
+	}
+	return &bv, nil
+}
+
+func (n *NodeExecutor) BlockVolumeDestroy(host string,
+	blockHostingVolumeName string, blockVolumeName string) error {
+
+	return n.call(host, nodeagent.OpBlockVolumeDestroy,
+		nodeagent.BlockRequest{
+			HostingVolume: blockHostingVolumeName,
+			Name:          blockVolumeName,
+		}, nil)
+}
+
+func (n *NodeExecutor) BlockVolumeExpand(host string,
+	blockHostingVolumeName string, blockVolumeName string, newSize int) error {
+
+	return n.call(host, nodeagent.OpBlockVolumeExpand,
+		nodeagent.BlockRequest{
+			HostingVolume: blockHostingVolumeName,
+			Name:          blockVolumeName,
+			Size:          newSize,
+		}, nil)
+}
+
+func (n *NodeExecutor) BlockVolumeInfo(host string,
+	blockhostingvolume string,
+	blockVolumeName string) (*executors.BlockVolumeInfo, error) {
+
+	var bv executors.BlockVolumeInfo
+	err := n.call(host, nodeagent.OpBlockVolumeInfo,
+		nodeagent.BlockRequest{
+			HostingVolume: blockhostingvolume,
+			Name:          blockVolumeName,
+		}, &bv)
+	if err != nil {
+		return nil, err
+	}
+	return &bv, nil
+}
+
+func (n *NodeExecutor) PVS(host string) (*executors.PVSCommandOutput, error) {
+	var out executors.PVSCommandOutput
+	if err := n.call(host, nodeagent.OpPVS, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (n *NodeExecutor) VGS(host string) (*executors.VGSCommandOutput, error) {
+	var out executors.VGSCommandOutput
+	if err := n.call(host, nodeagent.OpVGS, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (n *NodeExecutor) LVS(host string) (*executors.LVSCommandOutput, error) {
+	var out executors.LVSCommandOutput
+	if err := n.call(host, nodeagent.OpLVS, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (n *NodeExecutor) GetBrickMountStatus(
+	host string) (*executors.BricksMountStatus, error) {
+
+	var out executors.BricksMountStatus
+	if err := n.call(host, nodeagent.OpGetBrickMountStatus, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (n *NodeExecutor) ListBlockVolumes(host string,
+	blockhostingvolume string) ([]string, error) {
+
+	var out []string
+	err := n.call(host, nodeagent.OpListBlockVolumes,
+		nodeagent.BlockRequest{HostingVolume: blockhostingvolume}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeexec
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/executors/mockexec"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+)
+
+// newTestExecutor returns a node executor talking plain http to
+// an agent backed by the mock executor, and the agent's host.
+func newTestExecutor(t *testing.T) (*NodeExecutor, *mockexec.MockExecutor, string, func()) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	router := mux.NewRouter()
+	nodeagent.NewServer(m).SetRoutes(router)
+	ts := httptest.NewServer(router)
+
+	u, err := url.Parse(ts.URL)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	host, port, err := net.SplitHostPort(u.Host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	n := &NodeExecutor{
+		config: &NodeConfig{},
+		client: &http.Client{},
+		scheme: "http",
+		port:   port,
+	}
+	return n, m, host, ts.Close
+}
+
+func TestNodeExecutorMissingTLS(t *testing.T) {
+	_, err := NewNodeExecutor(&NodeConfig{})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestNodeExecutorDeviceSetup(t *testing.T) {
+	n, m, host, done := newTestExecutor(t)
+	defer done()
+
+	m.MockDeviceSetup = func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
+		tests.Assert(t, device == "/dev/sdb", "expected device == /dev/sdb, got:", device)
+		tests.Assert(t, vgid == "abc", "expected vgid == abc, got:", vgid)
+		tests.Assert(t, destroy, "expected destroy")
+		return &executors.DeviceInfo{
+			TotalSize:  1000,
+			FreeSize:   1000,
+			ExtentSize: 4096,
+			Meta:       &executors.DeviceHandle{UUID: "pv1"},
+		}, nil
+	}
+
+	info, err := n.DeviceSetup(host, "/dev/sdb", "abc", true)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.TotalSize == 1000, "expected info.TotalSize == 1000, got:", info.TotalSize)
+	tests.Assert(t, info.Meta != nil && info.Meta.UUID == "pv1",
+		"expected info.Meta.UUID == pv1, got:", info.Meta)
+}
+
+func TestNodeExecutorBrickOps(t *testing.T) {
+	n, m, host, done := newTestExecutor(t)
+	defer done()
+
+	m.MockBrickDestroy = func(host string, brick *executors.BrickRequest) (bool, error) {
+		tests.Assert(t, brick.Name == "b1", "expected brick.Name == b1, got:", brick.Name)
+		return true, nil
+	}
+
+	bi, err := n.BrickCreate(host, &executors.BrickRequest{Name: "b1", Size: 10})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, bi.Path == "/mockpath", "expected bi.Path == /mockpath, got:", bi.Path)
+
+	reclaimed, err := n.BrickDestroy(host, &executors.BrickRequest{Name: "b1"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, reclaimed, "expected reclaimed")
+}
+
+func TestNodeExecutorErrors(t *testing.T) {
+	n, m, host, done := newTestExecutor(t)
+	defer done()
+
+	m.MockVolumeDestroy = func(host string, volume string) error {
+		return &executors.VolumeDoesNotExistErr{Name: volume}
+	}
+	err := n.VolumeDestroy(host, "vol1")
+	_, ok := err.(*executors.VolumeDoesNotExistErr)
+	tests.Assert(t, ok, "expected VolumeDoesNotExistErr, got:", err)
+
+	m.MockDeviceSetup = func(host, device, vgid string, destroy bool) (*executors.DeviceInfo, error) {
+		return nil, &executors.DeviceNotAvailableErr{
+			OriginalError: errors.New("in use"),
+			Path:          device,
+			ConnectionOk:  true,
+			CurrentMeta:   &executors.DeviceHandle{UUID: "pv2"},
+		}
+	}
+	_, err = n.DeviceSetup(host, "/dev/sdc", "abc", false)
+	dna, ok := err.(*executors.DeviceNotAvailableErr)
+	tests.Assert(t, ok, "expected DeviceNotAvailableErr, got:", err)
+	tests.Assert(t, dna.ConnectionOk, "expected dna.ConnectionOk")
+	tests.Assert(t, dna.CurrentMeta.UUID == "pv2",
+		"expected dna.CurrentMeta.UUID == pv2, got:", dna.CurrentMeta.UUID)
+
+	m.MockPeerProbe = func(exec_host, newnode string) error {
+		return errors.New("peer rejected")
+	}
+	err = n.PeerProbe(host, "node2")
+	tests.Assert(t, err != nil && err.Error() == "peer rejected",
+		"expected err == peer rejected, got:", err)
+}
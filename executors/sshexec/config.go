@@ -19,4 +19,18 @@ type SshConfig struct {
 	PrivateKeyFile string `json:"keyfile"`
 	User           string `json:"user"`
 	Port           string `json:"port"`
+
+	// HostKeyCheck is one of "none", "known_hosts" or "tofu". If
+	// unset host keys are only checked when SSH_KNOWN_HOSTS is set.
+	HostKeyCheck   string `json:"host_key_check"`
+	KnownHostsFile string `json:"known_hosts_file"`
+
+	// connection pooling. Connections to a node are shared between
+	// command batches unless the pool is disabled.
+	DisablePool bool `json:"disable_connection_pool"`
+	// 0 uses the default, a negative value removes the limit
+	MaxSessionsPerHost int64 `json:"max_sessions_per_host"`
+	// in seconds, 0 uses the default, a negative value disables
+	IdleTimeout       int `json:"connection_idle_timeout"`
+	KeepAliveInterval int `json:"keepalive_interval"`
 }
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/lpabon/godbc"
 
@@ -27,6 +28,20 @@ type Ssher interface {
 	ExecCommands(host string, commands rex.Cmds, timeoutMinutes int, useSudo bool) (rex.Results, error)
 }
 
+// Pooler is implemented by Sshers that can keep connections to the
+// hosts open between command batches.
+type Pooler interface {
+	EnablePool(config ssh.PoolConfig)
+	PoolStats() []rex.PoolStats
+	Close()
+}
+
+const (
+	DefaultMaxSessionsPerHost = 10
+	DefaultIdleTimeout        = 300
+	DefaultKeepAliveInterval  = 30
+)
+
 type SshExecutor struct {
 	cmdexec.CmdExecutor
 
@@ -36,15 +51,24 @@ type SshExecutor struct {
 	exec            Ssher
 	config          *SshConfig
 	port            string
+	hostKeys        ssh.HostKeyStore
 }
 
 var (
-	ErrSshPrivateKey = errors.New("Unable to read private key file")
-	sshNew           = func(logger *logging.Logger, user string, file string) (Ssher, error) {
+	ErrSshPrivateKey  = errors.New("Unable to read private key file")
+	ErrNoHostKeyStore = errors.New("No ssh host key store available")
+	sshNew            = func(logger *logging.Logger, user string, file string,
+		hk ssh.HostKeyConfig) (Ssher, error) {
+
+		cb, err := hk.Callback()
+		if err != nil {
+			return nil, err
+		}
 		s := ssh.NewSshExecWithKeyFile(logger, user, file)
 		if s == nil {
 			return nil, ErrSshPrivateKey
 		}
+		s.SetHostKeyCallback(cb)
 		return s, nil
 	}
 )
@@ -67,6 +91,16 @@ func setWithEnvVariables(config *SshConfig) {
 		config.Port = env
 	}
 
+	env = os.Getenv("HEKETI_SSH_HOST_KEY_CHECK")
+	if "" != env {
+		config.HostKeyCheck = env
+	}
+
+	env = os.Getenv("HEKETI_SSH_KNOWN_HOSTS_FILE")
+	if "" != env {
+		config.KnownHostsFile = env
+	}
+
 	env = os.Getenv("HEKETI_FSTAB")
 	if "" != env {
 		config.Fstab = env
@@ -130,14 +164,31 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	// Save the configuration
 	s.config = config
 
-	// Setup key
+	// Setup key and host key verification. The trust-on-first-use
+	// policy pins keys using the store set by SetHostKeyStore.
+	hk := ssh.HostKeyConfig{
+		Check:          config.HostKeyCheck,
+		KnownHostsFile: config.KnownHostsFile,
+		Store:          s,
+	}
+	if err := hk.Validate(); err != nil {
+		return nil, err
+	}
+	if hk.Check == ssh.HostKeyCheckDefault {
+		s.Logger().Warning("No ssh host key check configured, " +
+			"host keys are only verified if SSH_KNOWN_HOSTS is set")
+	}
 	var err error
-	s.exec, err = sshNew(s.Logger(), s.user, s.private_keyfile)
+	s.exec, err = sshNew(s.Logger(), s.user, s.private_keyfile, hk)
 	if err != nil {
 		s.Logger().Err(err)
 		return nil, err
 	}
 
+	if p, ok := s.exec.(Pooler); ok && !config.DisablePool {
+		p.EnablePool(poolConfig(config))
+	}
+
 	godbc.Ensure(s != nil)
 	godbc.Ensure(s.config == config)
 	godbc.Ensure(s.user != "")
@@ -160,6 +211,63 @@ func (s *SshExecutor) ExecCommands(
 	return s.exec.ExecCommands(host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
 }
 
+func poolConfig(config *SshConfig) ssh.PoolConfig {
+	seconds := func(v, def int) time.Duration {
+		if v == 0 {
+			v = def
+		} else if v < 0 {
+			v = 0
+		}
+		return time.Second * time.Duration(v)
+	}
+	pc := ssh.PoolConfig{
+		IdleTimeout:       seconds(config.IdleTimeout, DefaultIdleTimeout),
+		KeepAliveInterval: seconds(config.KeepAliveInterval, DefaultKeepAliveInterval),
+	}
+	if config.MaxSessionsPerHost == 0 {
+		pc.MaxSessionsPerHost = DefaultMaxSessionsPerHost
+	} else if config.MaxSessionsPerHost > 0 {
+		pc.MaxSessionsPerHost = int(config.MaxSessionsPerHost)
+	}
+	return pc
+}
+
+// PoolStats returns the usage of the pooled connections to the
+// nodes. It returns nil if connections are not pooled.
+func (s *SshExecutor) PoolStats() []rex.PoolStats {
+	if p, ok := s.exec.(Pooler); ok {
+		return p.PoolStats()
+	}
+	return nil
+}
+
+// Close closes any pooled connections to the nodes.
+func (s *SshExecutor) Close() {
+	if p, ok := s.exec.(Pooler); ok {
+		p.Close()
+	}
+}
+
+// SetHostKeyStore sets the store of host keys pinned when using
+// the trust-on-first-use host key check.
+func (s *SshExecutor) SetHostKeyStore(store ssh.HostKeyStore) {
+	s.hostKeys = store
+}
+
+func (s *SshExecutor) PinnedHostKey(host string) (string, error) {
+	if s.hostKeys == nil {
+		return "", ErrNoHostKeyStore
+	}
+	return s.hostKeys.PinnedHostKey(host)
+}
+
+func (s *SshExecutor) PinHostKey(host, key string) error {
+	if s.hostKeys == nil {
+		return ErrNoHostKeyStore
+	}
+	return s.hostKeys.PinHostKey(host, key)
+}
+
 func (s *SshExecutor) RebalanceOnExpansion() bool {
 	return s.config.RebalanceOnExpansion
 }
@@ -12,10 +12,12 @@ package sshexec
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/heketi/heketi/v10/executors/cmdexec"
 	"github.com/heketi/heketi/v10/pkg/logging"
 	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+	"github.com/heketi/heketi/v10/pkg/remoteexec/ssh"
 	"github.com/heketi/tests"
 )
 
@@ -52,7 +54,8 @@ func TestNewSshExec(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *logging.Logger, user string, file string) (Ssher, error) {
+		func(logger *logging.Logger, user string, file string,
+			hk ssh.HostKeyConfig) (Ssher, error) {
 			return f, nil
 		}).Restore()
 
@@ -79,7 +82,8 @@ func TestSshExecRebalanceOnExpansion(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *logging.Logger, user string, file string) (Ssher, error) {
+		func(logger *logging.Logger, user string, file string,
+			hk ssh.HostKeyConfig) (Ssher, error) {
 			return f, nil
 		}).Restore()
 
@@ -127,7 +131,8 @@ func TestSshExecRebalanceOnExpansion(t *testing.T) {
 func TestNewSshExecDefaults(t *testing.T) {
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *logging.Logger, user string, file string) (Ssher, error) {
+		func(logger *logging.Logger, user string, file string,
+			hk ssh.HostKeyConfig) (Ssher, error) {
 			return f, nil
 		}).Restore()
 
@@ -158,7 +163,8 @@ func TestSshExecutorEnvVariables(t *testing.T) {
 
 	f := NewFakeSsh()
 	defer tests.Patch(&sshNew,
-		func(logger *logging.Logger, user string, file string) (Ssher, error) {
+		func(logger *logging.Logger, user string, file string,
+			hk ssh.HostKeyConfig) (Ssher, error) {
 			return f, nil
 		}).Restore()
 
@@ -205,3 +211,25 @@ func TestSshExecutorEnvVariables(t *testing.T) {
 	tests.Assert(t, s.exec != nil)
 
 }
+
+func TestSshExecPoolConfig(t *testing.T) {
+	pc := poolConfig(&SshConfig{})
+	tests.Assert(t, pc.MaxSessionsPerHost == DefaultMaxSessionsPerHost,
+		"expected default max sessions, got:", pc.MaxSessionsPerHost)
+	tests.Assert(t, pc.IdleTimeout == DefaultIdleTimeout*time.Second,
+		"expected default idle timeout, got:", pc.IdleTimeout)
+	tests.Assert(t, pc.KeepAliveInterval == DefaultKeepAliveInterval*time.Second,
+		"expected default keepalive interval, got:", pc.KeepAliveInterval)
+
+	pc = poolConfig(&SshConfig{
+		MaxSessionsPerHost: -1,
+		IdleTimeout:        -1,
+		KeepAliveInterval:  5,
+	})
+	tests.Assert(t, pc.MaxSessionsPerHost == 0,
+		"expected pc.MaxSessionsPerHost == 0, got:", pc.MaxSessionsPerHost)
+	tests.Assert(t, pc.IdleTimeout == 0,
+		"expected pc.IdleTimeout == 0, got:", pc.IdleTimeout)
+	tests.Assert(t, pc.KeepAliveInterval == 5*time.Second,
+		"expected pc.KeepAliveInterval == 5s, got:", pc.KeepAliveInterval)
+}
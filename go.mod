@@ -5,8 +5,10 @@ go 1.14
 require (
 	github.com/auth0/go-jwt-middleware v1.0.1
 	github.com/boltdb/bolt v1.3.1
+	github.com/container-storage-interface/spec v1.5.0
 	github.com/go-ozzo/ozzo-validation/v4 v4.3.0
 	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/golang/protobuf v1.5.2
 	github.com/gorilla/mux v1.8.0
 	github.com/heketi/tests v0.0.0-20151005000721-f3775cbcefd6
 	github.com/lpabon/godbc v0.1.1
@@ -14,6 +16,7 @@ require (
 	github.com/spf13/cobra v1.2.1
 	github.com/urfave/negroni v1.0.0
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
+	google.golang.org/grpc v1.38.0
 	k8s.io/api v0.15.12
 	k8s.io/apimachinery v0.15.12
 	k8s.io/client-go v0.15.12
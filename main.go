@@ -18,7 +18,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,10 +30,17 @@ import (
 	restclient "k8s.io/client-go/rest"
 
 	"github.com/heketi/heketi/v10/apps/glusterfs"
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/executors/agentexec"
+	"github.com/heketi/heketi/v10/executors/localexec"
 	"github.com/heketi/heketi/v10/middleware"
+	"github.com/heketi/heketi/v10/pkg/db/backup"
 	"github.com/heketi/heketi/v10/pkg/metrics"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
 	"github.com/heketi/heketi/v10/server/admin"
 	"github.com/heketi/heketi/v10/server/config"
+	"github.com/heketi/heketi/v10/server/csi"
+	"github.com/heketi/heketi/v10/server/ha"
 	"github.com/heketi/heketi/v10/server/profiling"
 )
 
@@ -47,6 +56,15 @@ var (
 	force                        bool
 	disableAuth                  bool
 	updateDbVolName              string
+	agentConfigFile              string
+	restoreFrom                  string
+	migrateTo                    int
+	migrateOutput                string
+	migrateForce                 bool
+	listSchemaVersions           bool
+	exportCluster                string
+	removeCluster                bool
+	mergeDb                      bool
 )
 
 var RootCmd = &cobra.Command{
@@ -99,6 +117,15 @@ var importdbCmd = &cobra.Command{
 		if debugOutput {
 			glusterfs.SetLogLevel("debug")
 		}
+		if mergeDb {
+			err := glusterfs.DbMerge(jsonFile, dbFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "db merge failed: %v\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Fprintln(os.Stderr, "DB merged into", dbFile)
+			os.Exit(0)
+		}
 		err := glusterfs.DbCreate(jsonFile, dbFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "db creation failed: %v\n", err.Error())
@@ -123,9 +150,25 @@ var exportdbCmd = &cobra.Command{
 			fmt.Fprintln(os.Stderr, "Please provide path for db file")
 			os.Exit(1)
 		}
+		if removeCluster && exportCluster == "" {
+			fmt.Fprintln(os.Stderr, "--remove requires --cluster")
+			os.Exit(1)
+		}
 		if debugOutput {
 			glusterfs.SetLogLevel("debug")
 		}
+		if exportCluster != "" {
+			err := glusterfs.DbDumpCluster(jsonFile, dbFile, exportCluster, removeCluster)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to dump cluster: %v\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Cluster %v exported to %v\n", exportCluster, jsonFile)
+			if removeCluster {
+				fmt.Fprintf(os.Stderr, "Cluster %v removed from %v\n", exportCluster, dbFile)
+			}
+			os.Exit(0)
+		}
 		err := glusterfs.DbDump(jsonFile, dbFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to dump db: %v\n", err.Error())
@@ -158,6 +201,132 @@ var checkdbCmd = &cobra.Command{
 	},
 }
 
+var restoredbCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "restore creates a db file from a db backup",
+	Long: "restore creates a db file from a db backup. The backup is the name\n" +
+		"of a backup of the store configured in the configuration file, or\n" +
+		"the path of the file of a backup kept in a directory.",
+	Example: "heketi db restore --config=heketi.json --from=heketi-db-20211019T120000Z-1342 --dbfile=/db/file/path/",
+	Run: func(cmd *cobra.Command, args []string) {
+		if restoreFrom == "" {
+			fmt.Fprintln(os.Stderr, "Please provide backup to restore")
+			os.Exit(1)
+		}
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if debugOutput {
+			glusterfs.SetLogLevel("debug")
+		}
+		if _, err := os.Stat(dbFile); err == nil && !force {
+			fmt.Fprintf(os.Stderr, "db file %v exists, use --force to replace it\n", dbFile)
+			os.Exit(1)
+		}
+
+		var m *backup.Manager
+		name := restoreFrom
+		if configfile != "" {
+			c, err := config.ReadConfig(configfile)
+			if err != nil {
+				os.Exit(1)
+			}
+			if c.GlusterFS == nil || !c.GlusterFS.DbBackup.Enabled() {
+				fmt.Fprintln(os.Stderr, "No db backups configured in configuration file")
+				os.Exit(1)
+			}
+			m, err = backup.NewManager(&c.GlusterFS.DbBackup)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid db backup configuration: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			// a backup file of a directory, with or without extension
+			name = filepath.Base(restoreFrom)
+			for _, ext := range []string{".gz", ".db", ".json"} {
+				name = strings.TrimSuffix(name, ext)
+			}
+			m = backup.NewManagerWithStore(
+				backup.NewDirStore(filepath.Dir(restoreFrom)), &backup.Config{})
+		}
+		m.Attributes = glusterfs.DbAttributes
+
+		orig := ""
+		if _, err := os.Stat(dbFile); err == nil {
+			orig = fmt.Sprintf("%v.%v.orig", dbFile, time.Now().Unix())
+			if err := os.Rename(dbFile, orig); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to keep existing db: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		info, err := m.Restore(name, dbFile, glusterfs.CheckDbAttributes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "db restore failed: %v\n", err.Error())
+			if orig != "" {
+				os.Rename(orig, dbFile)
+			}
+			os.Exit(1)
+		}
+		if orig != "" {
+			fmt.Fprintln(os.Stderr, "Existing db moved to", orig)
+		}
+		fmt.Fprintf(os.Stderr, "DB restored to %v from backup %v taken %v\n",
+			dbFile, info.Name, time.Unix(info.Time, 0).UTC().Format(time.RFC3339))
+		os.Exit(0)
+	},
+}
+
+var migratedbCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "migrate writes a copy of a db file migrated to another schema version",
+	Long: "migrate writes a copy of a db file migrated to another schema version.\n" +
+		"The db file is not changed. Migrating down undoes the most recent schema\n" +
+		"changes, so that an older version of heketi can use the db. Migrating down\n" +
+		"past a schema change holding entries created by the users, such as\n" +
+		"placement profiles, is refused unless forced.",
+	Example: "heketi db migrate --dbfile=/db/file/path/ --output=/new/db/file/path/ --to=1",
+	Run: func(cmd *cobra.Command, args []string) {
+		if listSchemaVersions {
+			for _, v := range glusterfs.DbSchemaVersions() {
+				reversible := ""
+				if v.Reversible {
+					reversible = " (reversible)"
+				}
+				fmt.Printf("%v: %v%v\n", v.Version, v.Description, reversible)
+			}
+			os.Exit(0)
+		}
+		if dbFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for db file")
+			os.Exit(1)
+		}
+		if migrateOutput == "" {
+			fmt.Fprintln(os.Stderr, "Please provide path for output db file")
+			os.Exit(1)
+		}
+		if debugOutput {
+			glusterfs.SetLogLevel("debug")
+		}
+		to := migrateTo
+		if to == 0 {
+			to = glusterfs.DbSchemaVersion
+		}
+		from, err := glusterfs.MigrateDbFile(dbFile, migrateOutput, to, migrateForce)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "db migration failed: %v\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "DB migrated from schema version %v to %v in %v\n",
+			from, to, migrateOutput)
+		if to < from {
+			fmt.Fprintf(os.Stderr, "Keep %v as a backup, it holds the data "+
+				"dropped by the migration\n", dbFile)
+		}
+		os.Exit(0)
+	},
+}
+
 var deleteBricksWithEmptyPath = &cobra.Command{
 	Use:     "delete-bricks-with-empty-path",
 	Short:   "removes brick entries from db that have empty path",
@@ -234,6 +403,7 @@ var cleanupOperationsCmd = &cobra.Command{
 		// Never start the background cleaner when running
 		// an offline cleanup
 		c.GlusterFS.DisableBackgroundCleaner = true
+		c.GlusterFS.EnableDeviceResync = false
 		app := setupApp(c)
 
 		// run the operation cleanup in the foreground (offline mode)
@@ -284,6 +454,7 @@ var examineGlusterCmd = &cobra.Command{
 		// Never start the background cleaner when running
 		// an offline cleanup
 		c.GlusterFS.DisableBackgroundCleaner = true
+		c.GlusterFS.EnableDeviceResync = false
 		app := setupApp(c)
 
 		fmt.Fprintf(os.Stdout, "Starting examiner now...\n")
@@ -342,6 +513,30 @@ var updateDbVolCmd = &cobra.Command{
 	},
 }
 
+var agentCmd = &cobra.Command{
+	Use:     "agent",
+	Aliases: []string{"heketi-agent"},
+	Short:   "run the heketi node agent",
+	Long: "run the heketi node agent on a storage node, executing " +
+		"operations and command batches sent by the heketi server",
+	Example: "heketi agent --config=/etc/heketi/agent.json",
+	Run: func(cmd *cobra.Command, args []string) {
+		if agentConfigFile == "" {
+			fmt.Fprintln(os.Stderr, "Please provide configuration file")
+			os.Exit(1)
+		}
+		options, err := config.ReadAgentConfig(agentConfigFile)
+		if err != nil {
+			os.Exit(1)
+		}
+		if err := runAgent(options); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: node agent failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+}
+
 func init() {
 	RootCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Show version")
@@ -355,12 +550,15 @@ func init() {
 	dbCmd.AddCommand(importdbCmd)
 	importdbCmd.Flags().StringVar(&jsonFile, "jsonfile", "", "Input file with data in JSON format")
 	importdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be created")
+	importdbCmd.Flags().BoolVar(&mergeDb, "merge", false, "Merge the clusters of the JSON input into the existing db file")
 	importdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
 	importdbCmd.SilenceUsage = true
 
 	dbCmd.AddCommand(exportdbCmd)
 	exportdbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be exported")
 	exportdbCmd.Flags().StringVar(&jsonFile, "jsonfile", "", "File path for JSON file to be created")
+	exportdbCmd.Flags().StringVar(&exportCluster, "cluster", "", "Only export the entries of this cluster")
+	exportdbCmd.Flags().BoolVar(&removeCluster, "remove", false, "Remove the exported cluster from the db")
 	exportdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
 	exportdbCmd.SilenceUsage = true
 
@@ -369,6 +567,23 @@ func init() {
 	checkdbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
 	checkdbCmd.SilenceUsage = true
 
+	dbCmd.AddCommand(restoredbCmd)
+	restoredbCmd.Flags().StringVar(&restoreFrom, "from", "", "Backup to restore")
+	restoredbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be created")
+	restoredbCmd.Flags().StringVar(&configfile, "config", "", "Configuration file with the db backup settings")
+	restoredbCmd.Flags().BoolVar(&force, "force", false, "Replace an existing db file, which is kept with the .orig extension")
+	restoredbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	restoredbCmd.SilenceUsage = true
+
+	dbCmd.AddCommand(migratedbCmd)
+	migratedbCmd.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to be migrated")
+	migratedbCmd.Flags().StringVar(&migrateOutput, "output", "", "File path for migrated db to be created")
+	migratedbCmd.Flags().IntVar(&migrateTo, "to", 0, "Schema version to migrate to (default: schema version of this heketi)")
+	migratedbCmd.Flags().BoolVar(&listSchemaVersions, "list", false, "List the schema versions known to this heketi")
+	migratedbCmd.Flags().BoolVar(&migrateForce, "force", false, "Drop the entries created by the users, such as placement profiles, when migrating down")
+	migratedbCmd.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
+	migratedbCmd.SilenceUsage = true
+
 	dbCmd.AddCommand(deleteBricksWithEmptyPath)
 	deleteBricksWithEmptyPath.Flags().StringVar(&dbFile, "dbfile", "", "File path for db to operate on")
 	deleteBricksWithEmptyPath.Flags().BoolVar(&debugOutput, "debug", false, "Show debug logs on stdout")
@@ -397,6 +612,59 @@ func init() {
 	updateDbVolCmd.SilenceUsage = true
 	updateDbVolCmd.Flags().StringVar(&configfile, "config", "", "Configuration file")
 	updateDbVolCmd.Flags().StringVar(&updateDbVolName, "force-volume-name", "", "Force volume name")
+
+	RootCmd.AddCommand(agentCmd)
+	agentCmd.SilenceUsage = true
+	agentCmd.Flags().StringVar(&agentConfigFile, "config", "", "Agent configuration file")
+}
+
+// runAgent serves the node agent api until the process is signaled
+// to stop or the http server fails.
+func runAgent(options *config.AgentConfig) error {
+	tlsConfig, err := nodeagent.ServerTLSConfig(options.TLS)
+	if err != nil {
+		return err
+	}
+	l, err := localexec.NewLocalExecutor(&options.LocalExec)
+	if err != nil {
+		return err
+	}
+
+	agent := nodeagent.NewServer(l)
+	if options.AllowExec {
+		fmt.Println("WARNING: Node agent runs arbitrary commands sent by " +
+			"clients with a trusted certificate")
+		agent.SetCommandRunner(l)
+	}
+	router := mux.NewRouter()
+	agent.SetRoutes(router)
+
+	port := options.Port
+	if port == "" {
+		port = agentexec.DefaultPort
+	}
+	srv := &http.Server{
+		Addr:      ":" + port,
+		Handler:   negroni.New(negroni.NewRecovery(), negroni.NewLogger(), negroni.Wrap(router)),
+		TLSConfig: tlsConfig,
+	}
+
+	signalch := make(chan os.Signal, 1)
+	signal.Notify(signalch, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	done := make(chan error, 1)
+	go func() {
+		fmt.Printf("Node agent listening on port %v\n", port)
+		done <- srv.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case <-signalch:
+		fmt.Println("Shutting down node agent...")
+		return srv.Close()
+	case err := <-done:
+		return err
+	}
 }
 
 func setWithEnvVariables(options *config.Config) {
@@ -432,6 +700,21 @@ func setWithEnvVariables(options *config.Config) {
 	if "" != env {
 		options.DefaultState = env
 	}
+
+	env = os.Getenv("HEKETI_CSI_SOCKET")
+	if "" != env {
+		options.CsiSocket = env
+	}
+
+	env = os.Getenv("HEKETI_HA_IDENTITY")
+	if "" != env {
+		options.HA.Identity = env
+	}
+
+	env = os.Getenv("HEKETI_HA_ADDRESS")
+	if "" != env {
+		options.HA.Address = env
+	}
 }
 
 func setupApp(config *config.Config) (a *glusterfs.App) {
@@ -442,6 +725,21 @@ func setupApp(config *config.Config) (a *glusterfs.App) {
 		}
 	}()
 
+	setBackgroundTasks(config)
+
+	a, e := glusterfs.NewApp(config.GlusterFS)
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Unable to start application: %s\n", e)
+		os.Exit(1)
+	}
+	if err := a.ServerReset(); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR: Failed to reset server application")
+		os.Exit(1)
+	}
+	return a
+}
+
+func setBackgroundTasks(config *config.Config) {
 	// If one really needs to disable the health monitor for
 	// the server binary.
 	glusterfs.MonitorGlusterNodes = enableBackgroundTask(
@@ -452,17 +750,105 @@ func setupApp(config *config.Config) (a *glusterfs.App) {
 	glusterfs.EnableBackgroundCleaner = enableBackgroundTask(
 		config.GlusterFS.DisableBackgroundCleaner,
 		"HEKETI_DISABLE_BACKGROUND_CLEANER")
+}
 
-	a, e := glusterfs.NewApp(config.GlusterFS)
-	if e != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: Unable to start application: %s\n", e)
+// appBackend is the app served by a heketi instance running in high
+// availability mode.
+type appBackend struct {
+	app     *glusterfs.App
+	api     http.Handler
+	metrics http.Handler
+}
+
+func (b *appBackend) Reload() error {
+	return b.app.ReloadDb()
+}
+
+func (b *appBackend) Close() {
+	b.app.Close()
+}
+
+func backendApi(b ha.Backend) http.Handler {
+	return b.(*appBackend).api
+}
+
+func backendMetrics(b ha.Backend) http.Handler {
+	return b.(*appBackend).metrics
+}
+
+// newAppBackend starts the app of the leader, over the db in
+// read-write mode, or the app of a standby, over the replica of the
+// db in read-only mode.
+func newAppBackend(options *config.Config, leader, backupDb bool) (*appBackend, error) {
+	conf := *options.GlusterFS
+	conf.DBReadOnly = !leader
+	app, err := glusterfs.NewApp(&conf)
+	if err != nil {
+		return nil, err
+	}
+	if leader {
+		// operations left pending by the previous leader are marked
+		// stale and taken over by the background cleaner
+		if err := app.ServerReset(); err != nil {
+			app.Close()
+			return nil, err
+		}
+	}
+
+	router := mux.NewRouter().StrictSlash(true)
+	if err := app.SetRoutes(router); err != nil {
+		app.Close()
+		return nil, err
+	}
+	n := negroni.New()
+	if leader && backupDb {
+		n.UseFunc(app.BackupToKubernetesSecret)
+	}
+	n.UseHandler(router)
+
+	return &appBackend{
+		app:     app,
+		api:     n,
+		metrics: metrics.NewMetricsHandler(app),
+	}, nil
+}
+
+// setupNode returns the node of a heketi instance running in high
+// availability mode.
+func setupNode(options *config.Config, backupDb bool) *ha.Node {
+	conf := &options.HA
+	if err := conf.SetDefaults(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid high availability configuration: %v\n", err)
 		os.Exit(1)
 	}
-	if err := a.ServerReset(); err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR: Failed to reset server application")
+	if err := conf.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid high availability configuration: %v\n", err)
 		os.Exit(1)
 	}
-	return a
+
+	var lease ha.Lease
+	switch conf.Lease {
+	case ha.LeaseKube:
+		l, err := ha.NewKubeLease(conf.LeaseName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Unable to use kubernetes lease: %v\n", err)
+			os.Exit(1)
+		}
+		lease = l
+	case ha.LeaseFile:
+		lease = ha.NewFileLease(conf.LeaseFile)
+	}
+
+	setBackgroundTasks(options)
+	newClient := func(address string) *client.Client {
+		return client.NewClient(address, "admin", options.JwtConfig.Admin.PrivateKey)
+	}
+	newBackend := func(leader bool) (ha.Backend, error) {
+		return newAppBackend(options, leader, backupDb)
+	}
+	fmt.Printf("High availability mode enabled as %v\n", conf.Identity)
+	return ha.NewNode(conf, lease, glusterfs.DbPath(options.GlusterFS),
+		newClient, newBackend)
 }
 
 // check if the config file or environment has disabled a internal
@@ -518,8 +904,22 @@ func main() {
 	// Negroni
 	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
 
-	// Setup a new GlusterFS application
-	app := setupApp(options)
+	backupDb := false
+	if options.BackupDbToKubeSecret {
+		// Check if running in a Kubernetes environment
+		_, err = restclient.InClusterConfig()
+		backupDb = err == nil
+	}
+
+	// Setup a new GlusterFS application, or the node serving the
+	// application of the leader or of a standby
+	var app *glusterfs.App
+	var node *ha.Node
+	if options.HA.Enabled {
+		node = setupNode(options, backupDb)
+	} else {
+		app = setupApp(options)
+	}
 
 	// Add /hello router
 	router := mux.NewRouter()
@@ -530,7 +930,11 @@ func main() {
 			fmt.Fprint(w, "Hello from Heketi")
 		})
 
-	router.Methods("GET").Path("/metrics").Name("Metrics").HandlerFunc(metrics.NewMetricsHandler(app))
+	if node != nil {
+		router.Methods("GET").Path("/metrics").Name("Metrics").Handler(node.Handler(backendMetrics))
+	} else {
+		router.Methods("GET").Path("/metrics").Name("Metrics").HandlerFunc(metrics.NewMetricsHandler(app))
+	}
 
 	// Enable profiling on "/debug/pprof"
 	if options.Profiling {
@@ -540,10 +944,16 @@ func main() {
 	// Create a router and do not allow any routes
 	// unless defined.
 	heketiRouter := mux.NewRouter().StrictSlash(true)
-	err = app.SetRoutes(heketiRouter)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR: Unable to create http server endpoints")
-		os.Exit(1)
+	if node != nil {
+		// the routes of the app are served by the current backend
+		node.SetRoutes(heketiRouter)
+		heketiRouter.NotFoundHandler = node.Handler(backendApi)
+	} else {
+		err = app.SetRoutes(heketiRouter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Unable to create http server endpoints")
+			os.Exit(1)
+		}
 	}
 
 	// Load authorization JWT middleware
@@ -558,7 +968,7 @@ func main() {
 		n.Use(jwtauth)
 
 		// Add application middleware check
-		n.UseFunc(app.Auth)
+		n.UseFunc(glusterfs.Auth)
 	} else {
 		fmt.Fprintln(os.Stderr, "WARNING: Heketi started with --disable-auth")
 	}
@@ -571,18 +981,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	if options.BackupDbToKubeSecret {
-		// Check if running in a Kubernetes environment
-		_, err = restclient.InClusterConfig()
-		if err == nil {
-			// Load middleware to backup database
-			n.UseFunc(app.BackupToKubernetesSecret)
-		}
+	if node != nil {
+		// Redirect writes of standbys to the leader
+		n.Use(node)
+	} else if backupDb {
+		// Load middleware to backup database
+		n.UseFunc(app.BackupToKubernetesSecret)
 	}
 
 	// Add all endpoints after the middleware was added
 	n.UseHandler(heketiRouter)
 
+	// Serve the CSI driver on a unix socket. It calls the endpoints
+	// in process through its own middleware chain, csin, which skips
+	// both the JWT check and the app's Auth middleware: every request
+	// on the socket runs with full admin rights. The socket is created
+	// owner-only (mode 0600), so only the heketi user, or root, can
+	// reach it.
+	var csiServer *csi.Server
+	if options.CsiSocket != "" {
+		csin := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
+		csin.Use(adminss)
+		if node != nil {
+			csin.UseFunc(node.LeaderWrites)
+		} else if backupDb {
+			csin.UseFunc(app.BackupToKubernetesSecret)
+		}
+		csin.UseHandler(heketiRouter)
+
+		csiServer = csi.New(csin, HEKETI_VERSION)
+		go func() {
+			fmt.Printf("Serving CSI driver on %v\n", options.CsiSocket)
+			if err := csiServer.Serve(options.CsiSocket); err != nil {
+				fmt.Printf("ERROR: CSI server error: %v\n", err)
+			}
+		}()
+	}
+
 	// Setup complete routing
 	router.NewRoute().Handler(n)
 
@@ -611,15 +1046,39 @@ func main() {
 		done <- true
 	}()
 
+	// Take part in the election of the leader
+	stopNode := make(chan struct{})
+	nodeDone := make(chan error, 1)
+	if node != nil {
+		go func() {
+			nodeDone <- node.Run(stopNode)
+		}()
+	}
+
 	// Block here for signals and errors from the HTTP server
+	nodeStopped := false
 	select {
 	case <-signalch:
 	case <-done:
+	case err := <-nodeDone:
+		fmt.Printf("ERROR: High availability error: %v\n", err)
+		nodeStopped = true
 	}
 	fmt.Printf("Shutting down...\n")
 
 	// Shutdown the application
 	// :TODO: Need to shutdown the server
-	app.Close()
+	if csiServer != nil {
+		csiServer.Stop()
+	}
+	if node != nil {
+		// the node releases its lease and closes its app
+		if !nodeStopped {
+			close(stopNode)
+			<-nodeDone
+		}
+	} else {
+		app.Close()
+	}
 
 }
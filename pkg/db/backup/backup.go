@@ -0,0 +1,402 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	wdb "github.com/heketi/heketi/v10/pkg/db"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/logging"
+)
+
+const (
+	namePrefix = "heketi-db-"
+	infoSuffix = ".json"
+	timeFormat = "20060102T150405Z"
+)
+
+var (
+	logger = logging.NewLogger("[backup]", logging.LEVEL_INFO)
+)
+
+// AttributesFunc reads the dbattribute entries of a db.
+type AttributesFunc func(tx *bolt.Tx) (map[string]string, error)
+
+// CheckFunc returns an error if a db with the given dbattribute
+// entries can not be used.
+type CheckFunc func(attrs map[string]string) error
+
+// Manager writes snapshots of the db to a store and keeps the most
+// recent ones. Each snapshot is stored as a data object, the db
+// possibly gzipped, and an info object describing it. The info
+// object is written last so that only complete snapshots are listed.
+type Manager struct {
+	store    Store
+	keep     int
+	compress bool
+	interval time.Duration
+	now      func() time.Time
+
+	// Attributes records the dbattribute entries of the db in the
+	// info of the snapshots if set.
+	Attributes AttributesFunc
+
+	lock   sync.Mutex
+	lastTx int
+
+	// to stop the periodic backups
+	stop chan<- interface{}
+	done <-chan interface{}
+}
+
+// NewManager returns a manager of the backups described by the
+// configuration.
+func NewManager(conf *Config) (*Manager, error) {
+	store, err := conf.NewStore()
+	if err != nil {
+		return nil, err
+	}
+	return NewManagerWithStore(store, conf), nil
+}
+
+// NewManagerWithStore returns a manager keeping the backups in the
+// given store, with the settings of the configuration.
+func NewManagerWithStore(store Store, conf *Config) *Manager {
+	return &Manager{
+		store:    store,
+		keep:     conf.keep(),
+		compress: conf.Compress,
+		interval: conf.interval(),
+		now:      time.Now,
+	}
+}
+
+// Snapshot writes a snapshot of the db unless the db did not change
+// since the last snapshot. It returns the info of the snapshot, or
+// nil if none was written. Snapshots beyond the number to keep are
+// then removed.
+func (m *Manager) Snapshot(db wdb.RODB) (*api.BackupInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var info *api.BackupInfo
+	var data []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		if tx.ID() == m.lastTx {
+			return nil
+		}
+		info = &api.BackupInfo{
+			Name:       fmt.Sprintf("%v%v-%v", namePrefix, m.now().UTC().Format(timeFormat), tx.ID()),
+			Time:       m.now().Unix(),
+			TxId:       tx.ID(),
+			Compressed: m.compress,
+		}
+		if m.Attributes != nil {
+			attrs, err := m.Attributes(tx)
+			if err != nil {
+				return fmt.Errorf("Unable to read db attributes: %v", err)
+			}
+			info.DbAttributes = attrs
+		}
+
+		var buf bytes.Buffer
+		if m.compress {
+			gz := gzip.NewWriter(&buf)
+			if _, err := tx.WriteTo(gz); err != nil {
+				return fmt.Errorf("Unable to access database: %v", err)
+			}
+			if err := gz.Close(); err != nil {
+				return fmt.Errorf("Unable to compress database: %v", err)
+			}
+		} else if _, err := tx.WriteTo(&buf); err != nil {
+			return fmt.Errorf("Unable to access database: %v", err)
+		}
+		data = buf.Bytes()
+		return nil
+	})
+	if err != nil || info == nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	info.Sha256 = hex.EncodeToString(sum[:])
+	info.Size = int64(len(data))
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Put(dataName(info), data); err != nil {
+		return nil, fmt.Errorf("Unable to store backup %v: %v", info.Name, err)
+	}
+	if err := m.store.Put(info.Name+infoSuffix, infoData); err != nil {
+		return nil, fmt.Errorf("Unable to store backup %v: %v", info.Name, err)
+	}
+	m.lastTx = info.TxId
+	logger.Info("Stored db backup %v", info.Name)
+
+	if err := m.rotate(); err != nil {
+		logger.LogError("Unable to remove old backups: %v", err)
+	}
+	return info, nil
+}
+
+// List returns the info of the stored snapshots, most recent first.
+func (m *Manager) List() ([]api.BackupInfo, error) {
+	names, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	backups := []api.BackupInfo{}
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, infoSuffix) {
+			continue
+		}
+		info, err := m.Info(strings.TrimSuffix(name, infoSuffix))
+		if err != nil {
+			logger.Warning("Skipping backup %v: %v", name, err)
+			continue
+		}
+		backups = append(backups, *info)
+	}
+	return backups, nil
+}
+
+// Info returns the info of a stored snapshot.
+func (m *Manager) Info(name string) (*api.BackupInfo, error) {
+	r, err := m.store.Get(name + infoSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var info api.BackupInfo
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return nil, fmt.Errorf("Invalid backup info: %v", err)
+	}
+	return &info, nil
+}
+
+// Fetch writes the db of a stored snapshot to w, after checking that
+// the stored snapshot matches its checksum.
+func (m *Manager) Fetch(name string, w io.Writer) (*api.BackupInfo, error) {
+	info, err := m.Info(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.store.Get(dataName(info))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != info.Sha256 || int64(len(data)) != info.Size {
+		return nil, fmt.Errorf("Backup %v is corrupted: checksum mismatch", name)
+	}
+
+	var db io.Reader = bytes.NewReader(data)
+	if info.Compressed {
+		gz, err := gzip.NewReader(db)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decompress backup %v: %v", name, err)
+		}
+		defer gz.Close()
+		db = gz
+	}
+	if _, err := io.Copy(w, db); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Restore writes the db of a stored snapshot to dbfile, replacing
+// any existing file. The dbattribute entries of the snapshot are
+// checked with check both before fetching the snapshot, from its
+// info, and after, from the db itself.
+func (m *Manager) Restore(name, dbfile string, check CheckFunc) (*api.BackupInfo, error) {
+	info, err := m.Info(name)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(info.DbAttributes); err != nil {
+			return nil, fmt.Errorf("Backup %v is not compatible: %v", name, err)
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(dbfile), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = m.Fetch(name, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkDb(tmp, check); err != nil {
+		return nil, fmt.Errorf("Backup %v is not compatible: %v", name, err)
+	}
+	if err := os.Rename(tmp, dbfile); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (m *Manager) checkDb(path string, check CheckFunc) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		ReadOnly: true,
+		Timeout:  3 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to open db: %v", err)
+	}
+	defer db.Close()
+	if m.Attributes == nil || check == nil {
+		return nil
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		attrs, err := m.Attributes(tx)
+		if err != nil {
+			return err
+		}
+		return check(attrs)
+	})
+}
+
+// rotate removes the snapshots beyond the number to keep, and data
+// objects left without info by failed snapshots.
+func (m *Manager) rotate() error {
+	names, err := m.store.List()
+	if err != nil {
+		return err
+	}
+	infos := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, namePrefix) && strings.HasSuffix(name, infoSuffix) {
+			infos = append(infos, strings.TrimSuffix(name, infoSuffix))
+		}
+	}
+	if len(infos) == 0 {
+		return nil
+	}
+	kept := map[string]bool{}
+	for i, name := range infos {
+		if i < len(infos)-m.keep {
+			if err := m.remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+		kept[name] = true
+	}
+
+	newest := infos[len(infos)-1]
+	for _, name := range names {
+		if !strings.HasPrefix(name, namePrefix) || strings.HasSuffix(name, infoSuffix) {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".db")
+		if !kept[base] && base < newest {
+			if err := m.store.Delete(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Manager) remove(name string) error {
+	info, err := m.Info(name)
+	if err != nil && err != ErrNotFound {
+		logger.Warning("Removing backup %v with invalid info: %v", name, err)
+	}
+	// the info goes first, the backup is not listed anymore even if
+	// removing the data fails
+	if err := m.store.Delete(name + infoSuffix); err != nil {
+		return err
+	}
+	if info != nil {
+		if err := m.store.Delete(dataName(info)); err != nil {
+			return err
+		}
+	}
+	logger.Info("Removed db backup %v", name)
+	return nil
+}
+
+// Start creates a background goroutine taking a snapshot of the db
+// at start and then periodically if the db changed.
+func (m *Manager) Start(db wdb.RODB) {
+	if backups, err := m.List(); err == nil && len(backups) > 0 {
+		m.lastTx = backups[0].TxId
+	}
+	ticker := time.NewTicker(m.interval)
+	stop := make(chan interface{})
+	done := make(chan interface{})
+	m.stop = stop
+	m.done = done
+
+	go func() {
+		logger.Info("Started periodic db backups")
+		defer close(done)
+		defer ticker.Stop()
+		for {
+			if _, err := m.Snapshot(db); err != nil {
+				logger.LogError("Periodic db backup: %v", err)
+			}
+			select {
+			case <-stop:
+				logger.Info("Stopping periodic db backups")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the periodic backups and wait for a snapshot in progress.
+func (m *Manager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+}
+
+func dataName(info *api.BackupInfo) string {
+	if info.Compressed {
+		return info.Name + ".db.gz"
+	}
+	return info.Name + ".db"
+}
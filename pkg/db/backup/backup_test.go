@@ -0,0 +1,201 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func testDb(t *testing.T, path string) *bolt.DB {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return db
+}
+
+func testPut(t *testing.T, db *bolt.DB, key, value string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("DATA"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), []byte(value))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func testGet(t *testing.T, path, key string) string {
+	db := testDb(t, path)
+	defer db.Close()
+	var value string
+	db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("DATA")); b != nil {
+			value = string(b.Get([]byte(key)))
+		}
+		return nil
+	})
+	return value
+}
+
+// testAttributes reads the keys of the DATA bucket as attributes.
+func testAttributes(tx *bolt.Tx) (map[string]string, error) {
+	attrs := map[string]string{}
+	if b := tx.Bucket([]byte("DATA")); b != nil {
+		b.ForEach(func(k, v []byte) error {
+			attrs[string(k)] = string(v)
+			return nil
+		})
+	}
+	return attrs, nil
+}
+
+func testManager(t *testing.T, store Store, compress bool) {
+	dir, err := ioutil.TempDir("", "heketi-backup")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	db := testDb(t, filepath.Join(dir, "heketi.db"))
+	defer db.Close()
+
+	m := NewManagerWithStore(store, &Config{Keep: 2, Compress: compress})
+	m.Attributes = testAttributes
+	now := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	testPut(t, db, "a", "1")
+	info, err := m.Snapshot(db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info != nil, "expected a snapshot")
+	tests.Assert(t, info.Compressed == compress)
+	tests.Assert(t, info.DbAttributes["a"] == "1",
+		"expected attributes, got:", info.DbAttributes)
+	first := info.Name
+
+	// no snapshot without changes
+	info, err = m.Snapshot(db)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info == nil, "expected no snapshot, got:", info)
+
+	for i := 2; i <= 3; i++ {
+		now = now.Add(time.Minute)
+		testPut(t, db, "a", fmt.Sprintf("%v", i))
+		info, err = m.Snapshot(db)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, info != nil, "expected a snapshot")
+	}
+
+	// only the last two snapshots are kept, most recent first
+	backups, err := m.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 2, "expected 2 backups, got:", backups)
+	tests.Assert(t, backups[0].Name == info.Name,
+		"expected most recent first, got:", backups[0].Name)
+	tests.Assert(t, backups[1].DbAttributes["a"] == "2",
+		"expected second snapshot, got:", backups[1].DbAttributes)
+	_, err = m.Info(first)
+	tests.Assert(t, err == ErrNotFound, "expected err == ErrNotFound, got:", err)
+	names, err := store.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(names) == 4, "expected 4 objects, got:", names)
+
+	// restore
+	dbfile := filepath.Join(dir, "restored.db")
+	_, err = m.Restore(backups[1].Name, dbfile, func(attrs map[string]string) error {
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, testGet(t, dbfile, "a") == "2",
+		"expected restored db, got:", testGet(t, dbfile, "a"))
+
+	// incompatible snapshots are not restored
+	_, err = m.Restore(backups[0].Name, dbfile, func(attrs map[string]string) error {
+		if attrs["a"] == "3" {
+			return fmt.Errorf("too new")
+		}
+		return nil
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, testGet(t, dbfile, "a") == "2",
+		"expected db kept, got:", testGet(t, dbfile, "a"))
+
+	// corrupted snapshots are detected
+	err = store.Put(dataName(&backups[0]), []byte("garbage"))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = m.Restore(backups[0].Name, dbfile, nil)
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, testGet(t, dbfile, "a") == "2",
+		"expected db kept, got:", testGet(t, dbfile, "a"))
+}
+
+func TestManagerDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-backup-store")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	testManager(t, NewDirStore(filepath.Join(dir, "backups")), false)
+}
+
+func TestManagerCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-backup-store")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	testManager(t, NewDirStore(dir), true)
+}
+
+func TestManagerStartStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-backup")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	db := testDb(t, filepath.Join(dir, "heketi.db"))
+	defer db.Close()
+	testPut(t, db, "a", "1")
+
+	store := NewDirStore(filepath.Join(dir, "backups"))
+	m := NewManagerWithStore(store, &Config{})
+	m.Start(db)
+	m.Stop()
+	backups, err := m.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 1, "expected a backup at start, got:", backups)
+
+	// a new manager does not repeat the last snapshot
+	m = NewManagerWithStore(store, &Config{})
+	m.Start(db)
+	m.Stop()
+	backups, err = m.List()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(backups) == 1, "expected a single backup, got:", backups)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{}
+	tests.Assert(t, !c.Enabled())
+	_, err := c.NewStore()
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	c = &Config{Dir: "/backups", S3: S3Config{Endpoint: "http://s3"}}
+	tests.Assert(t, c.Validate() != nil, "expected err for two destinations")
+
+	c = &Config{S3: S3Config{Endpoint: "http://s3"}}
+	tests.Assert(t, c.Validate() != nil, "expected err for missing bucket")
+
+	c = &Config{Dir: "/backups"}
+	tests.Assert(t, c.Validate() == nil)
+	tests.Assert(t, c.keep() == DefaultKeep, "expected default keep, got:", c.keep())
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultKeep     = 7
+	DefaultInterval = 3600
+	DefaultS3Region = "us-east-1"
+)
+
+// Config configures the periodic backups of the db to a directory
+// or to an S3 compatible object store. Backups are disabled if
+// neither is set.
+type Config struct {
+	Dir string   `json:"dir"`
+	S3  S3Config `json:"s3"`
+	// number of snapshots to keep
+	Keep int `json:"keep"`
+	// gzip the snapshots
+	Compress bool `json:"compress"`
+	// seconds between checks for changes of the db
+	Interval uint32 `json:"interval_sec"`
+}
+
+// S3Config locates a bucket of an S3 compatible object store. The
+// bucket is addressed in path style, as supported by most stores.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// Enabled returns true if a destination for the backups is set.
+func (c *Config) Enabled() bool {
+	return c.Dir != "" || c.S3.Endpoint != ""
+}
+
+// Validate checks that the configuration names exactly one
+// destination for the backups.
+func (c *Config) Validate() error {
+	if c.Dir != "" && c.S3.Endpoint != "" {
+		return fmt.Errorf("only one of dir and s3 can be set")
+	}
+	if c.S3.Endpoint != "" && c.S3.Bucket == "" {
+		return fmt.Errorf("s3 bucket is required")
+	}
+	if c.Keep < 0 {
+		return fmt.Errorf("keep must not be negative")
+	}
+	return nil
+}
+
+func (c *Config) keep() int {
+	if c.Keep == 0 {
+		return DefaultKeep
+	}
+	return c.Keep
+}
+
+func (c *Config) interval() time.Duration {
+	if c.Interval == 0 {
+		return DefaultInterval * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// NewStore returns the store of the backups described by the
+// configuration.
+func (c *Config) NewStore() (Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch {
+	case c.Dir != "":
+		return NewDirStore(c.Dir), nil
+	case c.S3.Endpoint != "":
+		return NewS3Store(c.S3), nil
+	}
+	return nil, fmt.Errorf("no backup destination configured")
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("backup not found")
+)
+
+// Store keeps the objects making up the backups.
+type Store interface {
+	// Put stores an object, replacing any object of the same name.
+	// A reader of the store never sees a partially written object.
+	Put(name string, data []byte) error
+	// Get opens an object. It returns ErrNotFound if there is no
+	// object of that name.
+	Get(name string) (io.ReadCloser, error)
+	// Delete removes an object. Removing a missing object is not
+	// an error.
+	Delete(name string) error
+	// List returns the names of all objects, sorted.
+	List() ([]string, error)
+}
+
+// DirStore keeps backups as files of a local directory, such as a
+// mounted volume.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (s *DirStore) Put(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (s *DirStore) Get(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *DirStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *DirStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".tmp-") {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
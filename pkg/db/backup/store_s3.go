@@ -0,0 +1,280 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3TimeFormat = "20060102T150405Z"
+	s3DateFormat = "20060102"
+)
+
+// S3Store keeps backups as objects of a bucket of an S3 compatible
+// object store. Requests are signed with AWS signature version 4.
+type S3Store struct {
+	conf   S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3Store(conf S3Config) *S3Store {
+	if conf.Region == "" {
+		conf.Region = DefaultS3Region
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	return &S3Store{
+		conf:   conf,
+		client: &http.Client{Timeout: 5 * time.Minute},
+		now:    time.Now,
+	}
+}
+
+func (s *S3Store) Put(name string, data []byte) error {
+	r, err := s.do(http.MethodPut, s.conf.Prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return s3Error(r)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(name string) (io.ReadCloser, error) {
+	r, err := s.do(http.MethodGet, s.conf.Prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch r.StatusCode {
+	case http.StatusOK:
+		return r.Body, nil
+	case http.StatusNotFound:
+		r.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer r.Body.Close()
+	return nil, s3Error(r)
+}
+
+func (s *S3Store) Delete(name string) error {
+	r, err := s.do(http.MethodDelete, s.conf.Prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error(r)
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List() ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if s.conf.Prefix != "" {
+			query.Set("prefix", s.conf.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		r, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if r.StatusCode != http.StatusOK {
+			err = s3Error(r)
+			r.Body.Close()
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(r.Body).Decode(&result)
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse bucket listing: %v", err)
+		}
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.conf.Prefix)
+			// keys of "sub directories" of the prefix are not ours
+			if name != "" && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// do sends a signed request for the given key of the bucket, or for
+// the bucket itself if the key is empty.
+func (s *S3Store) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	path := "/" + s.conf.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	u, err := url.Parse(s.conf.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid s3 endpoint: %v", err)
+	}
+	u.Path = path
+	u.RawPath = s3EscapePath(path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s3Sign(req, body, s.conf.AccessKey, s.conf.SecretKey, s.conf.Region, s.now())
+	return s.client.Do(req)
+}
+
+func s3Error(r *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(r.Body, 4096))
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 request failed: %v: %v", e.Code, e.Message)
+	}
+	return fmt.Errorf("s3 request failed: %v", r.Status)
+}
+
+// s3Sign adds the headers of AWS signature version 4 to the request,
+// signing the host and all headers already set on the request.
+func s3Sign(req *http.Request, body []byte,
+	accessKey, secretKey, region string, now time.Time) {
+
+	now = now.UTC()
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := now.Format(s3DateFormat) + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(s3TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := s3Hmac([]byte("AWS4"+secretKey), now.Format(s3DateFormat))
+	key = s3Hmac(key, region)
+	key = s3Hmac(key, "s3")
+	key = s3Hmac(key, "aws4_request")
+	signature := hex.EncodeToString(s3Hmac(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes all bytes but the unreserved characters,
+// as required for signing.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') ||
+			('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = s3Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(params, "&")
+}
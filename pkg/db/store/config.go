@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	TypeBolt = "bolt"
+	TypeEtcd = "etcd"
+
+	DefaultEtcdPrefix    = "/heketi/"
+	DefaultEtcdTimeout   = 5
+	DefaultEtcdMaxTxnOps = 128
+	DefaultSyncInterval  = 60
+)
+
+// Config selects the store holding the heketi db. With the default
+// bolt store the db file is the only copy of the db. With another
+// store the db file is a working copy of the store.
+type Config struct {
+	Type string     `json:"type"`
+	Etcd EtcdConfig `json:"etcd"`
+	// seconds between checks that the store holds all the changes
+	// of the db file, the changes of the entries of heketi are
+	// written as they are committed
+	SyncInterval uint32 `json:"sync_interval_sec"`
+}
+
+// EtcdConfig locates the etcd cluster holding the heketi db, used
+// through the JSON gateway of the etcd v3 api.
+type EtcdConfig struct {
+	Endpoints []string `json:"endpoints"`
+	// prefix of the keys of the db
+	Prefix   string `json:"prefix"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// tls settings
+	CaFile   string `json:"ca_file"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// seconds to wait for a response of etcd
+	Timeout uint32 `json:"timeout_sec"`
+	// maximum number of operations in a transaction, the
+	// --max-txn-ops setting of the etcd servers
+	MaxTxnOps int `json:"max_txn_ops"`
+}
+
+// Enabled returns true if the db is held by a store other than the
+// db file.
+func (c *Config) Enabled() bool {
+	return c.Type != "" && c.Type != TypeBolt
+}
+
+func (c *Config) Validate() error {
+	switch c.Type {
+	case "", TypeBolt:
+	case TypeEtcd:
+		if len(c.Etcd.Endpoints) == 0 {
+			return fmt.Errorf("etcd endpoints are required")
+		}
+		if (c.Etcd.CertFile == "") != (c.Etcd.KeyFile == "") {
+			return fmt.Errorf("etcd cert_file and key_file must be set together")
+		}
+	default:
+		return fmt.Errorf("unknown db store type %#v", c.Type)
+	}
+	return nil
+}
+
+// SyncPeriod returns the time between checks that the store holds all
+// the changes of the db file.
+func (c *Config) SyncPeriod() time.Duration {
+	if c.SyncInterval == 0 {
+		return DefaultSyncInterval * time.Second
+	}
+	return time.Duration(c.SyncInterval) * time.Second
+}
+
+// NewStore returns the store described by the configuration, or nil
+// if the db file is the only copy of the db.
+func (c *Config) NewStore() (Store, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case TypeEtcd:
+		return NewEtcdStore(c.Etcd)
+	}
+	return nil, nil
+}
@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+)
+
+func TestConfigValidate(t *testing.T) {
+	c := &Config{}
+	tests.Assert(t, c.Validate() == nil)
+	tests.Assert(t, !c.Enabled())
+	s, err := c.NewStore()
+	tests.Assert(t, s == nil && err == nil, "got:", s, err)
+
+	c = &Config{Type: TypeEtcd}
+	tests.Assert(t, c.Validate() != nil, "expected missing endpoints error")
+	c.Etcd.Endpoints = []string{"http://localhost:2379"}
+	c.Etcd.CertFile = "cert.pem"
+	tests.Assert(t, c.Validate() != nil, "expected missing key file error")
+	c.Etcd.CertFile = ""
+	tests.Assert(t, c.Validate() == nil)
+	tests.Assert(t, c.Enabled())
+
+	c = &Config{Type: "zookeeper"}
+	tests.Assert(t, c.Validate() != nil, "expected unknown type error")
+}
@@ -0,0 +1,541 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	etcdUpdateAttempts = 3
+	etcdRangeLimit     = 1000
+)
+
+// EtcdStore is a Store over the keys of an etcd cluster. The value of
+// the key k of bucket b is stored at the etcd key <prefix>b/k, so
+// that the db can be inspected with etcdctl.
+//
+// Transactions read at the revision of their first read. Updates
+// are committed in a single etcd transaction that fails if a key read
+// by the update changed since, and are then run again. Keys listed
+// with ForEach are not checked. An update with more changes than the
+// maximum number of operations of an etcd transaction fails with
+// ErrTooLarge.
+type EtcdStore struct {
+	conf   EtcdConfig
+	client *http.Client
+
+	lock     sync.Mutex
+	token    string
+	endpoint int
+}
+
+// NewEtcdStore returns a store over the etcd cluster of the given
+// configuration.
+func NewEtcdStore(conf EtcdConfig) (*EtcdStore, error) {
+	if conf.Prefix == "" {
+		conf.Prefix = DefaultEtcdPrefix
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = DefaultEtcdTimeout
+	}
+	if conf.MaxTxnOps == 0 {
+		conf.MaxTxnOps = DefaultEtcdMaxTxnOps
+	}
+	for i, e := range conf.Endpoints {
+		conf.Endpoints[i] = strings.TrimSuffix(e, "/")
+	}
+
+	transport := &http.Transport{}
+	if conf.CaFile != "" || conf.CertFile != "" {
+		tlsConfig := &tls.Config{}
+		if conf.CaFile != "" {
+			ca, err := ioutil.ReadFile(conf.CaFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read etcd ca file: %v", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("No certificate found in etcd ca file %v", conf.CaFile)
+			}
+		}
+		if conf.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to load etcd client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &EtcdStore{
+		conf: conf,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(conf.Timeout) * time.Second,
+		},
+	}, nil
+}
+
+func (s *EtcdStore) View(fn func(tx Tx) error) error {
+	return fn(&etcdTx{s: s})
+}
+
+func (s *EtcdStore) Update(fn func(tx Tx) error) error {
+	for i := 0; i < etcdUpdateAttempts; i++ {
+		tx := &etcdTx{
+			s:        s,
+			writable: true,
+			reads:    map[string]etcdInt{},
+			writes:   map[string][]byte{},
+			deletes:  map[string]bool{},
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		err := tx.commit()
+		if err != ErrConflict {
+			return err
+		}
+		logger.Debug("Retrying etcd transaction after a conflict")
+	}
+	return ErrConflict
+}
+
+// MaxTxnChanges returns the maximum number of changes of an update.
+func (s *EtcdStore) MaxTxnChanges() int {
+	return s.conf.MaxTxnOps
+}
+
+func (s *EtcdStore) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *EtcdStore) key(bucket, key string) string {
+	return s.conf.Prefix + bucket + "/" + key
+}
+
+// etcdInt is an int64 of the etcd api, encoded as a string.
+type etcdInt int64
+
+func (i etcdInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(i), 10))
+}
+
+func (i *etcdInt) UnmarshalJSON(b []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = etcdInt(v)
+	return nil
+}
+
+type etcdHeader struct {
+	Revision etcdInt `json:"revision"`
+}
+
+type etcdKV struct {
+	Key         []byte  `json:"key"`
+	Value       []byte  `json:"value"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte  `json:"key"`
+	RangeEnd []byte  `json:"range_end,omitempty"`
+	Limit    etcdInt `json:"limit,omitempty"`
+	Revision etcdInt `json:"revision,omitempty"`
+	KeysOnly bool    `json:"keys_only,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []etcdKV   `json:"kvs"`
+	More   bool       `json:"more"`
+}
+
+type etcdCompare struct {
+	Key         []byte  `json:"key"`
+	Target      string  `json:"target"`
+	Result      string  `json:"result"`
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+type etcdPutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdDeleteRequest struct {
+	Key []byte `json:"key"`
+}
+
+type etcdOp struct {
+	RequestPut         *etcdPutRequest    `json:"request_put,omitempty"`
+	RequestDeleteRange *etcdDeleteRequest `json:"request_delete_range,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []etcdCompare `json:"compare,omitempty"`
+	Success []etcdOp      `json:"success"`
+}
+
+type etcdTxnResponse struct {
+	Header    etcdHeader `json:"header"`
+	Succeeded bool       `json:"succeeded"`
+}
+
+type etcdError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// call posts a request to the JSON gateway of etcd, trying the
+// endpoints in turn until one answers.
+func (s *EtcdStore) call(path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	first, token := s.endpoint, s.token
+	s.lock.Unlock()
+	if token == "" && s.conf.Username != "" {
+		if token, err = s.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for i := 0; i < len(s.conf.Endpoints); i++ {
+		n := (first + i) % len(s.conf.Endpoints)
+		r, err := s.post(s.conf.Endpoints[n]+path, body, token)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		s.lock.Lock()
+		s.endpoint = n
+		s.lock.Unlock()
+
+		if r.StatusCode == http.StatusUnauthorized && s.conf.Username != "" {
+			// the token expired
+			r.Body.Close()
+			if token, err = s.authenticate(); err != nil {
+				return err
+			}
+			if r, err = s.post(s.conf.Endpoints[n]+path, body, token); err != nil {
+				return err
+			}
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			var e etcdError
+			b, _ := ioutil.ReadAll(r.Body)
+			if json.Unmarshal(b, &e) == nil && (e.Message != "" || e.Error != "") {
+				msg := e.Message
+				if msg == "" {
+					msg = e.Error
+				}
+				return fmt.Errorf("etcd request failed: %v", msg)
+			}
+			return fmt.Errorf("etcd request failed: %v", r.Status)
+		}
+		return json.NewDecoder(r.Body).Decode(resp)
+	}
+	return fmt.Errorf("Unable to reach etcd: %v", lastErr)
+}
+
+func (s *EtcdStore) post(url string, body []byte, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return s.client.Do(req)
+}
+
+func (s *EtcdStore) authenticate() (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"name":     s.conf.Username,
+		"password": s.conf.Password,
+	})
+	if err != nil {
+		return "", err
+	}
+	var lastErr error
+	for _, e := range s.conf.Endpoints {
+		r, err := s.post(e+"/v3/auth/authenticate", body, "")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("etcd authentication failed: %v", r.Status)
+		}
+		var resp struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			return "", err
+		}
+		s.lock.Lock()
+		s.token = resp.Token
+		s.lock.Unlock()
+		return resp.Token, nil
+	}
+	return "", fmt.Errorf("Unable to reach etcd: %v", lastErr)
+}
+
+// prefixEnd returns the end of the range of the keys with the given
+// prefix.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// all keys
+	return []byte{0}
+}
+
+type etcdTx struct {
+	s        *EtcdStore
+	writable bool
+	// revision of the reads, set by the first read
+	rev etcdInt
+
+	// the mod revisions of the keys read, and the changes of an
+	// update
+	reads   map[string]etcdInt
+	writes  map[string][]byte
+	deletes map[string]bool
+}
+
+func (t *etcdTx) rangeKeys(req *etcdRangeRequest) (*etcdRangeResponse, error) {
+	req.Revision = t.rev
+	var resp etcdRangeResponse
+	if err := t.s.call("/v3/kv/range", req, &resp); err != nil {
+		return nil, err
+	}
+	if t.rev == 0 {
+		t.rev = resp.Header.Revision
+	}
+	return &resp, nil
+}
+
+// scan returns all keys with the given prefix, and their values
+// unless keysOnly is set.
+func (t *etcdTx) scan(prefix string, keysOnly bool) ([]etcdKV, error) {
+	kvs := []etcdKV{}
+	start := []byte(prefix)
+	end := prefixEnd(prefix)
+	for {
+		resp, err := t.rangeKeys(&etcdRangeRequest{
+			Key:      start,
+			RangeEnd: end,
+			Limit:    etcdRangeLimit,
+			KeysOnly: keysOnly,
+		})
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, resp.Kvs...)
+		if !resp.More || len(resp.Kvs) == 0 {
+			return kvs, nil
+		}
+		start = append(append([]byte{}, resp.Kvs[len(resp.Kvs)-1].Key...), 0)
+	}
+}
+
+func (t *etcdTx) Get(bucket, key string) ([]byte, error) {
+	k := t.s.key(bucket, key)
+	if v, ok := t.writes[k]; ok {
+		return v, nil
+	}
+	if t.deletes[k] {
+		return nil, nil
+	}
+	resp, err := t.rangeKeys(&etcdRangeRequest{Key: []byte(k)})
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	var rev etcdInt
+	if len(resp.Kvs) > 0 {
+		value = resp.Kvs[0].Value
+		rev = resp.Kvs[0].ModRevision
+		if value == nil {
+			value = []byte{}
+		}
+	}
+	if t.writable {
+		t.reads[k] = rev
+	}
+	return value, nil
+}
+
+func (t *etcdTx) Put(bucket, key string, value []byte) error {
+	if !t.writable {
+		return fmt.Errorf("put in a read-only transaction")
+	}
+	k := t.s.key(bucket, key)
+	t.writes[k] = append([]byte{}, value...)
+	delete(t.deletes, k)
+	return nil
+}
+
+func (t *etcdTx) Delete(bucket, key string) error {
+	if !t.writable {
+		return fmt.Errorf("delete in a read-only transaction")
+	}
+	k := t.s.key(bucket, key)
+	t.deletes[k] = true
+	delete(t.writes, k)
+	return nil
+}
+
+func (t *etcdTx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	prefix := t.s.key(bucket, "")
+	kvs, err := t.scan(prefix, false)
+	if err != nil {
+		return err
+	}
+	values := map[string][]byte{}
+	for _, kv := range kvs {
+		values[string(kv.Key)] = kv.Value
+	}
+	for k, v := range t.writes {
+		if strings.HasPrefix(k, prefix) {
+			values[k] = v
+		}
+	}
+	for k := range t.deletes {
+		delete(values, k)
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := values[k]
+		if v == nil {
+			v = []byte{}
+		}
+		if err := fn(strings.TrimPrefix(k, prefix), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *etcdTx) Buckets() ([]string, error) {
+	kvs, err := t.scan(t.s.conf.Prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	add := func(k string) {
+		name := strings.TrimPrefix(k, t.s.conf.Prefix)
+		if i := strings.Index(name, "/"); i > 0 {
+			found[name[:i]] = true
+		}
+	}
+	for _, kv := range kvs {
+		add(string(kv.Key))
+	}
+	for k := range t.writes {
+		add(k)
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (t *etcdTx) commit() error {
+	ops := []etcdOp{}
+	keys := make([]string, 0, len(t.writes))
+	for k := range t.writes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ops = append(ops, etcdOp{RequestPut: &etcdPutRequest{
+			Key:   []byte(k),
+			Value: t.writes[k],
+		}})
+	}
+	keys = keys[:0]
+	for k := range t.deletes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ops = append(ops, etcdOp{RequestDeleteRange: &etcdDeleteRequest{
+			Key: []byte(k),
+		}})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	compares := []etcdCompare{}
+	for k, rev := range t.reads {
+		compares = append(compares, etcdCompare{
+			Key:         []byte(k),
+			Target:      "MOD",
+			Result:      "EQUAL",
+			ModRevision: rev,
+		})
+	}
+	if len(compares) > t.s.conf.MaxTxnOps || len(ops) > t.s.conf.MaxTxnOps {
+		logger.Warning("Etcd transaction of %v reads and %v changes exceeds %v operations",
+			len(compares), len(ops), t.s.conf.MaxTxnOps)
+		return ErrTooLarge
+	}
+
+	var resp etcdTxnResponse
+	err := t.s.call("/v3/kv/txn", &etcdTxnRequest{
+		Compare: compares,
+		Success: ops,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrConflict
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/pkg/idgen"
+)
+
+const (
+	// SyncBucket holds the sync state of the mirror: the id of the
+	// db file in the bolt db and the state of the copy in the store.
+	// It is never copied between them.
+	SyncBucket = "DBSTORE"
+
+	syncFileIdKey = "file_id"
+	syncStateKey  = "state"
+)
+
+var (
+	ErrStoreChanged = errors.New("db store was changed by another writer")
+	ErrNotSynced    = errors.New("db changes are refused until the db store is synced")
+
+	// time between attempts to sync a store that failed
+	retryInterval = 5 * time.Second
+
+	mirrorsLock sync.Mutex
+	mirrors     = map[*bolt.DB]*Mirror{}
+)
+
+type entryKey struct {
+	bucket string
+	key    string
+}
+
+type entryHashes map[entryKey][sha256.Size]byte
+
+// syncState records the db file the store was last written from and
+// the last transaction of the file written.
+type syncState struct {
+	FileId string `json:"file_id"`
+	TxId   int    `json:"tx_id"`
+	// false while a sync split in several store transactions runs
+	Complete bool `json:"complete"`
+}
+
+// Mirror copies the changes of a bolt db to a store. The bolt db is
+// a working copy of the store: all changes are made to the bolt db
+// and the mirror writes them to the store. Once started, the entries
+// recorded by a bolt transaction are written when it commits, before
+// the commit returns. A periodic sync copies any other change.
+//
+// A commit is not undone if writing it to the store fails. Instead the
+// mirror refuses the transactions recording entries until a sync
+// succeeds, so that no more changes are made the store is missing.
+type Mirror struct {
+	db    *bolt.DB
+	store Store
+
+	lock   sync.Mutex
+	fileId string
+	state  *syncState
+	synced entryHashes
+	lastTx int
+	// error of the last write to the store, nil once synced
+	failed error
+	// entries recorded by the running bolt write transaction
+	pendingTx *bolt.Tx
+	pending   map[entryKey]bool
+
+	stop chan interface{}
+	done chan interface{}
+}
+
+func NewMirror(db *bolt.DB, store Store) *Mirror {
+	return &Mirror{
+		db:    db,
+		store: store,
+	}
+}
+
+// Record notes that the write transaction tx changed the entry key
+// of bucket. If the db of tx is mirrored, the entry is written to
+// the store once tx commits. Record fails with ErrNotSynced while the
+// store misses changes of the db, and tx must then be rolled back.
+func Record(tx *bolt.Tx, bucket, key string) error {
+	if !tx.Writable() || bucket == SyncBucket {
+		return nil
+	}
+	mirrorsLock.Lock()
+	m := mirrors[tx.DB()]
+	mirrorsLock.Unlock()
+	if m != nil {
+		return m.record(tx, entryKey{bucket, key})
+	}
+	return nil
+}
+
+func (m *Mirror) record(tx *bolt.Tx, k entryKey) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.failed != nil {
+		return ErrNotSynced
+	}
+	if m.pendingTx != tx {
+		// bolt runs one write transaction at a time. the entries
+		// of one that was rolled back are dropped.
+		m.pendingTx = tx
+		m.pending = map[entryKey]bool{}
+		pending := m.pending
+		txid := tx.ID()
+		tx.OnCommit(func() {
+			m.flush(tx, txid, pending)
+		})
+	}
+	m.pending[k] = true
+	return nil
+}
+
+// flush writes the recorded entries of committed transaction txid to
+// the store. Their current values are read again, so that transactions
+// flushed out of order still leave the latest values in the store.
+func (m *Mirror) flush(tx *bolt.Tx, txid int, pending map[entryKey]bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.pendingTx == tx {
+		m.pendingTx = nil
+		m.pending = nil
+	}
+	if m.synced == nil {
+		return
+	}
+
+	puts := map[entryKey][]byte{}
+	deletes := []entryKey{}
+	err := m.db.View(func(tx *bolt.Tx) error {
+		for k := range pending {
+			var v []byte
+			if b := tx.Bucket([]byte(k.bucket)); b != nil {
+				v = b.Get([]byte(k.key))
+			}
+			if v == nil {
+				if _, ok := m.synced[k]; ok {
+					deletes = append(deletes, k)
+				}
+				continue
+			}
+			if old, ok := m.synced[k]; !ok || old != sha256.Sum256(v) {
+				puts[k] = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = m.write(puts, deletes, txid, false)
+	}
+	if err != nil {
+		logger.LogError("Unable to write db transaction %v to the store, "+
+			"refusing db changes until it is synced: %v", txid, err)
+		m.failed = err
+	}
+}
+
+// Sync writes the changes of the bolt db since the last sync to the
+// store. The first sync compares the bolt db with the store.
+func (m *Mirror) Sync() error {
+	// not under the lock, a running write transaction may be
+	// waiting for it
+	fileId, err := dbFileId(m.db)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	err = m.sync(fileId)
+	if err != nil {
+		m.failed = err
+	} else if m.failed != nil {
+		logger.Info("Db store synced, accepting db changes again")
+		m.failed = nil
+	}
+	return err
+}
+
+func (m *Mirror) sync(fileId string) error {
+	if m.synced == nil {
+		state, err := loadSyncState(m.store)
+		if err != nil {
+			return err
+		}
+		synced, err := storeHashes(m.store)
+		if err != nil {
+			return err
+		}
+		m.fileId = fileId
+		m.state = state
+		m.synced = synced
+		m.lastTx = -1
+	}
+
+	var txid int
+	current := entryHashes{}
+	puts := map[entryKey][]byte{}
+	err := m.db.View(func(tx *bolt.Tx) error {
+		txid = tx.ID()
+		if txid == m.lastTx {
+			return nil
+		}
+		return boltForEach(tx, func(k entryKey, v []byte) error {
+			h := sha256.Sum256(v)
+			current[k] = h
+			if old, ok := m.synced[k]; !ok || old != h {
+				puts[k] = append([]byte{}, v...)
+			}
+			return nil
+		})
+	})
+	if err != nil || txid == m.lastTx {
+		return err
+	}
+	deletes := []entryKey{}
+	for k := range m.synced {
+		if _, ok := current[k]; !ok {
+			deletes = append(deletes, k)
+		}
+	}
+
+	if err := m.write(puts, deletes, txid, m.lastTx == -1); err != nil {
+		return err
+	}
+	m.lastTx = txid
+	return nil
+}
+
+// write copies the changes of bolt transaction txid to the store. The
+// changes are split in as many store transactions as the store needs.
+// Each one checks that the sync state in the store is the one the
+// mirror last wrote, so that an interrupted sync or another writer is
+// detected, and updates it. The sync state is written even without
+// changes if force is set.
+func (m *Mirror) write(puts map[entryKey][]byte, deletes []entryKey,
+	txid int, force bool) error {
+
+	if len(puts) == 0 && len(deletes) == 0 && !force {
+		return nil
+	}
+	keys := make([]entryKey, 0, len(puts)+len(deletes))
+	for k := range puts {
+		keys = append(keys, k)
+	}
+	keys = append(keys, deletes...)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		return keys[i].key < keys[j].key
+	})
+
+	// one change of each store transaction is the sync state
+	size := len(keys)
+	if l, ok := m.store.(txnLimiter); ok && l.MaxTxnChanges()-1 < size {
+		size = l.MaxTxnChanges() - 1
+		if size < 1 {
+			size = 1
+		}
+	}
+	for {
+		n := size
+		if n > len(keys) {
+			n = len(keys)
+		}
+		batch := keys[:n]
+		keys = keys[n:]
+		state := &syncState{
+			FileId:   m.fileId,
+			TxId:     txid,
+			Complete: len(keys) == 0,
+		}
+		err := m.store.Update(func(tx Tx) error {
+			if err := checkSyncState(tx, m.state); err != nil {
+				return err
+			}
+			for _, k := range batch {
+				var err error
+				if v, ok := puts[k]; ok {
+					err = tx.Put(k.bucket, k.key, v)
+				} else {
+					err = tx.Delete(k.bucket, k.key)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return putSyncState(tx, state)
+		})
+		if err != nil {
+			return err
+		}
+		m.state = state
+		for _, k := range batch {
+			if v, ok := puts[k]; ok {
+				m.synced[k] = sha256.Sum256(v)
+			} else {
+				delete(m.synced, k)
+			}
+		}
+		if len(keys) == 0 {
+			break
+		}
+	}
+	logger.Debug("Synced db transaction %v to the store: %v changed, %v removed",
+		txid, len(puts), len(deletes))
+	return nil
+}
+
+// Start writes the entries recorded by bolt transactions to the store
+// as they commit and creates a background goroutine syncing the bolt
+// db to the store at the given interval.
+func (m *Mirror) Start(interval time.Duration) {
+	mirrorsLock.Lock()
+	mirrors[m.db] = m
+	mirrorsLock.Unlock()
+
+	stop := make(chan interface{})
+	done := make(chan interface{})
+	m.stop = stop
+	m.done = done
+
+	go func() {
+		logger.Info("Started db store sync")
+		defer close(done)
+		for {
+			wait := interval
+			if m.Failed() != nil && retryInterval < wait {
+				wait = retryInterval
+			}
+			select {
+			case <-stop:
+				logger.Info("Stopping db store sync")
+				return
+			case <-time.After(wait):
+			}
+			if err := m.Sync(); err != nil {
+				logger.LogError("Unable to sync db to the store: %v", err)
+			}
+		}
+	}()
+}
+
+// Failed returns the error of the last write to the store if the
+// store misses changes of the db, nil otherwise.
+func (m *Mirror) Failed() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.failed
+}
+
+// Stop the background sync and write the last changes to the store.
+func (m *Mirror) Stop() {
+	mirrorsLock.Lock()
+	if mirrors[m.db] == m {
+		delete(mirrors, m.db)
+	}
+	mirrorsLock.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+	if err := m.Sync(); err != nil {
+		logger.LogError("Unable to sync db to the store: %v", err)
+	}
+}
+
+// dbFileId returns the id of the bolt db file, created on first use.
+func dbFileId(db *bolt.DB) (string, error) {
+	var id string
+	err := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(SyncBucket)); b != nil {
+			id = string(b.Get([]byte(syncFileIdKey)))
+		}
+		return nil
+	})
+	if err != nil || id != "" {
+		return id, err
+	}
+	id = idgen.GenUUID()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(SyncBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(syncFileIdKey), []byte(id))
+	})
+	return id, err
+}
+
+func loadSyncState(s Store) (*syncState, error) {
+	var state *syncState
+	err := s.View(func(tx Tx) error {
+		var err error
+		state, err = getSyncState(tx)
+		return err
+	})
+	return state, err
+}
+
+func getSyncState(tx Tx) (*syncState, error) {
+	v, err := tx.Get(SyncBucket, syncStateKey)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	state := &syncState{}
+	if err := json.Unmarshal(v, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func putSyncState(tx Tx, state *syncState) error {
+	v, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return tx.Put(SyncBucket, syncStateKey, v)
+}
+
+// checkSyncState returns ErrStoreChanged if the sync state of the
+// store is not the expected one.
+func checkSyncState(tx Tx, expected *syncState) error {
+	state, err := getSyncState(tx)
+	if err != nil {
+		return err
+	}
+	if (state == nil) != (expected == nil) ||
+		(state != nil && *state != *expected) {
+		return ErrStoreChanged
+	}
+	return nil
+}
+
+// Unsynced returns true if the bolt db holds changes missing from the
+// store: the store was last written from this db file, at an earlier
+// transaction or by a sync that did not complete.
+func Unsynced(db *bolt.DB, s Store) (bool, error) {
+	state, err := loadSyncState(s)
+	if err != nil || state == nil {
+		return false, err
+	}
+	var (
+		fileId string
+		txid   int
+	)
+	err = db.View(func(tx *bolt.Tx) error {
+		txid = tx.ID()
+		if b := tx.Bucket([]byte(SyncBucket)); b != nil {
+			fileId = string(b.Get([]byte(syncFileIdKey)))
+		}
+		return nil
+	})
+	if err != nil || fileId == "" || fileId != state.FileId {
+		return false, err
+	}
+	return txid > state.TxId || !state.Complete, nil
+}
+
+// IsEmpty returns true if the store holds no entries.
+func IsEmpty(s Store) (bool, error) {
+	empty := true
+	err := s.View(func(tx Tx) error {
+		buckets, err := tx.Buckets()
+		for _, name := range buckets {
+			if name != SyncBucket {
+				empty = false
+			}
+		}
+		return err
+	})
+	return empty, err
+}
+
+// Load replaces the content of the bolt db with the content of the
+// store. The bolt db becomes a new db file.
+func Load(db *bolt.DB, s Store) error {
+	return s.View(func(stx Tx) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			names := [][]byte{}
+			err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				names = append(names, append([]byte{}, name...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+
+			buckets, err := stx.Buckets()
+			if err != nil {
+				return err
+			}
+			for _, name := range buckets {
+				if name == SyncBucket {
+					continue
+				}
+				b, err := tx.CreateBucket([]byte(name))
+				if err != nil {
+					return err
+				}
+				err = stx.ForEach(name, func(key string, value []byte) error {
+					return b.Put([]byte(key), append([]byte{}, value...))
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Diff returns the number of entries that differ between the bolt db
+// and the store.
+func Diff(db *bolt.DB, s Store) (int, error) {
+	stored, err := storeHashes(s)
+	if err != nil {
+		return 0, err
+	}
+	diff := 0
+	err = db.View(func(tx *bolt.Tx) error {
+		return boltForEach(tx, func(k entryKey, v []byte) error {
+			if h, ok := stored[k]; !ok || h != sha256.Sum256(v) {
+				diff++
+			}
+			delete(stored, k)
+			return nil
+		})
+	})
+	return diff + len(stored), err
+}
+
+func storeHashes(s Store) (entryHashes, error) {
+	hashes := entryHashes{}
+	err := s.View(func(tx Tx) error {
+		buckets, err := tx.Buckets()
+		if err != nil {
+			return err
+		}
+		for _, name := range buckets {
+			if name == SyncBucket {
+				continue
+			}
+			err := tx.ForEach(name, func(key string, value []byte) error {
+				hashes[entryKey{name, key}] = sha256.Sum256(value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func boltForEach(tx *bolt.Tx, fn func(k entryKey, v []byte) error) error {
+	return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if string(name) == SyncBucket {
+			return nil
+		}
+		return b.ForEach(func(key, value []byte) error {
+			// nested buckets are not entries
+			if value == nil {
+				return nil
+			}
+			return fn(entryKey{string(name), string(key)}, value)
+		})
+	})
+}
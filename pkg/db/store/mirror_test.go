@@ -0,0 +1,364 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+// testMirrorStore is a bolt store counting its updates and the keys
+// they write, limited to maxChanges changes per update if set. Its
+// updates fail with fail if set.
+type testMirrorStore struct {
+	*BoltStore
+	maxChanges int
+	updates    int
+	written    map[string]int
+	fail       error
+}
+
+type testMirrorTx struct {
+	Tx
+	s *testMirrorStore
+}
+
+func newTestMirrorStore(t *testing.T) (*testMirrorStore, func()) {
+	db, cleanup := newTestBoltDB(t)
+	return &testMirrorStore{
+		BoltStore: NewBoltStore(db),
+		written:   map[string]int{},
+	}, cleanup
+}
+
+func (s *testMirrorStore) Update(fn func(tx Tx) error) error {
+	if s.fail != nil {
+		return s.fail
+	}
+	s.updates++
+	return s.BoltStore.Update(func(tx Tx) error {
+		return fn(&testMirrorTx{tx, s})
+	})
+}
+
+func (s *testMirrorStore) MaxTxnChanges() int {
+	if s.maxChanges == 0 {
+		return math.MaxInt32
+	}
+	return s.maxChanges
+}
+
+func (t *testMirrorTx) Put(bucket, key string, value []byte) error {
+	t.s.written[bucket+"/"+key]++
+	return t.Tx.Put(bucket, key, value)
+}
+
+func (s *testMirrorStore) get(t *testing.T, bucket, key string) []byte {
+	var value []byte
+	err := s.View(func(tx Tx) error {
+		v, err := tx.Get(bucket, key)
+		value = append([]byte{}, v...)
+		if v == nil {
+			value = nil
+		}
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return value
+}
+
+func boltPut(t *testing.T, db *bolt.DB, bucket, key, value string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return b.Delete([]byte(key))
+		}
+		return b.Put([]byte(key), []byte(value))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+// boltRecordPut changes a key and records it, as the entries of the
+// app are saved.
+func boltRecordPut(t *testing.T, db *bolt.DB, bucket, key, value string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			err = b.Delete([]byte(key))
+		} else {
+			err = b.Put([]byte(key), []byte(value))
+		}
+		if err != nil {
+			return err
+		}
+		return Record(tx, bucket, key)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestMirrorSync(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	empty, err := IsEmpty(s)
+	tests.Assert(t, err == nil && empty, "expected empty store, got:", empty, err)
+
+	boltPut(t, db, "VOLUME", "v1", "a")
+	boltPut(t, db, "VOLUME", "v2", "b")
+	boltPut(t, db, "NODE", "n1", "c")
+
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+	n, err := Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+	empty, err = IsEmpty(s)
+	tests.Assert(t, err == nil && !empty, "expected store with entries, got:", empty, err)
+
+	// nothing to do without a new bolt transaction
+	updates := s.updates
+	tests.Assert(t, m.Sync() == nil)
+	tests.Assert(t, s.updates == updates, "expected no update, got:", s.updates-updates)
+
+	// only the changes are written
+	boltPut(t, db, "VOLUME", "v1", "changed")
+	boltPut(t, db, "VOLUME", "v2", "")
+	tests.Assert(t, m.Sync() == nil)
+	tests.Assert(t, string(s.get(t, "VOLUME", "v1")) == "changed")
+	tests.Assert(t, s.get(t, "VOLUME", "v2") == nil, "expected v2 removed")
+	tests.Assert(t, s.written["NODE/n1"] == 1, "expected n1 not rewritten")
+	tests.Assert(t, s.updates == updates+1, "expected one update, got:", s.updates-updates)
+
+	// stop writes the last changes
+	m.Start(time.Hour)
+	boltPut(t, db, "CLUSTER", "c1", "d")
+	m.Stop()
+	n, err = Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+}
+
+func TestMirrorWriteOnCommit(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	boltPut(t, db, "VOLUME", "v1", "a")
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+	m.Start(time.Hour)
+	defer m.Stop()
+
+	// recorded changes are in the store once the commit returns
+	boltRecordPut(t, db, "VOLUME", "v2", "b")
+	tests.Assert(t, string(s.get(t, "VOLUME", "v2")) == "b")
+	boltRecordPut(t, db, "VOLUME", "v1", "")
+	tests.Assert(t, s.get(t, "VOLUME", "v1") == nil, "expected v1 removed")
+
+	// the changes of a rolled back transaction are not written
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("VOLUME"))
+		tests.Assert(t, b.Put([]byte("v3"), []byte("c")) == nil)
+		tests.Assert(t, Record(tx, "VOLUME", "v3") == nil)
+		return fmt.Errorf("rollback")
+	})
+	tests.Assert(t, err != nil, "expected rollback")
+	boltRecordPut(t, db, "VOLUME", "v4", "d")
+	tests.Assert(t, s.get(t, "VOLUME", "v3") == nil, "expected no v3")
+	tests.Assert(t, s.get(t, "VOLUME", "v4") != nil, "expected v4")
+
+	// the store holds the file and transaction last written
+	unsynced, err := Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+
+	// changes not recorded are written by the next sync
+	boltPut(t, db, "NODE", "n1", "e")
+	unsynced, err = Unsynced(db, s)
+	tests.Assert(t, err == nil && unsynced, "got:", unsynced, err)
+	tests.Assert(t, m.Sync() == nil)
+	n, err := Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+	unsynced, err = Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+
+	// transactions of other dbs are not written
+	other, cleanupOther := newTestBoltDB(t)
+	defer cleanupOther()
+	boltRecordPut(t, other, "VOLUME", "o1", "f")
+	tests.Assert(t, s.get(t, "VOLUME", "o1") == nil, "expected no o1")
+	unsynced, err = Unsynced(other, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+}
+
+func TestMirrorRefusesChangesUntilSynced(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+	m.Start(time.Hour)
+	defer m.Stop()
+
+	// a commit that can not be written is kept in the db
+	s.fail = fmt.Errorf("etcd unreachable")
+	boltRecordPut(t, db, "VOLUME", "v1", "a")
+	tests.Assert(t, m.Failed() == s.fail, "got:", m.Failed())
+	tests.Assert(t, s.get(t, "VOLUME", "v1") == nil, "expected no v1")
+
+	// but no other change is made until the store is synced
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("VOLUME"))
+		tests.Assert(t, b.Put([]byte("v2"), []byte("b")) == nil)
+		return Record(tx, "VOLUME", "v2")
+	})
+	tests.Assert(t, err == ErrNotSynced, "expected ErrNotSynced, got:", err)
+	tests.Assert(t, m.Sync() == s.fail, "expected sync to fail")
+	tests.Assert(t, m.Failed() != nil, "expected mirror failed")
+
+	s.fail = nil
+	tests.Assert(t, m.Sync() == nil)
+	tests.Assert(t, m.Failed() == nil, "got:", m.Failed())
+	tests.Assert(t, string(s.get(t, "VOLUME", "v1")) == "a")
+	boltRecordPut(t, db, "VOLUME", "v2", "b")
+	tests.Assert(t, string(s.get(t, "VOLUME", "v2")) == "b")
+	db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte("VOLUME")).Get([]byte("v2"))
+		tests.Assert(t, string(v) == "b", "got:", v)
+		return nil
+	})
+}
+
+func TestMirrorBatches(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+	s.maxChanges = 4
+
+	for i := 0; i < 9; i++ {
+		boltPut(t, db, "VOLUME", fmt.Sprintf("v%v", i), "a")
+	}
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+	tests.Assert(t, s.updates == 3, "expected 3 updates, got:", s.updates)
+	n, err := Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+
+	state, err := loadSyncState(s)
+	tests.Assert(t, err == nil && state.Complete, "got:", state, err)
+}
+
+func TestMirrorOtherWriter(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	boltPut(t, db, "VOLUME", "v1", "a")
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+
+	// another heketi syncs its own db to the same store
+	other, cleanupOther := newTestBoltDB(t)
+	defer cleanupOther()
+	tests.Assert(t, Load(other, s) == nil)
+	boltPut(t, other, "VOLUME", "v2", "b")
+	tests.Assert(t, NewMirror(other, s).Sync() == nil)
+
+	// the first mirror no longer writes over it, nor accepts changes
+	m.Start(time.Hour)
+	defer m.Stop()
+	boltPut(t, db, "VOLUME", "v1", "changed")
+	err := m.Sync()
+	tests.Assert(t, err == ErrStoreChanged, "expected ErrStoreChanged, got:", err)
+	tests.Assert(t, string(s.get(t, "VOLUME", "v1")) == "a")
+	tests.Assert(t, s.get(t, "VOLUME", "v2") != nil, "expected v2")
+	err = db.Update(func(tx *bolt.Tx) error {
+		return Record(tx, "VOLUME", "v1")
+	})
+	tests.Assert(t, err == ErrNotSynced, "expected ErrNotSynced, got:", err)
+
+	// and its db file is not the last written
+	unsynced, err := Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+}
+
+func TestMirrorInterruptedSync(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	boltPut(t, db, "VOLUME", "v1", "a")
+	m := NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+
+	// a sync stopped between two store transactions
+	state, err := loadSyncState(s)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	state.Complete = false
+	err = s.Update(func(tx Tx) error {
+		return putSyncState(tx, state)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	unsynced, err := Unsynced(db, s)
+	tests.Assert(t, err == nil && unsynced, "got:", unsynced, err)
+}
+
+func TestMirrorLoad(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	s, cleanupStore := newTestMirrorStore(t)
+	defer cleanupStore()
+
+	err := s.Update(func(tx Tx) error {
+		tx.Put("VOLUME", "v1", []byte("a"))
+		tx.Put("NODE", "n1", []byte("b"))
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	boltPut(t, db, "VOLUME", "stale", "x")
+	boltPut(t, db, "DEVICE", "d1", "y")
+
+	n, err := Diff(db, s)
+	tests.Assert(t, err == nil && n == 4, "expected 4 differences, got:", n, err)
+
+	tests.Assert(t, Load(db, s) == nil)
+	n, err = Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+	db.View(func(tx *bolt.Tx) error {
+		tests.Assert(t, tx.Bucket([]byte("DEVICE")) == nil, "expected DEVICE removed")
+		v := tx.Bucket([]byte("VOLUME")).Get([]byte("v1"))
+		tests.Assert(t, string(v) == "a", "got:", v)
+		return nil
+	})
+
+	// a mirror of a loaded db only records its file in the store
+	m := NewMirror(db, s)
+	updates := s.updates
+	tests.Assert(t, m.Sync() == nil)
+	tests.Assert(t, s.updates == updates+1, "expected one update, got:", s.updates-updates)
+	tests.Assert(t, s.written["VOLUME/v1"] == 1, "expected v1 not rewritten")
+}
@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/heketi/heketi/v10/pkg/logging"
+)
+
+var (
+	logger = logging.NewLogger("[dbstore]", logging.LEVEL_INFO)
+
+	ErrConflict = errors.New("transaction conflicts with a concurrent update")
+	ErrTooLarge = errors.New("transaction has more changes than the store allows")
+)
+
+// Store is a transactional key value store with the layout of the
+// heketi db: entries are stored under a key in a bucket. Heketi still
+// reads and writes its entries in the bolt db; a Store holds the copy
+// of the bolt db kept by a Mirror.
+type Store interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(tx Tx) error) error
+	// Update runs fn in a read-write transaction, committed if fn
+	// returns nil.
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+// txnLimiter is implemented by stores limiting the number of changes
+// of a transaction. Larger updates fail with ErrTooLarge.
+type txnLimiter interface {
+	MaxTxnChanges() int
+}
+
+// Tx is a transaction of a Store. Values returned by a transaction
+// are only valid until the end of the transaction.
+type Tx interface {
+	// Get returns the value of a key, or nil if there is none.
+	Get(bucket, key string) ([]byte, error)
+	// Put sets the value of a key, creating the bucket if needed.
+	Put(bucket, key string, value []byte) error
+	// Delete removes a key. Removing a missing key is not an error.
+	Delete(bucket, key string) error
+	// ForEach calls fn for all keys of a bucket, in key order.
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	// Buckets returns the names of all buckets holding keys.
+	Buckets() ([]string, error)
+}
+
+// BoltStore is a Store over a bolt db.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(db *bolt.DB) *BoltStore {
+	return &BoltStore{db: db}
+}
+
+func (s *BoltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+// Close does nothing, the bolt db belongs to the caller.
+func (s *BoltStore) Close() error {
+	return nil
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Get(bucket, key string) ([]byte, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, nil
+	}
+	return b.Get([]byte(key)), nil
+}
+
+func (t *boltTx) Put(bucket, key string, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), value)
+}
+
+func (t *boltTx) Delete(bucket, key string) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(key))
+}
+
+func (t *boltTx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		// nested buckets are not entries
+		if v == nil {
+			return nil
+		}
+		return fn(string(k), v)
+	})
+}
+
+func (t *boltTx) Buckets() ([]string, error) {
+	names := []string{}
+	err := t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		names = append(names, string(name))
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,97 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func newTestBoltDB(t *testing.T) (*bolt.DB, func()) {
+	dbfile := tests.Tempfile()
+	db, err := bolt.Open(dbfile, 0600, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return db, func() {
+		db.Close()
+		os.Remove(dbfile)
+	}
+}
+
+// testStore checks the behavior common to all stores.
+func testStore(t *testing.T, s Store) {
+	err := s.View(func(tx Tx) error {
+		v, err := tx.Get("VOLUME", "v1")
+		tests.Assert(t, err == nil && v == nil, "expected no value, got:", v, err)
+		buckets, err := tx.Buckets()
+		tests.Assert(t, err == nil && len(buckets) == 0, "got:", buckets, err)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.Update(func(tx Tx) error {
+		for _, k := range []string{"v2", "v1", "v3"} {
+			if err := tx.Put("VOLUME", k, []byte("data-"+k)); err != nil {
+				return err
+			}
+		}
+		return tx.Put("NODE", "n1", []byte{})
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a failed update changes nothing
+	err = s.Update(func(tx Tx) error {
+		tx.Put("VOLUME", "v4", []byte("data-v4"))
+		return fmt.Errorf("failed")
+	})
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	err = s.Update(func(tx Tx) error {
+		if err := tx.Delete("VOLUME", "v2"); err != nil {
+			return err
+		}
+		return tx.Delete("CLUSTER", "missing")
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.View(func(tx Tx) error {
+		v, err := tx.Get("VOLUME", "v1")
+		tests.Assert(t, err == nil && string(v) == "data-v1", "got:", v, err)
+		v, err = tx.Get("NODE", "n1")
+		tests.Assert(t, err == nil && v != nil && len(v) == 0,
+			"expected empty value, got:", v, err)
+
+		keys := []string{}
+		err = tx.ForEach("VOLUME", func(k string, v []byte) error {
+			tests.Assert(t, string(v) == "data-"+k, "got:", k, v)
+			keys = append(keys, k)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(keys) == 2 && keys[0] == "v1" && keys[1] == "v3",
+			"expected v1 v3, got:", keys)
+
+		buckets, err := tx.Buckets()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(buckets) == 2 && buckets[0] == "NODE" && buckets[1] == "VOLUME",
+			"got:", buckets)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestBoltStore(t *testing.T) {
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+	testStore(t, NewBoltStore(db))
+}
@@ -18,8 +18,11 @@ package api
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
@@ -37,6 +40,16 @@ var (
 	blockVolNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
 	tagNameRe = regexp.MustCompile("^[a-zA-Z0-9_.-]+$")
+
+	idempotencyKeyRe = regexp.MustCompile("^[a-zA-Z0-9_.:-]+$")
+
+	profileNameRe = regexp.MustCompile("^[a-zA-Z0-9_-]{1,64}$")
+)
+
+const (
+	// IdempotencyKeyHeader is the http header that can be used
+	// instead of the IdempotencyKey field of create requests.
+	IdempotencyKeyHeader = "Idempotency-Key"
 )
 
 // ValidateUUID is written this way because heketi UUID does not
@@ -50,6 +63,21 @@ func ValidateUUID(value interface{}) error {
 	return nil
 }
 
+// ValidateIdempotencyKey checks that an optional idempotency key
+// is of reasonable length and made of url safe characters.
+func ValidateIdempotencyKey(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	err := validation.Validate(s, validation.RuneLength(1, 128),
+		validation.Match(idempotencyKeyRe))
+	if err != nil {
+		return fmt.Errorf("%v is not a valid idempotency key", s)
+	}
+	return nil
+}
+
 // State
 type EntryState string
 
@@ -208,10 +236,33 @@ type DeviceInfo struct {
 	PvUUID  string      `json:"pv_uuid,omitempty"`
 }
 
+// DeviceDrift records the difference between the free space heketi
+// tracks for a device and the free space reported by the device's VG.
+type DeviceDrift struct {
+	// FreeDiff is the actual free size minus the tracked free size in KB
+	FreeDiff int64 `json:"free_diff"`
+	// LastCheck is the time of the last check in seconds since the epoch
+	LastCheck int64 `json:"last_check"`
+}
+
+// ArbiterInodes estimates the number of files the arbiter bricks of
+// a device can hold, against the number of files expected from the
+// size of their data bricks and the average file size.
+type ArbiterInodes struct {
+	Capacity uint64 `json:"capacity"`
+	Expected uint64 `json:"expected"`
+	// lowest percent of the capacity left over the arbiter bricks of
+	// the device, negative if more files are expected than fit
+	Headroom int64 `json:"headroom_percent"`
+}
+
 type DeviceInfoResponse struct {
 	DeviceInfo
-	State  EntryState  `json:"state"`
-	Bricks []BrickInfo `json:"bricks"`
+	State         EntryState     `json:"state"`
+	Bricks        []BrickInfo    `json:"bricks"`
+	Drift         *DeviceDrift   `json:"drift,omitempty"`
+	ArbiterInodes *ArbiterInodes `json:"arbiter_inodes,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"`
 }
 
 // Node
@@ -242,6 +293,13 @@ type NodeInfoResponse struct {
 	DevicesInfo []DeviceInfoResponse `json:"devices"`
 }
 
+// NodeSshHostKeyResponse describes the ssh host key pinned for a
+// node. Key is empty if no key is pinned.
+type NodeSshHostKeyResponse struct {
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
 // Cluster
 
 type ClusterFlags struct {
@@ -264,10 +322,16 @@ type TopologyInfoResponse struct {
 
 type ClusterCreateRequest struct {
 	ClusterFlags
+	// default average file size in KiB for sizing the arbiter bricks
+	// of the volumes of the cluster
+	AverageFileSize uint64 `json:"average_file_size_kb,omitempty"`
 }
 
 type ClusterSetFlagsRequest struct {
 	ClusterFlags
+	// if set, replaces the default average file size of the cluster,
+	// zero clears it
+	AverageFileSize *uint64 `json:"average_file_size_kb,omitempty"`
 }
 
 type ClusterInfoResponse struct {
@@ -275,11 +339,132 @@ type ClusterInfoResponse struct {
 	Nodes   sort.StringSlice `json:"nodes"`
 	Volumes sort.StringSlice `json:"volumes"`
 	ClusterFlags
-	BlockVolumes sort.StringSlice `json:"blockvolumes"`
+	BlockVolumes    sort.StringSlice `json:"blockvolumes"`
+	AverageFileSize uint64           `json:"average_file_size_kb,omitempty"`
 }
 
 type ClusterListResponse struct {
 	Clusters []string `json:"clusters"`
+	// Details holds the information of the listed clusters when
+	// requested with ListQuery.Detail.
+	Details []ClusterInfoResponse `json:"details,omitempty"`
+	// Next is the cursor of the next page, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// Query parameters of the list requests.
+const (
+	ListQueryCluster    = "cluster"
+	ListQueryNamePrefix = "name_prefix"
+	ListQueryMinSize    = "min_size"
+	ListQueryMaxSize    = "max_size"
+	ListQueryDurability = "durability"
+	ListQuerySelector   = "selector"
+	ListQueryLimit      = "limit"
+	ListQueryCursor     = "cursor"
+	ListQueryDetail     = "detail"
+)
+
+// ListQuery holds the filters, the page and the level of detail of
+// the volume, block volume and cluster list requests. Lists are
+// sorted by id. The zero value lists all the ids in one page.
+type ListQuery struct {
+	// Cluster only lists the volumes of this cluster
+	Cluster string
+	// NamePrefix only lists the volumes whose name starts with it
+	NamePrefix string
+	// MinSize and MaxSize, in GiB, only list the volumes within the
+	// range. Zero means no bound.
+	MinSize int
+	MaxSize int
+	// Durability only lists the file volumes of this durability type
+	Durability DurabilityType
+	// Selector only lists the volumes whose tags match it, such as
+	// "namespace=ns1,!archived"
+	Selector string
+	// Limit is the maximum number of items of a page. Zero means no
+	// limit.
+	Limit int
+	// Cursor is the Next field of the previous page
+	Cursor string
+	// Detail requests the information of the items along with ids
+	Detail bool
+}
+
+// Values returns the query parameters of the request.
+func (q ListQuery) Values() url.Values {
+	v := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			v.Set(name, value)
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			v.Set(name, strconv.Itoa(value))
+		}
+	}
+	set(ListQueryCluster, q.Cluster)
+	set(ListQueryNamePrefix, q.NamePrefix)
+	setInt(ListQueryMinSize, q.MinSize)
+	setInt(ListQueryMaxSize, q.MaxSize)
+	set(ListQueryDurability, string(q.Durability))
+	set(ListQuerySelector, q.Selector)
+	setInt(ListQueryLimit, q.Limit)
+	set(ListQueryCursor, q.Cursor)
+	if q.Detail {
+		v.Set(ListQueryDetail, "true")
+	}
+	return v
+}
+
+// ParseListQuery parses the query parameters of a list request.
+func ParseListQuery(v url.Values) (ListQuery, error) {
+	q := ListQuery{
+		Cluster:    v.Get(ListQueryCluster),
+		NamePrefix: v.Get(ListQueryNamePrefix),
+		Durability: DurabilityType(v.Get(ListQueryDurability)),
+		Selector:   v.Get(ListQuerySelector),
+		Cursor:     v.Get(ListQueryCursor),
+	}
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{ListQueryMinSize, &q.MinSize},
+		{ListQueryMaxSize, &q.MaxSize},
+		{ListQueryLimit, &q.Limit},
+	}
+	for _, i := range ints {
+		if s := v.Get(i.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return q, fmt.Errorf("%v: %q is not a number", i.name, s)
+			}
+			*i.value = n
+		}
+	}
+	if s := v.Get(ListQueryDetail); s != "" {
+		d, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("%v: %q is not a boolean", ListQueryDetail, s)
+		}
+		q.Detail = d
+	}
+	return q, nil
+}
+
+func (q ListQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Cluster, validation.When(q.Cluster != "",
+			validation.By(ValidateUUID))),
+		validation.Field(&q.MinSize, validation.Min(0)),
+		validation.Field(&q.MaxSize, validation.Min(0),
+			validation.When(q.MaxSize != 0, validation.Min(q.MinSize))),
+		validation.Field(&q.Durability, validation.When(q.Durability != "",
+			validation.By(ValidateDurabilityType))),
+		validation.Field(&q.Limit, validation.Min(0)),
+	)
 }
 
 // Durabilities
@@ -290,6 +475,10 @@ type ReplicaDurability struct {
 type DisperseDurability struct {
 	Data       int `json:"data,omitempty"`
 	Redundancy int `json:"redundancy,omitempty"`
+	// Auto requests the server to choose the geometry of the volume
+	// from the failure domains of the cluster. Redundancy is then the
+	// minimum redundancy and Data must be left unset.
+	Auto bool `json:"auto,omitempty"`
 }
 
 // Volume
@@ -312,6 +501,41 @@ type VolumeCreateRequest struct {
 		Enable bool    `json:"enable"`
 		Factor float32 `json:"factor"`
 	} `json:"snapshot"`
+	// IdempotencyKey makes retries of the request return the volume
+	// created by the first request. See IdempotencyKeyHeader.
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	// Profile names the placement profile the volume is created with.
+	// See PlacementProfile.
+	Profile string `json:"profile,omitempty"`
+	// AntiAffinity keeps the bricks of the volume off the nodes, or
+	// devices, used by other volumes.
+	AntiAffinity *VolumeAntiAffinity `json:"anti_affinity,omitempty"`
+}
+
+const (
+	AntiAffinityScopeNode   = "node"
+	AntiAffinityScopeDevice = "device"
+)
+
+// VolumeAntiAffinity names the volumes that a volume must not share
+// nodes, or devices, with. The volumes are given by id or selected by
+// their tags, with a comma separated list of requirements such as
+// "app=db,role!=test". The rule is symmetric: volumes placed later
+// also avoid the volumes that select them.
+type VolumeAntiAffinity struct {
+	Volumes  []string `json:"volumes,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+	// Scope is either "node", the default, or "device"
+	Scope string `json:"scope,omitempty"`
+}
+
+func (a VolumeAntiAffinity) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Volumes, validation.Each(validation.By(ValidateUUID))),
+		validation.Field(&a.Scope,
+			validation.In(AntiAffinityScopeNode, AntiAffinityScopeDevice)),
+	)
 }
 
 func (volCreateRequest VolumeCreateRequest) Validate() error {
@@ -323,12 +547,49 @@ func (volCreateRequest VolumeCreateRequest) Validate() error {
 		validation.Field(&volCreateRequest.Gid, validation.Skip),
 		validation.Field(&volCreateRequest.GlusterVolumeOptions, validation.Skip),
 		validation.Field(&volCreateRequest.Block, validation.In(true, false)),
+		validation.Field(&volCreateRequest.IdempotencyKey, validation.By(ValidateIdempotencyKey)),
+		validation.Field(&volCreateRequest.Tags, validation.By(ValidateTags)),
+		validation.Field(&volCreateRequest.Profile, validation.Match(profileNameRe)),
+		validation.Field(&volCreateRequest.AntiAffinity),
 		// This is possibly a bug in validation lib, ignore next two lines for now
 		// validation.Field(&volCreateRequest.Snapshot.Enable, validation.In(true, false)),
 		// validation.Field(&volCreateRequest.Snapshot.Factor, validation.Min(1.0)),
 	)
 }
 
+// PlacementProfile is a named set of placement settings stored by the
+// server. Volumes created with a profile get the settings of the
+// profile as volume options, and its durability unless the request
+// sets one.
+type PlacementProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// TagMatch is a device tag matching rule, such as "disk=ssd"
+	TagMatch string `json:"tag_match,omitempty"`
+	// ZoneChecking is the zone checking strategy: "none" or "strict"
+	ZoneChecking string               `json:"zone_checking,omitempty"`
+	Durability   VolumeDurabilityInfo `json:"durability,omitempty"`
+	// limits of the size of the bricks, within those of the server
+	BrickMinSizeGb       int      `json:"brick_min_size_gb,omitempty"`
+	BrickMaxSizeGb       int      `json:"brick_max_size_gb,omitempty"`
+	GlusterVolumeOptions []string `json:"glustervolumeoptions,omitempty"`
+}
+
+func (p PlacementProfile) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.Required, validation.Match(profileNameRe)),
+		validation.Field(&p.ZoneChecking, validation.In("none", "strict")),
+		validation.Field(&p.Durability, validation.Skip),
+		validation.Field(&p.BrickMinSizeGb, validation.Min(0)),
+		validation.Field(&p.BrickMaxSizeGb, validation.Min(0),
+			validation.When(p.BrickMaxSizeGb != 0, validation.Min(p.BrickMinSizeGb))),
+	)
+}
+
+type PlacementProfileListResponse struct {
+	Profiles []PlacementProfile `json:"profiles"`
+}
+
 type BlockRestriction string
 
 const (
@@ -377,6 +638,11 @@ type VolumeInfoResponse struct {
 
 type VolumeListResponse struct {
 	Volumes []string `json:"volumes"`
+	// Details holds the information of the listed volumes when
+	// requested with ListQuery.Detail.
+	Details []VolumeInfoResponse `json:"details,omitempty"`
+	// Next is the cursor of the next page, empty on the last page.
+	Next string `json:"next,omitempty"`
 }
 
 type VolumeExpandRequest struct {
@@ -418,6 +684,10 @@ type BlockVolumeCreateRequest struct {
 	Name     string   `json:"name"`
 	Hacount  int      `json:"hacount,omitempty"`
 	Auth     bool     `json:"auth,omitempty"`
+	// IdempotencyKey makes retries of the request return the block
+	// volume created by the first request. See IdempotencyKeyHeader.
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
 }
 
 func (blockVolCreateReq BlockVolumeCreateRequest) Validate() error {
@@ -427,6 +697,8 @@ func (blockVolCreateReq BlockVolumeCreateRequest) Validate() error {
 		validation.Field(&blockVolCreateReq.Name, validation.Match(blockVolNameRe)),
 		validation.Field(&blockVolCreateReq.Hacount, validation.Min(1)),
 		validation.Field(&blockVolCreateReq.Auth, validation.Skip),
+		validation.Field(&blockVolCreateReq.IdempotencyKey, validation.By(ValidateIdempotencyKey)),
+		validation.Field(&blockVolCreateReq.Tags, validation.By(ValidateTags)),
 	)
 }
 
@@ -454,6 +726,11 @@ type BlockVolumeInfoResponse struct {
 
 type BlockVolumeListResponse struct {
 	BlockVolumes []string `json:"blockvolumes"`
+	// Details holds the information of the listed block volumes when
+	// requested with ListQuery.Detail.
+	Details []BlockVolumeInfoResponse `json:"details,omitempty"`
+	// Next is the cursor of the next page, empty on the last page.
+	Next string `json:"next,omitempty"`
 }
 
 type BlockVolumeExpandRequest struct {
@@ -564,6 +841,9 @@ func (v *VolumeInfoResponse) String() string {
 			"Disperse Redundancy: %v\n",
 			v.Durability.Disperse.Data,
 			v.Durability.Disperse.Redundancy)
+		if v.Durability.Disperse.Auto {
+			s += "Disperse Geometry: auto\n"
+		}
 	case DurabilityReplicate:
 		s += fmt.Sprintf("Distributed+Replica: %v\n",
 			v.Durability.Replicate.Replica)
@@ -573,6 +853,39 @@ func (v *VolumeInfoResponse) String() string {
 		s += fmt.Sprintf("Snapshot Factor: %.2f\n",
 			v.Snapshot.Factor)
 	}
+	if v.Profile != "" {
+		s += fmt.Sprintf("Placement Profile: %v\n", v.Profile)
+	}
+	if a := v.AntiAffinity; a != nil {
+		if len(a.Volumes) != 0 {
+			s += fmt.Sprintf("Anti-Affinity Volumes: %v\n",
+				strings.Join(a.Volumes, ","))
+		}
+		if a.Selector != "" {
+			s += fmt.Sprintf("Anti-Affinity Selector: %v\n", a.Selector)
+		}
+		if a.Scope != "" {
+			s += fmt.Sprintf("Anti-Affinity Scope: %v\n", a.Scope)
+		}
+	}
+	s += tagsString(v.Tags)
+	return s
+}
+
+// tagsString formats tags for the String functions, sorted by name.
+func tagsString(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(tags))
+	for k := range tags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	s := "Tags:\n"
+	for _, k := range names {
+		s += fmt.Sprintf("  %v: %v\n", k, tags[k])
+	}
 	return s
 }
 
@@ -610,6 +923,7 @@ func (v *BlockVolumeInfoResponse) String() string {
 		v.BlockVolume.Username,
 		v.BlockVolume.Password,
 		v.BlockHostingVolume)
+	s += tagsString(v.Tags)
 
 	/*
 		s += "\nBricks:\n"
@@ -633,6 +947,7 @@ func (v *BlockVolumeInfoResponse) String() string {
 type OperationsInfo struct {
 	Total    uint64 `json:"total"`
 	InFlight uint64 `json:"in_flight"`
+	Queued   uint64 `json:"queued"`
 	// state based counts:
 	Stale  uint64 `json:"stale"`
 	Failed uint64 `json:"failed"`
@@ -658,6 +973,68 @@ func (as AdminStatus) Validate() error {
 			validation.In(AdminStateNormal, AdminStateReadOnly, AdminStateLocal)))
 }
 
+// HaRole is the role of a heketi instance running in high
+// availability mode.
+type HaRole string
+
+const (
+	HaRoleLeader  HaRole = "leader"
+	HaRoleStandby HaRole = "standby"
+)
+
+// HaStatus describes a heketi instance running in high availability
+// mode and the leader it follows.
+type HaStatus struct {
+	Identity      string `json:"identity"`
+	Role          HaRole `json:"role"`
+	Leader        string `json:"leader"`
+	LeaderAddress string `json:"leader_address"`
+	// tag and time (unix seconds) of the last copy of the db of
+	// the leader received by a standby
+	ReplicaTag string `json:"replica_tag,omitempty"`
+	LastSync   int64  `json:"last_sync,omitempty"`
+}
+
+// BackupInfo describes a snapshot of the db kept by the backup
+// manager.
+type BackupInfo struct {
+	Name string `json:"name"`
+	// time the snapshot was taken, in unix seconds
+	Time int64 `json:"time"`
+	// id of the last transaction included in the snapshot
+	TxId int `json:"txid"`
+	// size and sha256 checksum of the stored (possibly compressed)
+	// snapshot
+	Size       int64  `json:"size"`
+	Sha256     string `json:"sha256"`
+	Compressed bool   `json:"compressed"`
+	// dbattribute entries of the db, to check that a heketi version
+	// can use the snapshot before restoring it
+	DbAttributes map[string]string `json:"db_attributes"`
+}
+
+type BackupListResponse struct {
+	Backups []BackupInfo `json:"backups"`
+}
+
+// DbRepairRequest selects issues reported by the db check to be
+// repaired, by their ids.
+type DbRepairRequest struct {
+	Issues []string `json:"issues"`
+}
+
+func (req DbRepairRequest) Validate() error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Issues, validation.Required),
+	)
+}
+
+type DbRepairResponse struct {
+	// name of the backup taken before the repair
+	Backup   string   `json:"backup"`
+	Repaired []string `json:"repaired"`
+}
+
 // DeviceDeleteOptions is used to specify additional behavior for device
 // deletes.
 type DeviceDeleteOptions struct {
@@ -673,9 +1050,26 @@ type PendingOperationInfo struct {
 	TypeName  string `json:"type_name"`
 	Status    string `json:"status"`
 	SubStatus string `json:"sub_status"`
+	// set while the operation is running on the server
+	Progress *OperationProgress `json:"progress,omitempty"`
 	// TODO label, timestamp?
 }
 
+// OperationProgress reports how far a running operation has come.
+type OperationProgress struct {
+	// step of the operation, such as build, exec or rollback
+	Phase string `json:"phase"`
+	// kind of the items the operation works through, such as
+	// the bricks moved by a device removal
+	Items string `json:"items,omitempty"`
+	Done  int    `json:"done,omitempty"`
+	Total int    `json:"total,omitempty"`
+	// executor command being run
+	Command string `json:"command,omitempty"`
+	// unix time of the last update
+	Updated int64 `json:"updated"`
+}
+
 type PendingChangeInfo struct {
 	Id          string `json:"id"`
 	Description string `json:"description"`
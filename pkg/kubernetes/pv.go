@@ -62,3 +62,109 @@ func VolumeToPv(volume *api.VolumeInfoResponse,
 
 	return pv
 }
+
+const (
+	// BlockVolumeIscsiPort is the port of the iSCSI targets of
+	// gluster block volumes.
+	BlockVolumeIscsiPort = 3260
+	// BlockVolumeChapSecretType is the type of the Secret holding
+	// the CHAP credentials of a block volume.
+	BlockVolumeChapSecretType = "kubernetes.io/iscsi-chap"
+	// BlockVolumeIdAnnotationKey is the annotation on the
+	// PersistentVolume object that records the heketi block volume id.
+	BlockVolumeIdAnnotationKey = "gluster.org/heketi-block-volume-id"
+)
+
+// BlockVolumeToPv returns an iSCSI PersistentVolume for the block
+// volume. If the block volume requires authentication the volume
+// refers to the CHAP Secret secretName in namespace secretNamespace,
+// as created by BlockVolumeToSecret.
+func BlockVolumeToPv(blockvolume *api.BlockVolumeInfoResponse,
+	name, secretName, secretNamespace string) *kubeapi.PersistentVolume {
+	// Initialize object
+	pv := &kubeapi.PersistentVolume{}
+	pv.Kind = "PersistentVolume"
+	pv.APIVersion = "v1"
+	pv.Spec.PersistentVolumeReclaimPolicy = kubeapi.PersistentVolumeReclaimRetain
+	pv.Spec.AccessModes = []kubeapi.PersistentVolumeAccessMode{
+		kubeapi.ReadWriteOnce,
+	}
+	pv.Spec.Capacity = make(kubeapi.ResourceList)
+	pv.Spec.Capacity[kubeapi.ResourceStorage] =
+		resource.MustParse(fmt.Sprintf("%vGi", blockvolume.Size))
+
+	// Set name
+	if name == "" {
+		pv.ObjectMeta.Name = "glusterblock-" + blockvolume.Id[:8]
+	} else {
+		pv.ObjectMeta.Name = name
+	}
+	pv.Annotations = map[string]string{
+		BlockVolumeIdAnnotationKey: blockvolume.Id,
+	}
+
+	// The first host is the target portal, all others are
+	// additional paths to the same target
+	iscsi := &kubeapi.ISCSIPersistentVolumeSource{
+		IQN:            blockvolume.BlockVolume.Iqn,
+		Lun:            int32(blockvolume.BlockVolume.Lun),
+		ISCSIInterface: "default",
+		FSType:         "xfs",
+	}
+	for i, host := range blockvolume.BlockVolume.Hosts {
+		portal := fmt.Sprintf("%v:%v", host, BlockVolumeIscsiPort)
+		if i == 0 {
+			iscsi.TargetPortal = portal
+		} else {
+			iscsi.Portals = append(iscsi.Portals, portal)
+		}
+	}
+
+	// Set CHAP secret
+	if blockvolume.BlockVolume.Username != "" {
+		if secretName == "" {
+			secretName = BlockVolumeSecretName(blockvolume)
+		}
+		iscsi.SessionCHAPAuth = true
+		iscsi.SecretRef = &kubeapi.SecretReference{
+			Name:      secretName,
+			Namespace: secretNamespace,
+		}
+	}
+	pv.Spec.ISCSI = iscsi
+
+	return pv
+}
+
+// BlockVolumeSecretName returns the default name of the CHAP Secret
+// of the block volume.
+func BlockVolumeSecretName(blockvolume *api.BlockVolumeInfoResponse) string {
+	return "glusterblock-" + blockvolume.Id[:8] + "-chap"
+}
+
+// BlockVolumeToSecret returns the Secret holding the CHAP credentials
+// of the block volume, or nil if the block volume does not require
+// authentication.
+func BlockVolumeToSecret(blockvolume *api.BlockVolumeInfoResponse,
+	name, namespace string) *kubeapi.Secret {
+
+	if blockvolume.BlockVolume.Username == "" {
+		return nil
+	}
+	secret := &kubeapi.Secret{}
+	secret.Kind = "Secret"
+	secret.APIVersion = "v1"
+	secret.Type = BlockVolumeChapSecretType
+	if name == "" {
+		secret.ObjectMeta.Name = BlockVolumeSecretName(blockvolume)
+	} else {
+		secret.ObjectMeta.Name = name
+	}
+	secret.ObjectMeta.Namespace = namespace
+	secret.StringData = map[string]string{
+		"node.session.auth.username": blockvolume.BlockVolume.Username,
+		"node.session.auth.password": blockvolume.BlockVolume.Password,
+	}
+
+	return secret
+}
@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+	kubeapi "k8s.io/api/core/v1"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+func testBlockVolume() *api.BlockVolumeInfoResponse {
+	bv := &api.BlockVolumeInfoResponse{}
+	bv.Id = "0123456789abcdef"
+	bv.Size = 10
+	bv.BlockVolume.Hosts = []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	bv.BlockVolume.Iqn = "iqn.2016-12.org.gluster-block:abc"
+	bv.BlockVolume.Lun = 0
+	return bv
+}
+
+func TestBlockVolumeToPv(t *testing.T) {
+	bv := testBlockVolume()
+
+	pv := BlockVolumeToPv(bv, "", "", "")
+	tests.Assert(t, pv.Name == "glusterblock-01234567", "got:", pv.Name)
+	tests.Assert(t, pv.Annotations[BlockVolumeIdAnnotationKey] == bv.Id)
+	tests.Assert(t, pv.Spec.AccessModes[0] == kubeapi.ReadWriteOnce)
+	size := pv.Spec.Capacity[kubeapi.ResourceStorage]
+	tests.Assert(t, size.String() == "10Gi", "got:", size.String())
+
+	iscsi := pv.Spec.ISCSI
+	tests.Assert(t, iscsi != nil, "expected iscsi volume source")
+	tests.Assert(t, iscsi.TargetPortal == "10.0.0.1:3260", "got:", iscsi.TargetPortal)
+	tests.Assert(t, len(iscsi.Portals) == 2, "got:", iscsi.Portals)
+	tests.Assert(t, iscsi.Portals[1] == "10.0.0.3:3260", "got:", iscsi.Portals)
+	tests.Assert(t, iscsi.IQN == bv.BlockVolume.Iqn, "got:", iscsi.IQN)
+	tests.Assert(t, !iscsi.SessionCHAPAuth, "expected no CHAP auth")
+	tests.Assert(t, iscsi.SecretRef == nil, "expected no secret")
+
+	tests.Assert(t, BlockVolumeToSecret(bv, "", "") == nil,
+		"expected no secret without authentication")
+}
+
+func TestBlockVolumeToPvChap(t *testing.T) {
+	bv := testBlockVolume()
+	bv.BlockVolume.Username = "user"
+	bv.BlockVolume.Password = "secret"
+
+	pv := BlockVolumeToPv(bv, "mypv", "", "storage")
+	tests.Assert(t, pv.Name == "mypv", "got:", pv.Name)
+	iscsi := pv.Spec.ISCSI
+	tests.Assert(t, iscsi.SessionCHAPAuth, "expected CHAP auth")
+	tests.Assert(t, iscsi.SecretRef.Name == "glusterblock-01234567-chap",
+		"got:", iscsi.SecretRef.Name)
+	tests.Assert(t, iscsi.SecretRef.Namespace == "storage",
+		"got:", iscsi.SecretRef.Namespace)
+
+	secret := BlockVolumeToSecret(bv, "", "storage")
+	tests.Assert(t, secret != nil, "expected a secret")
+	tests.Assert(t, secret.Name == iscsi.SecretRef.Name, "got:", secret.Name)
+	tests.Assert(t, secret.Namespace == "storage", "got:", secret.Namespace)
+	tests.Assert(t, string(secret.Type) == BlockVolumeChapSecretType)
+	tests.Assert(t, secret.StringData["node.session.auth.username"] == "user")
+	tests.Assert(t, secret.StringData["node.session.auth.password"] == "secret")
+}
@@ -14,6 +14,7 @@ import (
 	"net/http"
 
 	"github.com/heketi/heketi/v10/apps"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -109,6 +110,12 @@ var (
 		[]string{"cluster", "hostname", "storage_hostname", "id", "device", "pv_uuid"},
 	)
 
+	deviceFreeDriftInBytes = promDesc(
+		"device_free_drift_bytes",
+		"Difference between actual and tracked free space on the device in bytes",
+		[]string{"cluster", "hostname", "storage_hostname", "id", "device", "pv_uuid"},
+	)
+
 	staleCount = promDesc(
 		"operations_stale_count",
 		"Number of Stale Operations",
@@ -138,6 +145,42 @@ var (
 		"Number of in flight Operations",
 		nil,
 	)
+
+	poolConnected = promDesc(
+		"ssh_pool_connected",
+		"Is a pooled connection to the host open?",
+		[]string{"host"},
+	)
+
+	poolInUse = promDesc(
+		"ssh_pool_sessions_in_use",
+		"Number of command batches using the pooled connection to the host",
+		[]string{"host"},
+	)
+
+	poolDials = promDesc(
+		"ssh_pool_dials_total",
+		"Number of connections established to the host",
+		[]string{"host"},
+	)
+
+	poolReuses = promDesc(
+		"ssh_pool_reuses_total",
+		"Number of command batches that reused an open connection to the host",
+		[]string{"host"},
+	)
+
+	poolWaits = promDesc(
+		"ssh_pool_waits_total",
+		"Number of command batches that waited for a free session on the host",
+		[]string{"host"},
+	)
+
+	poolFailures = promDesc(
+		"ssh_pool_failures_total",
+		"Number of pooled connections to the host dropped after a failure",
+		[]string{"host"},
+	)
 )
 
 func promDesc(name, help string, variableLabels []string) *prometheus.Desc {
@@ -163,13 +206,20 @@ func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	ch <- deviceFreeInBytes
 	ch <- deviceUsedInBytes
 	ch <- brickCount
+	ch <- deviceFreeDriftInBytes
 	/* following metrics are grabbed from operations list, gives number of stale|failed|new|total|inFlight operations */
 	ch <- staleCount
 	ch <- failedCount
 	ch <- newCount
 	ch <- totalCount
 	ch <- inFlightCount
-
+	/* connection pool metrics, only if the executor pools connections */
+	ch <- poolConnected
+	ch <- poolInUse
+	ch <- poolDials
+	ch <- poolReuses
+	ch <- poolWaits
+	ch <- poolFailures
 }
 
 // Collect metrics from heketi app
@@ -225,6 +275,10 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 			float64(opinfo.InFlight))
 	}
 
+	if r, ok := m.app.(apps.ConnectionPoolReporter); ok {
+		m.collectPoolStats(ch, r.ConnectionPoolStats())
+	}
+
 	for _, cluster := range topinfo.ClusterList {
 		ch <- prometheus.MustNewConstMetric(
 			volumesCount,
@@ -333,11 +387,45 @@ func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
 					device.Name,
 					device.PvUUID,
 				)
+				if device.Drift != nil {
+					ch <- prometheus.MustNewConstMetric(
+						deviceFreeDriftInBytes,
+						prometheus.GaugeValue,
+						float64(device.Drift.FreeDiff*int64(KB)),
+						cluster.Id,
+						node.Hostnames.Manage[0],
+						node.Hostnames.Storage[0],
+						device.Id,
+						device.Name,
+						device.PvUUID,
+					)
+				}
 			}
 		}
 	}
 }
 
+func (m *Metrics) collectPoolStats(ch chan<- prometheus.Metric, stats []rex.PoolStats) {
+	for _, s := range stats {
+		connected := 0.0
+		if s.Connected {
+			connected = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(
+			poolConnected, prometheus.GaugeValue, connected, s.Host)
+		ch <- prometheus.MustNewConstMetric(
+			poolInUse, prometheus.GaugeValue, float64(s.InUse), s.Host)
+		ch <- prometheus.MustNewConstMetric(
+			poolDials, prometheus.CounterValue, float64(s.Dials), s.Host)
+		ch <- prometheus.MustNewConstMetric(
+			poolReuses, prometheus.CounterValue, float64(s.Reuses), s.Host)
+		ch <- prometheus.MustNewConstMetric(
+			poolWaits, prometheus.CounterValue, float64(s.Waits), s.Host)
+		ch <- prometheus.MustNewConstMetric(
+			poolFailures, prometheus.CounterValue, float64(s.Failures), s.Host)
+	}
+}
+
 func NewMetricsHandler(app apps.Application) http.HandlerFunc {
 	m := &Metrics{
 		app: app,
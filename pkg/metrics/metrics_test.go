@@ -18,11 +18,13 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
 )
 
 type testApp struct {
 	topologyInfo   *api.TopologyInfoResponse
 	operationsInfo *api.OperationsInfo
+	poolStats      []rex.PoolStats
 }
 
 func (t *testApp) SetRoutes(router *mux.Router) error {
@@ -42,6 +44,10 @@ func (t *testApp) AppOperationsInfo() (*api.OperationsInfo, error) {
 	return t.operationsInfo, nil
 }
 
+func (t *testApp) ConnectionPoolStats() []rex.PoolStats {
+	return t.poolStats
+}
+
 func TestMetricsEndpoint(t *testing.T) {
 	ta := &testApp{
 		topologyInfo: &api.TopologyInfoResponse{
@@ -65,6 +71,9 @@ func TestMetricsEndpoint(t *testing.T) {
 										Id:     "id1",
 										PvUUID: "pv1",
 									},
+									Drift: &api.DeviceDrift{
+										FreeDiff: -3,
+									},
 									Bricks: []api.BrickInfo{
 										{
 											Id:   "b1",
@@ -85,6 +94,15 @@ func TestMetricsEndpoint(t *testing.T) {
 			Failed:   2,
 			New:      1,
 		},
+		poolStats: []rex.PoolStats{
+			{
+				Host:      "n1:22",
+				Connected: true,
+				InUse:     1,
+				Dials:     2,
+				Reuses:    9,
+			},
+		},
 	}
 
 	ts := httptest.NewServer(NewMetricsHandler(ta))
@@ -110,6 +128,11 @@ func TestMetricsEndpoint(t *testing.T) {
 		t.Fatal("heketi_device_size{cluster=\"c1\",device=\"d1\",hostname=\"n1\",id=\"id1\",pv_uuid=\"pv1\",storage_hostname=\"n1\"} 2 should be present in the metrics output")
 	}
 
+	match, err = regexp.Match("heketi_device_free_drift_bytes{cluster=\"c1\",device=\"d1\",hostname=\"n1\",id=\"id1\",pv_uuid=\"pv1\",storage_hostname=\"n1\"} -3072", body)
+	if !match || err != nil {
+		t.Fatal("heketi_device_free_drift_bytes{cluster=\"c1\",device=\"d1\",hostname=\"n1\",id=\"id1\",pv_uuid=\"pv1\",storage_hostname=\"n1\"} -3072 should be present in the metrics output")
+	}
+
 	match, err = regexp.Match("operations_total_count 7", body)
 	if !match || err != nil {
 		t.Fatal("operations_total_count 7 should be present in the metrics output")
@@ -134,4 +157,14 @@ func TestMetricsEndpoint(t *testing.T) {
 	if !match || err != nil {
 		t.Fatal("operations_new_count 1 should be present in the metrics output")
 	}
+
+	match, err = regexp.Match("heketi_ssh_pool_connected{host=\"n1:22\"} 1", body)
+	if !match || err != nil {
+		t.Fatal("heketi_ssh_pool_connected{host=\"n1:22\"} 1 should be present in the metrics output")
+	}
+
+	match, err = regexp.Match("heketi_ssh_pool_reuses_total{host=\"n1:22\"} 9", body)
+	if !match || err != nil {
+		t.Fatal("heketi_ssh_pool_reuses_total{host=\"n1:22\"} 9 should be present in the metrics output")
+	}
 }
@@ -0,0 +1,126 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeagent
+
+import (
+	"errors"
+
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+)
+
+const (
+	// ExecRoute is the route accepting batches of commands to be
+	// run on the agent's node.
+	ExecRoute = "/v1/exec"
+)
+
+// CommandRunner runs a batch of commands. The command based
+// executors (cmdexec.RemoteCommandTransport) satisfy it.
+type CommandRunner interface {
+	ExecCommands(host string, commands rex.Cmds, timeoutMinutes int) (rex.Results, error)
+}
+
+// ExecCmd is the wire form of a single remoteexec.Cmd.
+type ExecCmd struct {
+	Command string
+	Quiet   bool `json:",omitempty"`
+	ErrorOk bool `json:",omitempty"`
+}
+
+// ExecRequest is the body of a command batch request. Each command
+// is given its own timeout of TimeoutMinutes.
+type ExecRequest struct {
+	Commands       []ExecCmd
+	TimeoutMinutes int
+}
+
+// ExecResult is the wire form of a remoteexec.Result.
+type ExecResult struct {
+	Completed  bool
+	Output     string
+	ErrOutput  string
+	Err        string `json:",omitempty"`
+	ExitStatus int
+}
+
+// ExecResponse is the body of the reply to a command batch. Error
+// is set if the batch as a whole could not be run, for example
+// when a command timed out.
+type ExecResponse struct {
+	Results []ExecResult
+	Error   string `json:",omitempty"`
+}
+
+func NewExecRequest(commands rex.Cmds, timeoutMinutes int) *ExecRequest {
+	req := &ExecRequest{
+		Commands:       make([]ExecCmd, len(commands)),
+		TimeoutMinutes: timeoutMinutes,
+	}
+	for i, c := range commands {
+		req.Commands[i] = ExecCmd{
+			Command: c.String(),
+			Quiet:   c.Opts().Quiet,
+			ErrorOk: c.Opts().ErrorOk,
+		}
+	}
+	return req
+}
+
+// Cmds converts the request's commands back to remoteexec.Cmds.
+func (req *ExecRequest) Cmds() rex.Cmds {
+	cmds := make(rex.Cmds, len(req.Commands))
+	for i, c := range req.Commands {
+		cmds[i] = rex.StringCmd{
+			Command: c.Command,
+			Options: rex.CmdOpts{Quiet: c.Quiet, ErrorOk: c.ErrorOk},
+		}
+	}
+	return cmds
+}
+
+func NewExecResponse(results rex.Results, err error) *ExecResponse {
+	resp := &ExecResponse{Results: make([]ExecResult, len(results))}
+	for i, r := range results {
+		resp.Results[i] = ExecResult{
+			Completed:  r.Completed,
+			Output:     r.Output,
+			ErrOutput:  r.ErrOutput,
+			ExitStatus: r.ExitStatus,
+		}
+		if r.Err != nil {
+			resp.Results[i].Err = r.Err.Error()
+		}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// ToResults converts the response back to remoteexec.Results and
+// the error returned by the agent's command runner.
+func (resp *ExecResponse) ToResults() (rex.Results, error) {
+	results := make(rex.Results, len(resp.Results))
+	for i, r := range resp.Results {
+		results[i] = rex.Result{
+			Completed:  r.Completed,
+			Output:     r.Output,
+			ErrOutput:  r.ErrOutput,
+			ExitStatus: r.ExitStatus,
+		}
+		if r.Err != "" {
+			results[i].Err = errors.New(r.Err)
+		}
+	}
+	if resp.Error != "" {
+		return results, errors.New(resp.Error)
+	}
+	return results, nil
+}
@@ -0,0 +1,277 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/logging"
+)
+
+const (
+	// the backend executor runs everything on the local node, the
+	// host name passed to it is only used for logging and throttling
+	localHost = "localhost"
+)
+
+var (
+	logger = logging.NewLogger("[nodeagent]", logging.LEVEL_INFO)
+)
+
+// Server handles typed operation requests sent to the node agent
+// and forwards them to a backend executor. The backend is normally
+// an executor that runs commands on the local node but any executor
+// (such as the mock executor) can be used.
+type Server struct {
+	backend executors.Executor
+	runner  CommandRunner
+}
+
+func NewServer(backend executors.Executor) *Server {
+	return &Server{backend: backend}
+}
+
+// SetCommandRunner enables the command batch route. Commands sent
+// to the agent are run using the given runner.
+func (s *Server) SetCommandRunner(runner CommandRunner) {
+	s.runner = runner
+}
+
+// SetRoutes registers the server's handlers on the given router.
+func (s *Server) SetRoutes(router *mux.Router) {
+	router.Methods("POST").
+		Path(OpsRoute + "{op:[A-Za-z]+}").
+		Name("NodeAgentOp").
+		HandlerFunc(s.handleOp)
+	if s.runner != nil {
+		router.Methods("POST").
+			Path(ExecRoute).
+			Name("NodeAgentExec").
+			HandlerFunc(s.handleExec)
+	}
+}
+
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+	if len(req.Commands) == 0 || req.TimeoutMinutes <= 0 {
+		http.Error(w, "commands and a timeout are required", http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Received batch of %v commands", len(req.Commands))
+
+	results, err := s.runner.ExecCommands(localHost, req.Cmds(), req.TimeoutMinutes)
+	if err != nil {
+		logger.LogError("Command batch failed: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(NewExecResponse(results, err)); err != nil {
+		logger.LogError("Unable to write response: %v", err)
+	}
+}
+
+func (s *Server) handleOp(w http.ResponseWriter, r *http.Request) {
+	op := mux.Vars(r)["op"]
+	logger.Debug("Received %v request", op)
+
+	result, err := s.dispatch(op, json.NewDecoder(r.Body))
+	if err == errUnknownOp {
+		http.Error(w, fmt.Sprintf("unknown operation: %v", op), http.StatusNotFound)
+		return
+	} else if err == errBadRequest {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	var resp Response
+	if err != nil {
+		logger.LogError("Operation %v failed: %v", op, err)
+		resp.Error = NewErrorInfo(err)
+	} else {
+		resp.Result, err = json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.LogError("Unable to write response: %v", err)
+	}
+}
+
+var (
+	errUnknownOp  = fmt.Errorf("unknown operation")
+	errBadRequest = fmt.Errorf("bad request")
+)
+
+func decode(dec *json.Decoder, v interface{}) error {
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return errBadRequest
+	}
+	return nil
+}
+
+// dispatch decodes the request for the named operation, runs
+// the operation on the backend and returns its result.
+func (s *Server) dispatch(op string, dec *json.Decoder) (interface{}, error) {
+	e := s.backend
+	switch op {
+	case OpGlusterdCheck:
+		return nil, e.GlusterdCheck(localHost)
+	case OpPeerProbe, OpPeerDetach:
+		var req NameRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		if op == OpPeerProbe {
+			return nil, e.PeerProbe(localHost, req.Name)
+		}
+		return nil, e.PeerDetach(localHost, req.Name)
+	case OpDeviceSetup:
+		var req DeviceSetupRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return e.DeviceSetup(localHost, req.Device, req.VgId, req.Destroy)
+	case OpGetDeviceInfo, OpDeviceTeardown, OpDeviceForget:
+		var req DeviceRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		if req.Handle == nil {
+			return nil, errBadRequest
+		}
+		switch op {
+		case OpGetDeviceInfo:
+			return e.GetDeviceInfo(localHost, req.Handle)
+		case OpDeviceTeardown:
+			return nil, e.DeviceTeardown(localHost, req.Handle)
+		default:
+			return nil, e.DeviceForget(localHost, req.Handle)
+		}
+	case OpBrickCreate, OpBrickDestroy:
+		var req executors.BrickRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		if op == OpBrickCreate {
+			return e.BrickCreate(localHost, &req)
+		}
+		return e.BrickDestroy(localHost, &req)
+	case OpVolumeCreate, OpVolumeExpand:
+		var req executors.VolumeRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		if op == OpVolumeCreate {
+			return e.VolumeCreate(localHost, &req)
+		}
+		return e.VolumeExpand(localHost, &req)
+	case OpVolumeDestroy, OpVolumeDestroyCheck, OpVolumeInfo,
+		OpSnapshotDestroy, OpHealInfo:
+		var req NameRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		switch op {
+		case OpVolumeDestroy:
+			return nil, e.VolumeDestroy(localHost, req.Name)
+		case OpVolumeDestroyCheck:
+			return nil, e.VolumeDestroyCheck(localHost, req.Name)
+		case OpVolumeInfo:
+			return e.VolumeInfo(localHost, req.Name)
+		case OpSnapshotDestroy:
+			return nil, e.SnapshotDestroy(localHost, req.Name)
+		default:
+			return e.HealInfo(localHost, req.Name)
+		}
+	case OpVolumeReplaceBrick:
+		var req ReplaceBrickRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return nil, e.VolumeReplaceBrick(
+			localHost, req.Volume, req.OldBrick, req.NewBrick)
+	case OpVolumesInfo:
+		return e.VolumesInfo(localHost)
+	case OpVolumeClone:
+		var req executors.VolumeCloneRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return e.VolumeClone(localHost, &req)
+	case OpVolumeSnapshot:
+		var req executors.VolumeSnapshotRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return e.VolumeSnapshot(localHost, &req)
+	case OpVolumeModify:
+		var req executors.VolumeModifyRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return nil, e.VolumeModify(localHost, &req)
+	case OpSnapshotCloneVolume, OpSnapshotCloneBlockVolume:
+		var req executors.SnapshotCloneRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		if op == OpSnapshotCloneVolume {
+			return e.SnapshotCloneVolume(localHost, &req)
+		}
+		return e.SnapshotCloneBlockVolume(localHost, &req)
+	case OpBlockVolumeCreate:
+		var req executors.BlockVolumeRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		return e.BlockVolumeCreate(localHost, &req)
+	case OpBlockVolumeDestroy, OpBlockVolumeExpand, OpBlockVolumeInfo,
+		OpListBlockVolumes:
+		var req BlockRequest
+		if err := decode(dec, &req); err != nil {
+			return nil, err
+		}
+		switch op {
+		case OpBlockVolumeDestroy:
+			return nil, e.BlockVolumeDestroy(
+				localHost, req.HostingVolume, req.Name)
+		case OpBlockVolumeExpand:
+			return nil, e.BlockVolumeExpand(
+				localHost, req.HostingVolume, req.Name, req.Size)
+		case OpBlockVolumeInfo:
+			return e.BlockVolumeInfo(localHost, req.HostingVolume, req.Name)
+		default:
+			return e.ListBlockVolumes(localHost, req.HostingVolume)
+		}
+	case OpPVS:
+		return e.PVS(localHost)
+	case OpVGS:
+		return e.VGS(localHost)
+	case OpLVS:
+		return e.LVS(localHost)
+	case OpGetBrickMountStatus:
+		return e.GetBrickMountStatus(localHost)
+	}
+	return nil, errUnknownOp
+}
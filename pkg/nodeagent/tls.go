@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSFiles names the files needed to set up one side of a
+// mutually authenticated TLS connection.
+type TLSFiles struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	CAFile   string `json:"ca_file"`
+}
+
+func (f TLSFiles) load() (tls.Certificate, *x509.CertPool, error) {
+	if f.CertFile == "" || f.KeyFile == "" || f.CAFile == "" {
+		return tls.Certificate{}, nil,
+			fmt.Errorf("certificate, key and CA files are required")
+	}
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil,
+			fmt.Errorf("unable to load key pair: %v", err)
+	}
+	pem, err := ioutil.ReadFile(f.CAFile)
+	if err != nil {
+		return tls.Certificate{}, nil,
+			fmt.Errorf("unable to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return tls.Certificate{}, nil,
+			fmt.Errorf("no certificates found in CA file %v", f.CAFile)
+	}
+	return cert, pool, nil
+}
+
+// ServerTLSConfig returns a TLS configuration for the agent that
+// only accepts clients presenting a certificate signed by the CA.
+func ServerTLSConfig(f TLSFiles) (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig returns a TLS configuration for heketi that
+// presents the client certificate and only trusts agents whose
+// certificate is signed by the CA.
+func ClientTLSConfig(f TLSFiles) (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
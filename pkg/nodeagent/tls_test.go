@@ -0,0 +1,148 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeagent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/executors/mockexec"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	err := ioutil.WriteFile(path,
+		pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	cert, err := x509.ParseCertificate(der)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, dir: dir}
+}
+
+// issue creates a certificate signed by the CA and returns the
+// TLSFiles referring to it.
+func (ca *testCA) issue(t *testing.T, name string, serial int64) TLSFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	kder, err := x509.MarshalECPrivateKey(key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	f := TLSFiles{
+		CertFile: filepath.Join(ca.dir, name+".crt"),
+		KeyFile:  filepath.Join(ca.dir, name+".key"),
+		CAFile:   filepath.Join(ca.dir, "ca.crt"),
+	}
+	writePEM(t, f.CertFile, "CERTIFICATE", der)
+	writePEM(t, f.KeyFile, "EC PRIVATE KEY", kder)
+	return f
+}
+
+func TestTLSFilesMissing(t *testing.T) {
+	_, err := ServerTLSConfig(TLSFiles{CertFile: "a", KeyFile: "b"})
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = ClientTLSConfig(TLSFiles{})
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nodeagent")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, dir)
+	serverFiles := ca.issue(t, "server", 2)
+	clientFiles := ca.issue(t, "client", 3)
+
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	router := mux.NewRouter()
+	NewServer(m).SetRoutes(router)
+
+	ts := httptest.NewUnstartedServer(router)
+	ts.TLS, err = ServerTLSConfig(serverFiles)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	ts.StartTLS()
+	defer ts.Close()
+
+	url := ts.URL + OpsRoute + OpGlusterdCheck
+
+	// a client trusting the CA but without a certificate is rejected
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	anon := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	_, err = anon.Post(url, "application/json", strings.NewReader("{}"))
+	tests.Assert(t, err != nil, "expected err != nil")
+
+	// a client presenting a certificate signed by the CA is accepted
+	tlsConfig, err := ClientTLSConfig(clientFiles)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}}
+	r, err := client.Post(url, "application/json", strings.NewReader("{}"))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer r.Body.Close()
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+}
@@ -0,0 +1,163 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package nodeagent
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/heketi/heketi/v10/executors"
+)
+
+const (
+	// OpsRoute is the prefix of the routes for typed operations.
+	// The name of the operation is appended to the prefix.
+	OpsRoute = "/v1/ops/"
+)
+
+// Names of the operations supported by the node agent. Each name
+// matches the executors.Executor method it is forwarded to.
+const (
+	OpGlusterdCheck            = "GlusterdCheck"
+	OpPeerProbe                = "PeerProbe"
+	OpPeerDetach               = "PeerDetach"
+	OpDeviceSetup              = "DeviceSetup"
+	OpGetDeviceInfo            = "GetDeviceInfo"
+	OpDeviceTeardown           = "DeviceTeardown"
+	OpDeviceForget             = "DeviceForget"
+	OpBrickCreate              = "BrickCreate"
+	OpBrickDestroy             = "BrickDestroy"
+	OpVolumeCreate             = "VolumeCreate"
+	OpVolumeDestroy            = "VolumeDestroy"
+	OpVolumeDestroyCheck       = "VolumeDestroyCheck"
+	OpVolumeExpand             = "VolumeExpand"
+	OpVolumeReplaceBrick       = "VolumeReplaceBrick"
+	OpVolumeInfo               = "VolumeInfo"
+	OpVolumesInfo              = "VolumesInfo"
+	OpVolumeClone              = "VolumeClone"
+	OpVolumeSnapshot           = "VolumeSnapshot"
+	OpVolumeModify             = "VolumeModify"
+	OpSnapshotCloneVolume      = "SnapshotCloneVolume"
+	OpSnapshotCloneBlockVolume = "SnapshotCloneBlockVolume"
+	OpSnapshotDestroy          = "SnapshotDestroy"
+	OpHealInfo                 = "HealInfo"
+	OpBlockVolumeCreate        = "BlockVolumeCreate"
+	OpBlockVolumeDestroy       = "BlockVolumeDestroy"
+	OpBlockVolumeExpand        = "BlockVolumeExpand"
+	OpBlockVolumeInfo          = "BlockVolumeInfo"
+	OpPVS                      = "PVS"
+	OpVGS                      = "VGS"
+	OpLVS                      = "LVS"
+	OpGetBrickMountStatus      = "GetBrickMountStatus"
+	OpListBlockVolumes         = "ListBlockVolumes"
+)
+
+// NoArgs is the request for operations that take no arguments
+// other than the node they are run on.
+type NoArgs struct{}
+
+// NameRequest is the request for operations on a single named
+// object such as a peer, volume or snapshot.
+type NameRequest struct {
+	Name string
+}
+
+type DeviceSetupRequest struct {
+	Device  string
+	VgId    string
+	Destroy bool
+}
+
+type DeviceRequest struct {
+	Handle *executors.DeviceVgHandle
+}
+
+type ReplaceBrickRequest struct {
+	Volume   string
+	OldBrick *executors.BrickInfo
+	NewBrick *executors.BrickInfo
+}
+
+// BlockRequest is the request for operations on a block volume
+// (or all block volumes) of a block hosting volume.
+type BlockRequest struct {
+	HostingVolume string
+	Name          string
+	Size          int
+}
+
+// ErrorInfo carries an error returned by the agent's executor
+// in a form that allows the typed errors heketi depends on
+// to be reconstructed by the client.
+type ErrorInfo struct {
+	Message string
+
+	// set for executors.NotSupportedError
+	NotSupported bool `json:",omitempty"`
+	// set for *executors.VolumeDoesNotExistErr
+	VolumeDoesNotExist string `json:",omitempty"`
+	// set for *executors.DeviceNotAvailableErr
+	DeviceNotAvailable *DeviceNotAvailableInfo `json:",omitempty"`
+}
+
+type DeviceNotAvailableInfo struct {
+	OriginalError string
+	Path          string
+	ConnectionOk  bool
+	CurrentMeta   *executors.DeviceHandle
+}
+
+// Response is the body of every reply from the agent. Exactly
+// one of Result or Error is set.
+type Response struct {
+	Result json.RawMessage `json:",omitempty"`
+	Error  *ErrorInfo      `json:",omitempty"`
+}
+
+// NewErrorInfo converts an error into an ErrorInfo.
+func NewErrorInfo(err error) *ErrorInfo {
+	ei := &ErrorInfo{Message: err.Error()}
+	switch e := err.(type) {
+	case *executors.VolumeDoesNotExistErr:
+		ei.VolumeDoesNotExist = e.Name
+	case *executors.DeviceNotAvailableErr:
+		ei.DeviceNotAvailable = &DeviceNotAvailableInfo{
+			Path:         e.Path,
+			ConnectionOk: e.ConnectionOk,
+			CurrentMeta:  e.CurrentMeta,
+		}
+		if e.OriginalError != nil {
+			ei.DeviceNotAvailable.OriginalError = e.OriginalError.Error()
+		}
+	default:
+		if err == executors.NotSupportedError {
+			ei.NotSupported = true
+		}
+	}
+	return ei
+}
+
+// Err converts the ErrorInfo back into an error value.
+func (ei *ErrorInfo) Err() error {
+	switch {
+	case ei.NotSupported:
+		return executors.NotSupportedError
+	case ei.VolumeDoesNotExist != "":
+		return &executors.VolumeDoesNotExistErr{Name: ei.VolumeDoesNotExist}
+	case ei.DeviceNotAvailable != nil:
+		return &executors.DeviceNotAvailableErr{
+			OriginalError: errors.New(ei.DeviceNotAvailable.OriginalError),
+			Path:          ei.DeviceNotAvailable.Path,
+			ConnectionOk:  ei.DeviceNotAvailable.ConnectionOk,
+			CurrentMeta:   ei.DeviceNotAvailable.CurrentMeta,
+		}
+	}
+	return errors.New(ei.Message)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/heketi/heketi/v10/pkg/logging"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+	rexlog "github.com/heketi/heketi/v10/pkg/remoteexec/log"
+)
+
+const (
+	localHost = "localhost"
+)
+
+var (
+	ErrTimeout = errors.New("Local command timeout")
+)
+
+// LocalExec runs commands on the system the current process
+// is running on.
+type LocalExec struct {
+	logger *logging.Logger
+
+	// Shell is the path of the shell used to run commands
+	Shell string
+}
+
+func NewLocalExec(logger *logging.Logger) *LocalExec {
+	return &LocalExec{
+		logger: logger,
+		Shell:  "/bin/bash",
+	}
+}
+
+// ExecCommands runs the given commands in order, each one with its
+// own timeout. Execution stops on the first command that fails.
+func (l *LocalExec) ExecCommands(
+	commands rex.Cmds, timeoutMinutes int, useSudo bool) (rex.Results, error) {
+
+	results := make(rex.Results, len(commands))
+	cmdlog := rexlog.NewCommandLogger(l.logger)
+
+	for index, cmd := range commands {
+		cmdlog.Before(cmd, localHost)
+
+		command := cmd.String()
+		if useSudo {
+			command = "sudo " + command
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Minute*time.Duration(timeoutMinutes))
+		var b bytes.Buffer
+		var berr bytes.Buffer
+		c := exec.CommandContext(ctx, l.Shell, "-c", command)
+		c.Stdout = &b
+		c.Stderr = &berr
+		err := c.Run()
+		timedOut := ctx.Err() == context.DeadlineExceeded
+		cancel()
+
+		if timedOut {
+			cmdlog.Timeout(cmd, err, localHost, b.String(), berr.String())
+			return results, ErrTimeout
+		}
+
+		r := rex.Result{
+			Completed: true,
+			Output:    b.String(),
+			ErrOutput: berr.String(),
+			Err:       err,
+		}
+		if err == nil {
+			cmdlog.Success(cmd, localHost, r.Output, r.ErrOutput)
+		} else {
+			cmdlog.Error(cmd, err, localHost, r.Output, r.ErrOutput)
+			// extract the real error code if possible
+			if ee, ok := err.(*exec.ExitError); ok {
+				r.ExitStatus = ee.ExitCode()
+			} else {
+				r.ExitStatus = 1
+			}
+		}
+		results[index] = r
+		if r.ExitStatus != 0 {
+			// stop running commands on error
+			return results, nil
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,48 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package local
+
+import (
+	"testing"
+
+	"github.com/heketi/tests"
+
+	"github.com/heketi/heketi/v10/pkg/logging"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+)
+
+func TestLocalExecCommands(t *testing.T) {
+	l := NewLocalExec(logging.NewLogger("[test]", logging.LEVEL_NOLOG))
+	res, err := l.ExecCommands(rex.ToCmds([]string{
+		"echo hello",
+		"echo oops >&2",
+	}), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(res) == 2, "expected len(res) == 2, got:", len(res))
+	tests.Assert(t, res.Ok(), "expected res.Ok()")
+	tests.Assert(t, res[0].Output == "hello\n",
+		"expected res[0].Output == \"hello\\n\", got:", res[0].Output)
+	tests.Assert(t, res[1].ErrOutput == "oops\n",
+		"expected res[1].ErrOutput == \"oops\\n\", got:", res[1].ErrOutput)
+}
+
+func TestLocalExecCommandsStopOnError(t *testing.T) {
+	l := NewLocalExec(logging.NewLogger("[test]", logging.LEVEL_NOLOG))
+	res, err := l.ExecCommands(rex.ToCmds([]string{
+		"true",
+		"exit 3",
+		"echo never",
+	}), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !res.Ok(), "expected !res.Ok()")
+	tests.Assert(t, res[1].ExitStatus == 3,
+		"expected res[1].ExitStatus == 3, got:", res[1].ExitStatus)
+	tests.Assert(t, !res[2].Completed, "expected !res[2].Completed")
+}
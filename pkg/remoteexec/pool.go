@@ -0,0 +1,27 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package remoteexec
+
+// PoolStats reports the usage of the pooled connection to a host.
+type PoolStats struct {
+	Host string
+	// true if a connection to the host is currently open
+	Connected bool
+	// number of command batches currently using the connection
+	InUse int
+	// number of connections established to the host
+	Dials uint64
+	// number of command batches that reused an open connection
+	Reuses uint64
+	// number of command batches that had to wait for a free session
+	Waits uint64
+	// number of connections dropped because they failed
+	Failures uint64
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key checking policies.
+const (
+	// HostKeyCheckDefault keeps the historical behavior of verifying
+	// host keys only if SSH_KNOWN_HOSTS is set in the environment.
+	HostKeyCheckDefault = ""
+	// HostKeyCheckNone disables host key verification.
+	HostKeyCheckNone = "none"
+	// HostKeyCheckKnownHosts requires every host key to be present
+	// in the configured known_hosts files.
+	HostKeyCheckKnownHosts = "known_hosts"
+	// HostKeyCheckTofu trusts the key presented on the first connection
+	// to a host and rejects any other key afterwards.
+	HostKeyCheckTofu = "tofu"
+)
+
+// HostKeyStore persists the host keys pinned by the trust-on-first-use
+// policy. Keys are in the authorized_keys format.
+type HostKeyStore interface {
+	// PinnedHostKey returns the key pinned for host or an empty
+	// string if no key is pinned yet.
+	PinnedHostKey(host string) (string, error)
+	// PinHostKey pins key for host.
+	PinHostKey(host, key string) error
+}
+
+// HostKeyMismatchError is returned when a host presents a key other
+// than the one pinned for it.
+type HostKeyMismatchError struct {
+	Host        string
+	Fingerprint string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf(
+		"ssh host key for %v does not match the pinned key (got %v)",
+		e.Host, e.Fingerprint)
+}
+
+// HostKeyConfig selects how host keys are verified.
+type HostKeyConfig struct {
+	Check string
+	// list of known_hosts files, separated by the os path list separator
+	KnownHostsFile string
+	// used by the tofu policy
+	Store HostKeyStore
+}
+
+// Validate checks that the configuration can produce a callback.
+func (c HostKeyConfig) Validate() error {
+	switch c.Check {
+	case HostKeyCheckDefault, HostKeyCheckNone, HostKeyCheckTofu:
+		return nil
+	case HostKeyCheckKnownHosts:
+		if c.KnownHostsFile == "" {
+			return fmt.Errorf("known_hosts file required for host key check %v",
+				c.Check)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid host key check: %v", c.Check)
+}
+
+// Callback returns the ssh host key callback for the configuration.
+func (c HostKeyConfig) Callback() (ssh.HostKeyCallback, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Check {
+	case HostKeyCheckNone:
+		return ssh.InsecureIgnoreHostKey(), nil
+	case HostKeyCheckKnownHosts:
+		cb, err := knownhosts.New(filepath.SplitList(c.KnownHostsFile)...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read known_hosts %q: %v",
+				c.KnownHostsFile, err)
+		}
+		return cb, nil
+	case HostKeyCheckTofu:
+		if c.Store == nil {
+			return nil, fmt.Errorf("host key store required for host key check %v",
+				c.Check)
+		}
+		return NewTofuHostKeyCallback(c.Store), nil
+	}
+	return getHostKeyCallback(), nil
+}
+
+// MarshalHostKey returns the authorized_keys form of key.
+func MarshalHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// HostKeyFingerprint returns the SHA256 fingerprint of a key in the
+// authorized_keys format.
+func HostKeyFingerprint(key string) (string, error) {
+	pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(pk), nil
+}
+
+// NewTofuHostKeyCallback returns a host key callback that pins the
+// first key seen for a host in store and only accepts that key for
+// all later connections.
+func NewTofuHostKeyCallback(store HostKeyStore) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host := hostname
+		if h, _, err := net.SplitHostPort(hostname); err == nil {
+			host = h
+		}
+		presented := MarshalHostKey(key)
+		pinned, err := store.PinnedHostKey(host)
+		if err != nil {
+			return err
+		}
+		if pinned == "" {
+			return store.PinHostKey(host, presented)
+		}
+		if pinned != presented {
+			return &HostKeyMismatchError{
+				Host:        host,
+				Fingerprint: ssh.FingerprintSHA256(key),
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+type memHostKeyStore map[string]string
+
+func (m memHostKeyStore) PinnedHostKey(host string) (string, error) {
+	return m[host], nil
+}
+
+func (m memHostKeyStore) PinHostKey(host, key string) error {
+	m[host] = key
+	return nil
+}
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	key, err := ssh.NewPublicKey(pub)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return key
+}
+
+func TestTofuHostKeyCallback(t *testing.T) {
+	store := memHostKeyStore{}
+	cb := NewTofuHostKeyCallback(store)
+	key1 := newTestHostKey(t)
+	key2 := newTestHostKey(t)
+
+	// first connection pins the key
+	err := cb("node1:22", nil, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, store["node1"] == MarshalHostKey(key1),
+		"expected key1 pinned for node1, got:", store["node1"])
+
+	// same key is accepted
+	err = cb("node1:22", nil, key1)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// other key is rejected
+	err = cb("node1:22", nil, key2)
+	_, ok := err.(*HostKeyMismatchError)
+	tests.Assert(t, ok, "expected HostKeyMismatchError, got:", err)
+
+	// other hosts get their own key
+	err = cb("node2:22", nil, key2)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	fp, err := HostKeyFingerprint(store["node2"])
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fp == ssh.FingerprintSHA256(key2),
+		"expected fingerprint of key2, got:", fp)
+}
+
+func TestHostKeyConfigValidate(t *testing.T) {
+	tests.Assert(t, HostKeyConfig{}.Validate() == nil)
+	tests.Assert(t, HostKeyConfig{Check: HostKeyCheckTofu}.Validate() == nil)
+	tests.Assert(t, HostKeyConfig{Check: HostKeyCheckKnownHosts}.Validate() != nil)
+	tests.Assert(t, HostKeyConfig{Check: "bogus"}.Validate() != nil)
+
+	_, err := HostKeyConfig{Check: HostKeyCheckTofu}.Callback()
+	tests.Assert(t, err != nil, "expected err != nil")
+	_, err = HostKeyConfig{
+		Check:          HostKeyCheckKnownHosts,
+		KnownHostsFile: "/does/not/exist",
+	}.Callback()
+	tests.Assert(t, err != nil, "expected err != nil")
+}
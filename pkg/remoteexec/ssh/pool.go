@@ -0,0 +1,266 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/heketi/heketi/v10/pkg/logging"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+)
+
+// PoolConfig controls how connections to hosts are kept open and
+// shared between command batches.
+type PoolConfig struct {
+	// maximum number of command batches sharing the connection to a
+	// host at once, zero for no limit
+	MaxSessionsPerHost int
+	// idle connections are closed after this long, zero keeps them
+	// open until they fail
+	IdleTimeout time.Duration
+	// interval between keepalive requests sent on open connections,
+	// zero disables keepalives; a connection that does not reply
+	// within the interval is not given to new batches
+	KeepAliveInterval time.Duration
+}
+
+type pooledConn struct {
+	client   *ssh.Client
+	inUse    int
+	lastUsed time.Time
+	// no longer given to new batches, closed once unused
+	retired bool
+}
+
+type hostPool struct {
+	// held while the connection is checked, dialed or retired
+	lock  sync.Mutex
+	conn  *pooledConn
+	slots chan struct{}
+	stats rex.PoolStats
+}
+
+// connPool keeps one multiplexed ssh connection open per host.
+type connPool struct {
+	config PoolConfig
+	logger *logging.Logger
+	dial   func(host string) (*ssh.Client, error)
+
+	lock  sync.Mutex
+	hosts map[string]*hostPool
+}
+
+func newConnPool(config PoolConfig, logger *logging.Logger,
+	dial func(host string) (*ssh.Client, error)) *connPool {
+
+	return &connPool{
+		config: config,
+		logger: logger,
+		dial:   dial,
+		hosts:  map[string]*hostPool{},
+	}
+}
+
+func (p *connPool) host(host string) *hostPool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	hp, ok := p.hosts[host]
+	if !ok {
+		hp = &hostPool{}
+		hp.stats.Host = host
+		if p.config.MaxSessionsPerHost > 0 {
+			hp.slots = make(chan struct{}, p.config.MaxSessionsPerHost)
+		}
+		p.hosts[host] = hp
+	}
+	return hp
+}
+
+// get returns a connection to host, dialing a new one if needed.
+// The returned function must be called once the caller is done
+// with the connection, passing true if the connection failed. A
+// failed connection is retired: the batches still using it finish,
+// and the next batches use a new connection.
+func (p *connPool) get(host string) (*ssh.Client, func(failed bool), error) {
+	hp := p.host(host)
+	if hp.slots != nil {
+		select {
+		case hp.slots <- struct{}{}:
+		default:
+			hp.lock.Lock()
+			hp.stats.Waits++
+			hp.lock.Unlock()
+			hp.slots <- struct{}{}
+		}
+	}
+
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+	pc := hp.conn
+	if pc == nil {
+		client, err := p.dial(host)
+		if err != nil {
+			hp.stats.Failures++
+			hp.releaseSlot()
+			return nil, nil, err
+		}
+		pc = &pooledConn{client: client}
+		hp.conn = pc
+		hp.stats.Dials++
+		go p.monitor(host, hp, pc)
+	} else {
+		hp.stats.Reuses++
+	}
+	pc.inUse++
+
+	release := func(failed bool) {
+		hp.lock.Lock()
+		defer hp.lock.Unlock()
+		pc.inUse--
+		pc.lastUsed = time.Now()
+		if failed && hp.conn == pc {
+			p.logger.Warning("Retiring failed ssh connection to %v", host)
+			hp.stats.Failures++
+			hp.retire()
+		} else if pc.retired && pc.inUse == 0 {
+			pc.client.Close()
+		}
+		hp.releaseSlot()
+	}
+	return pc.client, release, nil
+}
+
+func (hp *hostPool) releaseSlot() {
+	if hp.slots != nil {
+		<-hp.slots
+	}
+}
+
+// retire stops giving the current connection to new batches. It is
+// closed once no batch uses it. Must be called with the lock held.
+func (hp *hostPool) retire() {
+	pc := hp.conn
+	if pc == nil {
+		return
+	}
+	hp.conn = nil
+	pc.retired = true
+	if pc.inUse == 0 {
+		pc.client.Close()
+	}
+}
+
+// monitor sends keepalives on the connection and closes it once
+// it has been idle for too long. It exits once the connection is
+// no longer the pooled connection of the host.
+func (p *connPool) monitor(host string, hp *hostPool, pc *pooledConn) {
+	interval := p.config.KeepAliveInterval
+	if interval <= 0 {
+		interval = p.config.IdleTimeout
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hp.lock.Lock()
+		if hp.conn != pc {
+			hp.lock.Unlock()
+			return
+		}
+		if pc.inUse == 0 && p.config.IdleTimeout > 0 &&
+			time.Since(pc.lastUsed) >= p.config.IdleTimeout {
+			p.logger.Debug("Closing idle ssh connection to %v", host)
+			hp.retire()
+			hp.lock.Unlock()
+			return
+		}
+		hp.lock.Unlock()
+
+		if p.config.KeepAliveInterval <= 0 {
+			continue
+		}
+		if err := keepAlive(pc.client, p.config.KeepAliveInterval); err != nil {
+			hp.lock.Lock()
+			if hp.conn == pc {
+				p.logger.Warning("Keepalive to %v failed: %v", host, err)
+				hp.stats.Failures++
+				hp.retire()
+			}
+			hp.lock.Unlock()
+			return
+		}
+	}
+}
+
+// keepAlive sends a keepalive request on the connection and waits at
+// most timeout for the reply, as a half-open connection never replies.
+func keepAlive(client *ssh.Client, timeout time.Duration) error {
+	errch := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errch <- err
+	}()
+	select {
+	case err := <-errch:
+		return err
+	case <-time.After(timeout):
+		return errors.New("no keepalive reply")
+	}
+}
+
+// Stats returns the usage of the connections of all hosts the pool
+// has connected to, sorted by host.
+func (p *connPool) Stats() []rex.PoolStats {
+	p.lock.Lock()
+	hosts := make([]*hostPool, 0, len(p.hosts))
+	for _, hp := range p.hosts {
+		hosts = append(hosts, hp)
+	}
+	p.lock.Unlock()
+
+	stats := make([]rex.PoolStats, 0, len(hosts))
+	for _, hp := range hosts {
+		hp.lock.Lock()
+		s := hp.stats
+		if hp.conn != nil {
+			s.Connected = true
+			s.InUse = hp.conn.inUse
+		}
+		hp.lock.Unlock()
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+// Close closes all open connections. Sessions still running on them
+// fail and their callers see an error.
+func (p *connPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, hp := range p.hosts {
+		hp.lock.Lock()
+		if hp.conn != nil {
+			hp.conn.client.Close()
+			hp.conn = nil
+		}
+		hp.lock.Unlock()
+	}
+}
@@ -0,0 +1,290 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/heketi/heketi/v10/pkg/logging"
+	rex "github.com/heketi/heketi/v10/pkg/remoteexec"
+)
+
+// testSshServer accepts any client and answers every exec request
+// with the command string on stdout and an exit status of zero.
+// Commands containing "no-status" end without an exit status.
+type testSshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	// keepalive requests are never answered
+	noKeepAlive bool
+
+	lock  sync.Mutex
+	conns int
+}
+
+func newTestSshServer(t *testing.T) *testSshServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	s := &testSshServer{listener: l, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *testSshServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *testSshServer) handle(c net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(c, s.config)
+	if err != nil {
+		return
+	}
+	s.lock.Lock()
+	s.conns++
+	s.lock.Unlock()
+
+	go func() {
+		for req := range reqs {
+			if s.noKeepAlive && req.Type == "keepalive@openssh.com" {
+				continue
+			}
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		}
+	}()
+	for nc := range chans {
+		ch, creqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range creqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				// payload is a length prefixed command string
+				ch.Write(req.Payload[4:])
+				if !strings.Contains(string(req.Payload), "no-status") {
+					status := make([]byte, 4)
+					binary.BigEndian.PutUint32(status, 0)
+					ch.SendRequest("exit-status", false, status)
+				}
+				ch.Close()
+			}
+		}()
+	}
+}
+
+func (s *testSshServer) Conns() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conns
+}
+
+func newTestSshExec(t *testing.T) *SshExec {
+	return &SshExec{
+		logger: logging.NewLogger("[test]", logging.LEVEL_NOLOG),
+		clientConfig: &ssh.ClientConfig{
+			User:            "test",
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		},
+	}
+}
+
+func TestSshExecPoolReusesConnection(t *testing.T) {
+	srv := newTestSshServer(t)
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	s.EnablePool(PoolConfig{MaxSessionsPerHost: 2})
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		r, err := s.ExecCommands(host, rex.OneCmd("echo hi"), 1, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r[0].Ok(), "expected r[0].Ok(), got:", r[0])
+	}
+	tests.Assert(t, srv.Conns() == 1, "expected srv.Conns() == 1, got:", srv.Conns())
+
+	stats := s.PoolStats()
+	tests.Assert(t, len(stats) == 1, "expected len(stats) == 1, got:", len(stats))
+	tests.Assert(t, stats[0].Connected, "expected stats[0].Connected")
+	tests.Assert(t, stats[0].InUse == 0, "expected stats[0].InUse == 0, got:", stats[0].InUse)
+	tests.Assert(t, stats[0].Dials == 1, "expected stats[0].Dials == 1, got:", stats[0].Dials)
+	tests.Assert(t, stats[0].Reuses == 2, "expected stats[0].Reuses == 2, got:", stats[0].Reuses)
+}
+
+func TestSshExecWithoutPool(t *testing.T) {
+	srv := newTestSshServer(t)
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	for i := 0; i < 2; i++ {
+		r, err := s.ExecCommands(host, rex.OneCmd("echo hi"), 1, false)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r[0].Ok(), "expected r[0].Ok(), got:", r[0])
+	}
+	tests.Assert(t, srv.Conns() == 2, "expected srv.Conns() == 2, got:", srv.Conns())
+	tests.Assert(t, s.PoolStats() == nil, "expected s.PoolStats() == nil")
+}
+
+func TestSshExecPoolIdleTimeout(t *testing.T) {
+	srv := newTestSshServer(t)
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	s.EnablePool(PoolConfig{
+		IdleTimeout:       50 * time.Millisecond,
+		KeepAliveInterval: 10 * time.Millisecond,
+	})
+	defer s.Close()
+
+	_, err := s.ExecCommands(host, rex.OneCmd("echo hi"), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	for i := 0; i < 100 && s.PoolStats()[0].Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, !s.PoolStats()[0].Connected, "expected idle connection closed")
+
+	// the next batch dials a new connection
+	_, err = s.ExecCommands(host, rex.OneCmd("echo hi"), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, srv.Conns() == 2, "expected srv.Conns() == 2, got:", srv.Conns())
+}
+
+func TestConnPoolMaxSessions(t *testing.T) {
+	srv := newTestSshServer(t)
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	s.EnablePool(PoolConfig{MaxSessionsPerHost: 1})
+	defer s.Close()
+
+	_, release, err := s.pool.get(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	got := make(chan struct{})
+	go func() {
+		_, release2, err := s.pool.get(host)
+		if err == nil {
+			release2(false)
+		}
+		close(got)
+	}()
+
+	select {
+	case <-got:
+		t.Fatalf("expected second session to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release(false)
+	<-got
+
+	stats := s.PoolStats()
+	tests.Assert(t, stats[0].Waits == 1, "expected stats[0].Waits == 1, got:", stats[0].Waits)
+}
+
+func TestSshExecPoolFailureKeepsOtherBatches(t *testing.T) {
+	srv := newTestSshServer(t)
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	s.EnablePool(PoolConfig{})
+	defer s.Close()
+
+	// another batch is running on the connection
+	client, release, err := s.pool.get(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// a session ending without an exit status fails its batch
+	r, err := s.ExecCommands(host, rex.OneCmd("no-status"), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !r[0].Ok(), "expected !r[0].Ok(), got:", r[0])
+
+	stats := s.PoolStats()
+	tests.Assert(t, !stats[0].Connected, "expected connection retired")
+	tests.Assert(t, stats[0].Failures == 1, "expected stats[0].Failures == 1, got:", stats[0].Failures)
+
+	// the running batch can still use the connection
+	session, err := client.NewSession()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	session.Close()
+
+	// new batches dial a new connection
+	r, err = s.ExecCommands(host, rex.OneCmd("echo hi"), 1, false)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r[0].Ok(), "expected r[0].Ok(), got:", r[0])
+	tests.Assert(t, srv.Conns() == 2, "expected srv.Conns() == 2, got:", srv.Conns())
+
+	// the retired connection is closed once its last batch is done
+	release(false)
+	_, err = client.NewSession()
+	tests.Assert(t, err != nil, "expected err != nil")
+}
+
+func TestSshExecPoolKeepAliveTimeout(t *testing.T) {
+	srv := newTestSshServer(t)
+	srv.noKeepAlive = true
+	defer srv.listener.Close()
+	host := srv.listener.Addr().String()
+
+	s := newTestSshExec(t)
+	s.EnablePool(PoolConfig{KeepAliveInterval: 10 * time.Millisecond})
+	defer s.Close()
+
+	client, release, err := s.pool.get(host)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer release(false)
+
+	for i := 0; i < 100 && s.PoolStats()[0].Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := s.PoolStats()
+	tests.Assert(t, !stats[0].Connected, "expected connection retired")
+	tests.Assert(t, stats[0].Failures == 1, "expected stats[0].Failures == 1, got:", stats[0].Failures)
+
+	// the batch using it is not interrupted
+	session, err := client.NewSession()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	session.Close()
+}
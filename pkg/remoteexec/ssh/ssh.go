@@ -32,6 +32,7 @@ import (
 type SshExec struct {
 	clientConfig *ssh.ClientConfig
 	logger       *logging.Logger
+	pool         *connPool
 }
 
 func getKeyFile(file string) (key ssh.Signer, err error) {
@@ -104,6 +105,51 @@ func NewSshExecWithKeyFile(logger *logging.Logger, user string, file string) *Ss
 	return sshexec
 }
 
+// SetHostKeyCallback replaces the callback used to verify the keys
+// of the hosts connected to.
+func (s *SshExec) SetHostKeyCallback(cb ssh.HostKeyCallback) {
+	s.clientConfig.HostKeyCallback = cb
+}
+
+// EnablePool makes the SshExec keep connections to hosts open and
+// share them between command batches.
+func (s *SshExec) EnablePool(config PoolConfig) {
+	s.pool = newConnPool(config, s.logger, s.dial)
+}
+
+// PoolStats returns the usage of the pooled connections, or nil if
+// pooling is not enabled.
+func (s *SshExec) PoolStats() []rex.PoolStats {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.Stats()
+}
+
+// Close closes any pooled connections.
+func (s *SshExec) Close() {
+	if s.pool != nil {
+		s.pool.Close()
+	}
+}
+
+func (s *SshExec) dial(host string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", host, s.clientConfig)
+}
+
+// connect returns a client connected to host and a function to be
+// called once the client is no longer needed.
+func (s *SshExec) connect(host string) (*ssh.Client, func(failed bool), error) {
+	if s.pool != nil {
+		return s.pool.get(host)
+	}
+	client, err := s.dial(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, func(bool) { client.Close() }, nil
+}
+
 func getHostKeyCallback() ssh.HostKeyCallback {
 	hostKeysFiles := os.Getenv("SSH_KNOWN_HOSTS")
 	if len(hostKeysFiles) == 0 {
@@ -136,12 +182,13 @@ func (s *SshExec) ExecCommands(
 	cmdlog := rexlog.NewCommandLogger(s.logger)
 
 	// :TODO: Will need a timeout here in case the server does not respond
-	client, err := ssh.Dial("tcp", host, s.clientConfig)
+	client, done, err := s.connect(host)
 	if err != nil {
 		s.logger.Warning("Failed to create SSH connection to %v: %v", host, err)
 		return nil, err
 	}
-	defer client.Close()
+	connFailed := false
+	defer func() { done(connFailed) }()
 
 	// Execute each command
 	for index, cmd := range commands {
@@ -150,6 +197,7 @@ func (s *SshExec) ExecCommands(
 		session, err := client.NewSession()
 		if err != nil {
 			s.logger.LogError("Unable to create SSH session: %v", err)
+			connFailed = true
 			return nil, err
 		}
 		defer session.Close()
@@ -173,6 +221,7 @@ func (s *SshExec) ExecCommands(
 		// Execute command
 		err = session.Start(command)
 		if err != nil {
+			connFailed = true
 			return nil, err
 		}
 
@@ -202,6 +251,8 @@ func (s *SshExec) ExecCommands(
 				if ee, ok := err.(*ssh.ExitError); ok {
 					r.ExitStatus = ee.ExitStatus()
 				} else {
+					// the connection may be broken, do not reuse it
+					connFailed = true
 					r.ExitStatus = 1
 				}
 			}
@@ -219,6 +270,11 @@ func (s *SshExec) ExecCommands(
 				s.logger.LogError("Unable to send kill signal to command [%v] on host [%v]: %v",
 					command, host, err)
 			}
+			// closing the session ends it even if the kill signal
+			// did not get through; other batches on the connection
+			// keep running, but it is not given to new ones
+			session.Close()
+			connFailed = true
 			return results, errors.New("SSH command timeout")
 		}
 	}
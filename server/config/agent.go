@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/heketi/heketi/v10/executors/localexec"
+	"github.com/heketi/heketi/v10/pkg/nodeagent"
+)
+
+// AgentConfig is the configuration of the heketi node agent.
+type AgentConfig struct {
+	Port string             `json:"port"`
+	TLS  nodeagent.TLSFiles `json:"tls"`
+
+	// configuration of the executor running commands on the node
+	LocalExec localexec.LocalConfig `json:"localexec"`
+
+	// AllowExec enables the route running arbitrary command batches
+	// sent by the "agent" executor of the server. It is off by default
+	// so that the agent only runs the typed operations of the "node"
+	// executor.
+	AllowExec bool `json:"allow_exec"`
+}
+
+func ParseAgentConfig(input io.Reader) (config *AgentConfig, e error) {
+	configParser := json.NewDecoder(input)
+	if e = configParser.Decode(&config); e != nil {
+		fmt.Fprintf(os.Stderr,
+			"ERROR: Unable to parse agent configuration: %v\n",
+			e.Error())
+		return
+	}
+	return
+}
+
+func ReadAgentConfig(configfile string) (config *AgentConfig, e error) {
+	fp, e := os.Open(configfile)
+	if e != nil {
+		fmt.Fprintf(os.Stderr,
+			"ERROR: Unable to open agent config file %v: %v\n",
+			configfile,
+			e.Error())
+		return
+	}
+	defer fp.Close()
+	return ParseAgentConfig(fp)
+}
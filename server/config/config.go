@@ -17,6 +17,7 @@ import (
 
 	"github.com/heketi/heketi/v10/apps/glusterfs"
 	"github.com/heketi/heketi/v10/middleware"
+	"github.com/heketi/heketi/v10/server/ha"
 )
 
 type Config struct {
@@ -29,6 +30,10 @@ type Config struct {
 	KeyFile              string                   `json:"key_file"`
 	Profiling            bool                     `json:"profiling"`
 	DefaultState         string                   `json:"default_state"`
+	CsiSocket            string                   `json:"csi_socket"`
+
+	// high availability mode
+	HA ha.Config `json:"ha"`
 
 	// pull in the config sub-object for glusterfs app
 	GlusterFS *glusterfs.GlusterFSConfig `json:"glusterfs"`
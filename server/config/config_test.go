@@ -86,3 +86,31 @@ func TestReadConfigError(t *testing.T) {
 	_, err := ReadConfig("/this/path.should/never_exist/asdf")
 	tests.Assert(t, err != nil, "expected err != nil, got:", err)
 }
+
+func TestParseAgentConfig(t *testing.T) {
+	data := configString(`{
+		"port": "9443",
+		"tls": {
+			"cert_file": "/etc/heketi/agent.crt",
+			"key_file": "/etc/heketi/agent.key",
+			"ca_file": "/etc/heketi/ca.crt"
+		},
+		"localexec": {
+			"fstab": "/etc/fstab.heketi"
+		}
+	}`)
+	c, err := ParseAgentConfig(data)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.Port == "9443", `expected c.Port == "9443", got:`, c.Port)
+	tests.Assert(t, c.TLS.CAFile == "/etc/heketi/ca.crt",
+		`expected c.TLS.CAFile == "/etc/heketi/ca.crt", got:`, c.TLS.CAFile)
+	tests.Assert(t, c.LocalExec.Fstab == "/etc/fstab.heketi",
+		`expected c.LocalExec.Fstab == "/etc/fstab.heketi", got:`,
+		c.LocalExec.Fstab)
+	// raw command batches are off unless enabled
+	tests.Assert(t, !c.AllowExec, "expected c.AllowExec == false")
+
+	c, err = ParseAgentConfig(configString(`{"allow_exec": true}`))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.AllowExec, "expected c.AllowExec == true")
+}
@@ -0,0 +1,674 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package csi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+const (
+	gib = 1024 * 1024 * 1024
+	kib = 1024
+
+	// prefix of the CSI ids of block volumes; file volumes use the
+	// heketi volume id
+	blockIdPrefix = "block:"
+
+	// prefix of the idempotency keys of the volumes created through
+	// CSI
+	idempotencyKeyPrefix = "csi:"
+
+	// prefixes of the names of the heketi volumes holding snapshots
+	// and the volumes restored from a snapshot or cloned from a volume
+	snapshotNamePrefix = "csisnap_"
+	cloneNamePrefix    = "csiclone_"
+
+	// length of the name hash in the names of heketi volumes
+	nameHashLen = 24
+)
+
+var controllerCapabilities = []csi.ControllerServiceCapability_RPC_Type{
+	csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+	csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+	csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+	csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+	csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+	csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+}
+
+type controllerServer struct {
+	csi.UnimplementedControllerServer
+	server *Server
+}
+
+func (s *controllerServer) ControllerGetCapabilities(ctx context.Context,
+	req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+
+	caps := []*csi.ControllerServiceCapability{}
+	for _, c := range controllerCapabilities {
+		caps = append(caps, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{Type: c},
+			},
+		})
+	}
+	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
+}
+
+func (s *controllerServer) CreateVolume(ctx context.Context,
+	req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume name")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"missing volume capabilities")
+	}
+	size, err := requestedSize(req.GetCapacityRange())
+	if err != nil {
+		return nil, err
+	}
+	params, err := parseParams(req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateCapabilities(req.GetVolumeCapabilities(), params.block); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var v *csi.Volume
+	switch {
+	case req.GetVolumeContentSource() != nil:
+		if params.block {
+			return nil, status.Error(codes.InvalidArgument,
+				"block volumes can not be created from a content source")
+		}
+		v, err = s.createClone(req.GetName(), size, req.GetVolumeContentSource())
+	case params.block:
+		v, err = s.createBlockVolume(req.GetName(), size, &params.blockVolume)
+	default:
+		v, err = s.createVolume(req.GetName(), size, &params.volume)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &csi.CreateVolumeResponse{Volume: v}, nil
+}
+
+func (s *controllerServer) createVolume(name string, size int,
+	request *api.VolumeCreateRequest) (*csi.Volume, error) {
+
+	request.Size = size
+	request.IdempotencyKey = idempotencyKey(name)
+	info, err := s.server.heketi.VolumeCreate(request)
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	// a replayed request returns the volume created first
+	if info.Size != size {
+		return nil, status.Errorf(codes.AlreadyExists,
+			"volume %v exists with a size of %v GiB", name, info.Size)
+	}
+	return fileVolume(info), nil
+}
+
+func (s *controllerServer) createBlockVolume(name string, size int,
+	request *api.BlockVolumeCreateRequest) (*csi.Volume, error) {
+
+	request.Size = size
+	request.IdempotencyKey = idempotencyKey(name)
+	info, err := s.server.heketi.BlockVolumeCreate(request)
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	if info.Size != size {
+		return nil, status.Errorf(codes.AlreadyExists,
+			"volume %v exists with a size of %v GiB", name, info.Size)
+	}
+	return blockVolume(info), nil
+}
+
+// createClone creates the volume name as a clone of a snapshot or of
+// another file volume. As clones can not be created with an
+// idempotency key, the heketi volume is named after name instead.
+func (s *controllerServer) createClone(name string, size int,
+	source *csi.VolumeContentSource) (*csi.Volume, error) {
+
+	var sourceId string
+	switch {
+	case source.GetSnapshot() != nil:
+		sourceId = source.GetSnapshot().GetSnapshotId()
+		if _, err := s.snapshotVolume(sourceId); err != nil {
+			return nil, err
+		}
+	case source.GetVolume() != nil:
+		sourceId = source.GetVolume().GetVolumeId()
+		if _, err := s.fileVolumeInfo(sourceId); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument,
+			"unsupported volume content source")
+	}
+
+	cloneName := cloneNamePrefix + nameHash(name)
+	info, err := s.findVolume(cloneName)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		info, err = s.server.heketi.VolumeClone(sourceId,
+			&api.VolumeCloneRequest{Name: cloneName})
+		if err != nil {
+			return nil, heketiError(err)
+		}
+	}
+
+	switch {
+	case info.Size > size:
+		return nil, status.Errorf(codes.OutOfRange,
+			"the source of volume %v is larger than %v GiB", name, size)
+	case info.Size < size:
+		info, err = s.server.heketi.VolumeExpand(info.Id,
+			&api.VolumeExpandRequest{Size: size - info.Size})
+		if err != nil {
+			return nil, heketiError(err)
+		}
+	}
+	v := fileVolume(info)
+	v.ContentSource = source
+	return v, nil
+}
+
+// DeleteVolume deletes a volume. Volumes that do not exist are
+// reported deleted.
+func (s *controllerServer) DeleteVolume(ctx context.Context,
+	req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+
+	id := req.GetVolumeId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+
+	var err error
+	if bid, ok := blockVolumeId(id); ok {
+		err = s.server.heketi.BlockVolumeDelete(bid)
+	} else if _, err = s.fileVolumeInfo(id); err == nil {
+		err = s.server.heketi.VolumeDelete(id)
+	}
+	if err != nil && status.Code(err) != codes.NotFound && !isNotFound(err) {
+		return nil, heketiError(err)
+	}
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+func (s *controllerServer) ControllerExpandVolume(ctx context.Context,
+	req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+
+	id := req.GetVolumeId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+	if req.GetCapacityRange() == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing capacity range")
+	}
+	size, err := requestedSize(req.GetCapacityRange())
+	if err != nil {
+		return nil, err
+	}
+
+	if bid, ok := blockVolumeId(id); ok {
+		info, err := s.server.heketi.BlockVolumeInfo(bid)
+		if err != nil {
+			return nil, heketiError(err)
+		}
+		if info.Size < size {
+			info, err = s.server.heketi.BlockVolumeExpand(bid,
+				&api.BlockVolumeExpandRequest{Size: size})
+			if err != nil {
+				return nil, heketiError(err)
+			}
+		}
+		// the file system on the block device is grown by the node
+		return &csi.ControllerExpandVolumeResponse{
+			CapacityBytes:         int64(info.Size) * gib,
+			NodeExpansionRequired: true,
+		}, nil
+	}
+
+	info, err := s.fileVolumeInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size < size {
+		info, err = s.server.heketi.VolumeExpand(id,
+			&api.VolumeExpandRequest{Size: size - info.Size})
+		if err != nil {
+			return nil, heketiError(err)
+		}
+	}
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes: int64(info.Size) * gib,
+	}, nil
+}
+
+func (s *controllerServer) ValidateVolumeCapabilities(ctx context.Context,
+	req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+
+	id := req.GetVolumeId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"missing volume capabilities")
+	}
+
+	bid, block := blockVolumeId(id)
+	var err error
+	if block {
+		_, err = s.server.heketi.BlockVolumeInfo(bid)
+		err = heketiError(err)
+	} else {
+		_, err = s.fileVolumeInfo(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCapabilities(req.GetVolumeCapabilities(), block); err != nil {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+			Parameters:         req.GetParameters(),
+		},
+	}, nil
+}
+
+// ListVolumes lists the file and block volumes, except the volumes
+// heketi uses internally and the volumes holding snapshots. The
+// starting token is the index of the first volume to list.
+func (s *controllerServer) ListVolumes(ctx context.Context,
+	req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+
+	if req.GetMaxEntries() < 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"max entries can not be negative")
+	}
+	start := 0
+	if t := req.GetStartingToken(); t != "" {
+		var err error
+		start, err = strconv.Atoi(t)
+		if err != nil || start < 0 {
+			return nil, status.Errorf(codes.Aborted,
+				"invalid starting token %q", t)
+		}
+	}
+
+	volumes, err := s.server.heketi.VolumeList()
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	blockVolumes, err := s.server.heketi.BlockVolumeList()
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	ids := append([]string{}, volumes.Volumes...)
+	for _, id := range blockVolumes.BlockVolumes {
+		ids = append(ids, blockIdPrefix+id)
+	}
+	sort.Strings(ids)
+	if start > len(ids) {
+		return nil, status.Errorf(codes.Aborted,
+			"invalid starting token %q", req.GetStartingToken())
+	}
+
+	resp := &csi.ListVolumesResponse{}
+	for i := start; i < len(ids); i++ {
+		if req.GetMaxEntries() > 0 &&
+			len(resp.Entries) == int(req.GetMaxEntries()) {
+
+			resp.NextToken = strconv.Itoa(i)
+			break
+		}
+		v, err := s.volume(ids[i])
+		if status.Code(err) == codes.NotFound {
+			// deleted while listing or not a CSI volume
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		resp.Entries = append(resp.Entries,
+			&csi.ListVolumesResponse_Entry{Volume: v})
+	}
+	return resp, nil
+}
+
+// GetCapacity returns the storage free in the online devices of the
+// clusters given in the parameters, or of all clusters. For file
+// volumes it is reduced according to their volume type.
+func (s *controllerServer) GetCapacity(ctx context.Context,
+	req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+
+	params, err := parseParams(req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	clusters := map[string]bool{}
+	for _, c := range params.volume.Clusters {
+		clusters[c] = true
+	}
+
+	topology, err := s.server.heketi.TopologyInfo()
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	var free uint64
+	for _, c := range topology.ClusterList {
+		if len(clusters) > 0 && !clusters[c.Id] {
+			continue
+		}
+		if (params.block && !c.Block) || (!params.block && !c.File) {
+			continue
+		}
+		for _, n := range c.Nodes {
+			if n.State != api.EntryStateOnline {
+				continue
+			}
+			for _, d := range n.DevicesInfo {
+				if d.State == api.EntryStateOnline {
+					free += d.Storage.Free
+				}
+			}
+		}
+	}
+
+	capacity := float64(free*kib) * usableFraction(params.volume.Durability)
+	return &csi.GetCapacityResponse{AvailableCapacity: int64(capacity)}, nil
+}
+
+// CreateSnapshot creates a snapshot of a file volume as a clone of
+// the volume. The heketi volume holding the snapshot is named after
+// the snapshot name and the source volume.
+func (s *controllerServer) CreateSnapshot(ctx context.Context,
+	req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing snapshot name")
+	}
+	sourceId := req.GetSourceVolumeId()
+	if sourceId == "" {
+		return nil, status.Error(codes.InvalidArgument,
+			"missing source volume id")
+	}
+	if _, ok := blockVolumeId(sourceId); ok {
+		return nil, status.Error(codes.InvalidArgument,
+			"snapshots of block volumes are not supported")
+	}
+
+	prefix := snapshotNamePrefix + nameHash(req.GetName()) + "_"
+	info, err := s.findVolume(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil && info.Name != prefix+sourceId {
+		return nil, status.Errorf(codes.AlreadyExists,
+			"snapshot %v exists for another volume", req.GetName())
+	}
+	if info == nil {
+		if _, err := s.fileVolumeInfo(sourceId); err != nil {
+			return nil, err
+		}
+		info, err = s.server.heketi.VolumeClone(sourceId,
+			&api.VolumeCloneRequest{Name: prefix + sourceId})
+		if err != nil {
+			return nil, heketiError(err)
+		}
+	}
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{
+			SnapshotId:     info.Id,
+			SourceVolumeId: sourceId,
+			SizeBytes:      int64(info.Size) * gib,
+			CreationTime:   ptypes.TimestampNow(),
+			ReadyToUse:     true,
+		},
+	}, nil
+}
+
+// DeleteSnapshot deletes a snapshot. Snapshots that do not exist are
+// reported deleted.
+func (s *controllerServer) DeleteSnapshot(ctx context.Context,
+	req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+
+	id := req.GetSnapshotId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing snapshot id")
+	}
+	_, err := s.snapshotVolume(id)
+	if err == nil {
+		err = s.server.heketi.VolumeDelete(id)
+	}
+	if err != nil && status.Code(err) != codes.NotFound && !isNotFound(err) {
+		return nil, heketiError(err)
+	}
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// volume returns the CSI volume with the given id.
+func (s *controllerServer) volume(id string) (*csi.Volume, error) {
+	if bid, ok := blockVolumeId(id); ok {
+		info, err := s.server.heketi.BlockVolumeInfo(bid)
+		if err != nil {
+			return nil, heketiError(err)
+		}
+		return blockVolume(info), nil
+	}
+	info, err := s.fileVolumeInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	return fileVolume(info), nil
+}
+
+// fileVolumeInfo returns the heketi volume of a CSI file volume. The
+// block hosting volumes and the volumes holding snapshots are not
+// found.
+func (s *controllerServer) fileVolumeInfo(id string) (*api.VolumeInfoResponse, error) {
+	info, err := s.server.heketi.VolumeInfo(id)
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	if info.Block || strings.HasPrefix(info.Name, snapshotNamePrefix) {
+		return nil, status.Errorf(codes.NotFound, "volume %v not found", id)
+	}
+	return info, nil
+}
+
+// snapshotVolume returns the heketi volume holding a snapshot.
+func (s *controllerServer) snapshotVolume(id string) (*api.VolumeInfoResponse, error) {
+	info, err := s.server.heketi.VolumeInfo(id)
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	if !strings.HasPrefix(info.Name, snapshotNamePrefix) {
+		return nil, status.Errorf(codes.NotFound, "snapshot %v not found", id)
+	}
+	return info, nil
+}
+
+// findVolume returns the heketi volume whose name starts with
+// prefix, or nil if there is none.
+func (s *controllerServer) findVolume(prefix string) (*api.VolumeInfoResponse, error) {
+	volumes, err := s.server.heketi.VolumeListWithQuery(&api.ListQuery{
+		NamePrefix: prefix,
+		Limit:      1,
+		Detail:     true,
+	})
+	if err != nil {
+		return nil, heketiError(err)
+	}
+	if len(volumes.Details) == 0 {
+		return nil, nil
+	}
+	return &volumes.Details[0], nil
+}
+
+func fileVolume(info *api.VolumeInfoResponse) *csi.Volume {
+	mount := info.Mount.GlusterFS
+	return &csi.Volume{
+		VolumeId:      info.Id,
+		CapacityBytes: int64(info.Size) * gib,
+		VolumeContext: map[string]string{
+			"name":                   info.Name,
+			"cluster":                info.Cluster,
+			"mountpoint":             mount.MountPoint,
+			"hosts":                  strings.Join(mount.Hosts, ","),
+			"backup-volfile-servers": mount.Options["backup-volfile-servers"],
+		},
+	}
+}
+
+func blockVolume(info *api.BlockVolumeInfoResponse) *csi.Volume {
+	hosts := info.BlockVolume.Hosts
+	ctx := map[string]string{
+		"name":     info.Name,
+		"cluster":  info.Cluster,
+		"iqn":      info.BlockVolume.Iqn,
+		"lun":      strconv.Itoa(info.BlockVolume.Lun),
+		"chapAuth": strconv.FormatBool(info.BlockVolume.Username != ""),
+	}
+	if len(hosts) > 0 {
+		ctx["targetPortal"] = hosts[0]
+		ctx["portals"] = strings.Join(hosts[1:], ",")
+	}
+	return &csi.Volume{
+		VolumeId:      blockIdPrefix + info.Id,
+		CapacityBytes: int64(info.Size) * gib,
+		VolumeContext: ctx,
+	}
+}
+
+// blockVolumeId returns the heketi id of a CSI block volume id.
+func blockVolumeId(id string) (string, bool) {
+	if strings.HasPrefix(id, blockIdPrefix) {
+		return strings.TrimPrefix(id, blockIdPrefix), true
+	}
+	return "", false
+}
+
+// idempotencyKey returns the idempotency key of the heketi create
+// request of the CSI volume name.
+func idempotencyKey(name string) string {
+	key := idempotencyKeyPrefix + name
+	if api.ValidateIdempotencyKey(key) == nil {
+		return key
+	}
+	return idempotencyKeyPrefix + nameHash(name)
+}
+
+func nameHash(name string) string {
+	h := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(h[:])[:nameHashLen]
+}
+
+// requestedSize returns the size in GiB of a volume within the range.
+// Volumes are 1 GiB when no size is required.
+func requestedSize(r *csi.CapacityRange) (int, error) {
+	required, limit := r.GetRequiredBytes(), r.GetLimitBytes()
+	if required < 0 || limit < 0 {
+		return 0, status.Error(codes.InvalidArgument,
+			"capacity range can not be negative")
+	}
+	if limit > 0 && required > limit {
+		return 0, status.Error(codes.InvalidArgument,
+			"required bytes exceed the limit bytes")
+	}
+	size := (required + gib - 1) / gib
+	if size == 0 {
+		size = 1
+	}
+	if limit > 0 && size*gib > limit {
+		return 0, status.Errorf(codes.OutOfRange,
+			"volumes are allocated in GiB, %v GiB exceeds the limit of %v bytes",
+			size, limit)
+	}
+	return int(size), nil
+}
+
+// validateCapabilities checks that volumes support the capabilities.
+// File volumes can be mounted by many nodes, block volumes by a
+// single node.
+func validateCapabilities(caps []*csi.VolumeCapability, block bool) error {
+	for _, c := range caps {
+		if c.GetBlock() != nil && !block {
+			return fmt.Errorf("file volumes do not support block access")
+		}
+		if c.GetBlock() == nil && c.GetMount() == nil {
+			return fmt.Errorf("missing access type")
+		}
+		switch c.GetAccessMode().GetMode() {
+		case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER:
+		case csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER,
+			csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER:
+			if block {
+				return fmt.Errorf("block volumes support single node access only")
+			}
+		default:
+			return fmt.Errorf("unsupported access mode %v",
+				c.GetAccessMode().GetMode())
+		}
+	}
+	return nil
+}
+
+// heketiError returns the gRPC status of an error of the heketi api.
+func heketiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case isNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case strings.Contains(err.Error(), "No space"):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func isNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Id not found")
+}
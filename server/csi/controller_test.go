@@ -0,0 +1,557 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package csi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/gorilla/mux"
+	"github.com/heketi/tests"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heketi/heketi/v10/apps/glusterfs"
+	"github.com/heketi/heketi/v10/executors"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+type testDriver struct {
+	server     *Server
+	identity   csi.IdentityClient
+	controller csi.ControllerClient
+}
+
+// setupTestDriver serves the CSI driver of a heketi test app on a
+// temporary socket. The app has a cluster of three nodes with four
+// devices each.
+func setupTestDriver(t *testing.T) (*testDriver, func()) {
+	dir, err := ioutil.TempDir("", "heketi-csi")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	app := glusterfs.NewTestApp(filepath.Join(dir, "heketi.db"))
+	mockClones(app)
+	router := mux.NewRouter()
+	err = app.SetRoutes(router)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	s := New(router, "test")
+	socket := filepath.Join(dir, "csi.sock")
+	go s.Serve(socket)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "unix://"+socket,
+		grpc.WithInsecure(), grpc.WithBlock())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	cluster, err := s.heketi.ClusterCreate(&api.ClusterCreateRequest{
+		ClusterFlags: api.ClusterFlags{Block: true, File: true},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	for n := 0; n < 3; n++ {
+		host := fmt.Sprintf("node%v", n)
+		node, err := s.heketi.NodeAdd(&api.NodeAddRequest{
+			Zone:      n + 1,
+			ClusterId: cluster.Id,
+			Hostnames: api.HostAddresses{
+				Manage:  []string{host},
+				Storage: []string{host},
+			},
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for d := 0; d < 4; d++ {
+			err := s.heketi.DeviceAdd(&api.DeviceAddRequest{
+				NodeId: node.Id,
+				Device: api.Device{Name: fmt.Sprintf("/dev/sd%c", 'b'+d)},
+			})
+			tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		}
+	}
+
+	d := &testDriver{
+		server:     s,
+		identity:   csi.NewIdentityClient(conn),
+		controller: csi.NewControllerClient(conn),
+	}
+	return d, func() {
+		conn.Close()
+		s.Stop()
+		app.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// mockClones makes the mock executor of app remember the bricks of
+// the volumes it creates, as cloning a volume requires them.
+func mockClones(app *glusterfs.App) {
+	var lock sync.Mutex
+	volumes := map[string][]executors.Brick{}
+	addBricks := func(volume string, bricks []executors.BrickInfo) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, b := range bricks {
+			volumes[volume] = append(volumes[volume],
+				executors.Brick{Name: b.Host + ":" + b.Path})
+		}
+	}
+
+	xo := app.MockExecutor()
+	xo.MockVolumeCreate = func(host string,
+		v *executors.VolumeRequest) (*executors.Volume, error) {
+
+		addBricks(v.Name, v.Bricks)
+		return &executors.Volume{}, nil
+	}
+	xo.MockVolumeExpand = func(host string,
+		v *executors.VolumeRequest) (*executors.Volume, error) {
+
+		addBricks(v.Name, v.Bricks)
+		return &executors.Volume{}, nil
+	}
+	xo.MockVolumeInfo = func(host string,
+		volume string) (*executors.Volume, error) {
+
+		lock.Lock()
+		defer lock.Unlock()
+		return &executors.Volume{
+			VolumeName: volume,
+			Bricks:     executors.Bricks{BrickList: volumes[volume]},
+		}, nil
+	}
+	xo.MockVolumeClone = func(host string,
+		vcr *executors.VolumeCloneRequest) (*executors.Volume, error) {
+
+		lock.Lock()
+		defer lock.Unlock()
+		clone := &executors.Volume{VolumeName: vcr.Clone, ID: vcr.Clone}
+		for _, b := range volumes[vcr.Volume] {
+			clone.Bricks.BrickList = append(clone.Bricks.BrickList,
+				executors.Brick{Name: b.Name + "_" + vcr.Clone})
+		}
+		volumes[vcr.Clone] = clone.Bricks.BrickList
+		return clone, nil
+	}
+}
+
+func mountCapability(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+	}
+}
+
+func createRequest(name string, size int64,
+	params map[string]string) *csi.CreateVolumeRequest {
+
+	return &csi.CreateVolumeRequest{
+		Name:          name,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: size},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			mountCapability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+		},
+		Parameters: params,
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	info, err := d.identity.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Name == DriverName)
+	tests.Assert(t, info.VendorVersion == "test")
+
+	caps, err := d.identity.GetPluginCapabilities(ctx,
+		&csi.GetPluginCapabilitiesRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, caps.Capabilities[0].GetService().GetType() ==
+		csi.PluginCapability_Service_CONTROLLER_SERVICE)
+
+	probe, err := d.identity.Probe(ctx, &csi.ProbeRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, probe.Ready.GetValue())
+}
+
+func TestCreateDeleteVolume(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	params := map[string]string{
+		ParamVolumeType:    "replicate:3",
+		ParamGid:           "2000",
+		ParamVolumeOptions: "performance.cache-size 1GB, user.heketi.test x",
+	}
+	req := createRequest("pvc-1", 2*gib+1, params)
+	resp, err := d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := resp.Volume
+	tests.Assert(t, v.CapacityBytes == 3*gib, "got:", v.CapacityBytes)
+	tests.Assert(t, v.VolumeContext["mountpoint"] != "")
+
+	info, err := d.server.heketi.VolumeInfo(v.VolumeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, info.Durability.Type == api.DurabilityReplicate)
+	tests.Assert(t, info.Durability.Replicate.Replica == 3)
+	tests.Assert(t, info.Gid == 2000)
+	options := strings.Join(info.GlusterVolumeOptions, ",")
+	tests.Assert(t, strings.Contains(options, "performance.cache-size 1GB"),
+		"got:", info.GlusterVolumeOptions)
+	tests.Assert(t, strings.Contains(options, "user.heketi.test x"),
+		"got:", info.GlusterVolumeOptions)
+
+	// creating the volume again returns the same volume
+	resp, err = d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Volume.VolumeId == v.VolumeId)
+
+	// with another size it is refused
+	_, err = d.controller.CreateVolume(ctx, createRequest("pvc-1", 5*gib, params))
+	tests.Assert(t, status.Code(err) == codes.AlreadyExists, "got:", err)
+
+	vresp, err := d.controller.ValidateVolumeCapabilities(ctx,
+		&csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId: v.VolumeId,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER),
+			},
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vresp.Confirmed != nil)
+
+	list, err := d.controller.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Entries) == 1, "got:", list.Entries)
+	tests.Assert(t, list.Entries[0].Volume.VolumeId == v.VolumeId)
+
+	_, err = d.controller.DeleteVolume(ctx,
+		&csi.DeleteVolumeRequest{VolumeId: v.VolumeId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = d.server.heketi.VolumeInfo(v.VolumeId)
+	tests.Assert(t, isNotFound(err), "got:", err)
+
+	// deleting a volume that does not exist succeeds
+	_, err = d.controller.DeleteVolume(ctx,
+		&csi.DeleteVolumeRequest{VolumeId: v.VolumeId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// and the name can be used again
+	resp, err = d.controller.CreateVolume(ctx, createRequest("pvc-1", 5*gib, params))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, resp.Volume.VolumeId != v.VolumeId)
+}
+
+func TestCreateVolumeInvalid(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := d.controller.CreateVolume(ctx, createRequest("", gib, nil))
+	tests.Assert(t, status.Code(err) == codes.InvalidArgument, "got:", err)
+
+	_, err = d.controller.CreateVolume(ctx,
+		createRequest("pvc-1", gib, map[string]string{"foo": "bar"}))
+	tests.Assert(t, status.Code(err) == codes.InvalidArgument, "got:", err)
+
+	_, err = d.controller.CreateVolume(ctx,
+		createRequest("pvc-1", gib, map[string]string{ParamHacount: "3"}))
+	tests.Assert(t, status.Code(err) == codes.InvalidArgument, "got:", err)
+
+	req := createRequest("pvc-1", 0, nil)
+	req.CapacityRange.LimitBytes = gib / 2
+	_, err = d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, status.Code(err) == codes.OutOfRange, "got:", err)
+
+	req = createRequest("pvc-1", gib, nil)
+	req.VolumeCapabilities[0].AccessType = &csi.VolumeCapability_Block{
+		Block: &csi.VolumeCapability_BlockVolume{},
+	}
+	_, err = d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, status.Code(err) == codes.InvalidArgument, "got:", err)
+
+	_, err = d.controller.CreateVolume(ctx, createRequest("pvc-1", 7000*gib, nil))
+	tests.Assert(t, status.Code(err) == codes.ResourceExhausted, "got:", err)
+}
+
+func TestBlockVolume(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	params := map[string]string{
+		ParamBlock:   "true",
+		ParamHacount: "3",
+		ParamAuth:    "true",
+	}
+	resp, err := d.controller.CreateVolume(ctx, createRequest("pvc-b", gib, params))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v := resp.Volume
+	tests.Assert(t, strings.HasPrefix(v.VolumeId, blockIdPrefix))
+	tests.Assert(t, v.VolumeContext["iqn"] != "")
+	tests.Assert(t, v.VolumeContext["chapAuth"] == "true")
+
+	// block volumes are attached to a single node
+	vresp, err := d.controller.ValidateVolumeCapabilities(ctx,
+		&csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId: v.VolumeId,
+			VolumeCapabilities: []*csi.VolumeCapability{
+				mountCapability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER),
+			},
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vresp.Confirmed == nil)
+	tests.Assert(t, vresp.Message != "")
+
+	eresp, err := d.controller.ControllerExpandVolume(ctx,
+		&csi.ControllerExpandVolumeRequest{
+			VolumeId:      v.VolumeId,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * gib},
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, eresp.CapacityBytes == 2*gib)
+	tests.Assert(t, eresp.NodeExpansionRequired)
+
+	// the block hosting volume is not listed
+	list, err := d.controller.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Entries) == 1, "got:", list.Entries)
+	tests.Assert(t, list.Entries[0].Volume.VolumeId == v.VolumeId)
+
+	_, err = d.controller.DeleteVolume(ctx,
+		&csi.DeleteVolumeRequest{VolumeId: v.VolumeId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	bl, err := d.server.heketi.BlockVolumeList()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(bl.BlockVolumes) == 0)
+}
+
+func TestControllerExpandVolume(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	resp, err := d.controller.CreateVolume(ctx, createRequest("pvc-1", gib, nil))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	eresp, err := d.controller.ControllerExpandVolume(ctx,
+		&csi.ControllerExpandVolumeRequest{
+			VolumeId:      resp.Volume.VolumeId,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 3 * gib},
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, eresp.CapacityBytes == 3*gib)
+	tests.Assert(t, !eresp.NodeExpansionRequired)
+
+	// volumes are never shrunk
+	eresp, err = d.controller.ControllerExpandVolume(ctx,
+		&csi.ControllerExpandVolumeRequest{
+			VolumeId:      resp.Volume.VolumeId,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * gib},
+		})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, eresp.CapacityBytes == 3*gib)
+
+	_, err = d.controller.ControllerExpandVolume(ctx,
+		&csi.ControllerExpandVolumeRequest{
+			VolumeId:      "0123456789abcdef0123456789abcdef",
+			CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * gib},
+		})
+	tests.Assert(t, status.Code(err) == codes.NotFound, "got:", err)
+}
+
+func TestSnapshots(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	params := map[string]string{ParamSnapFactor: "1.5"}
+	v1, err := d.controller.CreateVolume(ctx, createRequest("pvc-1", gib, params))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	v2, err := d.controller.CreateVolume(ctx, createRequest("pvc-2", gib, params))
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	sreq := &csi.CreateSnapshotRequest{
+		Name:           "snap-1",
+		SourceVolumeId: v1.Volume.VolumeId,
+	}
+	snap, err := d.controller.CreateSnapshot(ctx, sreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, snap.Snapshot.SourceVolumeId == v1.Volume.VolumeId)
+	tests.Assert(t, snap.Snapshot.ReadyToUse)
+
+	again, err := d.controller.CreateSnapshot(ctx, sreq)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again.Snapshot.SnapshotId == snap.Snapshot.SnapshotId)
+
+	sreq.SourceVolumeId = v2.Volume.VolumeId
+	_, err = d.controller.CreateSnapshot(ctx, sreq)
+	tests.Assert(t, status.Code(err) == codes.AlreadyExists, "got:", err)
+
+	// snapshots are not volumes
+	list, err := d.controller.ListVolumes(ctx, &csi.ListVolumesRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(list.Entries) == 2, "got:", list.Entries)
+	_, err = d.controller.DeleteVolume(ctx,
+		&csi.DeleteVolumeRequest{VolumeId: snap.Snapshot.SnapshotId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = d.server.heketi.VolumeInfo(snap.Snapshot.SnapshotId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// restore the snapshot to a larger volume
+	req := createRequest("pvc-3", 2*gib, nil)
+	req.VolumeContentSource = &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Snapshot{
+			Snapshot: &csi.VolumeContentSource_SnapshotSource{
+				SnapshotId: snap.Snapshot.SnapshotId,
+			},
+		},
+	}
+	v3, err := d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, v3.Volume.CapacityBytes == 2*gib)
+	tests.Assert(t, v3.Volume.ContentSource.GetSnapshot() != nil)
+	again3, err := d.controller.CreateVolume(ctx, req)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, again3.Volume.VolumeId == v3.Volume.VolumeId)
+
+	_, err = d.controller.DeleteSnapshot(ctx,
+		&csi.DeleteSnapshotRequest{SnapshotId: snap.Snapshot.SnapshotId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = d.server.heketi.VolumeInfo(snap.Snapshot.SnapshotId)
+	tests.Assert(t, isNotFound(err), "got:", err)
+
+	// volumes are not snapshots
+	_, err = d.controller.DeleteSnapshot(ctx,
+		&csi.DeleteSnapshotRequest{SnapshotId: v1.Volume.VolumeId})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = d.server.heketi.VolumeInfo(v1.Volume.VolumeId)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestListVolumesPages(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := d.controller.CreateVolume(ctx,
+			createRequest(fmt.Sprintf("pvc-%v", i), gib, nil))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+
+	seen := map[string]bool{}
+	token := ""
+	for pages := 0; pages < 3; pages++ {
+		list, err := d.controller.ListVolumes(ctx, &csi.ListVolumesRequest{
+			MaxEntries:    2,
+			StartingToken: token,
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		for _, e := range list.Entries {
+			seen[e.Volume.VolumeId] = true
+		}
+		token = list.NextToken
+	}
+	tests.Assert(t, token == "", "got:", token)
+	tests.Assert(t, len(seen) == 5, "got:", seen)
+
+	_, err := d.controller.ListVolumes(ctx,
+		&csi.ListVolumesRequest{StartingToken: "x"})
+	tests.Assert(t, status.Code(err) == codes.Aborted, "got:", err)
+}
+
+func TestGetCapacity(t *testing.T) {
+	d, cleanup := setupTestDriver(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// three nodes with four 500 GiB devices
+	raw := int64(3*4*500) * gib
+	c, err := d.controller.GetCapacity(ctx, &csi.GetCapacityRequest{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.AvailableCapacity == raw, "got:", c.AvailableCapacity)
+
+	c, err = d.controller.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{ParamVolumeType: "replicate:3"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.AvailableCapacity == raw/3, "got:", c.AvailableCapacity)
+
+	c, err = d.controller.GetCapacity(ctx, &csi.GetCapacityRequest{
+		Parameters: map[string]string{ParamClusters: "0123456789abcdef0123456789abcdef"},
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.AvailableCapacity == 0, "got:", c.AvailableCapacity)
+}
+
+func TestParseParams(t *testing.T) {
+	vp, err := parseParams(map[string]string{
+		ParamVolumeType: "disperse:4:2",
+		ParamClusters:   "a, b",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !vp.block)
+	tests.Assert(t, vp.volume.Durability.Type == api.DurabilityEC)
+	tests.Assert(t, vp.volume.Durability.Disperse.Data == 4)
+	tests.Assert(t, vp.volume.Durability.Disperse.Redundancy == 2)
+	tests.Assert(t, len(vp.volume.Clusters) == 2)
+	tests.Assert(t, vp.volume.Clusters[1] == "b")
+
+	vp, err = parseParams(map[string]string{ParamVolumeType: "none"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vp.volume.Durability.Type == api.DurabilityDistributeOnly)
+	tests.Assert(t, vp.volume.Tags == nil)
+
+	vp, err = parseParams(map[string]string{ParamProfile: "ssd-strict"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vp.volume.Profile == "ssd-strict", "got:", vp.volume.Profile)
+
+	vp, err = parseParams(map[string]string{ParamAntiAffinity: "app=db,role=primary"})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vp.volume.AntiAffinity.Selector == "app=db,role=primary",
+		"got:", vp.volume.AntiAffinity)
+
+	vp, err = parseParams(map[string]string{
+		ParamBlock:                         "true",
+		"csi.storage.k8s.io/pvc/name":      "claim1",
+		"csi.storage.k8s.io/pvc/namespace": "ns1",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, vp.blockVolume.Tags["pvc"] == "claim1")
+	tests.Assert(t, vp.blockVolume.Tags["namespace"] == "ns1")
+
+	for _, params := range []map[string]string{
+		{ParamVolumeType: "replicate"},
+		{ParamVolumeType: "disperse:4"},
+		{ParamVolumeType: "mirror:2"},
+		{ParamGid: "x"},
+		{ParamBlock: "maybe"},
+		{ParamBlock: "true", ParamGid: "100"},
+		{ParamAuth: "true"},
+		{ParamBlock: "true", ParamProfile: "ssd-strict"},
+		{ParamBlock: "true", ParamAntiAffinity: "app=db"},
+	} {
+		_, err := parseParams(params)
+		tests.Assert(t, err != nil, "expected err != nil for", params)
+	}
+}
@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package csi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// Parameters accepted in the CreateVolume and GetCapacity requests,
+// usually set in the storage class.
+const (
+	// ParamVolumeType is the durability of file volumes: "none",
+	// "replicate:<replica>" or "disperse:<data>:<redundancy>"
+	ParamVolumeType = "volumetype"
+	// ParamClusters is a comma separated list of cluster ids
+	ParamClusters = "clusters"
+	// ParamGid is the group id owning file volumes
+	ParamGid = "gid"
+	// ParamVolumeOptions is a comma separated list of gluster volume
+	// options of file volumes, such as "performance.cache-size 1GB"
+	ParamVolumeOptions = "volumeoptions"
+	// ParamSnapFactor enables snapshots of file volumes, reserving
+	// factor times their size
+	ParamSnapFactor = "snapfactor"
+	// ParamBlock creates block volumes when "true"
+	ParamBlock = "block"
+	// ParamHacount is the number of paths to block volumes
+	ParamHacount = "hacount"
+	// ParamAuth enables CHAP authentication of block volumes when
+	// "true"
+	ParamAuth = "auth"
+	// ParamProfile names the placement profile of file volumes
+	ParamProfile = "profile"
+	// ParamAntiAffinity keeps file volumes off the nodes of the
+	// volumes whose tags match the selector, such as "app=db"
+	ParamAntiAffinity = "antiaffinity"
+)
+
+// metadataTags maps the parameters the external-provisioner adds when
+// run with --extra-create-metadata to the tags set on the volumes, so
+// that volumes can be traced back to their claims.
+var metadataTags = map[string]string{
+	"csi.storage.k8s.io/pvc/name":      "pvc",
+	"csi.storage.k8s.io/pvc/namespace": "namespace",
+	"csi.storage.k8s.io/pv/name":       "pv",
+}
+
+// volumeParams holds the create requests described by the parameters
+// of a CSI request. The size of the requests is not set.
+type volumeParams struct {
+	block       bool
+	volume      api.VolumeCreateRequest
+	blockVolume api.BlockVolumeCreateRequest
+}
+
+func parseParams(params map[string]string) (*volumeParams, error) {
+	vp := &volumeParams{}
+	if v, ok := params[ParamBlock]; ok {
+		block, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v parameter %q", ParamBlock, v)
+		}
+		vp.block = block
+	}
+
+	for k, v := range params {
+		if tag, ok := metadataTags[k]; ok {
+			if vp.volume.Tags == nil {
+				vp.volume.Tags = map[string]string{}
+				vp.blockVolume.Tags = vp.volume.Tags
+			}
+			vp.volume.Tags[tag] = v
+			continue
+		}
+
+		var err error
+		switch k {
+		case ParamBlock:
+		case ParamClusters:
+			clusters := splitList(v)
+			vp.volume.Clusters = clusters
+			vp.blockVolume.Clusters = clusters
+		case ParamVolumeType:
+			err = vp.fileOnly()
+			if err == nil {
+				vp.volume.Durability, err = parseVolumeType(v)
+			}
+		case ParamGid:
+			err = vp.fileOnly()
+			if err == nil {
+				vp.volume.Gid, err = strconv.ParseInt(v, 10, 32)
+			}
+		case ParamVolumeOptions:
+			err = vp.fileOnly()
+			if err == nil {
+				vp.volume.GlusterVolumeOptions = splitList(v)
+			}
+		case ParamProfile:
+			err = vp.fileOnly()
+			if err == nil {
+				vp.volume.Profile = v
+			}
+		case ParamAntiAffinity:
+			err = vp.fileOnly()
+			if err == nil {
+				vp.volume.AntiAffinity = &api.VolumeAntiAffinity{Selector: v}
+			}
+		case ParamSnapFactor:
+			err = vp.fileOnly()
+			if err == nil {
+				var factor float64
+				factor, err = strconv.ParseFloat(v, 32)
+				vp.volume.Snapshot.Enable = true
+				vp.volume.Snapshot.Factor = float32(factor)
+			}
+		case ParamHacount:
+			err = vp.blockOnly()
+			if err == nil {
+				vp.blockVolume.Hacount, err = strconv.Atoi(v)
+			}
+		case ParamAuth:
+			err = vp.blockOnly()
+			if err == nil {
+				vp.blockVolume.Auth, err = strconv.ParseBool(v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown parameter %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v parameter %q: %v", k, v, err)
+		}
+	}
+	return vp, nil
+}
+
+func (vp *volumeParams) fileOnly() error {
+	if vp.block {
+		return fmt.Errorf("not supported by block volumes")
+	}
+	return nil
+}
+
+func (vp *volumeParams) blockOnly() error {
+	if !vp.block {
+		return fmt.Errorf("only supported by block volumes")
+	}
+	return nil
+}
+
+// parseVolumeType parses the durability of a volume, as the
+// volumetype parameter of the kubernetes glusterfs provisioner.
+func parseVolumeType(v string) (api.VolumeDurabilityInfo, error) {
+	var d api.VolumeDurabilityInfo
+	parts := strings.Split(v, ":")
+	switch api.DurabilityType(parts[0]) {
+	case api.DurabilityDistributeOnly:
+		if len(parts) != 1 {
+			return d, fmt.Errorf("expected %q", api.DurabilityDistributeOnly)
+		}
+		d.Type = api.DurabilityDistributeOnly
+	case api.DurabilityReplicate:
+		if len(parts) != 2 {
+			return d, fmt.Errorf("expected \"replicate:<replica>\"")
+		}
+		replica, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return d, err
+		}
+		d.Type = api.DurabilityReplicate
+		d.Replicate.Replica = replica
+	case api.DurabilityEC:
+		if len(parts) != 3 {
+			return d, fmt.Errorf("expected \"disperse:<data>:<redundancy>\"")
+		}
+		data, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return d, err
+		}
+		redundancy, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return d, err
+		}
+		d.Type = api.DurabilityEC
+		d.Disperse.Data = data
+		d.Disperse.Redundancy = redundancy
+	default:
+		return d, fmt.Errorf("unknown volume type")
+	}
+	return d, nil
+}
+
+// usableFraction returns the fraction of raw storage that file
+// volumes of durability d can use.
+func usableFraction(d api.VolumeDurabilityInfo) float64 {
+	switch d.Type {
+	case api.DurabilityReplicate:
+		if d.Replicate.Replica > 0 {
+			return 1 / float64(d.Replicate.Replica)
+		}
+	case api.DurabilityEC:
+		if d.Disperse.Data > 0 {
+			return float64(d.Disperse.Data) /
+				float64(d.Disperse.Data+d.Disperse.Redundancy)
+		}
+	}
+	return 1
+}
+
+func splitList(v string) []string {
+	var l []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			l = append(l, s)
+		}
+	}
+	return l
+}
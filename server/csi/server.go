@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package csi serves the identity and controller services of the
+// Container Storage Interface on top of the heketi REST api, so that
+// container orchestrators can provision heketi volumes without an
+// external provisioner.
+package csi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/pkg/logging"
+)
+
+const (
+	// DriverName is the name of the CSI driver served by heketi
+	DriverName = "heketi.gluster.org"
+
+	// host used to address the in-process heketi server
+	heketiHost = "http://heketi.csi"
+
+	// milliseconds between polls of pending heketi operations
+	pollDelay = 100
+)
+
+var (
+	logger = logging.NewLogger("[csi]", logging.LEVEL_INFO)
+)
+
+// Server serves the CSI identity and controller services on a unix
+// socket. Requests are carried out through the heketi http handler
+// given to New, in process.
+type Server struct {
+	version string
+	heketi  *client.Client
+
+	lock sync.Mutex
+	grpc *grpc.Server
+	path string
+}
+
+// New returns a CSI server sending its requests to the heketi http
+// handler. The handler must not require authentication: the unix
+// socket the server listens on is only accessible to its owner.
+func New(handler http.Handler, version string) *Server {
+	opts := client.DefaultClientOptions()
+	opts.RetryEnabled = false
+	opts.PollDelay = pollDelay
+	heketi := client.NewClientWithOptions(heketiHost, "", "", opts)
+	heketi.SetClientFunc(func(tlsConfig *tls.Config,
+		checkRedirect client.CheckRedirectFunc) (client.HttpPerformer, error) {
+
+		return &http.Client{
+			Transport:     &handlerTransport{handler: handler},
+			CheckRedirect: checkRedirect,
+		}, nil
+	})
+
+	return &Server{
+		version: version,
+		heketi:  heketi,
+	}
+}
+
+// Serve listens on the unix socket at path and serves CSI requests
+// until Stop is called. A stale socket left at path is removed.
+func (s *Server) Serve(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove stale socket %v: %v", path, err)
+	}
+	l, err := listenOwnerOnly(path)
+	if err != nil {
+		return err
+	}
+
+	g := grpc.NewServer(grpc.UnaryInterceptor(logErrors))
+	csi.RegisterIdentityServer(g, &identityServer{server: s})
+	csi.RegisterControllerServer(g, &controllerServer{server: s})
+
+	s.lock.Lock()
+	s.grpc = g
+	s.path = path
+	s.lock.Unlock()
+
+	logger.Info("Serving CSI driver %v on %v", DriverName, path)
+	return g.Serve(l)
+}
+
+// Stop stops serving and closes the socket.
+func (s *Server) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.grpc != nil {
+		s.grpc.Stop()
+		s.grpc = nil
+		os.Remove(s.path)
+	}
+}
+
+// listenOwnerOnly listens on a unix socket at path that only the owner
+// of the process may connect to. The socket is bound in a private
+// directory and moved to path once its mode is set, so it is never
+// reachable with the default permissions.
+func listenOwnerOnly(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".csi")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// logErrors logs the CSI requests that fail.
+func logErrors(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		logger.LogError("%v failed: %v", info.FullMethod, err)
+	}
+	return resp, err
+}
+
+// handlerTransport is a http.RoundTripper serving requests with a
+// http handler, without going through the network.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the handler sees the request as a server would
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
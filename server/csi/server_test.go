@@ -0,0 +1,56 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package csi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+)
+
+func TestServeSocketOwnerOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-csi")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	// a stale socket is replaced
+	socket := filepath.Join(dir, "csi.sock")
+	err = ioutil.WriteFile(socket, []byte{}, 0666)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	s := New(http.NotFoundHandler(), "test")
+	go s.Serve(socket)
+
+	var fi os.FileInfo
+	for i := 0; i < 100; i++ {
+		fi, err = os.Stat(socket)
+		if err == nil && fi.Mode()&os.ModeSocket != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, fi.Mode()&os.ModeSocket != 0, "got mode:", fi.Mode())
+	tests.Assert(t, fi.Mode().Perm() == 0600, "got mode:", fi.Mode())
+
+	// only the socket is left in the directory
+	entries, err := ioutil.ReadDir(dir)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, len(entries) == 1, "got:", entries)
+
+	s.Stop()
+	_, err = os.Stat(socket)
+	tests.Assert(t, os.IsNotExist(err), "expected socket removed, got:", err)
+}
@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	LeaseKube = "kube"
+	LeaseFile = "file"
+
+	DefaultLeaseName     = "heketi-leader"
+	DefaultLeaseDuration = 15
+	DefaultRenewInterval = 5
+	DefaultSyncInterval  = 2
+)
+
+// Config is the configuration of the high availability mode, where
+// multiple heketi instances elect a leader serving the api while the
+// others stand by with a replica of its db.
+type Config struct {
+	Enabled bool `json:"enabled"`
+
+	// lease the instances compete for: "kube" for a Kubernetes Lease
+	// object in the namespace of the pod, "file" for a lock on a file
+	// shared by the instances
+	Lease     string `json:"lease"`
+	LeaseName string `json:"lease_name"`
+	LeaseFile string `json:"lease_file"`
+
+	// unique name of this instance (default: the host name) and the
+	// url of its api, used by the standbys to reach the leader
+	Identity string `json:"identity"`
+	Address  string `json:"address"`
+
+	// timings in seconds
+	LeaseDuration int `json:"lease_duration_sec"`
+	RenewInterval int `json:"renew_interval_sec"`
+	SyncInterval  int `json:"sync_interval_sec"`
+}
+
+// SetDefaults fills in the unset values of the configuration.
+func (c *Config) SetDefaults() error {
+	if c.Identity == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to get host name for identity: %v", err)
+		}
+		c.Identity = host
+	}
+	if c.LeaseName == "" {
+		c.LeaseName = DefaultLeaseName
+	}
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = DefaultLeaseDuration
+	}
+	if c.RenewInterval == 0 {
+		c.RenewInterval = DefaultRenewInterval
+	}
+	if c.SyncInterval == 0 {
+		c.SyncInterval = DefaultSyncInterval
+	}
+	return nil
+}
+
+// Validate returns an error if the configuration can not be used.
+func (c *Config) Validate() error {
+	switch c.Lease {
+	case LeaseKube:
+	case LeaseFile:
+		if c.LeaseFile == "" {
+			return fmt.Errorf("lease_file is required for a file lease")
+		}
+	default:
+		return fmt.Errorf("invalid lease type: %q", c.Lease)
+	}
+	if c.Address == "" {
+		return fmt.Errorf("address is required in high availability mode")
+	}
+	if c.LeaseDuration <= 0 || c.RenewInterval <= 0 || c.SyncInterval <= 0 {
+		return fmt.Errorf("lease duration and intervals must be positive")
+	}
+	// the leader steps down once it could not renew the lease for the
+	// lease duration minus the renew interval, which must leave room
+	// for a retry, so that it stops before a standby takes over
+	if 2*c.RenewInterval > c.LeaseDuration {
+		return fmt.Errorf(
+			"renew interval (%vs) must be at most half of the lease duration (%vs)",
+			c.RenewInterval, c.LeaseDuration)
+	}
+	return nil
+}
+
+func (c *Config) leaseDuration() time.Duration {
+	return time.Duration(c.LeaseDuration) * time.Second
+}
+
+func (c *Config) renewInterval() time.Duration {
+	return time.Duration(c.RenewInterval) * time.Second
+}
+
+// renewDeadline is the time after which a leader that could not renew
+// the lease steps down. It is one renew interval short of the lease
+// duration, after which the standbys may take over.
+func (c *Config) renewDeadline() time.Duration {
+	return c.leaseDuration() - c.renewInterval()
+}
+
+func (c *Config) syncInterval() time.Duration {
+	return time.Duration(c.SyncInterval) * time.Second
+}
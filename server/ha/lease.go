@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrLeaseConflict is returned when the lease was updated by
+	// another instance since it was read.
+	ErrLeaseConflict = errors.New("lease was modified by another instance")
+)
+
+// LeaseRecord is the state of the lease the heketi instances compete
+// for. The holder is the leader as long as it renews the lease before
+// the duration of the lease is over.
+type LeaseRecord struct {
+	Holder      string        `json:"holder"`
+	Address     string        `json:"address"`
+	AcquireTime time.Time     `json:"acquire_time"`
+	RenewTime   time.Time     `json:"renew_time"`
+	Duration    time.Duration `json:"duration"`
+	Transitions int           `json:"transitions"`
+}
+
+// Lease is the storage of the lease record shared by the instances.
+// Updates are conditional on the version of the record, so that only
+// one of the instances trying to take over a lease can succeed.
+type Lease interface {
+	// Get returns the current record of the lease and its version.
+	// A lease that was never taken has an empty record and version.
+	Get() (LeaseRecord, string, error)
+	// Update replaces the record of the lease if the lease is still
+	// at the given version, and returns ErrLeaseConflict otherwise.
+	Update(r LeaseRecord, version string) error
+}
+
+// FileLease is a Lease stored in a file shared by the instances, such
+// as a file on a shared volume. Access to the file is serialized with
+// a lock on a companion ".lock" file.
+type FileLease struct {
+	path string
+}
+
+type fileLeaseData struct {
+	Version int64       `json:"version"`
+	Record  LeaseRecord `json:"record"`
+}
+
+func NewFileLease(path string) *FileLease {
+	return &FileLease{path: path}
+}
+
+func (l *FileLease) Get() (LeaseRecord, string, error) {
+	var d fileLeaseData
+	err := l.locked(syscall.LOCK_SH, func() error {
+		var err error
+		d, err = l.read()
+		return err
+	})
+	if err != nil {
+		return LeaseRecord{}, "", err
+	}
+	return d.Record, d.version(), nil
+}
+
+func (l *FileLease) Update(r LeaseRecord, version string) error {
+	return l.locked(syscall.LOCK_EX, func() error {
+		d, err := l.read()
+		if err != nil {
+			return err
+		}
+		if d.version() != version {
+			return ErrLeaseConflict
+		}
+		d.Version++
+		d.Record = r
+		return l.write(d)
+	})
+}
+
+func (d fileLeaseData) version() string {
+	if d.Version == 0 {
+		return ""
+	}
+	return strconv.FormatInt(d.Version, 10)
+}
+
+func (l *FileLease) locked(how int, f func() error) error {
+	fp, err := os.OpenFile(l.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open lease lock: %v", err)
+	}
+	defer fp.Close()
+	if err := syscall.Flock(int(fp.Fd()), how); err != nil {
+		return fmt.Errorf("unable to lock lease: %v", err)
+	}
+	defer syscall.Flock(int(fp.Fd()), syscall.LOCK_UN)
+	return f()
+}
+
+func (l *FileLease) read() (fileLeaseData, error) {
+	var d fileLeaseData
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return d, fmt.Errorf("unable to read lease: %v", err)
+	}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return d, fmt.Errorf("unable to parse lease %v: %v", l.path, err)
+	}
+	return d, nil
+}
+
+// write replaces the lease file with a new file, so that the lease is
+// never left partially written.
+func (l *FileLease) write(d fileLeaseData) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), ".lease")
+	if err != nil {
+		return fmt.Errorf("unable to write lease: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write lease: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write lease: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write lease: %v", err)
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
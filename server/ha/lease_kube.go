@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	coordv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	coordclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/heketi/heketi/v10/pkg/kubernetes"
+)
+
+const (
+	// LeaderAddressAnnotation holds the address of the leader on the
+	// Kubernetes Lease, which only records the identity of the holder.
+	LeaderAddressAnnotation = "gluster.org/heketi-leader-address"
+)
+
+// KubeLease is a Lease stored in a Kubernetes Lease object. Updates
+// rely on the resource version of the object.
+type KubeLease struct {
+	leases coordclient.LeaseInterface
+	name   string
+}
+
+// NewKubeLease returns the lease stored in the Lease object of the
+// given name in the namespace of the pod heketi runs in.
+func NewKubeLease(name string) (*KubeLease, error) {
+	kubeConfig, err := restclient.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get kubernetes configuration: %v", err)
+	}
+	c, err := clientset.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get kubernetes clientset: %v", err)
+	}
+	ns, err := kubernetes.GetNamespace()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get namespace: %v", err)
+	}
+	return newKubeLease(c.CoordinationV1().Leases(ns), name), nil
+}
+
+func newKubeLease(leases coordclient.LeaseInterface, name string) *KubeLease {
+	return &KubeLease{leases: leases, name: name}
+}
+
+func (l *KubeLease) Get() (LeaseRecord, string, error) {
+	lease, err := l.leases.Get(l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return LeaseRecord{}, "", nil
+	} else if err != nil {
+		return LeaseRecord{}, "", fmt.Errorf("unable to get lease %v: %v", l.name, err)
+	}
+
+	var r LeaseRecord
+	if lease.Spec.HolderIdentity != nil {
+		r.Holder = *lease.Spec.HolderIdentity
+	}
+	r.Address = lease.Annotations[LeaderAddressAnnotation]
+	if lease.Spec.AcquireTime != nil {
+		r.AcquireTime = lease.Spec.AcquireTime.Time
+	}
+	if lease.Spec.RenewTime != nil {
+		r.RenewTime = lease.Spec.RenewTime.Time
+	}
+	if lease.Spec.LeaseDurationSeconds != nil {
+		r.Duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	if lease.Spec.LeaseTransitions != nil {
+		r.Transitions = int(*lease.Spec.LeaseTransitions)
+	}
+	// an unset resource version must not be mistaken for a missing lease
+	return r, "rv:" + lease.ResourceVersion, nil
+}
+
+func (l *KubeLease) Update(r LeaseRecord, version string) error {
+	lease := &coordv1.Lease{}
+	lease.Name = l.name
+	lease.Annotations = map[string]string{
+		LeaderAddressAnnotation: r.Address,
+	}
+	holder := r.Holder
+	seconds := int32(math.Ceil(r.Duration.Seconds()))
+	transitions := int32(r.Transitions)
+	acquire := metav1.NewMicroTime(r.AcquireTime)
+	renew := metav1.NewMicroTime(r.RenewTime)
+	lease.Spec = coordv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &seconds,
+		AcquireTime:          &acquire,
+		RenewTime:            &renew,
+		LeaseTransitions:     &transitions,
+	}
+
+	var err error
+	if version == "" {
+		_, err = l.leases.Create(lease)
+		if apierrors.IsAlreadyExists(err) {
+			return ErrLeaseConflict
+		}
+	} else {
+		lease.ResourceVersion = strings.TrimPrefix(version, "rv:")
+		_, err = l.leases.Update(lease)
+		if apierrors.IsConflict(err) {
+			return ErrLeaseConflict
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update lease %v: %v", l.name, err)
+	}
+	return nil
+}
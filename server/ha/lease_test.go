@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func testLease(t *testing.T, l Lease) {
+	r, version, err := l.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Holder == "", "expected empty holder, got:", r.Holder)
+	tests.Assert(t, version == "", "expected empty version, got:", version)
+
+	now := time.Now().Round(time.Second)
+	err = l.Update(LeaseRecord{
+		Holder:      "a",
+		Address:     "http://a:8080",
+		AcquireTime: now,
+		RenewTime:   now,
+		Duration:    15 * time.Second,
+	}, "")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the lease was created by someone else
+	err = l.Update(LeaseRecord{Holder: "b"}, "")
+	tests.Assert(t, err == ErrLeaseConflict,
+		"expected err == ErrLeaseConflict, got:", err)
+
+	r, version, err = l.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, version != "", "expected a version")
+	tests.Assert(t, r.Holder == "a", `expected r.Holder == "a", got:`, r.Holder)
+	tests.Assert(t, r.Address == "http://a:8080",
+		`expected r.Address == "http://a:8080", got:`, r.Address)
+	tests.Assert(t, r.Duration == 15*time.Second,
+		"expected r.Duration == 15s, got:", r.Duration)
+	tests.Assert(t, r.RenewTime.Equal(now),
+		"expected r.RenewTime == now, got:", r.RenewTime, now)
+
+	r.Holder = "b"
+	r.Transitions = 1
+	err = l.Update(r, version)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	r, _, err = l.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Holder == "b", `expected r.Holder == "b", got:`, r.Holder)
+	tests.Assert(t, r.Transitions == 1,
+		"expected r.Transitions == 1, got:", r.Transitions)
+}
+
+func TestFileLease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-lease")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	l := NewFileLease(filepath.Join(dir, "lease"))
+	testLease(t, l)
+
+	// an update based on an old version of the lease is rejected
+	_, version, err := l.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = l.Update(LeaseRecord{Holder: "c"}, version)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = l.Update(LeaseRecord{Holder: "d"}, version)
+	tests.Assert(t, err == ErrLeaseConflict,
+		"expected err == ErrLeaseConflict, got:", err)
+
+	// a second lease on the same file sees the same record
+	r, _, err := NewFileLease(filepath.Join(dir, "lease")).Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Holder == "c", `expected r.Holder == "c", got:`, r.Holder)
+}
+
+func TestKubeLease(t *testing.T) {
+	c := fakeclientset.NewSimpleClientset()
+	l := newKubeLease(c.CoordinationV1().Leases("default"), "heketi-leader")
+	testLease(t, l)
+
+	lease, err := c.CoordinationV1().Leases("default").Get("heketi-leader", metav1.GetOptions{})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, *lease.Spec.HolderIdentity == "b",
+		`expected holder "b", got:`, *lease.Spec.HolderIdentity)
+	tests.Assert(t, lease.Annotations[LeaderAddressAnnotation] == "http://a:8080",
+		"expected leader address annotation, got:", lease.Annotations)
+}
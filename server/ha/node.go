@@ -0,0 +1,418 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+	"github.com/heketi/heketi/v10/pkg/logging"
+)
+
+var (
+	logger = logging.NewLogger("[ha]", logging.LEVEL_INFO)
+
+	// ErrLeaseLost is returned by Run when the leader could not renew
+	// its lease. The process must stop, another instance may already
+	// be writing to the storage.
+	ErrLeaseLost = errors.New("lost the leader lease")
+)
+
+// Backend is the heketi app served by a node.
+type Backend interface {
+	// Reload opens the db of a standby app again once the replica
+	// was updated.
+	Reload() error
+	Close()
+}
+
+// BackendFunc starts the app served by a node: the app of the leader,
+// over the db in read-write mode, or the app of a standby, over the
+// replica of the db of the leader in read-only mode.
+type BackendFunc func(leader bool) (Backend, error)
+
+// Node is a heketi instance running in high availability mode. The
+// node competes for the lease and serves the app of the leader or of
+// a standby accordingly. Standbys serve reads from their replica of
+// the db of the leader and redirect writes to the leader.
+type Node struct {
+	identity   string
+	address    string
+	lease      Lease
+	replica    *Replica
+	newBackend BackendFunc
+
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	renewDeadline time.Duration
+	syncInterval  time.Duration
+	now           func() time.Time
+
+	// the lease as last observed, and when it was observed to change.
+	// Only used by the loop of Run.
+	observed        LeaseRecord
+	observedVersion string
+	observedTime    time.Time
+	lastRenew       time.Time
+
+	lock    sync.RWMutex
+	backend Backend
+	leader  bool
+	record  LeaseRecord
+}
+
+// NewNode returns a node competing for the lease with the given
+// configuration. The db of the app is stored at dbfile, where the
+// node keeps the replica of the db of the leader while standing by.
+func NewNode(conf *Config,
+	lease Lease,
+	dbfile string,
+	newClient ClientFunc,
+	newBackend BackendFunc) *Node {
+
+	return &Node{
+		identity:      conf.Identity,
+		address:       conf.Address,
+		lease:         lease,
+		replica:       NewReplica(dbfile, newClient),
+		newBackend:    newBackend,
+		leaseDuration: conf.leaseDuration(),
+		renewInterval: conf.renewInterval(),
+		renewDeadline: conf.renewDeadline(),
+		syncInterval:  conf.syncInterval(),
+		now:           time.Now,
+	}
+}
+
+// Run takes part in the election of the leader until stop is closed.
+// It returns ErrLeaseLost if the node lost the lease while leading.
+func (n *Node) Run(stop <-chan struct{}) error {
+	renew := time.NewTicker(n.renewInterval)
+	defer renew.Stop()
+	resync := time.NewTicker(n.syncInterval)
+	defer resync.Stop()
+
+	err := n.elect()
+	if err == nil && !n.IsLeader() {
+		n.sync()
+	}
+	for err == nil {
+		select {
+		case <-stop:
+			n.shutdown()
+			return nil
+		case <-renew.C:
+			err = n.elect()
+		case <-resync.C:
+			if !n.IsLeader() {
+				n.sync()
+			}
+		}
+	}
+	n.shutdown()
+	return err
+}
+
+// IsLeader returns true if the node holds the lease.
+func (n *Node) IsLeader() bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.leader
+}
+
+// Status returns the state of the node.
+func (n *Node) Status() *api.HaStatus {
+	n.lock.RLock()
+	s := &api.HaStatus{
+		Identity:      n.identity,
+		Role:          api.HaRoleStandby,
+		Leader:        n.record.Holder,
+		LeaderAddress: n.record.Address,
+	}
+	if n.leader {
+		s.Role = api.HaRoleLeader
+	}
+	n.lock.RUnlock()
+
+	if s.Role == api.HaRoleStandby {
+		tag, last := n.replica.Status()
+		s.ReplicaTag = tag
+		if !last.IsZero() {
+			s.LastSync = last.Unix()
+		}
+	}
+	return s
+}
+
+// ServeHTTP lets the leader serve all requests and standbys serve
+// reads only. Other requests are redirected to the leader, keeping
+// their method and body.
+func (n *Node) ServeHTTP(
+	w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next(w, r)
+		return
+	}
+
+	n.lock.RLock()
+	leader, record := n.leader, n.record
+	n.lock.RUnlock()
+	if leader {
+		next(w, r)
+		return
+	}
+	if record.Holder == "" || record.Holder == n.identity || record.Address == "" {
+		http.Error(w, "No heketi leader elected", http.StatusServiceUnavailable)
+		return
+	}
+	http.Redirect(w, r,
+		strings.TrimSuffix(record.Address, "/")+r.URL.RequestURI(),
+		http.StatusTemporaryRedirect)
+}
+
+// Handler returns a handler serving requests with the handler picked
+// by get from the backend the node currently serves.
+func (n *Node) Handler(get func(b Backend) http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the backend is not replaced while serving the request
+		n.lock.RLock()
+		defer n.lock.RUnlock()
+		if n.backend == nil {
+			http.Error(w, "Heketi is not ready", http.StatusServiceUnavailable)
+			return
+		}
+		get(n.backend).ServeHTTP(w, r)
+	})
+}
+
+func (n *Node) SetRoutes(router *mux.Router) error {
+	router.
+		Methods("GET").
+		Path("/ha").
+		Name("HaStatus").
+		Handler(http.HandlerFunc(n.HaStatus))
+	return nil
+}
+
+func (n *Node) HaStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(n.Status()); err != nil {
+		panic(err)
+	}
+}
+
+// elect acquires or renews the lease and switches the node to the
+// leader if it acquired the lease.
+func (n *Node) elect() error {
+	prev := n.observed
+	acquired, err := n.tryAcquire()
+	if err != nil {
+		logger.LogError("Unable to acquire lease: %v", err)
+	}
+
+	if n.IsLeader() {
+		if acquired {
+			n.lastRenew = n.now()
+			return nil
+		}
+		if err == nil {
+			logger.LogError("Lease taken over by %v", n.observed.Holder)
+			return ErrLeaseLost
+		}
+		// step down before the standbys may take the lease over
+		if n.now().Sub(n.lastRenew) >= n.renewDeadline {
+			logger.LogError("Unable to renew the lease since %v", n.lastRenew)
+			return ErrLeaseLost
+		}
+		return nil
+	}
+	if acquired {
+		n.lastRenew = n.now()
+		return n.promote(prev)
+	}
+	return nil
+}
+
+// tryAcquire takes the lease if it is free, expired or already held
+// by the node. The lease expires once it did not change for its
+// duration, as observed by this node, so that the clocks of the nodes
+// do not need to be in sync.
+func (n *Node) tryAcquire() (bool, error) {
+	r, version, err := n.lease.Get()
+	if err != nil {
+		return false, err
+	}
+	now := n.now()
+	if version != n.observedVersion {
+		n.observe(r, version, now)
+	}
+
+	held := r.Holder == n.identity
+	if r.Holder != "" && !held && now.Before(n.observedTime.Add(r.Duration)) {
+		return false, nil
+	}
+
+	next := LeaseRecord{
+		Holder:      n.identity,
+		Address:     n.address,
+		AcquireTime: now,
+		RenewTime:   now,
+		Duration:    n.leaseDuration,
+		Transitions: r.Transitions,
+	}
+	if held {
+		next.AcquireTime = r.AcquireTime
+	} else if r.Holder != "" {
+		next.Transitions++
+	}
+	if err := n.lease.Update(next, version); err != nil {
+		return false, err
+	}
+	r, version, err = n.lease.Get()
+	if err != nil {
+		return false, err
+	}
+	n.observe(r, version, now)
+	return r.Holder == n.identity, nil
+}
+
+func (n *Node) observe(r LeaseRecord, version string, now time.Time) {
+	n.observed = r
+	n.observedVersion = version
+	n.observedTime = now
+	n.lock.Lock()
+	n.record = r
+	n.lock.Unlock()
+}
+
+// promote switches the node from standby to leader. The replica is
+// first brought up to date from the previous leader if it can still
+// be reached, as on a graceful shutdown of the previous leader.
+func (n *Node) promote(prev LeaseRecord) error {
+	logger.Info("Acquired the leader lease as %v", n.identity)
+	if prev.Holder != "" && prev.Holder != n.identity && prev.Address != "" {
+		if _, err := n.replica.Sync(prev.Address); err != nil {
+			logger.Warning("Unable to sync db from previous leader: %v", err)
+		}
+	}
+
+	n.setBackend(nil, false)
+	b, err := n.newBackend(true)
+	if err != nil {
+		logger.LogError("Unable to start leader app: %v", err)
+		n.release()
+		return err
+	}
+	n.setBackend(b, true)
+	logger.Info("Serving as leader")
+	return nil
+}
+
+// sync updates the replica from the leader and reloads the db of the
+// app of the standby if the replica changed. The app is only started
+// again if reloading its db failed.
+func (n *Node) sync() {
+	n.lock.RLock()
+	record, hasBackend := n.record, n.backend != nil
+	n.lock.RUnlock()
+
+	changed := false
+	if record.Holder != "" && record.Holder != n.identity && record.Address != "" {
+		var err error
+		changed, err = n.replica.Sync(record.Address)
+		if err != nil {
+			logger.Warning("Unable to sync db: %v", err)
+		}
+	}
+	if changed && hasBackend && n.reload() {
+		return
+	}
+	if (changed || !hasBackend) && n.replica.Exists() {
+		b, err := n.newBackend(false)
+		if err != nil {
+			logger.LogError("Unable to start standby app: %v", err)
+			return
+		}
+		n.setBackend(b, false)
+	}
+}
+
+// reload reloads the db of the backend of the standby once the
+// requests it serves are done. It returns false if it failed.
+func (n *Node) reload() bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.backend == nil || n.leader {
+		return false
+	}
+	if err := n.backend.Reload(); err != nil {
+		logger.LogError("Unable to reload standby db: %v", err)
+		return false
+	}
+	return true
+}
+
+// setBackend replaces the backend served by the node, once the
+// requests served by the previous backend are done, and closes the
+// previous backend.
+func (n *Node) setBackend(b Backend, leader bool) {
+	n.lock.Lock()
+	old := n.backend
+	n.backend = b
+	n.leader = leader
+	n.lock.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// release gives up the lease if the node holds it, so that a standby
+// can take over without waiting for the lease to expire.
+func (n *Node) release() {
+	r, version, err := n.lease.Get()
+	if err != nil || r.Holder != n.identity {
+		return
+	}
+	r.Holder = ""
+	r.Address = ""
+	if err := n.lease.Update(r, version); err != nil {
+		logger.Warning("Unable to release lease: %v", err)
+	}
+}
+
+func (n *Node) shutdown() {
+	if n.IsLeader() {
+		n.release()
+	}
+	n.setBackend(nil, false)
+}
+
+// LeaderWrites lets only the leader serve requests other than reads,
+// like ServeHTTP but without redirecting the requests of standbys. It
+// is meant for in process callers, like the CSI driver, that can not
+// reach the leader.
+func (n *Node) LeaderWrites(
+	w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !n.IsLeader() {
+		http.Error(w, "Not the heketi leader", http.StatusServiceUnavailable)
+		return
+	}
+	next(w, r)
+}
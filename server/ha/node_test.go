@@ -0,0 +1,395 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+	"github.com/urfave/negroni"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+	"github.com/heketi/heketi/v10/pkg/glusterfs/api"
+)
+
+// testDbServer serves /backup/db like the app, from a byte slice.
+type testDbServer struct {
+	lock sync.Mutex
+	data string
+	txid int
+}
+
+func (s *testDbServer) set(data string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data = data
+	s.txid++
+}
+
+func (s *testDbServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	etag := fmt.Sprintf(`"%v"`, s.txid)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	fmt.Fprint(w, s.data)
+}
+
+type testBackend struct {
+	dbfile  string
+	leader  bool
+	data    string
+	reloads int
+	closed  bool
+}
+
+func (b *testBackend) Reload() error {
+	data, err := ioutil.ReadFile(b.dbfile)
+	if err != nil {
+		return err
+	}
+	b.data = string(data)
+	b.reloads++
+	return nil
+}
+
+func (b *testBackend) Close() {
+	b.closed = true
+}
+
+func newTestNode(dir, identity, address string, lease Lease) *Node {
+	conf := &Config{
+		Identity:      identity,
+		Address:       address,
+		LeaseDuration: 15,
+		RenewInterval: 5,
+		SyncInterval:  2,
+	}
+	dbfile := filepath.Join(dir, identity+".db")
+	newClient := func(address string) *client.Client {
+		return client.NewClientNoAuth(address)
+	}
+	newBackend := func(leader bool) (Backend, error) {
+		data, _ := ioutil.ReadFile(dbfile)
+		return &testBackend{dbfile: dbfile, leader: leader, data: string(data)}, nil
+	}
+	return NewNode(conf, lease, dbfile, newClient, newBackend)
+}
+
+func TestReplicaSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-replica")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	db := &testDbServer{}
+	db.set("one")
+	ts := httptest.NewServer(db)
+	defer ts.Close()
+
+	path := filepath.Join(dir, "heketi.db")
+	r := NewReplica(path, func(address string) *client.Client {
+		return client.NewClientNoAuth(address)
+	})
+	tests.Assert(t, !r.Exists(), "expected no replica")
+
+	changed, err := r.Sync(ts.URL)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, changed, "expected changed")
+	data, _ := ioutil.ReadFile(path)
+	tests.Assert(t, string(data) == "one", "expected one, got:", string(data))
+	tag, last := r.Status()
+	tests.Assert(t, tag == `"1"`, `expected tag "1", got:`, tag)
+	tests.Assert(t, !last.IsZero(), "expected time of last sync")
+
+	changed, err = r.Sync(ts.URL)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !changed, "expected not changed")
+
+	db.set("two")
+	changed, err = r.Sync(ts.URL)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, changed, "expected changed")
+	data, _ = ioutil.ReadFile(path)
+	tests.Assert(t, string(data) == "two", "expected two, got:", string(data))
+
+	// a failed sync keeps the replica
+	changed, err = r.Sync("http://127.0.0.1:1")
+	tests.Assert(t, err != nil, "expected err != nil")
+	tests.Assert(t, !changed, "expected not changed")
+	data, _ = ioutil.ReadFile(path)
+	tests.Assert(t, string(data) == "two", "expected two, got:", string(data))
+}
+
+func TestNodeElection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-node")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	db := &testDbServer{}
+	db.set("leader db")
+	ts := httptest.NewServer(db)
+	defer ts.Close()
+
+	lease := NewFileLease(filepath.Join(dir, "lease"))
+	now := time.Now()
+	a := newTestNode(dir, "a", ts.URL, lease)
+	a.now = func() time.Time { return now }
+	b := newTestNode(dir, "b", "http://b:8080", lease)
+	b.now = func() time.Time { return now }
+
+	// the first node takes the free lease
+	err = a.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, a.IsLeader(), "expected a to be leader")
+	tests.Assert(t, a.backend.(*testBackend).leader)
+
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !b.IsLeader(), "expected b to stand by")
+	tests.Assert(t, b.backend == nil, "expected no backend for b")
+
+	// the standby serves the replica of the db of the leader
+	b.sync()
+	tests.Assert(t, b.backend != nil, "expected a backend for b")
+	tests.Assert(t, !b.backend.(*testBackend).leader)
+	tests.Assert(t, b.backend.(*testBackend).data == "leader db",
+		"expected replica of leader db, got:", b.backend.(*testBackend).data)
+	s := b.Status()
+	tests.Assert(t, s.Role == api.HaRoleStandby, "expected standby, got:", s.Role)
+	tests.Assert(t, s.Leader == "a", `expected s.Leader == "a", got:`, s.Leader)
+	tests.Assert(t, s.LeaderAddress == ts.URL,
+		"expected s.LeaderAddress == ts.URL, got:", s.LeaderAddress)
+
+	// the db of the backend is only reloaded when the db of the
+	// leader changed, the backend itself is kept
+	backend := b.backend
+	b.sync()
+	tests.Assert(t, b.backend == backend, "expected same backend")
+	tests.Assert(t, backend.(*testBackend).reloads == 0,
+		"expected no reload, got:", backend.(*testBackend).reloads)
+	db.set("leader db 2")
+	b.sync()
+	tests.Assert(t, b.backend == backend, "expected same backend")
+	tests.Assert(t, backend.(*testBackend).reloads == 1,
+		"expected one reload, got:", backend.(*testBackend).reloads)
+	tests.Assert(t, backend.(*testBackend).data == "leader db 2",
+		"expected new replica of leader db, got:", backend.(*testBackend).data)
+	tests.Assert(t, !backend.(*testBackend).closed, "expected backend kept open")
+
+	// the leader renews its lease
+	now = now.Add(10 * time.Second)
+	err = a.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, a.IsLeader(), "expected a to be leader")
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !b.IsLeader(), "expected b to stand by")
+
+	// the standby takes over once the lease was not renewed for its
+	// duration, after fetching the db of the previous leader
+	db.set("leader db 3")
+	now = now.Add(10 * time.Second)
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !b.IsLeader(), "expected b to stand by")
+	now = now.Add(10 * time.Second)
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.IsLeader(), "expected b to be leader")
+	tests.Assert(t, b.backend.(*testBackend).leader)
+	tests.Assert(t, b.backend.(*testBackend).data == "leader db 3",
+		"expected last db of previous leader, got:", b.backend.(*testBackend).data)
+	r, _, err := lease.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Holder == "b" && r.Transitions == 1,
+		"expected lease held by b after a transition, got:", r)
+
+	// the previous leader finds out it lost the lease
+	err = a.elect()
+	tests.Assert(t, err == ErrLeaseLost, "expected err == ErrLeaseLost, got:", err)
+
+	// the leader releases the lease on shutdown
+	b.shutdown()
+	tests.Assert(t, !b.IsLeader(), "expected b not to be leader")
+	tests.Assert(t, b.backend == nil, "expected no backend for b")
+	r, _, err = lease.Get()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.Holder == "", "expected free lease, got:", r.Holder)
+
+	c := newTestNode(dir, "c", "http://c:8080", lease)
+	c.now = func() time.Time { return now }
+	err = c.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, c.IsLeader(), "expected c to be leader")
+}
+
+func TestNodeRedirectsWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-node")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	lease := NewFileLease(filepath.Join(dir, "lease"))
+	a := newTestNode(dir, "a", "http://a:8080/", lease)
+	b := newTestNode(dir, "b", "http://b:8080", lease)
+
+	serve := func(node *Node, method, path string) *httptest.ResponseRecorder {
+		n := negroni.New(node)
+		n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		w := httptest.NewRecorder()
+		n.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader("{}")))
+		return w
+	}
+
+	// no leader yet
+	w := serve(b, http.MethodPost, "/volumes")
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable,
+		"expected http.StatusServiceUnavailable, got:", w.Code)
+
+	err = a.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	w = serve(a, http.MethodPost, "/volumes")
+	tests.Assert(t, w.Code == http.StatusOK, "expected http.StatusOK, got:", w.Code)
+	w = serve(b, http.MethodGet, "/volumes")
+	tests.Assert(t, w.Code == http.StatusOK, "expected http.StatusOK, got:", w.Code)
+	w = serve(b, http.MethodDelete, "/volumes/abc?force=true")
+	tests.Assert(t, w.Code == http.StatusTemporaryRedirect,
+		"expected http.StatusTemporaryRedirect, got:", w.Code)
+	location := w.Header().Get("Location")
+	tests.Assert(t, location == "http://a:8080/volumes/abc?force=true",
+		"unexpected location:", location)
+
+	// in process callers get an error instead of a redirect
+	n := negroni.New()
+	n.UseFunc(b.LeaderWrites)
+	n.UseHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w = httptest.NewRecorder()
+	n.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/volumes", nil))
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable,
+		"expected http.StatusServiceUnavailable, got:", w.Code)
+
+	// the backend serves requests once available
+	h := b.Handler(func(b Backend) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/volumes", nil))
+	tests.Assert(t, w.Code == http.StatusServiceUnavailable,
+		"expected http.StatusServiceUnavailable, got:", w.Code)
+	b.setBackend(&testBackend{}, false)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/volumes", nil))
+	tests.Assert(t, w.Code == http.StatusNoContent,
+		"expected http.StatusNoContent, got:", w.Code)
+}
+
+// failingLease fails all accesses while broken is set.
+type failingLease struct {
+	Lease
+	broken bool
+}
+
+func (l *failingLease) Get() (LeaseRecord, string, error) {
+	if l.broken {
+		return LeaseRecord{}, "", fmt.Errorf("lease unavailable")
+	}
+	return l.Lease.Get()
+}
+
+func (l *failingLease) Update(r LeaseRecord, version string) error {
+	if l.broken {
+		return fmt.Errorf("lease unavailable")
+	}
+	return l.Lease.Update(r, version)
+}
+
+func TestNodeStepsDownBeforeTakeOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heketi-node")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer os.RemoveAll(dir)
+
+	fl := NewFileLease(filepath.Join(dir, "lease"))
+	la := &failingLease{Lease: fl}
+	now := time.Now()
+	a := newTestNode(dir, "a", "http://a:8080", la)
+	a.now = func() time.Time { return now }
+	b := newTestNode(dir, "b", "http://b:8080", fl)
+	b.now = func() time.Time { return now }
+
+	err = a.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, a.IsLeader(), "expected a to be leader")
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// the leader keeps leading through a failed renewal
+	la.broken = true
+	now = now.Add(5 * time.Second)
+	err = a.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, a.IsLeader(), "expected a to be leader")
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !b.IsLeader(), "expected b to stand by")
+
+	// and steps down one renew interval before the standby takes over
+	now = now.Add(5 * time.Second)
+	err = a.elect()
+	tests.Assert(t, err == ErrLeaseLost, "expected err == ErrLeaseLost, got:", err)
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, !b.IsLeader(), "expected b to stand by")
+	now = now.Add(5 * time.Second)
+	err = b.elect()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, b.IsLeader(), "expected b to be leader")
+}
+
+func TestConfigValidateRenewMargin(t *testing.T) {
+	conf := &Config{
+		Lease:     LeaseFile,
+		LeaseFile: "/tmp/lease",
+		Address:   "http://a:8080",
+	}
+	err := conf.SetDefaults()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = conf.Validate()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, conf.renewDeadline() == 10*time.Second, "got:", conf.renewDeadline())
+
+	// no room is left for a retry before stepping down
+	conf.RenewInterval = 10
+	err = conf.Validate()
+	tests.Assert(t, err != nil && strings.Contains(err.Error(), "half"),
+		"expected margin error, got:", err)
+	conf.RenewInterval = 7
+	err = conf.Validate()
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package ha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	client "github.com/heketi/heketi/v10/client/api/go-client"
+)
+
+// ClientFunc returns a client of the api of the heketi instance at
+// the given address.
+type ClientFunc func(address string) *client.Client
+
+// Replica is the copy of the db of the leader kept by a standby. The
+// copy is only fetched again when the db of the leader changed.
+type Replica struct {
+	path      string
+	newClient ClientFunc
+
+	lock     sync.Mutex
+	tag      string
+	lastSync time.Time
+}
+
+// NewReplica returns a replica of the db of the leader stored at path.
+func NewReplica(path string, newClient ClientFunc) *Replica {
+	return &Replica{path: path, newClient: newClient}
+}
+
+// Sync copies the db of the leader at address to the replica file if
+// the db changed since the last copy. It returns true if the replica
+// was updated.
+func (r *Replica) Sync(address string) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), ".replica")
+	if err != nil {
+		return false, fmt.Errorf("unable to create replica: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	tag, changed, err := r.newClient(address).BackupDbIfChanged(tmp, r.tag)
+	if err != nil {
+		return false, fmt.Errorf("unable to copy db from %v: %v", address, err)
+	}
+	r.lastSync = time.Now()
+	if !changed {
+		return false, nil
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return false, fmt.Errorf("unable to write replica: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("unable to write replica: %v", err)
+	}
+	// replace the file in one step, a standby app may still have the
+	// previous copy open
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return false, fmt.Errorf("unable to replace replica: %v", err)
+	}
+	r.tag = tag
+	return true, nil
+}
+
+// Exists returns true if a copy of the db is available.
+func (r *Replica) Exists() bool {
+	_, err := os.Stat(r.path)
+	return err == nil
+}
+
+// Status returns the tag and time of the last copy of the db.
+func (r *Replica) Status() (string, time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.tag, r.lastSync
+}
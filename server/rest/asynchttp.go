@@ -10,7 +10,9 @@
 package rest
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -24,12 +26,58 @@ var (
 	logger = logging.NewLogger("[asynchttp]", logging.LEVEL_INFO)
 )
 
+// Status values of persisted asynchronous operations
+const (
+	AsyncQueued    = "queued"
+	AsyncPending   = "pending"
+	AsyncCompleted = "completed"
+	AsyncFailed    = "failed"
+)
+
+const (
+	// QueuePositionHeader is set on the status of operations that are
+	// waiting to start to their position in the queue.
+	QueuePositionHeader = "X-Queue-Position"
+	// ProgressHeader is set on the status of running operations to
+	// their JSON encoded progress.
+	ProgressHeader = "X-Operation-Progress"
+)
+
+// AsyncEntry is the persisted state of an asynchronous operation.
+type AsyncEntry struct {
+	Id string
+	// id of the pending operation performing the work, if any
+	OpId   string
+	Status string
+	// location to redirect to once completed. For operations it is
+	// recorded before the operation completes.
+	Location string
+	Error    string
+	// unix time of the last status change
+	Updated int64
+}
+
+// AsyncStore persists asynchronous operations so that their status
+// can still be queried after the server restarts.
+type AsyncStore interface {
+	Save(e *AsyncEntry) error
+	// Load returns nil and no error if the id is not known
+	Load(id string) (*AsyncEntry, error)
+	Delete(id string) error
+}
+
 // Contains information about the asynchronous operation
 type AsyncHttpHandler struct {
 	err          error
 	completed    bool
 	manager      *AsyncHttpManager
 	location, id string
+	opId         string
+	// reports the queue position of a waiting operation. nil once
+	// the operation has started.
+	position func() int
+	// asks the operation to stop. nil if it can not be cancelled.
+	cancel func() error
 }
 
 // Manager of asynchronous operations
@@ -38,6 +86,9 @@ type AsyncHttpManager struct {
 	lock     sync.RWMutex
 	route    string
 	handlers map[string]*AsyncHttpHandler
+	store    AsyncStore
+	// reports the progress of a running pending operation
+	progress func(opId string) interface{}
 }
 
 // Creates a new manager
@@ -49,6 +100,58 @@ func NewAsyncHttpManager(route string) *AsyncHttpManager {
 	}
 }
 
+// SetStore makes the manager persist the state of the operations
+// it starts from now on in store.
+func (a *AsyncHttpManager) SetStore(store AsyncStore) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.store = store
+}
+
+// SetProgress makes the manager report the progress of running
+// operations, as returned by f, in the status of the operations.
+// f returns nil if the progress of the operation is unknown.
+func (a *AsyncHttpManager) SetProgress(f func(opId string) interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.progress = f
+}
+
+// persistLater captures the current state of the handler, with the
+// lock held, and returns a function recording it in the store that
+// must be called once the lock is released, so that status polls are
+// not serialized behind db writes. Failing to persist is logged but
+// does not fail the operation.
+func (a *AsyncHttpManager) persistLater(h *AsyncHttpHandler) func() {
+	store := a.store
+	if store == nil {
+		return func() {}
+	}
+	e := &AsyncEntry{
+		Id:       h.id,
+		OpId:     h.opId,
+		Status:   AsyncPending,
+		Location: h.location,
+		Updated:  time.Now().Unix(),
+	}
+	if h.position != nil {
+		e.Status = AsyncQueued
+	}
+	if h.completed {
+		if h.err != nil {
+			e.Status = AsyncFailed
+			e.Error = h.err.Error()
+		} else {
+			e.Status = AsyncCompleted
+		}
+	}
+	return func() {
+		if err := store.Save(e); err != nil {
+			logger.LogError("Unable to persist job %v: %v", e.Id, err)
+		}
+	}
+}
+
 // Use to create a new asynchronous operation handler.
 // Only use this function if you need to do every step by hand.
 // It is recommended to use AsyncHttpRedirectFunc() instead
@@ -66,12 +169,13 @@ func (a *AsyncHttpManager) NewHandlerWithId(id string) *AsyncHttpHandler {
 	}
 
 	a.lock.Lock()
-	defer a.lock.Unlock()
-
 	_, idPresent := a.handlers[handler.id]
 	godbc.Require(!idPresent)
 	a.handlers[handler.id] = handler
+	persist := a.persistLater(handler)
+	a.lock.Unlock()
 
+	persist()
 	return handler
 }
 
@@ -148,11 +252,93 @@ func (a *AsyncHttpManager) AsyncHttpRedirectUsing(w http.ResponseWriter,
 	http.Redirect(w, r, handler.Url(), http.StatusAccepted)
 }
 
+// AsyncHttpRedirectOperation works like AsyncHttpRedirectFunc for
+// handler functions that run the pending operation opId and redirect
+// to location on success. Both are persisted with the handler so
+// that the outcome can be resolved if the server restarts before
+// the operation completes. If cancel is not nil clients may ask the
+// operation to stop through HandlerCancel.
+func (a *AsyncHttpManager) AsyncHttpRedirectOperation(w http.ResponseWriter,
+	r *http.Request,
+	opId, location string,
+	cancel func() error,
+	handlerfunc func() (string, error)) {
+
+	handler := &AsyncHttpHandler{
+		manager:  a,
+		id:       a.NewId(),
+		opId:     opId,
+		location: location,
+		cancel:   cancel,
+	}
+
+	a.lock.Lock()
+	_, idPresent := a.handlers[handler.id]
+	godbc.Require(!idPresent)
+	a.handlers[handler.id] = handler
+	persist := a.persistLater(handler)
+	a.lock.Unlock()
+	persist()
+
+	handler.handle(handlerfunc)
+	http.Redirect(w, r, handler.Url(), http.StatusAccepted)
+}
+
+// AsyncHttpRedirectQueued works like AsyncHttpRedirectOperation for
+// operations that may have to wait in a queue before they start.
+// While the operation waits position returns its place in the queue,
+// starting at 1, and is reported to clients polling its status.
+// handlerfunc must call started once the operation leaves the queue.
+func (a *AsyncHttpManager) AsyncHttpRedirectQueued(w http.ResponseWriter,
+	r *http.Request,
+	opId, location string,
+	position func() int,
+	cancel func() error,
+	handlerfunc func(started func()) (string, error)) {
+
+	handler := &AsyncHttpHandler{
+		manager:  a,
+		id:       a.NewId(),
+		opId:     opId,
+		location: location,
+		position: position,
+		cancel:   cancel,
+	}
+
+	a.lock.Lock()
+	_, idPresent := a.handlers[handler.id]
+	godbc.Require(!idPresent)
+	a.handlers[handler.id] = handler
+	persist := a.persistLater(handler)
+	a.lock.Unlock()
+	persist()
+
+	handler.handle(func() (string, error) {
+		return handlerfunc(handler.started)
+	})
+	http.Redirect(w, r, handler.Url(), http.StatusAccepted)
+}
+
+// OperationUrl returns the url of the status of the asynchronous
+// handler started for pending operation opId, if it is still known.
+func (a *AsyncHttpManager) OperationUrl(opId string) (string, bool) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	for id, h := range a.handlers {
+		if h.opId != "" && h.opId == opId {
+			return a.route + "/" + id, true
+		}
+	}
+	return "", false
+}
+
 // Handler for asynchronous operation status
 // Register this handler with a router like Gorilla Mux
 //
 // Returns the following HTTP status codes
-// 		200 Operation is still pending
+// 		200 Operation is still pending. The X-Operation-Progress header
+//			is set to the JSON encoded progress of the operation, if known.
 //		404 Id requested does not exist
 //		500 Operation finished and has failed.  Body will be filled in with the
 //			error in plain text.
@@ -187,12 +373,12 @@ func (a *AsyncHttpManager) HandlerStatus(w http.ResponseWriter, r *http.Request)
 	id := vars["id"]
 
 	a.lock.Lock()
-	defer a.lock.Unlock()
 
 	// Check the id is in the map
 	if handler, ok := a.handlers[id]; ok {
+		completed := handler.completed
 
-		if handler.completed {
+		if completed {
 			if handler.err != nil {
 
 				// Return 500 status
@@ -215,14 +401,138 @@ func (a *AsyncHttpManager) HandlerStatus(w http.ResponseWriter, r *http.Request)
 			// Still pending
 			// Could add a JSON body here later
 			w.Header().Add("X-Pending", "true")
+			if handler.position != nil {
+				if pos := handler.position(); pos > 0 {
+					w.Header().Add(QueuePositionHeader, strconv.Itoa(pos))
+				}
+			}
+			if handler.opId != "" && a.progress != nil {
+				a.addProgressHeader(w, id, a.progress(handler.opId))
+			}
 			w.WriteHeader(http.StatusOK)
 		}
+		a.lock.Unlock()
 
+		if completed {
+			a.forget(id)
+		}
+		return
+	}
+	a.lock.Unlock()
+
+	if e := a.load(id); e != nil {
+		// started before the server was restarted
+		switch e.Status {
+		case AsyncFailed:
+			http.Error(w, e.Error, http.StatusInternalServerError)
+		case AsyncCompleted:
+			if e.Location != "" {
+				http.Redirect(w, r, e.Location, http.StatusSeeOther)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			w.Header().Add("X-Pending", "true")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		a.forget(id)
 	} else {
 		http.Error(w, "Id not found", http.StatusNotFound)
 	}
 }
 
+// Handler to cancel an asynchronous operation
+// Register this handler with a router like Gorilla Mux using the
+// DELETE method on the same route as HandlerStatus.
+//
+// Returns the following HTTP status codes
+//		202 Operation was asked to stop. Location is set to the status
+//			of the operation which fails once it has stopped.
+//		404 Id requested does not exist
+//		409 Operation has already finished or can not be cancelled
+func (a *AsyncHttpManager) HandlerCancel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	a.lock.RLock()
+	handler, ok := a.handlers[id]
+	var (
+		completed bool
+		cancel    func() error
+	)
+	if ok {
+		completed = handler.completed
+		cancel = handler.cancel
+	}
+	a.lock.RUnlock()
+
+	switch {
+	case !ok && a.load(id) == nil:
+		http.Error(w, "Id not found", http.StatusNotFound)
+	case !ok || completed:
+		http.Error(w, "Operation already completed", http.StatusConflict)
+	case cancel == nil:
+		http.Error(w, "Operation can not be cancelled", http.StatusConflict)
+	default:
+		if err := cancel(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logger.Info("Requested cancellation of job %v", id)
+		http.Redirect(w, r, handler.Url(), http.StatusAccepted)
+	}
+}
+
+// addProgressHeader reports progress, if any, JSON encoded in a
+// header. A body would make clients take the operation as done.
+func (a *AsyncHttpManager) addProgressHeader(w http.ResponseWriter,
+	id string, progress interface{}) {
+
+	if progress == nil {
+		return
+	}
+	b, err := json.Marshal(progress)
+	if err != nil {
+		logger.LogError("Unable to report progress of job %v: %v", id, err)
+		return
+	}
+	w.Header().Add(ProgressHeader, string(b))
+}
+
+// getStore returns the store of the manager. The store is read
+// under the lock but used without it.
+func (a *AsyncHttpManager) getStore() AsyncStore {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.store
+}
+
+// load and forget access the store and must be called without the
+// lock held.
+func (a *AsyncHttpManager) load(id string) *AsyncEntry {
+	store := a.getStore()
+	if store == nil {
+		return nil
+	}
+	e, err := store.Load(id)
+	if err != nil {
+		logger.LogError("Unable to load job %v: %v", id, err)
+		return nil
+	}
+	return e
+}
+
+func (a *AsyncHttpManager) forget(id string) {
+	store := a.getStore()
+	if store == nil {
+		return
+	}
+	if err := store.Delete(id); err != nil {
+		logger.LogError("Unable to delete job %v: %v", id, err)
+	}
+}
+
 // Returns the url for the specified asynchronous handler
 func (h *AsyncHttpHandler) Url() string {
 	h.manager.lock.RLock()
@@ -233,14 +543,9 @@ func (h *AsyncHttpHandler) Url() string {
 
 // Registers that the handler has completed with an error
 func (h *AsyncHttpHandler) CompletedWithError(err error) {
-
-	h.manager.lock.RLock()
-	defer h.manager.lock.RUnlock()
-
-	godbc.Require(h.completed == false)
-
-	h.err = err
-	h.completed = true
+	h.complete(func(c *AsyncHttpHandler) {
+		c.err = err
+	})
 
 	godbc.Ensure(h.completed == true)
 }
@@ -248,14 +553,9 @@ func (h *AsyncHttpHandler) CompletedWithError(err error) {
 // Registers that the handler has completed and has provided a location
 // where information can be retreived
 func (h *AsyncHttpHandler) CompletedWithLocation(location string) {
-
-	h.manager.lock.RLock()
-	defer h.manager.lock.RUnlock()
-
-	godbc.Require(h.completed == false)
-
-	h.location = location
-	h.completed = true
+	h.complete(func(c *AsyncHttpHandler) {
+		c.location = location
+	})
 
 	godbc.Ensure(h.completed == true)
 	godbc.Ensure(h.location == location)
@@ -264,17 +564,47 @@ func (h *AsyncHttpHandler) CompletedWithLocation(location string) {
 
 // Registers that the handler has completed and no data needs to be returned
 func (h *AsyncHttpHandler) Completed() {
+	h.complete(func(c *AsyncHttpHandler) {
+		// drop any location planned when the operation was started
+		c.location = ""
+	})
 
-	h.manager.lock.RLock()
-	defer h.manager.lock.RUnlock()
+	godbc.Ensure(h.completed == true)
+	godbc.Ensure(h.location == "")
+	godbc.Ensure(h.err == nil)
+}
 
+// complete applies update to the handler and marks it completed. The
+// outcome is persisted, without the lock held, before status polls
+// can see it: a poll that forgets the completed handler is then never
+// followed by a stale write of its state.
+func (h *AsyncHttpHandler) complete(update func(*AsyncHttpHandler)) {
+	m := h.manager
+
+	m.lock.RLock()
 	godbc.Require(h.completed == false)
+	done := *h
+	update(&done)
+	done.completed = true
+	persist := m.persistLater(&done)
+	m.lock.RUnlock()
+
+	persist()
 
+	m.lock.Lock()
+	update(h)
 	h.completed = true
+	m.lock.Unlock()
+}
 
-	godbc.Ensure(h.completed == true)
-	godbc.Ensure(h.location == "")
-	godbc.Ensure(h.err == nil)
+// started records that a queued operation has left the queue.
+func (h *AsyncHttpHandler) started() {
+	h.manager.lock.Lock()
+	h.position = nil
+	persist := h.manager.persistLater(h)
+	h.manager.lock.Unlock()
+
+	persist()
 }
 
 // handle starts running the given function in the background (goroutine).
@@ -537,3 +537,341 @@ func TestAsyncHttpRedirectFuncCustomIds(t *testing.T) {
 	}
 
 }
+
+type testAsyncStore struct {
+	lock    sync.Mutex
+	entries map[string]AsyncEntry
+}
+
+func newTestAsyncStore() *testAsyncStore {
+	return &testAsyncStore{entries: map[string]AsyncEntry{}}
+}
+
+func (s *testAsyncStore) Save(e *AsyncEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries[e.Id] = *e
+	return nil
+}
+
+func (s *testAsyncStore) Load(id string) (*AsyncEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.entries[id]; ok {
+		return &e, nil
+	}
+	return nil, nil
+}
+
+func (s *testAsyncStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+func TestAsyncStorePersists(t *testing.T) {
+	store := newTestAsyncStore()
+	manager := NewAsyncHttpManager("/x")
+	manager.SetStore(store)
+
+	handler := manager.NewHandler()
+	e, err := store.Load(handler.id)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, e != nil, "expected e != nil")
+	tests.Assert(t, e.Status == AsyncPending,
+		"expected e.Status == AsyncPending, got:", e.Status)
+
+	handler.CompletedWithLocation("/a")
+	e, _ = store.Load(handler.id)
+	tests.Assert(t, e.Status == AsyncCompleted,
+		"expected e.Status == AsyncCompleted, got:", e.Status)
+	tests.Assert(t, e.Location == "/a", "expected e.Location == /a, got:", e.Location)
+
+	handler = manager.NewHandler()
+	handler.CompletedWithError(errors.New("boom"))
+	e, _ = store.Load(handler.id)
+	tests.Assert(t, e.Status == AsyncFailed,
+		"expected e.Status == AsyncFailed, got:", e.Status)
+	tests.Assert(t, e.Error == "boom", "expected e.Error == boom, got:", e.Error)
+}
+
+func TestAsyncHttpRedirectOperation(t *testing.T) {
+	store := newTestAsyncStore()
+	manager := NewAsyncHttpManager("/x")
+	manager.SetStore(store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/x/{id}", manager.HandlerStatus).Methods("GET")
+	router.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		manager.AsyncHttpRedirectOperation(w, r, "op1", "/result", nil,
+			func() (string, error) {
+				return "/result", nil
+			})
+	}).Methods("GET")
+	router.HandleFunc("/result", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	r, err := client.Get(ts.URL + "/app")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	location := r.Header.Get("Location")
+	id := strings.TrimPrefix(location, "/x/")
+
+	for {
+		e, _ := store.Load(id)
+		tests.Assert(t, e != nil, "expected e != nil")
+		tests.Assert(t, e.OpId == "op1", "expected e.OpId == op1, got:", e.OpId)
+		if e.Status != AsyncPending {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	r, err = client.Get(ts.URL + location)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther,
+		"expected r.StatusCode == http.StatusSeeOther, got:", r.StatusCode)
+	e, _ := store.Load(id)
+	tests.Assert(t, e == nil, "expected entry to be removed once read")
+}
+
+func TestHandlerStatusFromStore(t *testing.T) {
+	store := newTestAsyncStore()
+	manager := NewAsyncHttpManager("/x")
+	manager.SetStore(store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/x/{id}", manager.HandlerStatus).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// entries left by a previous run of the server
+	store.Save(&AsyncEntry{Id: "p", Status: AsyncPending})
+	store.Save(&AsyncEntry{Id: "c", Status: AsyncCompleted, Location: "/vol"})
+	store.Save(&AsyncEntry{Id: "d", Status: AsyncCompleted})
+	store.Save(&AsyncEntry{Id: "f", Status: AsyncFailed, Error: "oops"})
+
+	r, err := client.Get(ts.URL + "/x/p")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK,
+		"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("X-Pending") == "true")
+
+	r, err = client.Get(ts.URL + "/x/c")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusSeeOther,
+		"expected r.StatusCode == http.StatusSeeOther, got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == "/vol")
+
+	r, err = client.Get(ts.URL + "/x/d")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent,
+		"expected r.StatusCode == http.StatusNoContent, got:", r.StatusCode)
+
+	r, err = client.Get(ts.URL + "/x/f")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError,
+		"expected r.StatusCode == http.StatusInternalServerError, got:", r.StatusCode)
+	body, _ := ioutil.ReadAll(r.Body)
+	tests.Assert(t, strings.Contains(string(body), "oops"))
+
+	// completed entries are removed once read, pending ones are kept
+	for _, id := range []string{"c", "d", "f"} {
+		r, err = client.Get(ts.URL + "/x/" + id)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusNotFound,
+			"expected r.StatusCode == http.StatusNotFound, got:", r.StatusCode)
+	}
+	e, _ := store.Load("p")
+	tests.Assert(t, e != nil, "expected e != nil")
+}
+
+func TestHandlerCancel(t *testing.T) {
+	manager := NewAsyncHttpManager("/x")
+
+	stop := make(chan bool, 1)
+	router := mux.NewRouter()
+	router.HandleFunc("/x/{id}", manager.HandlerStatus).Methods("GET")
+	router.HandleFunc("/x/{id}", manager.HandlerCancel).Methods("DELETE")
+	router.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		manager.AsyncHttpRedirectOperation(w, r, "op1", "",
+			func() error {
+				stop <- true
+				return nil
+			},
+			func() (string, error) {
+				<-stop
+				return "", errors.New("cancelled")
+			})
+	}).Methods("GET")
+	router.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		manager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+			return "", nil
+		})
+	}).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	del := func(url string) *http.Response {
+		req, err := http.NewRequest("DELETE", url, nil)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err := client.Do(req)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		return r
+	}
+
+	r := del(ts.URL + "/x/12345")
+	tests.Assert(t, r.StatusCode == http.StatusNotFound,
+		"expected r.StatusCode == http.StatusNotFound, got:", r.StatusCode)
+
+	r, err := client.Get(ts.URL + "/app")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	location := r.Header.Get("Location")
+	r = del(ts.URL + location)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted,
+		"expected r.StatusCode == http.StatusAccepted, got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("Location") == location,
+		"expected", location, "got:", r.Header.Get("Location"))
+
+	for {
+		r, err = client.Get(ts.URL + location)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		if r.Header.Get("X-Pending") != "true" {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	tests.Assert(t, r.StatusCode == http.StatusInternalServerError,
+		"expected r.StatusCode == http.StatusInternalServerError, got:", r.StatusCode)
+
+	// functions without a cancel hook can not be cancelled
+	r, err = client.Get(ts.URL + "/plain")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	location = r.Header.Get("Location")
+	r = del(ts.URL + location)
+	tests.Assert(t, r.StatusCode == http.StatusConflict,
+		"expected r.StatusCode == http.StatusConflict, got:", r.StatusCode)
+}
+
+func TestHandlerStatusProgress(t *testing.T) {
+	manager := NewAsyncHttpManager("/x")
+	manager.SetProgress(func(opId string) interface{} {
+		if opId != "op1" {
+			return nil
+		}
+		return map[string]int{"done": 3}
+	})
+
+	release := make(chan bool)
+	defer close(release)
+	router := mux.NewRouter()
+	router.HandleFunc("/x/{id}", manager.HandlerStatus).Methods("GET")
+	router.HandleFunc("/app/{op}", func(w http.ResponseWriter, r *http.Request) {
+		manager.AsyncHttpRedirectOperation(w, r, mux.Vars(r)["op"], "", nil,
+			func() (string, error) {
+				<-release
+				return "", nil
+			})
+	}).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	status := func(op string) string {
+		r, err := client.Get(ts.URL + "/app/" + op)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		r, err = client.Get(ts.URL + r.Header.Get("Location"))
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, r.StatusCode == http.StatusOK,
+			"expected r.StatusCode == http.StatusOK, got:", r.StatusCode)
+		tests.Assert(t, r.ContentLength <= 0,
+			"expected no body, got:", r.ContentLength)
+		return r.Header.Get(ProgressHeader)
+	}
+
+	tests.Assert(t, status("op1") == `{"done":3}`,
+		"expected progress header, got:", status("op1"))
+	tests.Assert(t, status("op2") == "",
+		"expected no progress header, got:", status("op2"))
+}
+
+// slowAsyncStore blocks saves until released.
+type slowAsyncStore struct {
+	*testAsyncStore
+	saving  chan string
+	release chan struct{}
+}
+
+func (s *slowAsyncStore) Save(e *AsyncEntry) error {
+	s.saving <- e.Id
+	<-s.release
+	return s.testAsyncStore.Save(e)
+}
+
+func TestHandlerStatusNotBlockedByStore(t *testing.T) {
+	manager := NewAsyncHttpManager("/x")
+	handler := manager.NewHandler()
+
+	store := &slowAsyncStore{
+		testAsyncStore: newTestAsyncStore(),
+		saving:         make(chan string, 1),
+		release:        make(chan struct{}),
+	}
+	manager.SetStore(store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/x/{id}", manager.HandlerStatus).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	done := make(chan struct{})
+	go func() {
+		handler.Completed()
+		close(done)
+	}()
+	id := <-store.saving
+	tests.Assert(t, id == handler.id, "got:", id)
+
+	// the handler is polled while its state is being written
+	r, err := http.Get(ts.URL + handler.Url())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusOK, "got:", r.StatusCode)
+	tests.Assert(t, r.Header.Get("X-Pending") == "true")
+
+	close(store.release)
+	<-done
+	e, _ := store.Load(handler.id)
+	tests.Assert(t, e != nil && e.Status == AsyncCompleted, "got:", e)
+
+	// the completed handler is forgotten once polled
+	r, err = http.Get(ts.URL + handler.Url())
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, r.StatusCode == http.StatusNoContent, "got:", r.StatusCode)
+	e, _ = store.Load(handler.id)
+	tests.Assert(t, e == nil, "got:", e)
+}
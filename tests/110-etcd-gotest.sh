@@ -0,0 +1,6 @@
+#!/bin/bash
+
+# the etcd db store tests run an embedded etcd server, whose
+# dependencies are kept in a module of their own
+cd tests/etcd || exit 1
+exec go test ./...
@@ -0,0 +1,13 @@
+module github.com/heketi/heketi/v10/tests/etcd
+
+go 1.14
+
+require (
+	github.com/boltdb/bolt v1.3.1
+	github.com/heketi/heketi/v10 v10.0.0
+	github.com/heketi/tests v0.0.0-20151005000721-f3775cbcefd6
+	go.etcd.io/etcd/client/v3 v3.5.5
+	go.etcd.io/etcd/server/v3 v3.5.5
+)
+
+replace github.com/heketi/heketi/v10 => ../..
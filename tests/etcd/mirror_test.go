@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/heketi/heketi/v10/pkg/db/store"
+)
+
+func newTestBoltDB(t *testing.T) (*bolt.DB, func()) {
+	dbfile := tests.Tempfile()
+	db, err := bolt.Open(dbfile, 0600, nil)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return db, func() {
+		db.Close()
+		os.Remove(dbfile)
+	}
+}
+
+// boltPut changes a key, recording it as the entries of the app are
+// saved if record is set.
+func boltPut(t *testing.T, db *bolt.DB, record bool, bucket, key, value string) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			err = b.Delete([]byte(key))
+		} else {
+			err = b.Put([]byte(key), []byte(value))
+		}
+		if err != nil || !record {
+			return err
+		}
+		return store.Record(tx, bucket, key)
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+}
+
+func TestMirror(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+
+	boltPut(t, db, false, "VOLUME", "v1", "a")
+	boltPut(t, db, false, "NODE", "n1", "b")
+	m := store.NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+	n, err := store.Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+
+	// nothing to do without a new bolt transaction
+	_, rev := e.get(t, "/heketi/VOLUME/v1")
+	tests.Assert(t, m.Sync() == nil)
+	_, after := e.get(t, "/heketi/VOLUME/v1")
+	tests.Assert(t, after == rev, "expected no etcd txn, got:", after-rev)
+
+	// recorded changes are in etcd once the commit returns, in one
+	// etcd transaction
+	m.Start(time.Hour)
+	defer m.Stop()
+	resp, _ := e.get(t, "/heketi/NODE/n1")
+	n1 := resp.Kvs[0].ModRevision
+	boltPut(t, db, true, "VOLUME", "v2", "c")
+	boltPut(t, db, true, "VOLUME", "v1", "")
+	v := e.value(t, "/heketi/VOLUME/v2")
+	tests.Assert(t, string(v) == "c", "got:", string(v))
+	resp, after = e.get(t, "/heketi/VOLUME/v1")
+	tests.Assert(t, len(resp.Kvs) == 0, "expected v1 removed, got:", resp.Kvs)
+	tests.Assert(t, after == rev+2, "expected 2 etcd txns, got:", after-rev)
+	resp, _ = e.get(t, "/heketi/NODE/n1")
+	tests.Assert(t, resp.Kvs[0].ModRevision == n1, "expected n1 not rewritten")
+	unsynced, err := store.Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+
+	// changes not recorded are written by the next sync
+	boltPut(t, db, false, "CLUSTER", "c1", "d")
+	unsynced, err = store.Unsynced(db, s)
+	tests.Assert(t, err == nil && unsynced, "got:", unsynced, err)
+	tests.Assert(t, m.Sync() == nil)
+	v = e.value(t, "/heketi/CLUSTER/c1")
+	tests.Assert(t, string(v) == "d", "got:", string(v))
+	unsynced, err = store.Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+}
+
+func TestMirrorBatches(t *testing.T) {
+	e := newTestEtcd(t, func(cfg *embed.Config) {
+		cfg.MaxTxnOps = 4
+	})
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{MaxTxnOps: 4})
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+
+	for i := 0; i < 9; i++ {
+		boltPut(t, db, false, "VOLUME", fmt.Sprintf("v%v", i), "a")
+	}
+	m := store.NewMirror(db, s)
+	_, rev := e.get(t, "/heketi/VOLUME/v0")
+	tests.Assert(t, m.Sync() == nil)
+	_, after := e.get(t, "/heketi/VOLUME/v0")
+	tests.Assert(t, after == rev+3, "expected 3 etcd txns, got:", after-rev)
+	n, err := store.Diff(db, s)
+	tests.Assert(t, err == nil && n == 0, "expected no diff, got:", n, err)
+
+	var state struct {
+		Complete bool `json:"complete"`
+	}
+	err = json.Unmarshal(e.value(t, "/heketi/"+store.SyncBucket+"/state"), &state)
+	tests.Assert(t, err == nil && state.Complete, "got:", state, err)
+}
+
+func TestMirrorOtherWriter(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+	db, cleanup := newTestBoltDB(t)
+	defer cleanup()
+
+	boltPut(t, db, false, "VOLUME", "v1", "a")
+	m := store.NewMirror(db, s)
+	tests.Assert(t, m.Sync() == nil)
+
+	// another heketi syncs its own db to the same etcd keys
+	other, cleanupOther := newTestBoltDB(t)
+	defer cleanupOther()
+	tests.Assert(t, store.Load(other, s) == nil)
+	boltPut(t, other, false, "VOLUME", "v2", "b")
+	tests.Assert(t, store.NewMirror(other, s).Sync() == nil)
+
+	// the first mirror no longer writes over it
+	boltPut(t, db, false, "VOLUME", "v1", "changed")
+	err := m.Sync()
+	tests.Assert(t, err == store.ErrStoreChanged, "expected ErrStoreChanged, got:", err)
+	v := e.value(t, "/heketi/VOLUME/v1")
+	tests.Assert(t, string(v) == "a", "got:", string(v))
+	unsynced, err := store.Unsynced(db, s)
+	tests.Assert(t, err == nil && !unsynced, "got:", unsynced, err)
+}
@@ -0,0 +1,357 @@
+//
+// Copyright (c) 2021 The heketi Authors
+//
+// This file is licensed to you under your choice of the GNU Lesser
+// General Public License, version 3 or any later version (LGPLv3 or
+// later), or the GNU General Public License, version 2 (GPLv2), in all
+// cases as published by the Free Software Foundation.
+//
+
+// Package etcd tests the etcd db store against an embedded etcd server.
+// It is a module of its own so that the etcd server and its
+// dependencies are not dependencies of heketi.
+package etcd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/heketi/heketi/v10/pkg/db/store"
+)
+
+// more keys than a range request of the store returns
+const rangePageKeys = 1010
+
+func freeLocalUrl(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// testEtcd is a single member etcd server.
+type testEtcd struct {
+	endpoint string
+	client   *clientv3.Client
+	stop     func()
+}
+
+func newTestEtcd(t *testing.T, configure func(cfg *embed.Config)) *testEtcd {
+	dir, err := ioutil.TempDir("", "heketi-etcd")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	client := freeLocalUrl(t)
+	peer := freeLocalUrl(t)
+	cfg.LCUrls = []url.URL{client}
+	cfg.ACUrls = []url.URL{client}
+	cfg.LPUrls = []url.URL{peer}
+	cfg.APUrls = []url.URL{peer}
+	cfg.InitialCluster = cfg.Name + "=" + peer.String()
+	if configure != nil {
+		configure(cfg)
+	}
+	e, err := embed.StartEtcd(cfg)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	stop := func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		stop()
+		t.Fatal("etcd server not ready")
+	}
+
+	endpoint := "http://" + e.Clients[0].Addr().String()
+	c, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: 5 * time.Second,
+		Username:    "root",
+		Password:    "root",
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return &testEtcd{
+		endpoint: endpoint,
+		client:   c,
+		stop: func() {
+			c.Close()
+			stop()
+		},
+	}
+}
+
+// get returns the etcd key, or nil, and the revision of the cluster.
+func (e *testEtcd) get(t *testing.T, key string) (*clientv3.GetResponse, int64) {
+	resp, err := e.client.Get(context.Background(), key)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return resp, resp.Header.Revision
+}
+
+func (e *testEtcd) value(t *testing.T, key string) []byte {
+	resp, _ := e.get(t, key)
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	return resp.Kvs[0].Value
+}
+
+func (e *testEtcd) store(t *testing.T, conf store.EtcdConfig) *store.EtcdStore {
+	conf.Endpoints = append(conf.Endpoints, e.endpoint)
+	s, err := store.NewEtcdStore(conf)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	return s
+}
+
+func TestEtcdStore(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+	defer s.Close()
+
+	err := s.Update(func(tx store.Tx) error {
+		for _, k := range []string{"v2", "v1", "v3"} {
+			if err := tx.Put("VOLUME", k, []byte("data-"+k)); err != nil {
+				return err
+			}
+		}
+		return tx.Put("NODE", "n1", []byte{})
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	err = s.Update(func(tx store.Tx) error {
+		return tx.Delete("VOLUME", "v2")
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.View(func(tx store.Tx) error {
+		v, err := tx.Get("NODE", "n1")
+		tests.Assert(t, err == nil && v != nil && len(v) == 0,
+			"expected empty value, got:", v, err)
+		keys := []string{}
+		err = tx.ForEach("VOLUME", func(k string, v []byte) error {
+			tests.Assert(t, string(v) == "data-"+k, "got:", k, v)
+			keys = append(keys, k)
+			return nil
+		})
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(keys) == 2 && keys[0] == "v1" && keys[1] == "v3",
+			"expected v1 v3, got:", keys)
+		buckets, err := tx.Buckets()
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+		tests.Assert(t, len(buckets) == 2 && buckets[0] == "NODE" && buckets[1] == "VOLUME",
+			"got:", buckets)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// keys are readable with standard tooling
+	v := e.value(t, "/heketi/VOLUME/v1")
+	tests.Assert(t, string(v) == "data-v1", "got:", string(v))
+}
+
+func TestEtcdStoreReadOwnWrites(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+
+	err := s.Update(func(tx store.Tx) error {
+		tests.Assert(t, tx.Put("B", "a", []byte("1")) == nil)
+		tests.Assert(t, tx.Put("B", "b", []byte("2")) == nil)
+		tests.Assert(t, tx.Delete("B", "a") == nil)
+		v, err := tx.Get("B", "b")
+		tests.Assert(t, err == nil && string(v) == "2", "got:", v, err)
+		v, err = tx.Get("B", "a")
+		tests.Assert(t, err == nil && v == nil, "got:", v, err)
+		keys := []string{}
+		tx.ForEach("B", func(k string, v []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		tests.Assert(t, len(keys) == 1 && keys[0] == "b", "got:", keys)
+		return nil
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	err = s.View(func(tx store.Tx) error {
+		return tx.Put("B", "c", []byte("3"))
+	})
+	tests.Assert(t, err != nil, "expected put in view to fail")
+}
+
+func TestEtcdStoreConflict(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+	otherPut := func(key, value string) {
+		_, err := e.client.Put(context.Background(), "/heketi/B/"+key, value)
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	otherPut("counter", "0")
+
+	// another writer changes the key between the read and the
+	// commit of the first attempt
+	attempts := 0
+	err := s.Update(func(tx store.Tx) error {
+		attempts++
+		v, err := tx.Get("B", "counter")
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			otherPut("counter", "5")
+		}
+		return tx.Put("B", "counter", append(v, '1'))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, attempts == 2, "expected 2 attempts, got:", attempts)
+	v := e.value(t, "/heketi/B/counter")
+	tests.Assert(t, string(v) == "51", "got:", string(v))
+
+	// a key read as missing is checked too
+	attempts = 0
+	err = s.Update(func(tx store.Tx) error {
+		attempts++
+		v, err := tx.Get("B", "new")
+		if err != nil || v != nil {
+			return err
+		}
+		if attempts == 1 {
+			otherPut("new", "other")
+		}
+		return tx.Put("B", "new", []byte("mine"))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, attempts == 2, "expected 2 attempts, got:", attempts)
+	v = e.value(t, "/heketi/B/new")
+	tests.Assert(t, string(v) == "other", "got:", string(v))
+
+	// conflicts on every attempt
+	err = s.Update(func(tx store.Tx) error {
+		v, err := tx.Get("B", "counter")
+		if err != nil {
+			return err
+		}
+		otherPut("counter", "x")
+		return tx.Put("B", "counter", append(v, '1'))
+	})
+	tests.Assert(t, err == store.ErrConflict, "expected ErrConflict, got:", err)
+}
+
+func TestEtcdStoreTooLarge(t *testing.T) {
+	e := newTestEtcd(t, func(cfg *embed.Config) {
+		cfg.MaxTxnOps = 4
+	})
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{MaxTxnOps: 4})
+	tests.Assert(t, s.MaxTxnChanges() == 4, "got:", s.MaxTxnChanges())
+
+	put := func(keys ...string) error {
+		return s.Update(func(tx store.Tx) error {
+			for _, k := range keys {
+				if err := tx.Put("B", k, []byte(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	tests.Assert(t, put("a", "b", "c", "d") == nil)
+
+	// nothing of a larger update is written
+	_, rev := e.get(t, "/heketi/B/a")
+	err := put("e", "f", "g", "h", "i")
+	tests.Assert(t, err == store.ErrTooLarge, "expected ErrTooLarge, got:", err)
+	resp, after := e.get(t, "/heketi/B/e")
+	tests.Assert(t, len(resp.Kvs) == 0, "expected no key e, got:", resp.Kvs)
+	tests.Assert(t, after == rev, "expected revision", rev, "got:", after)
+}
+
+func TestEtcdStoreRangePaging(t *testing.T) {
+	e := newTestEtcd(t, nil)
+	defer e.stop()
+	s := e.store(t, store.EtcdConfig{})
+	for i := 0; i < rangePageKeys; i++ {
+		_, err := e.client.Put(context.Background(),
+			"/heketi/B/"+strconv.Itoa(100000+i), "v")
+		tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	}
+	count := 0
+	err := s.View(func(tx store.Tx) error {
+		return tx.ForEach("B", func(k string, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	tests.Assert(t, count == rangePageKeys, "got:", count)
+}
+
+func TestEtcdStoreAuthAndFailover(t *testing.T) {
+	e := newTestEtcd(t, func(cfg *embed.Config) {
+		cfg.AuthTokenTTL = 1
+	})
+	defer e.stop()
+
+	// enable authentication, with a root user and a heketi user
+	ctx := context.Background()
+	_, err := e.client.RoleAdd(ctx, "root")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e.client.UserAdd(ctx, "root", "root")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e.client.UserGrantRole(ctx, "root", "root")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e.client.UserAdd(ctx, "heketi", "secret")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e.client.UserGrantRole(ctx, "heketi", "root")
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+	_, err = e.client.AuthEnable(ctx)
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	down := freeLocalUrl(t)
+	s := e.store(t, store.EtcdConfig{
+		Endpoints: []string{down.String()},
+		Username:  "heketi",
+		Password:  "secret",
+	})
+	err = s.Update(func(tx store.Tx) error {
+		return tx.Put("B", "k", []byte("v"))
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// an expired token is renewed
+	time.Sleep(3 * time.Second)
+	err = s.View(func(tx store.Tx) error {
+		v, err := tx.Get("B", "k")
+		tests.Assert(t, string(v) == "v", "got:", v)
+		return err
+	})
+	tests.Assert(t, err == nil, "expected err == nil, got:", err)
+
+	// requests without a token are refused
+	s = e.store(t, store.EtcdConfig{})
+	err = s.View(func(tx store.Tx) error {
+		_, err := tx.Get("B", "k")
+		return err
+	})
+	tests.Assert(t, err != nil, "expected auth error")
+
+	s = e.store(t, store.EtcdConfig{Username: "heketi", Password: "wrong"})
+	err = s.View(func(tx store.Tx) error {
+		_, err := tx.Get("B", "k")
+		return err
+	})
+	tests.Assert(t, err != nil, "expected auth error")
+}